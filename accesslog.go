@@ -0,0 +1,210 @@
+package log4go
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An AccessLogRecord is an HTTP request served, to be logged with
+// Logger.Access and written in the Common or Combined Log Format of Apache and
+// nginx by an AccessLogFormatter, or as a message by any other.
+type AccessLogRecord struct {
+	Time       time.Time // the request was received
+	RemoteAddr string    // the client's address, without the port
+	User       string    // authenticated, if any
+	Method     string
+	Path       string // as requested, with the query
+	Proto      string
+	Status     int
+	Bytes      int64 // of the response's body
+	Latency    time.Duration
+	Referer    string
+	UserAgent  string
+}
+
+// NewAccessLogRecord creates a new AccessLogRecord of req, received at start,
+// answered with status and bytes of body.
+func NewAccessLogRecord(req *http.Request, start time.Time, status int, bytes int64) *AccessLogRecord {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	user, _, _ := req.BasicAuth()
+	path := req.RequestURI
+	if path == "" {
+		path = req.URL.RequestURI()
+	}
+	return &AccessLogRecord{
+		Time:       start,
+		RemoteAddr: remote,
+		User:       user,
+		Method:     req.Method,
+		Path:       path,
+		Proto:      req.Proto,
+		Status:     status,
+		Bytes:      bytes,
+		Latency:    time.Since(start),
+		Referer:    req.Referer(),
+		UserAgent:  req.UserAgent(),
+	}
+}
+
+// Access logs a request served, at ERROR if the status is 500 or over, at
+// WARNING if 400 or over, and otherwise at INFO, with its method, path,
+// status, size and latency as the message.
+func (log Logger) Access(a *AccessLogRecord) {
+	lvl := INFO
+	switch {
+	case a.Status >= 500:
+		lvl = ERROR
+	case a.Status >= 400:
+		lvl = WARNING
+	}
+	skip := true
+	for _, filt := range log {
+		if lvl >= filt.Level {
+			skip = false
+			break
+		}
+	}
+	if skip {
+		return
+	}
+
+	src := ""
+	if pc, _, lineno, ok := runtime.Caller(1); ok {
+		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
+	}
+	rec := &LogRecord{
+		Level:   lvl,
+		Created: time.Now(),
+		Source:  src,
+		Message: fmt.Sprintf("%s %s %s %d %d %s", a.Method, a.Path, a.Proto, a.Status, a.Bytes, a.Latency),
+		Access:  a,
+
+		Goroutine: goroutineID(),
+	}
+	if rec = log.prepareRecord(rec); rec == nil {
+		return
+	}
+	for _, filt := range log {
+		if rec.Level < filt.Level {
+			continue
+		}
+		filt.LogWrite(rec)
+	}
+}
+
+// AccessLogHandler returns a handler serving requests with handler and logging
+// each to log once served.
+//
+//	http.ListenAndServe(":8080", AccessLogHandler(access, mux))
+func AccessLogHandler(log Logger, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		aw := &accessResponseWriter{ResponseWriter: rw}
+		handler.ServeHTTP(aw, req)
+		if aw.status == 0 {
+			aw.status = http.StatusOK
+		}
+		log.Access(NewAccessLogRecord(req, start, aw.status, aw.bytes))
+	})
+}
+
+// A ResponseWriter noting the status and size of the response
+type accessResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// An AccessLogFormatter writes the requests logged with Logger.Access in the
+// Common Log Format,
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+//
+// or the Combined, with the referer and user agent after.  Other records are
+// written with FORMAT_DEFAULT.  FORMAT_COMMON and FORMAT_COMBINED are
+// formatted by AccessLogFormatters.
+type AccessLogFormatter struct {
+	Combined bool // rather than Common
+	Latency  bool // in microseconds after it all, as Apache's %D
+}
+
+// Format appends rec to *buf as a line of the access log.
+func (f *AccessLogFormatter) Format(rec *LogRecord, buf *[]byte) {
+	a := rec.Access
+	if a == nil {
+		*buf = append(*buf, FormatLogRecord(FORMAT_DEFAULT, rec)...)
+		return
+	}
+	when := a.Time
+	if when.IsZero() {
+		when = rec.Created
+	}
+
+	b := append(*buf, accessField(a.RemoteAddr)...)
+	b = append(b, " - "...)
+	b = append(b, accessField(a.User)...)
+	b = append(b, " ["...)
+	b = append(b, when.Format("02/Jan/2006:15:04:05 -0700")...)
+	b = append(b, `] "`...)
+	b = append(b, accessQuote.Replace(a.Method+" "+a.Path+" "+a.Proto)...)
+	b = append(b, `" `...)
+	b = strconv.AppendInt(b, int64(a.Status), 10)
+	b = append(b, ' ')
+	if a.Bytes > 0 {
+		b = strconv.AppendInt(b, a.Bytes, 10)
+	} else {
+		b = append(b, '-')
+	}
+	if f.Combined {
+		b = append(b, ` "`...)
+		b = append(b, accessQuote.Replace(accessField(a.Referer))...)
+		b = append(b, `" "`...)
+		b = append(b, accessQuote.Replace(accessField(a.UserAgent))...)
+		b = append(b, '"')
+	}
+	if f.Latency {
+		b = append(b, ' ')
+		b = strconv.AppendInt(b, int64(a.Latency/time.Microsecond), 10)
+	}
+	*buf = append(b, '\n')
+}
+
+// Field, or - if it is empty
+func accessField(field string) string {
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+var accessQuote = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`, "\r", `\r`)
@@ -0,0 +1,196 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// This log writer posts the records at ERROR and above, until set otherwise,
+// to a Slack-compatible incoming webhook, to page whoever watches the channel.
+// Posts are throttled, the records logged meanwhile posted together, and a
+// message repeated within the dedup window is posted once, with how many
+// times it was repeated noted the next time it is posted.
+type AlertLogWriter struct {
+	httpBatcher
+
+	level    Level
+	template string // the log format of each alert
+	fields   map[string]interface{}
+	throttle time.Duration // between posts
+	lastPost time.Time
+
+	window time.Duration // of dedup
+	seen   map[string]*alertSeen
+}
+
+// When an alert was last posted, and how many times it has been held back
+// since
+type alertSeen struct {
+	posted     time.Time
+	suppressed int
+}
+
+// This is the AlertLogWriter's output method
+func (w *AlertLogWriter) LogWrite(rec *LogRecord) {
+	if rec.Level < w.level {
+		return
+	}
+	w.logWrite(rec)
+}
+
+// wait for the alerts to be posted
+func (w *AlertLogWriter) Close() {
+	w.close()
+}
+
+// Flush posts the alerts held so far, returning once they have been.
+func (w *AlertLogWriter) Flush() {
+	w.flush()
+}
+
+// NewAlertLogWriter creates a new LogWriter which posts records to the incoming
+// webhook at url, as {"text": ...} with a line for each record, formatted with
+// "*%L* (%S) %M" until set otherwise.
+//
+// At most one post is made a second, and a message is posted once every five
+// minutes however often it is logged.
+func NewAlertLogWriter(url string, opts ...Option) *AlertLogWriter {
+	w := &AlertLogWriter{
+		httpBatcher: newHTTPBatcher("AlertLogWriter", url, opts),
+		level:       ERROR,
+		template:    "*%L* (%S) %M",
+		fields:      make(map[string]interface{}),
+		throttle:    time.Second,
+		window:      5 * time.Minute,
+		seen:        make(map[string]*alertSeen),
+	}
+	w.batchSize, w.batchWait = 20, w.throttle
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go w.run(w.send)
+
+	return w
+}
+
+// Post a batch, but for the alerts already posted within the window
+func (w *AlertLogWriter) send(batch []*LogRecord) error {
+	now := time.Now()
+	for key, seen := range w.seen {
+		// the repeats held back are noted if the alert comes again soon
+		if age := now.Sub(seen.posted); age >= w.window && (seen.suppressed == 0 || age >= 2*w.window) {
+			delete(w.seen, key)
+		}
+	}
+
+	var lines []string
+	for _, rec := range batch {
+		text := string(rec.Binary)
+		if rec.Binary == nil {
+			text = strings.TrimRight(FormatLogRecord(w.template, rec), "\n")
+		}
+
+		key := rec.Level.String() + "\x00" + rec.Source + "\x00" + rec.Message
+		seen := w.seen[key]
+		if seen != nil && now.Sub(seen.posted) < w.window {
+			seen.suppressed++
+			continue
+		}
+		if seen != nil && seen.suppressed > 0 {
+			text += fmt.Sprintf(" (repeated %d times since %s)", seen.suppressed, seen.posted.Format("15:04:05"))
+		}
+		w.seen[key] = &alertSeen{posted: now}
+		lines = append(lines, text)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	doc := make(map[string]interface{}, 1+len(w.fields))
+	for name, value := range w.fields {
+		doc[name] = value
+	}
+	doc["text"] = strings.Join(lines, "\n")
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if wait := time.Until(w.lastPost.Add(w.throttle)); wait > 0 {
+		time.Sleep(wait)
+	}
+	w.lastPost = time.Now()
+	_, err = w.post(body, "application/json")
+	return err
+}
+
+// Set the lowest level of the records posted (chainable).  The default is
+// ERROR.  Must be called before the first log message is written.
+func (w *AlertLogWriter) SetLevel(lvl Level) *AlertLogWriter {
+	w.level = lvl
+	return w
+}
+
+// Set the logging format of each alert (chainable), in Slack's markup.  Must
+// be called before the first log message is written.
+func (w *AlertLogWriter) SetTemplate(template string) *AlertLogWriter {
+	w.template = template
+	return w
+}
+
+// Add a field to every post (chainable), such as "channel", "username" or
+// "icon_emoji".  Must be called before the first log message is written.
+func (w *AlertLogWriter) SetField(name string, value interface{}) *AlertLogWriter {
+	w.fields[name] = value
+	return w
+}
+
+// Set the least time between posts (chainable).  The default is a second, as
+// Slack allows.  Must be called before the first log message is written.
+func (w *AlertLogWriter) SetThrottle(throttle time.Duration) *AlertLogWriter {
+	w.throttle, w.batchWait = throttle, throttle
+	return w
+}
+
+// Set how long a message is not posted again after it has been (chainable);
+// zero posts every one.  The default is five minutes.  Must be called before
+// the first log message is written.
+func (w *AlertLogWriter) SetDedup(window time.Duration) *AlertLogWriter {
+	w.window = window
+	return w
+}
+
+// Set how many more times a post is made when the webhook fails, and the wait
+// before the first retry, doubling after (chainable).  The default is five
+// times, from half a second.  Must be called before the first log message is
+// written.
+func (w *AlertLogWriter) SetRetry(retries int, wait time.Duration) *AlertLogWriter {
+	w.maxRetries, w.retryWait = retries, wait
+	return w
+}
+
+// Set the timeout of each request (chainable).  The default is 30 seconds.
+// Must be called before the first log message is written.
+func (w *AlertLogWriter) SetTimeout(timeout time.Duration) *AlertLogWriter {
+	w.client.Timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time alerts cannot
+// be posted (chainable).  It must not log to this writer.  Must be called
+// before the first log message is written.
+func (w *AlertLogWriter) SetErrorHandler(handler func(error)) *AlertLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be posted
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *AlertLogWriter) SetStderrFallback(fallback bool) *AlertLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
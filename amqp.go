@@ -0,0 +1,484 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+)
+
+// This is as much of AMQP 0-9-1 as AMQPLogWriter needs to publish: the
+// connection handshake, a channel, confirm mode, and the closing of either by
+// the broker.
+
+const (
+	amqpFrameMethod    = 1
+	amqpFrameHeader    = 2
+	amqpFrameBody      = 3
+	amqpFrameHeartbeat = 8
+	amqpFrameEnd       = 0xce
+
+	amqpFrameMax = 128 << 10 // asked for, unless the broker wants less
+)
+
+var amqpProtocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+// The classes and methods used, as class<<16 | method
+const (
+	amqpConnectionStart   = 10<<16 | 10
+	amqpConnectionStartOk = 10<<16 | 11
+	amqpConnectionTune    = 10<<16 | 30
+	amqpConnectionTuneOk  = 10<<16 | 31
+	amqpConnectionOpen    = 10<<16 | 40
+	amqpConnectionOpenOk  = 10<<16 | 41
+	amqpConnectionClose   = 10<<16 | 50
+	amqpConnectionCloseOk = 10<<16 | 51
+	amqpChannelOpen       = 20<<16 | 10
+	amqpChannelOpenOk     = 20<<16 | 11
+	amqpChannelClose      = 20<<16 | 40
+	amqpChannelCloseOk    = 20<<16 | 41
+	amqpBasicPublish      = 60<<16 | 40
+	amqpBasicAck          = 60<<16 | 80
+	amqpBasicNack         = 60<<16 | 120
+	amqpConfirmSelect     = 85<<16 | 10
+	amqpConfirmSelectOk   = 85<<16 | 11
+)
+
+type amqpFrame struct {
+	typ     byte
+	channel uint16
+	payload []byte
+}
+
+// The class<<16 | method of a method frame, 0 for any other
+func (f amqpFrame) method() uint32 {
+	if f.typ != amqpFrameMethod || len(f.payload) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(f.payload)
+}
+
+// The arguments of a method frame
+func (f amqpFrame) args() *amqpDecoder {
+	return &amqpDecoder{b: f.payload[4:]}
+}
+
+func readAMQPFrame(r io.Reader) (amqpFrame, error) {
+	var header [7]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return amqpFrame{}, err
+	}
+	f := amqpFrame{typ: header[0], channel: binary.BigEndian.Uint16(header[1:])}
+	f.payload = make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return amqpFrame{}, err
+	}
+	if f.payload[len(f.payload)-1] != amqpFrameEnd {
+		return amqpFrame{}, errors.New("AMQP frame not ended")
+	}
+	f.payload = f.payload[:len(f.payload)-1]
+	return f, nil
+}
+
+func appendAMQPFrame(b []byte, typ byte, channel uint16, payload []byte) []byte {
+	var header [7]byte
+	header[0] = typ
+	binary.BigEndian.PutUint16(header[1:], channel)
+	binary.BigEndian.PutUint32(header[3:], uint32(len(payload)))
+	b = append(append(b, header[:]...), payload...)
+	return append(b, amqpFrameEnd)
+}
+
+// amqpBuffer encodes the arguments of a method, or the properties of a
+// content header
+type amqpBuffer struct {
+	bytes.Buffer
+}
+
+func amqpMethod(method uint32) *amqpBuffer {
+	b := new(amqpBuffer)
+	b.long(method)
+	return b
+}
+
+func (b *amqpBuffer) octet(v byte) {
+	b.WriteByte(v)
+}
+
+func (b *amqpBuffer) short(v uint16) {
+	b.Write([]byte{byte(v >> 8), byte(v)})
+}
+
+func (b *amqpBuffer) long(v uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	b.Write(buf[:])
+}
+
+func (b *amqpBuffer) longlong(v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	b.Write(buf[:])
+}
+
+func (b *amqpBuffer) shortstr(s string) {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	b.WriteByte(byte(len(s)))
+	b.WriteString(s)
+}
+
+func (b *amqpBuffer) longstr(s string) {
+	b.long(uint32(len(s)))
+	b.WriteString(s)
+}
+
+// A field table of long strings, in the order of the names
+func (b *amqpBuffer) table(t map[string]string) {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var fields amqpBuffer
+	for _, name := range names {
+		fields.shortstr(name)
+		fields.octet('S')
+		fields.longstr(t[name])
+	}
+	b.long(uint32(fields.Len()))
+	b.Write(fields.Bytes())
+}
+
+// amqpDecoder decodes the arguments of a method, the first error sticking
+type amqpDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *amqpDecoder) take(n int) []byte {
+	if d.err != nil || len(d.b) < n {
+		d.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *amqpDecoder) octet() byte {
+	return d.take(1)[0]
+}
+
+func (d *amqpDecoder) short() uint16 {
+	return binary.BigEndian.Uint16(d.take(2))
+}
+
+func (d *amqpDecoder) long() uint32 {
+	return binary.BigEndian.Uint32(d.take(4))
+}
+
+func (d *amqpDecoder) longlong() uint64 {
+	return binary.BigEndian.Uint64(d.take(8))
+}
+
+func (d *amqpDecoder) shortstr() string {
+	return string(d.take(int(d.octet())))
+}
+
+func (d *amqpDecoder) longstr() string {
+	return string(d.take(int(d.long())))
+}
+
+// An amqpCloseError is the broker closing the connection, or a channel, as
+// when publishing to an exchange that does not exist
+type amqpCloseError struct {
+	channel bool
+	code    uint16
+	text    string
+}
+
+func (e *amqpCloseError) Error() string {
+	if e.channel {
+		return fmt.Sprintf("channel closed: %d %s", e.code, e.text)
+	}
+	return fmt.Sprintf("connection closed: %d %s", e.code, e.text)
+}
+
+// An amqpConn is a connection to a broker, with its frames read on a goroutine
+// of its own so that those the broker sends unasked are seen.
+type amqpConn struct {
+	conn     net.Conn
+	frames   chan amqpFrame
+	err      error // why frames was closed
+	frameMax int
+	timeout  time.Duration
+}
+
+// openAMQP does the handshake of a new connection to a broker, logging in as
+// username to the virtual host vhost.
+func openAMQP(conn net.Conn, username, password, vhost string, timeout time.Duration) (*amqpConn, error) {
+	c := &amqpConn{conn: conn, frameMax: amqpFrameMax, timeout: timeout}
+	conn.SetDeadline(time.Now().Add(timeout))
+	r := bufio.NewReader(conn)
+	expect := func(method uint32) (amqpFrame, error) {
+		for {
+			f, err := readAMQPFrame(r)
+			if err != nil {
+				return f, err
+			}
+			switch f.method() {
+			case method:
+				return f, nil
+			case amqpConnectionClose:
+				args := f.args()
+				return f, &amqpCloseError{code: args.short(), text: args.shortstr()}
+			}
+		}
+	}
+
+	if _, err := conn.Write(amqpProtocolHeader); err != nil {
+		return nil, err
+	}
+	if _, err := expect(amqpConnectionStart); err != nil {
+		return nil, err
+	}
+	m := amqpMethod(amqpConnectionStartOk)
+	m.table(map[string]string{"product": "log4go"})
+	m.shortstr("PLAIN")
+	m.longstr("\x00" + username + "\x00" + password)
+	m.shortstr("en_US")
+	if err := c.send(0, m); err != nil {
+		return nil, err
+	}
+
+	f, err := expect(amqpConnectionTune)
+	if err != nil {
+		return nil, err
+	}
+	args := f.args()
+	channelMax, frameMax := args.short(), args.long()
+	if frameMax != 0 && frameMax < amqpFrameMax {
+		c.frameMax = int(frameMax)
+	}
+	m = amqpMethod(amqpConnectionTuneOk)
+	m.short(channelMax)
+	m.long(uint32(c.frameMax))
+	m.short(0) // no heartbeats
+	if err := c.send(0, m); err != nil {
+		return nil, err
+	}
+
+	m = amqpMethod(amqpConnectionOpen)
+	m.shortstr(vhost)
+	m.shortstr("")
+	m.octet(0)
+	if err := c.send(0, m); err != nil {
+		return nil, err
+	}
+	if _, err := expect(amqpConnectionOpenOk); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.frames = make(chan amqpFrame, 64)
+	go func() {
+		for {
+			f, err := readAMQPFrame(r)
+			if err != nil {
+				c.err = err
+				close(c.frames)
+				return
+			}
+			c.frames <- f
+		}
+	}()
+	return c, nil
+}
+
+func (c *amqpConn) send(channel uint16, m *amqpBuffer) error {
+	return c.write(appendAMQPFrame(nil, amqpFrameMethod, channel, m.Bytes()))
+}
+
+func (c *amqpConn) write(b []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// next returns the next frame from the broker, waiting for it if wait is set,
+// or nil.  The closing of the connection or of a channel is answered and
+// returned as an error.
+func (c *amqpConn) next(wait bool) (*amqpFrame, error) {
+	var f amqpFrame
+	var ok bool
+	if wait {
+		timer := time.NewTimer(c.timeout)
+		defer timer.Stop()
+		select {
+		case f, ok = <-c.frames:
+		case <-timer.C:
+			return nil, fmt.Errorf("no answer from the broker in %s", c.timeout)
+		}
+	} else {
+		select {
+		case f, ok = <-c.frames:
+		default:
+			return nil, nil
+		}
+	}
+	if !ok {
+		return nil, c.err
+	}
+
+	switch f.method() {
+	case amqpConnectionClose:
+		args := f.args()
+		c.send(0, amqpMethod(amqpConnectionCloseOk))
+		return nil, &amqpCloseError{code: args.short(), text: args.shortstr()}
+	case amqpChannelClose:
+		args := f.args()
+		c.send(f.channel, amqpMethod(amqpChannelCloseOk))
+		return nil, &amqpCloseError{channel: true, code: args.short(), text: args.shortstr()}
+	}
+	return &f, nil
+}
+
+// call sends a method and waits for the broker's answer to it
+func (c *amqpConn) call(channel uint16, m *amqpBuffer, answer uint32) error {
+	if err := c.send(channel, m); err != nil {
+		return err
+	}
+	for {
+		f, err := c.next(true)
+		if err != nil {
+			return err
+		}
+		if f.method() == answer {
+			return nil
+		}
+	}
+}
+
+// Open a channel, in confirm mode if asked to
+func (c *amqpConn) openChannel(channel uint16, confirm bool) error {
+	m := amqpMethod(amqpChannelOpen)
+	m.shortstr("")
+	if err := c.call(channel, m, amqpChannelOpenOk); err != nil {
+		return err
+	}
+	if !confirm {
+		return nil
+	}
+	m = amqpMethod(amqpConfirmSelect)
+	m.octet(0)
+	return c.call(channel, m, amqpConfirmSelectOk)
+}
+
+// The properties of a published message AMQPLogWriter sets
+type amqpProperties struct {
+	contentType string
+	headers     map[string]string
+	persistent  bool
+	timestamp   time.Time
+	appID       string
+}
+
+// Publish body to the exchange with the routing key, as a method, a content
+// header and as many body frames as it takes
+func (c *amqpConn) publish(channel uint16, exchange, key string, props amqpProperties, body []byte) error {
+	m := amqpMethod(amqpBasicPublish)
+	m.short(0)
+	m.shortstr(exchange)
+	m.shortstr(key)
+	m.octet(0) // neither mandatory nor immediate
+	b := appendAMQPFrame(nil, amqpFrameMethod, channel, m.Bytes())
+
+	var flags uint16
+	var p amqpBuffer
+	if props.contentType != "" {
+		flags |= 1 << 15
+		p.shortstr(props.contentType)
+	}
+	if len(props.headers) > 0 {
+		flags |= 1 << 13
+		p.table(props.headers)
+	}
+	if props.persistent {
+		flags |= 1 << 12
+		p.octet(2)
+	}
+	flags |= 1 << 6
+	p.longlong(uint64(props.timestamp.Unix()))
+	if props.appID != "" {
+		flags |= 1 << 3
+		p.shortstr(props.appID)
+	}
+	h := new(amqpBuffer)
+	h.short(60)
+	h.short(0)
+	h.longlong(uint64(len(body)))
+	h.short(flags)
+	h.Write(p.Bytes())
+	b = appendAMQPFrame(b, amqpFrameHeader, channel, h.Bytes())
+
+	for size := c.frameMax - 8; len(body) > 0; {
+		chunk := body
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		b = appendAMQPFrame(b, amqpFrameBody, channel, chunk)
+		body = body[len(chunk):]
+	}
+	return c.write(b)
+}
+
+// Wait for the broker to confirm the message with the delivery tag
+func (c *amqpConn) confirmed(tag uint64) error {
+	for {
+		f, err := c.next(true)
+		if err != nil {
+			return err
+		}
+		switch f.method() {
+		case amqpBasicAck, amqpBasicNack:
+			args := f.args()
+			acked, multiple := args.longlong(), args.octet()&1 != 0
+			if acked != tag && !(multiple && acked >= tag) {
+				continue
+			}
+			if f.method() == amqpBasicNack {
+				return errors.New("message refused by the broker")
+			}
+			return nil
+		}
+	}
+}
+
+// Close the connection, telling the broker first
+func (c *amqpConn) close() {
+	m := amqpMethod(amqpConnectionClose)
+	m.short(200)
+	m.shortstr("closing")
+	m.short(0)
+	m.short(0)
+	c.call(0, m, amqpConnectionCloseOk) // the broker may have gone already
+	c.abandon()
+}
+
+// Close the connection as it is, having failed
+func (c *amqpConn) abandon() {
+	c.conn.Close()
+	// let the reader see the connection closed, should it be stuck sending
+	go func() {
+		for range c.frames {
+		}
+	}()
+}
@@ -0,0 +1,379 @@
+package log4go
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An ArchiveUploader copies a finished backup file to long term storage.
+type ArchiveUploader interface {
+	Upload(path string) error
+}
+
+// An Archiver is a RotationHook that hands every completed backup to an
+// ArchiveUploader.  Uploads run on their own goroutine, off the logging path,
+// from a bounded queue; when the queue is full further backups are left on
+// disk and not uploaded.
+//
+//	w := NewTimeFileLogWriter("app.log", "MIDNIGHT", 7)
+//	w.AddRotationHook(NewArchiver(NewS3Uploader("logs", "us-east-1", "app/"), 16))
+type Archiver struct {
+	uploader ArchiveUploader
+	queue    chan string
+	done     chan bool
+
+	retries     int           // retries after the first failed upload
+	backoff     time.Duration // wait before the first retry, doubled each time
+	deleteLocal bool          // remove the backup once it is uploaded
+}
+
+// NewArchiver creates an Archiver queueing at most queueSize backups.
+func NewArchiver(uploader ArchiveUploader, queueSize int) *Archiver {
+	a := &Archiver{
+		uploader: uploader,
+		queue:    make(chan string, queueSize),
+		done:     make(chan bool),
+		retries:  5,
+		backoff:  time.Second,
+	}
+	go a.run()
+	return a
+}
+
+func (a *Archiver) run() {
+	defer close(a.done)
+	for path := range a.queue {
+		if err := a.upload(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Archiver(%q): %s\n", path, err)
+			continue
+		}
+		if a.deleteLocal {
+			os.Remove(path)
+		}
+	}
+}
+
+// upload tries the upload, backing off exponentially between attempts.
+func (a *Archiver) upload(path string) (err error) {
+	wait := a.backoff
+	for i := 0; ; i++ {
+		if err = a.uploader.Upload(path); err == nil || i >= a.retries {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// Set how many times a failed upload is retried, and the wait before the
+// first retry, which doubles after each attempt (chainable).
+func (a *Archiver) SetRetry(retries int, backoff time.Duration) *Archiver {
+	a.retries, a.backoff = retries, backoff
+	return a
+}
+
+// Set whether backups are removed from disk once uploaded (chainable).
+func (a *Archiver) SetDeleteLocal(deleteLocal bool) *Archiver {
+	a.deleteLocal = deleteLocal
+	return a
+}
+
+// OnBeforeRotate does nothing; only complete backups are uploaded.
+func (a *Archiver) OnBeforeRotate(old string) {}
+
+// OnAfterRotate queues the backup old for upload.
+func (a *Archiver) OnAfterRotate(old, new string) {
+	select {
+	case a.queue <- old:
+	default:
+		fmt.Fprintf(os.Stderr, "Archiver(%q): upload queue full, not uploading\n", old)
+	}
+}
+
+// Close waits for the queued uploads to finish.  The writers the Archiver is
+// registered with must be closed first.
+func (a *Archiver) Close() {
+	close(a.queue)
+	<-a.done
+}
+
+/****** S3 ******/
+
+// An S3Uploader puts backups into an Amazon S3 (or compatible) bucket,
+// signing requests with AWS Signature Version 4.
+type S3Uploader struct {
+	bucket   string
+	region   string
+	prefix   string // prepended to the file name to make the object key
+	endpoint string // scheme and host; the bucket goes in the path if set
+
+	accessKey, secretKey, sessionToken string
+
+	client *http.Client
+}
+
+// NewS3Uploader creates an S3Uploader for the bucket in region, taking its
+// credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.  Objects are named prefix + the backup's file name.
+func NewS3Uploader(bucket, region, prefix string) *S3Uploader {
+	return &S3Uploader{
+		bucket:       bucket,
+		region:       region,
+		prefix:       prefix,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Set the credentials to sign with (chainable).  sessionToken may be empty.
+func (u *S3Uploader) SetCredentials(accessKey, secretKey, sessionToken string) *S3Uploader {
+	u.accessKey, u.secretKey, u.sessionToken = accessKey, secretKey, sessionToken
+	return u
+}
+
+// Set an endpoint such as "http://minio:9000" for S3 compatible storage
+// (chainable).  The bucket is then addressed in the path, not the host name.
+func (u *S3Uploader) SetEndpoint(endpoint string) *S3Uploader {
+	u.endpoint = strings.TrimRight(endpoint, "/")
+	return u
+}
+
+// Upload puts the file at path into the bucket.
+func (u *S3Uploader) Upload(path string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+
+	key := awsURIEscape(u.prefix+filepath.Base(path), false)
+	target := "https://" + u.bucket + ".s3." + u.region + ".amazonaws.com/" + key
+	if u.endpoint != "" {
+		target = u.endpoint + "/" + awsURIEscape(u.bucket, true) + "/" + key
+	}
+	req, err := http.NewRequest("PUT", target, fd)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	signAWSv4(req, "UNSIGNED-PAYLOAD", "s3", u.region, u.accessKey, u.secretKey, u.sessionToken, time.Now())
+
+	return doUpload(u.client, req)
+}
+
+// signAWSv4 adds AWS Signature Version 4 headers to req.  Every header already
+// set on req is signed, along with the host.
+func signAWSv4(req *http.Request, payloadHash, service, region, accessKey, secretKey, sessionToken string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders string
+	for _, k := range names {
+		canonHeaders += k + ":" + headers[k] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		vs := query[k]
+		sort.Strings(vs)
+		for _, v := range vs {
+			params = append(params, awsURIEscape(k, true)+"="+awsURIEscape(v, true))
+		}
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonRequest := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Join(params, "&"),
+		canonHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	sum := sha256.Sum256([]byte(canonRequest))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIEscape percent-encodes everything but the RFC 3986 unreserved
+// characters, leaving '/' alone unless slash is set.
+func awsURIEscape(s string, slash bool) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !slash) {
+			out.WriteByte(c)
+		} else {
+			fmt.Fprintf(&out, "%%%02X", c)
+		}
+	}
+	return out.String()
+}
+
+/****** GCS ******/
+
+// A GCSUploader puts backups into a Google Cloud Storage bucket through the
+// JSON API.
+type GCSUploader struct {
+	bucket string
+	prefix string // prepended to the file name to make the object name
+
+	// token returns an OAuth2 access token with a storage write scope
+	token func() (string, error)
+
+	client *http.Client
+}
+
+// NewGCSUploader creates a GCSUploader for bucket.  Objects are named prefix +
+// the backup's file name.  By default the access token comes from the GCE
+// metadata server, which works on Compute Engine, GKE and Cloud Run.
+func NewGCSUploader(bucket, prefix string) *GCSUploader {
+	u := &GCSUploader{
+		bucket: bucket,
+		prefix: prefix,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+	u.token = u.metadataToken
+	return u
+}
+
+// Set the function that provides access tokens (chainable).
+func (u *GCSUploader) SetTokenSource(token func() (string, error)) *GCSUploader {
+	u.token = token
+	return u
+}
+
+// Upload puts the file at path into the bucket.
+func (u *GCSUploader) Upload(path string) error {
+	token, err := u.token()
+	if err != nil {
+		return err
+	}
+
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+
+	target := "https://storage.googleapis.com/upload/storage/v1/b/" + url.PathEscape(u.bucket) +
+		"/o?uploadType=media&name=" + url.QueryEscape(u.prefix+filepath.Base(path))
+	req, err := http.NewRequest("POST", target, fd)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = fi.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return doUpload(u.client, req)
+}
+
+func (u *GCSUploader) metadataToken() (string, error) {
+	return gceMetadataToken(u.client)
+}
+
+// gceMetadataToken fetches an access token for the default service account from
+// the GCE metadata server.
+func gceMetadataToken(client *http.Client) (string, error) {
+	req, err := http.NewRequest("GET", "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata token: %s", resp.Status)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
+
+// doUpload sends req and turns a non-2xx reply into an error.
+func doUpload(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package log4go
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// In an audit log each record ends in " hmac=" and the hex HMAC-SHA256 of the
+// record, keyed with the audit key and chained to the HMAC before it, so that
+// a record cannot be changed, dropped or moved without breaking the chain.
+// Closing the file seals the chain with a line of its own, "hmac-end=" and an
+// HMAC chained the same way, which a truncated file lacks.  A file reopened or
+// appended to starts a new chain after the seal.
+const (
+	auditMark = " hmac="
+	auditSeal = "hmac-end="
+)
+
+// ErrAuditUnsealed is returned by VerifyLogFile for an audit log whose last
+// records are not sealed: it was truncated, or is still being written.
+var ErrAuditUnsealed = errors.New("audit log is not sealed")
+
+// auditChain keeps the HMAC chain of an audit log.  A nil *auditChain audits
+// nothing.
+type auditChain struct {
+	key  []byte
+	prev []byte // HMAC of the last record, nil at the start of a chain
+}
+
+func auditMAC(key, prev []byte, kind byte, text []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(prev)
+	mac.Write([]byte{kind})
+	mac.Write(text)
+	return mac.Sum(nil)
+}
+
+// wrap returns out, appending the chained HMAC to each write if c is set.
+func (c *auditChain) wrap(out io.Writer) io.Writer {
+	if c == nil {
+		return out
+	}
+	return auditWriter{c, out}
+}
+
+// seal ends the chain in out, the next write starting a new one.
+func (c *auditChain) seal(out io.Writer) {
+	if c == nil || c.prev == nil {
+		return
+	}
+	io.WriteString(out, auditSeal+hex.EncodeToString(auditMAC(c.key, c.prev, 'e', nil))+"\n")
+	c.prev = nil
+}
+
+type auditWriter struct {
+	*auditChain
+	out io.Writer
+}
+
+func (w auditWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	text := bytes.TrimSuffix(p, []byte("\n"))
+	mac := auditMAC(w.key, w.prev, 'r', text)
+	line := make([]byte, 0, len(text)+len(auditMark)+2*len(mac)+1)
+	line = append(line, text...)
+	line = append(line, auditMark...)
+	line = append(line, hex.EncodeToString(mac)...)
+	line = append(line, '\n')
+
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	w.prev = mac
+	return len(p), nil
+}
+
+// VerifyLogFile checks the HMAC chain of the audit log path, written by a
+// FileLogWriter, TimeFileLogWriter or PanicFileLogWriter after SetAudit(key).
+// It returns the number of records found intact, and an error for the first
+// record changed, dropped or moved, or ErrAuditUnsealed if the file ends in
+// unsealed records.
+// Decrypt an encrypted audit log, with DecryptLog, and use VerifyLog instead.
+func VerifyLogFile(path string, key []byte) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return VerifyLog(f, key)
+}
+
+// VerifyLog checks the HMAC chain of the audit log read from r, as
+// VerifyLogFile does.
+func VerifyLog(r io.Reader, key []byte) (int, error) {
+	in := bufio.NewReader(r)
+	records, lineno := 0, 0
+	var prev []byte
+	var pending strings.Builder // lines of a record spanning several
+
+	for {
+		line, err := in.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		} else if err != nil && err != io.EOF {
+			return records, err
+		}
+		lineno++
+		line = strings.TrimSuffix(line, "\n")
+
+		if pending.Len() == 0 && strings.HasPrefix(line, auditSeal) {
+			if prev == nil || !hmac.Equal(decodeMAC(line[len(auditSeal):]), auditMAC(key, prev, 'e', nil)) {
+				return records, fmt.Errorf("audit log line %d: seal does not match", lineno)
+			}
+			prev = nil
+			continue
+		}
+
+		i := len(line) - len(auditMark) - 2*sha256.Size
+		if i < 0 || line[i:i+len(auditMark)] != auditMark || decodeMAC(line[i+len(auditMark):]) == nil {
+			pending.WriteString(line)
+			pending.WriteString("\n")
+			continue
+		}
+		pending.WriteString(line[:i])
+		text := []byte(pending.String())
+		pending.Reset()
+
+		mac := decodeMAC(line[i+len(auditMark):])
+		if !hmac.Equal(mac, auditMAC(key, prev, 'r', text)) {
+			if prev != nil && hmac.Equal(mac, auditMAC(key, nil, 'r', text)) {
+				return records, fmt.Errorf("audit log line %d: chain starts again without the last one being sealed", lineno)
+			}
+			return records, fmt.Errorf("audit log line %d: record does not match its hmac", lineno)
+		}
+		prev = mac
+		records++
+	}
+
+	if pending.Len() > 0 {
+		return records, fmt.Errorf("audit log line %d: record has no hmac", lineno)
+	}
+	if prev != nil {
+		return records, ErrAuditUnsealed
+	}
+	return records, nil
+}
+
+// decodeMAC returns the HMAC written in hex as s, or nil.
+func decodeMAC(s string) []byte {
+	if len(s) != 2*sha256.Size {
+		return nil
+	}
+	mac, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	return mac
+}
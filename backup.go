@@ -0,0 +1,323 @@
+package log4go
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A backupFile is a rotated-out log file sitting next to the live log.
+type backupFile struct {
+	path string
+	size int64
+	mod  int64 // modification time, time.Unix()
+}
+
+// listBackups returns the backups of base, oldest first.  A file is a backup
+// if its name is base + "." + suffix (optionally followed by ".gz") and match
+// accepts the suffix.
+func listBackups(base string, match func(suffix string) bool) []backupFile {
+	dirName := filepath.Dir(base)
+	prefix := filepath.Base(base) + "."
+
+	result := []backupFile{}
+
+	fileInfos, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", base, err)
+		return result
+	}
+
+	for _, fileInfo := range fileInfos {
+		fileName := strings.TrimSuffix(fileInfo.Name(), ".gz")
+		if fileInfo.IsDir() || !strings.HasPrefix(fileName, prefix) {
+			continue
+		}
+		if match(fileName[len(prefix):]) {
+			result = append(result, backupFile{
+				path: filepath.Join(dirName, fileInfo.Name()),
+				size: fileInfo.Size(),
+				mod:  fileInfo.ModTime().Unix(),
+			})
+		}
+	}
+
+	sortBackups(result)
+	return result
+}
+
+// globBackups returns the backups of base, oldest first, taking as a backup
+// any file in its directory whose name matches the shell pattern (as in
+// filepath.Match).  The log itself and its rotation temp and lock files are
+// never taken.
+func globBackups(base, pattern string) []backupFile {
+	dirName := filepath.Dir(base)
+	baseName := filepath.Base(base)
+
+	result := []backupFile{}
+
+	fileInfos, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", base, err)
+		return result
+	}
+
+	for _, fileInfo := range fileInfos {
+		fileName := fileInfo.Name()
+		switch fileName {
+		case baseName, baseName + rotatingSuffix, baseName + ".lock":
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, fileName); matched && !fileInfo.IsDir() {
+			result = append(result, backupFile{
+				path: filepath.Join(dirName, fileName),
+				size: fileInfo.Size(),
+				mod:  fileInfo.ModTime().Unix(),
+			})
+		}
+	}
+
+	sortBackups(result)
+	return result
+}
+
+// sortBackups puts backups oldest first.
+func sortBackups(backups []backupFile) {
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].mod != backups[j].mod {
+			return backups[i].mod < backups[j].mod
+		}
+		return backups[i].path < backups[j].path
+	})
+}
+
+// checkBackupGlob reports a malformed backup glob pattern.
+func checkBackupGlob(pattern string) error {
+	_, err := filepath.Match(pattern, "")
+	return err
+}
+
+// removeBackupsOverSize deletes the oldest backups until the combined size of
+// those left is no more than maxTotalSize bytes.  It returns the survivors.
+func removeBackupsOverSize(backups []backupFile, maxTotalSize int64) []backupFile {
+	var total int64
+	for _, b := range backups {
+		total += b.size
+	}
+	for len(backups) > 0 && total > maxTotalSize {
+		os.Remove(backups[0].path)
+		total -= backups[0].size
+		backups = backups[1:]
+	}
+	return backups
+}
+
+// removeBackupsOlderThan deletes the backups last modified more than maxAge
+// ago.  It returns the survivors.
+func removeBackupsOlderThan(backups []backupFile, maxAge time.Duration) []backupFile {
+	cutoff := time.Now().Add(-maxAge).Unix()
+	for len(backups) > 0 && backups[0].mod < cutoff {
+		os.Remove(backups[0].path)
+		backups = backups[1:]
+	}
+	return backups
+}
+
+// sequenceFilter matches the suffixes of backups numbered .1, .2, ...
+var sequenceFilter = regexp.MustCompile(`^\d+$`)
+
+// shiftBackups makes room for a new backup base.1 by renaming every base.N
+// (or base.N.gz) to base.N+1, newest last, like log4j's RollingFileAppender.
+// If maxBackups is > 0, backups that would be numbered above it are removed.
+func shiftBackups(base string, maxBackups int) error {
+	type numbered struct {
+		path, ext string
+		num       int
+	}
+	var backups []numbered
+	for _, b := range listBackups(base, sequenceFilter.MatchString) {
+		ext := ""
+		if strings.HasSuffix(b.path, ".gz") {
+			ext = ".gz"
+		}
+		num, _ := strconv.Atoi(strings.TrimSuffix(b.path, ext)[len(base)+1:])
+		backups = append(backups, numbered{b.path, ext, num})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].num > backups[j].num })
+
+	for _, b := range backups {
+		if maxBackups > 0 && b.num >= maxBackups {
+			os.Remove(b.path)
+			continue
+		}
+		if err := os.Rename(b.path, base+"."+strconv.Itoa(b.num+1)+b.ext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTruncate appends the log file src to the backup dst, then empties src in
+// place instead of renaming it, so anything else holding src open (a child
+// process sharing the fd, say) keeps writing to the live log.  Lines written
+// by others between the copy and the truncate are lost.
+func copyTruncate(src, dst string) error {
+	if err := appendFile(dst, src); err != nil {
+		return err
+	}
+	return os.Truncate(src, 0)
+}
+
+// appendFile appends the contents of src to dst, creating dst with the mode of
+// src if need be.
+func appendFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND|os.O_CREATE, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// rotatingSuffix marks the next log file while a rotation moves it into place.
+const rotatingSuffix = ".rotating"
+
+// rollOver has move put the log file name aside, and a new file take its
+// place.  The new file is opened first, as name + rotatingSuffix, so that
+// failing to open it leaves the log as it was, and a crash at worst leaves the
+// new file for adoptOrphan.  Should move, which closes the log, or the rename
+// after it fail, the new file is removed and only the error is returned: there
+// is no file to log to until the writer's recovery opens one again.  open opens
+// a log file by name; rollOver returns the new log, as the file opened first if
+// it cannot be opened again by its name.
+func rollOver(name string, open func(string) (*os.File, error), move func() error) (*os.File, error) {
+	tmp := name + rotatingSuffix
+	next, err := open(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := move(); err != nil {
+		next.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		next.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	// reopen it by its proper name, keeping the file already open if need be
+	if fd, err := open(name); err == nil {
+		next.Close()
+		return fd, nil
+	}
+	return next, nil
+}
+
+// adoptOrphan finishes a rotation a crash interrupted, moving the new log file
+// it left as name + rotatingSuffix into place.  Should the old log still be
+// there, the new file is appended to it instead.
+func adoptOrphan(name string) error {
+	tmp := name + rotatingSuffix
+	if _, err := os.Lstat(tmp); err != nil {
+		return nil
+	}
+	if _, err := os.Lstat(name); os.IsNotExist(err) {
+		return os.Rename(tmp, name)
+	}
+	if err := appendFile(name, tmp); err != nil {
+		return err
+	}
+	return os.Remove(tmp)
+}
+
+// A RotationHook is told when a rotating writer (FileLogWriter,
+// TimeFileLogWriter or PanicFileLogWriter) moves its log file aside, e.g. to
+// compress or upload the backup.  Hooks run on the writer's goroutine, so a
+// slow hook holds up logging.
+type RotationHook interface {
+	// OnBeforeRotate is called just before the log file old is renamed to
+	// its backup name.  Nothing more will be written to it.
+	OnBeforeRotate(old string)
+
+	// OnAfterRotate is called once the backup old is complete and the log
+	// file new has been opened in place of the rotated one.
+	OnAfterRotate(old, new string)
+}
+
+type rotationHooks []RotationHook
+
+func (hooks rotationHooks) before(old string) {
+	for _, h := range hooks {
+		h.OnBeforeRotate(old)
+	}
+}
+
+func (hooks rotationHooks) after(old, newName string) {
+	for _, h := range hooks {
+		h.OnAfterRotate(old, newName)
+	}
+}
+
+// A rotationLock lets several processes write one log file while only one of
+// them moves it aside at each rollover.  They take turns through an advisory
+// lock on path, which also records when the file was last rotated.
+type rotationLock struct {
+	path string
+	last int64 // latest rotation this process knows of, time.UnixNano()
+}
+
+// rotate calls move with the lock held, unless another process rotated the
+// file since this one last did or saw it done.  It reports whether move was
+// called.
+func (l *rotationLock) rotate(move func() error) (bool, error) {
+	fd, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer fd.Close()
+	if err := lockFile(fd); err != nil {
+		return false, err
+	}
+	defer unlockFile(fd)
+
+	b, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return false, err
+	}
+	if done, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64); err == nil && done > l.last {
+		l.last = done
+		return false, nil
+	}
+
+	if err := move(); err != nil {
+		return false, err
+	}
+	l.last = time.Now().UnixNano()
+	if err := fd.Truncate(0); err != nil {
+		return true, err
+	}
+	_, err = fd.WriteAt([]byte(strconv.FormatInt(l.last, 10)+"\n"), 0)
+	return true, err
+}
@@ -0,0 +1,91 @@
+package log4go
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// The functions Helper has marked, by name
+var helpers = struct {
+	sync.RWMutex
+	funcs map[string]bool
+}{funcs: make(map[string]bool)}
+
+// How many functions Helper has marked, read without the lock
+var helperCount int32
+
+// WithCallerSkip returns a Logger that takes the source of its records from
+// skip more frames up the stack than log does, for a logging facade that
+// calls it from a function of its own:
+//
+//	var facade = log4go.Global.WithCallerSkip(1)
+//
+//	func Infof(format string, args ...interface{}) {
+//		facade.Info(format, args...)
+//	}
+//
+// It has the filters of log, over the same writers, as a Logger derived With
+// fields has.
+func (log Logger) WithCallerSkip(skip int) Logger {
+	return log.derive(nil, skip)
+}
+
+// How many more frames up than its own caller a Logger takes the source from
+func (log Logger) callerSkip() int {
+	if w := log.derivedWriter(); w != nil {
+		return w.callerSkip
+	}
+	return 0
+}
+
+// Helper marks the function calling it as a logging helper, as testing.T's
+// Helper does, so that records logged from within it take their source from
+// its caller instead, or from the first caller up the stack that is not a
+// helper:
+//
+//	func logRequest(r *http.Request) {
+//		log4go.Helper()
+//		log4go.Info("%s %s", r.Method, r.URL)
+//	}
+func Helper() {
+	pc, _, _, ok := runtime.Caller(1)
+	if !ok {
+		return
+	}
+	name := runtime.FuncForPC(pc).Name()
+	helpers.RLock()
+	marked := helpers.funcs[name]
+	helpers.RUnlock()
+	if marked {
+		return
+	}
+	helpers.Lock()
+	defer helpers.Unlock()
+	helpers.funcs[name] = true
+	atomic.StoreInt32(&helperCount, int32(len(helpers.funcs)))
+}
+
+// The source of the frame skip up from the caller, as runtime.Caller counts
+// them, or of the first above it not in a helper, and how many frames up that
+// one is
+func callerSource(skip int) (string, int) {
+	for {
+		pc, _, lineno, ok := runtime.Caller(skip + 1)
+		if !ok {
+			return "", skip
+		}
+		name := runtime.FuncForPC(pc).Name()
+		if atomic.LoadInt32(&helperCount) > 0 {
+			helpers.RLock()
+			helper := helpers.funcs[name]
+			helpers.RUnlock()
+			if helper {
+				skip++
+				continue
+			}
+		}
+		return fmt.Sprintf("%s:%d", name, lineno), skip
+	}
+}
@@ -0,0 +1,150 @@
+package log4go
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A CEFFormatter writes each record in the Common Event Format of ArcSight, as
+// a SIEM takes it from syslog or a file:
+//
+//	CEF:0|Acme|Billing|1.2|main.charge|card declined|8|dvchost=web1 rt=Feb 13 2009 23:31:30.123 UTC
+//
+// The signature ID, name and extensions are formats, as for FormatLogRecord,
+// so that each can be mapped from what a record has.
+type CEFFormatter struct {
+	Vendor, Product, Version string // of the device, the application logging
+
+	SignatureID string            // the format of the event class, by default "%F"
+	Name        string            // the format of the event's name, by default "%M"
+	Extensions  map[string]string // the formats of the extensions, written in key order
+}
+
+// NewCEFFormatter creates a new CEFFormatter for the product of vendor at
+// version, with the function logged from as the signature ID, the message as
+// the name, and the time and host as the rt and dvchost extensions.
+func NewCEFFormatter(vendor, product, version string) *CEFFormatter {
+	return &CEFFormatter{
+		Vendor:      vendor,
+		Product:     product,
+		Version:     version,
+		SignatureID: "%F",
+		Name:        "%M",
+		Extensions: map[string]string{
+			"rt":      "%{Jan 02 2006 15:04:05.000 MST}",
+			"dvchost": "%h",
+		},
+	}
+}
+
+// The severity of lvl as CEF and LEEF have it, 0 to 10
+func eventSeverity(lvl Level) int {
+	switch {
+	case lvl <= TRACE:
+		return 1
+	case lvl == INFO:
+		return 3
+	case lvl == WARNING:
+		return 5
+	case lvl == ERROR:
+		return 8
+	}
+	return 10
+}
+
+var (
+	cefHeader    = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ")
+	cefExtension = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// Format appends rec to *buf as a CEF event and a newline.
+func (f *CEFFormatter) Format(rec *LogRecord, buf *[]byte) {
+	b := append(*buf, "CEF:0|"...)
+	for _, field := range []string{
+		f.Vendor, f.Product, f.Version,
+		formatField(f.SignatureID, rec), formatField(f.Name, rec),
+	} {
+		b = append(b, cefHeader.Replace(field)...)
+		b = append(b, '|')
+	}
+	b = strconv.AppendInt(b, int64(eventSeverity(rec.Level)), 10)
+	b = append(b, '|')
+
+	for i, key := range sortedKeys(f.Extensions) {
+		if i > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, key...)
+		b = append(b, '=')
+		b = append(b, cefExtension.Replace(formatField(f.Extensions[key], rec))...)
+	}
+	*buf = append(b, '\n')
+}
+
+// A LEEFFormatter writes each record in the Log Event Extended Format of QRadar,
+// version 1.0, its attributes separated by tabs:
+//
+//	LEEF:1.0|Acme|Billing|1.2|main.charge|sev=8	devTime=Feb 13 2009 23:31:30.123 UTC	devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z	identHostName=web1	msg=card declined
+//
+// The event ID and attributes are formats, as for FormatLogRecord.
+type LEEFFormatter struct {
+	Vendor, Product, Version string // of the device, the application logging
+
+	EventID    string            // the format of the event's ID, by default "%F"
+	Attributes map[string]string // the formats of the attributes but sev, written in key order
+}
+
+// NewLEEFFormatter creates a new LEEFFormatter for the product of vendor at
+// version, with the function logged from as the event ID, and the time, host
+// and message as the devTime, identHostName and msg attributes.
+func NewLEEFFormatter(vendor, product, version string) *LEEFFormatter {
+	return &LEEFFormatter{
+		Vendor:  vendor,
+		Product: product,
+		Version: version,
+		EventID: "%F",
+		Attributes: map[string]string{
+			"devTime":       "%{Jan 02 2006 15:04:05.000 MST}",
+			"devTimeFormat": "MMM dd yyyy HH:mm:ss.SSS z",
+			"identHostName": "%h",
+			"msg":           "%M",
+		},
+	}
+}
+
+var leefAttribute = strings.NewReplacer("\t", `\t`, "\r", `\r`, "\n", `\n`)
+
+// Format appends rec to *buf as a LEEF event and a newline.
+func (f *LEEFFormatter) Format(rec *LogRecord, buf *[]byte) {
+	b := append(*buf, "LEEF:1.0|"...)
+	for _, field := range []string{f.Vendor, f.Product, f.Version, formatField(f.EventID, rec)} {
+		b = append(b, cefHeader.Replace(field)...)
+		b = append(b, '|')
+	}
+
+	b = append(b, "sev="...)
+	b = strconv.AppendInt(b, int64(eventSeverity(rec.Level)), 10)
+	for _, key := range sortedKeys(f.Attributes) {
+		b = append(b, '\t')
+		b = append(b, key...)
+		b = append(b, '=')
+		b = append(b, leefAttribute.Replace(formatField(f.Attributes[key], rec))...)
+	}
+	*buf = append(b, '\n')
+}
+
+// Rec formatted with format, without the newline
+func formatField(format string, rec *LogRecord) string {
+	return strings.TrimRight(FormatLogRecord(format, rec), "\n")
+}
+
+// The keys of m, sorted
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
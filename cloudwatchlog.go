@@ -0,0 +1,294 @@
+package log4go
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The limits of a PutLogEvents call
+const (
+	cloudWatchMaxEvents  = 10000
+	cloudWatchMaxBytes   = 1048576 // of the messages, with cloudWatchOverhead each
+	cloudWatchOverhead   = 26
+	cloudWatchMaxMessage = 262144 - cloudWatchOverhead
+	cloudWatchMaxSpan    = 24 * time.Hour // between the first and last events
+)
+
+// This log writer puts batches of records into a log stream of AWS CloudWatch
+// Logs through PutLogEvents, as an agent would, signing its requests with AWS
+// Signature Version 4.
+type CloudWatchLogWriter struct {
+	httpBatcher
+
+	region string
+	group  string
+	stream string
+	create bool   // the group and stream, if missing
+	token  string // the sequence token of the next put, if known
+
+	accessKey, secretKey, sessionToken string
+}
+
+// This is the CloudWatchLogWriter's output method
+func (w *CloudWatchLogWriter) LogWrite(rec *LogRecord) {
+	w.logWrite(rec)
+}
+
+// wait for the records to be put
+func (w *CloudWatchLogWriter) Close() {
+	w.close()
+}
+
+// Flush puts the records batched so far, returning once they have been.
+func (w *CloudWatchLogWriter) Flush() {
+	w.flush()
+}
+
+// NewCloudWatchLogWriter creates a new LogWriter which puts records into the log
+// stream of the log group in region, both created if they are missing, taking
+// its credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.  Each event is the record formatted with "[%L] (%S) %M"
+// until set otherwise, at the time it was logged.
+//
+// Records are put in batches of up to 10000, or a second after the first of a
+// batch, split further to keep within the limits of PutLogEvents.
+func NewCloudWatchLogWriter(region, group, stream string, opts ...Option) *CloudWatchLogWriter {
+	w := &CloudWatchLogWriter{
+		httpBatcher:  newHTTPBatcher("CloudWatchLogWriter", "https://logs."+region+".amazonaws.com/", opts),
+		region:       region,
+		group:        group,
+		stream:       stream,
+		create:       true,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	w.format = "[%L] (%S) %M"
+	w.batchSize = cloudWatchMaxEvents
+	w.sign = func(req *http.Request, body []byte) {
+		sum := sha256.Sum256(body)
+		signAWSv4(req, hex.EncodeToString(sum[:]), "logs", w.region, w.accessKey, w.secretKey, w.sessionToken, time.Now())
+	}
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go w.run(w.send)
+
+	return w
+}
+
+type cloudWatchEvent struct {
+	Timestamp int64  `json:"timestamp"` // in milliseconds
+	Message   string `json:"message"`
+}
+
+// Put a batch, in time order, in as many calls as the limits take
+func (w *CloudWatchLogWriter) send(batch []*LogRecord) error {
+	events := make([]cloudWatchEvent, 0, len(batch))
+	for _, rec := range batch {
+		message := string(rec.Binary)
+		if rec.Binary == nil {
+			message = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+		}
+		if len(message) > cloudWatchMaxMessage {
+			message = message[:cloudWatchMaxMessage]
+			for !utf8.ValidString(message) {
+				message = message[:len(message)-1]
+			}
+		}
+		events = append(events, cloudWatchEvent{rec.Created.UnixNano() / int64(time.Millisecond), message})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp < events[j].Timestamp })
+
+	for len(events) > 0 {
+		n, size := 0, 0
+		for ; n < len(events) && n < cloudWatchMaxEvents; n++ {
+			size += len(events[n].Message) + cloudWatchOverhead
+			if n > 0 && (size > cloudWatchMaxBytes ||
+				time.Duration(events[n].Timestamp-events[0].Timestamp)*time.Millisecond >= cloudWatchMaxSpan) {
+				break
+			}
+		}
+		if err := w.put(events[:n]); err != nil {
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+// PutLogEvents, taking the sequence token CloudWatch expects, and creating the
+// group and stream if need be
+func (w *CloudWatchLogWriter) put(events []cloudWatchEvent) error {
+	created := false
+	for retried := 0; ; retried++ {
+		req := map[string]interface{}{
+			"logGroupName":  w.group,
+			"logStreamName": w.stream,
+			"logEvents":     events,
+		}
+		if w.token != "" {
+			req["sequenceToken"] = w.token
+		}
+		resp, err := w.call("PutLogEvents", req)
+		if err == nil {
+			var reply struct {
+				NextSequenceToken string `json:"nextSequenceToken"`
+			}
+			json.Unmarshal(resp, &reply)
+			w.token = reply.NextSequenceToken
+			return nil
+		}
+
+		kind, expected := cloudWatchError(err)
+		switch {
+		case kind == "DataAlreadyAcceptedException":
+			w.token = expected
+			return nil
+		case kind == "InvalidSequenceTokenException" && retried < 2:
+			w.token = expected
+			continue
+		case kind == "ResourceNotFoundException" && w.create && !created:
+			if err := w.createStream(); err != nil {
+				return err
+			}
+			created = true
+			w.token = ""
+			continue
+		}
+		return err
+	}
+}
+
+// Create the group, should it be missing, and the stream
+func (w *CloudWatchLogWriter) createStream() error {
+	if _, err := w.call("CreateLogGroup", map[string]string{"logGroupName": w.group}); err != nil {
+		if kind, _ := cloudWatchError(err); kind != "ResourceAlreadyExistsException" {
+			return err
+		}
+	}
+	if _, err := w.call("CreateLogStream", map[string]string{"logGroupName": w.group, "logStreamName": w.stream}); err != nil {
+		if kind, _ := cloudWatchError(err); kind != "ResourceAlreadyExistsException" {
+			return err
+		}
+	}
+	return nil
+}
+
+// Call action of the CloudWatch Logs API with req
+func (w *CloudWatchLogWriter) call(action string, req interface{}) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return w.postHeader(body, "application/x-amz-json-1.1", http.Header{
+		"X-Amz-Target": {"Logs_20140328." + action},
+	})
+}
+
+// The kind of an error CloudWatch replied with, e.g.
+// "InvalidSequenceTokenException", and the sequence token it expected, if any
+func cloudWatchError(err error) (kind, expected string) {
+	serr, ok := err.(*httpStatusError)
+	if !ok {
+		return "", ""
+	}
+	var reply struct {
+		Type     string `json:"__type"`
+		Expected string `json:"expectedSequenceToken"`
+	}
+	json.Unmarshal([]byte(serr.body), &reply)
+	kind = reply.Type
+	if i := strings.LastIndex(kind, "#"); i >= 0 {
+		kind = kind[i+1:]
+	}
+	return kind, reply.Expected
+}
+
+// Set the credentials to sign with (chainable).  sessionToken may be empty.
+// Must be called before the first log message is written.
+func (w *CloudWatchLogWriter) SetCredentials(accessKey, secretKey, sessionToken string) *CloudWatchLogWriter {
+	w.accessKey, w.secretKey, w.sessionToken = accessKey, secretKey, sessionToken
+	return w
+}
+
+// Set an endpoint such as "http://localhost:4566" for a VPC endpoint or an
+// emulator (chainable).  Must be called before the first log message is
+// written.
+func (w *CloudWatchLogWriter) SetEndpoint(endpoint string) *CloudWatchLogWriter {
+	w.url = strings.TrimRight(endpoint, "/") + "/"
+	return w
+}
+
+// Set whether the log group and stream are created when they are missing
+// (chainable).  The default is to create them.  Must be called before the
+// first log message is written.
+func (w *CloudWatchLogWriter) SetCreate(create bool) *CloudWatchLogWriter {
+	w.create = create
+	return w
+}
+
+// Set the logging format of the events (chainable).  Must be called before the
+// first log message is written.
+func (w *CloudWatchLogWriter) SetFormat(format string) *CloudWatchLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *CloudWatchLogWriter) SetFormatter(formatter Formatter) *CloudWatchLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the most records put at once, up to 10000, and the longest the first of
+// them waits to be put (chainable).  The default is 10000 records and a
+// second.  Must be called before the first log message is written.
+func (w *CloudWatchLogWriter) SetBatch(size int, wait time.Duration) *CloudWatchLogWriter {
+	if size > cloudWatchMaxEvents {
+		size = cloudWatchMaxEvents
+	}
+	w.batchSize, w.batchWait = size, wait
+	return w
+}
+
+// Set how many more times a call is made when CloudWatch fails or throttles,
+// and the wait before the first retry, doubling after (chainable).  The
+// default is five times, from half a second.  Must be called before the first
+// log message is written.
+func (w *CloudWatchLogWriter) SetRetry(retries int, wait time.Duration) *CloudWatchLogWriter {
+	w.maxRetries, w.retryWait = retries, wait
+	return w
+}
+
+// Set the timeout of each request (chainable).  The default is 30 seconds.
+// Must be called before the first log message is written.
+func (w *CloudWatchLogWriter) SetTimeout(timeout time.Duration) *CloudWatchLogWriter {
+	w.client.Timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time a batch cannot
+// be put (chainable).  It must not log to this writer.  Must be called before
+// the first log message is written.
+func (w *CloudWatchLogWriter) SetErrorHandler(handler func(error)) *CloudWatchLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be put
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *CloudWatchLogWriter) SetStderrFallback(fallback bool) *CloudWatchLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
@@ -3,153 +3,675 @@
 package log4go
 
 import (
+	"bytes"
 	"encoding/xml"
-	"fmt"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
 
-type xmlProperty struct {
+// The configuration of a Logger, as the files of every format set it out: the
+// XML one as it is, the YAML and JSON ones as read into it.  The lines are
+// those of the file, for messages, 0 if not known.
+type configProperty struct {
 	Name  string `xml:"name,attr"`
 	Value string `xml:",chardata"`
+
+	line int
+}
+
+type filterConfig struct {
+	Enabled  string           `xml:"enabled,attr"`
+	Tag      string           `xml:"tag"`
+	Level    string           `xml:"level"`
+	Type     string           `xml:"type"`
+	Property []configProperty `xml:"property"`
+
+	file                      string // if included, the file it is of
+	line, levelLine, typeLine int
 }
 
-type xmlFilter struct {
-	Enabled  string        `xml:"enabled,attr"`
-	Tag      string        `xml:"tag"`
-	Level    string        `xml:"level"`
-	Type     string        `xml:"type"`
-	Property []xmlProperty `xml:"property"`
+type loggerConfig struct {
+	// The files it is layered over, of any format, relative to it: their
+	// filters, but those of the tags it gives again, and then its own, and
+	// their settings, but those it gives again
+	Include []configProperty `xml:"include"`
+
+	Filter []filterConfig `xml:"filter"`
+
+	// Settings of the package, as SetAppName, SetSourceRoot, SetStacktraceLevel
+	// and SetGlobalFields make them, if given
+	AppName         string           `xml:"appname"`
+	SourceRoot      string           `xml:"sourceroot"`
+	StacktraceLevel string           `xml:"stacktracelevel"`
+	Field           []configProperty `xml:"field"`
+
+	// The levels and filters of loggers' names, as SetLoggerLevel and
+	// SetLoggerFilters set them
+	Logger []namedLoggerConfig `xml:"logger"`
+
+	stacktraceFile string
+	stacktraceLine int
 }
 
-type xmlLoggerConfig struct {
-	Filter []xmlFilter `xml:"filter"`
+type namedLoggerConfig struct {
+	Name     string   `xml:"name,attr"`
+	Additive string   `xml:"additive,attr"`
+	Level    string   `xml:"level"`
+	Filter   []string `xml:"filter"`
+
+	file            string
+	line, levelLine int
 }
 
 // Load XML configuration; see examples/example.xml for documentation
 func (log Logger) LoadConfiguration(filename string) {
 	log.Close()
 
+	r := &configReport{caller: "LoadConfiguration", filename: filename}
+	xc, ok := readConfiguration(r, "XML")
+	if !ok || !log.applyConfiguration(r, xc) {
+		os.Exit(1)
+	}
+}
+
+// Read the configuration of r's file, of the format, XML, YAML or JSON, or
+// report why it cannot be
+func readConfiguration(r *configReport, format string) (*loggerConfig, bool) {
 	// Open the configuration file
-	fd, err := os.Open(filename)
+	fd, err := os.Open(r.filename)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not open %q for reading: %s\n", filename, err)
-		os.Exit(1)
+		r.errorf(0, "", "Could not open for reading: %s", err)
+		return nil, false
 	}
+	defer fd.Close()
 
 	contents, err := ioutil.ReadAll(fd)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not read %q: %s\n", filename, err)
-		os.Exit(1)
+		r.errorf(0, "", "Could not read: %s", err)
+		return nil, false
 	}
 
-	xc := new(xmlLoggerConfig)
-	if err := xml.Unmarshal(contents, xc); err != nil {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not parse XML configuration in %q: %s\n", filename, err)
-		os.Exit(1)
+	var xc *loggerConfig
+	switch format {
+	case "XML":
+		xc = new(loggerConfig)
+		if err = xml.Unmarshal(contents, xc); err == nil {
+			xmlConfigLines(contents, xc)
+		}
+	case "YAML", "JSON":
+		var root *configNode
+		if format == "YAML" {
+			root, err = parseYAML(contents)
+		} else {
+			root, err = parseJSONConfig(contents)
+		}
+		if err == nil {
+			if xc = configFromNode(r, root); xc == nil {
+				return nil, false
+			}
+		}
+	}
+	if err != nil {
+		line, msg := 0, err.Error()
+		switch e := err.(type) {
+		case *ConfigError:
+			line, msg = e.Line, e.Message
+		case *xml.SyntaxError:
+			line, msg = e.Line, e.Msg
+		}
+		r.errorf(line, "", "Could not parse %s configuration: %s", format, msg)
+		return nil, false
 	}
+	xc.expand()
+	return r.include(xc)
+}
 
-	for _, xmlfilt := range xc.Filter {
-		var filt LogWriter
-		var lvl Level
-		bad, good, enabled := false, true, false
+// The configuration of xc over those of the files it includes, each read as
+// readConfiguration does
+func (r *configReport) include(xc *loggerConfig) (*loggerConfig, bool) {
+	if len(xc.Include) == 0 {
+		return xc, true
+	}
+	merged := new(loggerConfig)
+	for _, inc := range xc.Include {
+		filename := strings.TrimSpace(inc.Value)
+		if filename == "" {
+			r.errorf(inc.line, "", "Include of no file")
+			return nil, false
+		}
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(filepath.Dir(r.filename), filename)
+		}
+		for _, including := range append(r.including, r.filename) {
+			if sameFile(including, filename) {
+				r.errorf(inc.line, "", "Could not include %s: it includes this file", filename)
+				return nil, false
+			}
+		}
 
-		// Check required children
-		if len(xmlfilt.Enabled) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required attribute %s for filter missing in %s\n", "enabled", filename)
-			bad = true
-		} else {
-			enabled = xmlfilt.Enabled != "false"
+		including := r.filename
+		r.including, r.filename = append(r.including, including), filename
+		incxc, ok := readConfiguration(r, configFormat(filename))
+		r.including, r.filename = r.including[:len(r.including)-1], including
+		if !ok {
+			r.errorf(inc.line, "", "Could not include %s", filename)
+			return nil, false
 		}
-		if len(xmlfilt.Tag) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter missing in %s\n", "tag", filename)
-			bad = true
+		incxc.inFile(filename)
+		merged.merge(incxc)
+	}
+	own := *xc
+	own.Include = nil
+	merged.merge(&own)
+	return merged, true
+}
+
+// Whether the names are of the same file, as far as can be told
+func sameFile(a, b string) bool {
+	if absa, err := filepath.Abs(a); err == nil {
+		a = absa
+	}
+	if absb, err := filepath.Abs(b); err == nil {
+		b = absb
+	}
+	return a == b
+}
+
+// Mark what is of the included file, and not of one it includes, as of it
+func (xc *loggerConfig) inFile(filename string) {
+	for i := range xc.Filter {
+		if xc.Filter[i].file == "" {
+			xc.Filter[i].file = filename
 		}
-		if len(xmlfilt.Type) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter missing in %s\n", "type", filename)
-			bad = true
+	}
+	for i := range xc.Logger {
+		if xc.Logger[i].file == "" {
+			xc.Logger[i].file = filename
 		}
-		if len(xmlfilt.Level) == 0 {
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter missing in %s\n", "level", filename)
-			bad = true
+	}
+	if xc.stacktraceFile == "" {
+		xc.stacktraceFile = filename
+	}
+}
+
+// Layer over over xc: its filters replace those of xc of the same tags, and
+// its settings those of xc, if it gives them
+func (xc *loggerConfig) merge(over *loggerConfig) {
+	base := len(xc.Filter)
+	for _, filt := range over.Filter {
+		replaced := false
+		for i := 0; i < base && !replaced; i++ {
+			if xc.Filter[i].Tag == filt.Tag {
+				xc.Filter[i], replaced = filt, true
+			}
+		}
+		if !replaced {
+			xc.Filter = append(xc.Filter, filt)
 		}
+	}
+	if over.AppName != "" {
+		xc.AppName = over.AppName
+	}
+	if over.SourceRoot != "" {
+		xc.SourceRoot = over.SourceRoot
+	}
+	if over.StacktraceLevel != "" {
+		xc.StacktraceLevel, xc.stacktraceFile, xc.stacktraceLine = over.StacktraceLevel, over.stacktraceFile, over.stacktraceLine
+	}
+	xc.Field = append(xc.Field, over.Field...)
+	xc.Logger = append(xc.Logger, over.Logger...)
+}
 
-		switch xmlfilt.Level {
-		case "FINEST":
-			lvl = FINEST
-		case "FINE":
-			lvl = FINE
-		case "DEBUG":
-			lvl = DEBUG
-		case "TRACE":
-			lvl = TRACE
-		case "INFO":
-			lvl = INFO
-		case "WARNING":
-			lvl = WARNING
-		case "ERROR":
-			lvl = ERROR
-		case "CRITICAL":
-			lvl = CRITICAL
-		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required child <%s> for filter has unknown value in %s: %s\n", "level", filename, xmlfilt.Level)
-			bad = true
+// Set the lines of the filters, properties and settings of a configuration
+// read from the XML of contents
+func xmlConfigLines(contents []byte, xc *loggerConfig) {
+	d := xml.NewDecoder(bytes.NewReader(contents))
+	depth, filter, prop, field, logger, include := 0, -1, -1, -1, -1, -1
+	parent := ""
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			line := 1 + bytes.Count(contents[:d.InputOffset()], []byte("\n"))
+			if depth == 2 {
+				parent = t.Name.Local
+			}
+			switch {
+			case depth == 2 && t.Name.Local == "logger":
+				if logger++; logger < len(xc.Logger) {
+					xc.Logger[logger].line = line
+				}
+			case depth == 3 && parent == "logger" && t.Name.Local == "level":
+				if logger < len(xc.Logger) {
+					xc.Logger[logger].levelLine = line
+				}
+			case depth == 2 && t.Name.Local == "filter":
+				if filter, prop = filter+1, -1; filter < len(xc.Filter) {
+					xc.Filter[filter].line = line
+				}
+			case depth == 2 && t.Name.Local == "include":
+				if include++; include < len(xc.Include) {
+					xc.Include[include].line = line
+				}
+			case depth == 2 && t.Name.Local == "field":
+				if field++; field < len(xc.Field) {
+					xc.Field[field].line = line
+				}
+			case depth == 2 && t.Name.Local == "stacktracelevel":
+				xc.stacktraceLine = line
+			case depth == 3 && parent == "filter" && filter < len(xc.Filter):
+				filt := &xc.Filter[filter]
+				switch t.Name.Local {
+				case "property":
+					if prop++; prop < len(filt.Property) {
+						filt.Property[prop].line = line
+					}
+				case "level":
+					filt.levelLine = line
+				case "type":
+					filt.typeLine = line
+				}
+			}
+		case xml.EndElement:
+			depth--
 		}
+	}
+}
 
-		// Just so all of the required attributes are errored at the same time if missing
-		if bad {
-			os.Exit(1)
+// Expand the environment variables in the values of the configuration, so
+// that one file may serve every environment:
+//
+//	<property name="filename">${LOG_DIR:-/var/log}/app.log</property>
+//	<level>${LOG_LEVEL:-INFO}</level>
+func (xc *loggerConfig) expand() {
+	for i := range xc.Include {
+		xc.Include[i].Value = expandEnv(xc.Include[i].Value)
+	}
+	for i := range xc.Filter {
+		filt := &xc.Filter[i]
+		for _, value := range []*string{&filt.Enabled, &filt.Tag, &filt.Level, &filt.Type} {
+			*value = expandEnv(*value)
+		}
+		for j := range filt.Property {
+			filt.Property[j].Value = expandEnv(filt.Property[j].Value)
+		}
+	}
+	for _, value := range []*string{&xc.AppName, &xc.SourceRoot, &xc.StacktraceLevel} {
+		*value = expandEnv(*value)
+	}
+	for i := range xc.Field {
+		xc.Field[i].Value = expandEnv(xc.Field[i].Value)
+	}
+	for i := range xc.Logger {
+		l := &xc.Logger[i]
+		for _, value := range []*string{&l.Name, &l.Additive, &l.Level} {
+			*value = expandEnv(*value)
+		}
+		for j := range l.Filter {
+			l.Filter[j] = expandEnv(l.Filter[j])
 		}
+	}
+}
 
-		switch xmlfilt.Type {
-		case "console":
-			filt, good = xmlToConsoleLogWriter(filename, xmlfilt.Property, enabled)
-		case "file":
-			filt, good = xmlToFileLogWriter(filename, xmlfilt.Property, enabled)
-		case "xml":
-			filt, good = xmlToXMLLogWriter(filename, xmlfilt.Property, enabled)
-		case "socket":
-			filt, good = xmlToSocketLogWriter(filename, xmlfilt.Property, enabled)
-		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Could not load XML configuration in %s: unknown filter type \"%s\"\n", filename, xmlfilt.Type)
-			os.Exit(1)
+// Replace ${VAR} in s with the value of the environment variable, and
+// ${VAR:-fallback} with it, or the fallback if it is unset or empty; $${ is a
+// literal ${, and a $ otherwise left as it is.
+func expandEnv(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			break
 		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		name, fallback := s[i+2:i+end], ""
+		if j := strings.Index(name, ":-"); j >= 0 {
+			name, fallback = name[:j], name[j+2:]
+		}
+		if value := os.Getenv(name); value != "" {
+			b.WriteString(value)
+		} else {
+			b.WriteString(fallback)
+		}
+		s = s[i+end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// Parse the name of a level, as the configuration files give it
+func parseLevel(name string) (Level, bool) {
+	switch name {
+	case "FINEST":
+		return FINEST, true
+	case "FINE":
+		return FINE, true
+	case "DEBUG":
+		return DEBUG, true
+	case "TRACE":
+		return TRACE, true
+	case "INFO":
+		return INFO, true
+	case "WARNING":
+		return WARNING, true
+	case "ERROR":
+		return ERROR, true
+	case "CRITICAL":
+		return CRITICAL, true
+	}
+	return 0, false
+}
+
+// Add the filters of a configuration to log, and make its settings, or report
+// what is wrong with it and return false
+func (log Logger) applyConfiguration(r *configReport, xc *loggerConfig) bool {
+	if !r.check(xc) {
+		return false
+	}
+	filters, ok := buildFilters(r, xc, nil)
+	if !ok {
+		return false
+	}
+	for tag, filt := range filters {
+		log[tag] = filt
+	}
+	applySettings(xc)
+	return true
+}
+
+// Check a configuration, reporting all that is wrong with it, and return
+// whether it may be applied
+func (r *configReport) check(xc *loggerConfig) bool {
+	before := len(r.errors)
+	lines := make(map[string]int)
+	for _, filt := range xc.Filter {
+		r.in(filt.file, func() {
+			r.checkFilter(filt)
+			if filt.Enabled == "false" || filt.Tag == "" {
+				return
+			}
+			if line, dup := lines[filt.Tag]; dup {
+				r.warnf(filt.line, filt.Tag, "Filter tag given before, at line %d, is replaced", line)
+			}
+			lines[filt.Tag] = filt.line
+		})
+	}
+	if xc.StacktraceLevel != "" {
+		if _, ok := parseLevel(xc.StacktraceLevel); !ok {
+			r.in(xc.stacktraceFile, func() {
+				r.errorf(xc.stacktraceLine, "", "Stack trace level has unknown value: %s", xc.StacktraceLevel)
+			})
+		}
+	}
+	for _, l := range xc.Logger {
+		r.in(l.file, func() { r.checkLogger(xc, l) })
+	}
+	return len(r.errors) == before
+}
 
-		// Just so all of the required params are errored at the same time if wrong
-		if !good {
-			os.Exit(1)
+// Check the level and filters of a logger's name, as check does
+func (r *configReport) checkLogger(xc *loggerConfig, l namedLoggerConfig) {
+	if l.Level != "" {
+		if _, ok := parseLevel(strings.TrimSpace(l.Level)); !ok {
+			r.errorf(l.levelLine, "", "Level of logger %q has unknown value: %s", l.Name, l.Level)
+		}
+	}
+	for _, tag := range l.Filter {
+		known := false
+		for _, filt := range xc.Filter {
+			known = known || filt.Tag == strings.TrimSpace(tag)
 		}
+		if !known {
+			r.errorf(l.line, "", "Filter %q of logger %q is not configured", strings.TrimSpace(tag), l.Name)
+		}
+	}
+	if l.Additive != "" && l.Additive != "true" && l.Additive != "false" {
+		r.warnf(l.line, "", "Additive of logger %q is not true or false: %s", l.Name, l.Additive)
+	}
+}
+
+// Check a filter of a configuration, as check does
+func (r *configReport) checkFilter(xmlfilt filterConfig) {
+	bad := false
+
+	// Check required children
+	if len(xmlfilt.Enabled) == 0 {
+		r.errorf(xmlfilt.line, xmlfilt.Tag, "Required attribute %s for filter missing", "enabled")
+		bad = true
+	}
+	if len(xmlfilt.Tag) == 0 {
+		r.errorf(xmlfilt.line, xmlfilt.Tag, "Required child <%s> for filter missing", "tag")
+		bad = true
+	}
+	if len(xmlfilt.Type) == 0 {
+		r.errorf(xmlfilt.line, xmlfilt.Tag, "Required child <%s> for filter missing", "type")
+		bad = true
+	}
+	if len(xmlfilt.Level) == 0 {
+		r.errorf(xmlfilt.line, xmlfilt.Tag, "Required child <%s> for filter missing", "level")
+		bad = true
+	} else if _, ok := parseLevel(xmlfilt.Level); !ok {
+		r.errorf(xmlfilt.levelLine, xmlfilt.Tag, "Required child <%s> for filter has unknown value: %s", "level", xmlfilt.Level)
+		bad = true
+	}
+
+	// Just so all of the required attributes are errored at the same time if
+	// missing, and the properties checked once they are right
+	if !bad {
+		r.filterWriter(xmlfilt, false)
+	}
+}
+
+// The writer of a filter of a configuration, or false if it is wrong; if it is
+// not enabled, its properties are only checked
+func (r *configReport) filterWriter(xmlfilt filterConfig, enabled bool) (LogWriter, bool) {
+	switch xmlfilt.Type {
+	case "console":
+		clw, good := xmlToConsoleLogWriter(r, xmlfilt, enabled)
+		return clw, good
+	case "file":
+		flw, good := xmlToFileLogWriter(r, xmlfilt, enabled)
+		return flw, good
+	case "xml":
+		xlw, good := xmlToXMLLogWriter(r, xmlfilt, enabled)
+		return xlw, good
+	case "socket":
+		slw, good := xmlToSocketLogWriter(r, xmlfilt, enabled)
+		return slw, good
+	}
+	factory := writerFactory(xmlfilt.Type)
+	if factory == nil {
+		r.errorf(xmlfilt.typeLine, xmlfilt.Tag, "Unknown filter type %q", xmlfilt.Type)
+		return nil, false
+	}
+
+	// If it's disabled, we're just checking syntax, and its properties are the
+	// factory's to check
+	if !enabled {
+		return nil, true
+	}
+	props := make(map[string]string, len(xmlfilt.Property))
+	for _, prop := range xmlfilt.Property {
+		props[prop.Name] = strings.Trim(prop.Value, " \r\n")
+	}
+	w, err := factory(props)
+	if err == nil && w == nil {
+		err = errors.New("no writer made")
+	}
+	if err != nil {
+		r.errorf(xmlfilt.line, xmlfilt.Tag, "Could not make %s writer: %s", xmlfilt.Type, err)
+		return nil, false
+	}
+	return w, true
+}
 
+// The enabled filters of a checked configuration, by tag, or false if a writer
+// could not be made, as reported; a filter reuse gives a writer for is given
+// it, in place of a new one
+func buildFilters(r *configReport, xc *loggerConfig, reuse func(filterConfig) LogWriter) (Logger, bool) {
+	quiet := &configReport{filename: r.filename, quiet: true} // told of as checked
+	log := make(Logger)
+	var made []LogWriter
+	for _, xmlfilt := range xc.Filter {
 		// If we're disabled (syntax and correctness checks only), don't add to logger
-		if !enabled {
+		if xmlfilt.Enabled == "false" {
 			continue
 		}
+		lvl, _ := parseLevel(xmlfilt.Level)
 
+		// A writer configured as it was is kept
+		var filt LogWriter
+		if reuse != nil {
+			filt = reuse(xmlfilt)
+		}
+		if filt == nil {
+			var ok bool
+			if filt, ok = quiet.filterWriter(xmlfilt, true); !ok {
+				for _, err := range quiet.errors {
+					r.in(xmlfilt.file, func() { r.errorf(err.Line, err.Filter, "%s", err.Message) })
+				}
+				for _, filt := range made {
+					filt.Close()
+				}
+				return nil, false
+			}
+			made = append(made, filt)
+		}
 		log[xmlfilt.Tag] = &Filter{lvl, filt}
 	}
+	return log, true
+}
+
+// Make the settings of a checked configuration
+func applySettings(xc *loggerConfig) {
+	if xc.AppName != "" {
+		SetAppName(xc.AppName)
+	}
+	if xc.SourceRoot != "" {
+		SetSourceRoot(xc.SourceRoot)
+	}
+	if xc.StacktraceLevel != "" {
+		lvl, _ := parseLevel(xc.StacktraceLevel)
+		SetStacktraceLevel(lvl)
+	}
+	if len(xc.Field) > 0 {
+		SetGlobalFields(xc.fields())
+	}
+	if len(xc.Logger) > 0 {
+		setLoggers(xc.namedLoggers())
+	}
+}
+
+// The levels and filters of the loggers' names of a configuration; those
+// given none are additive, and those given filters or not additive have
+// filters set
+func (xc *loggerConfig) namedLoggers() map[string]*namedLogger {
+	byName := make(map[string]*namedLogger, len(xc.Logger))
+	for _, l := range xc.Logger {
+		named := &namedLogger{additive: l.Additive != "false"}
+		if l.Level != "" {
+			named.level, named.hasLevel = parseLevel(strings.TrimSpace(l.Level))
+		}
+		for _, tag := range l.Filter {
+			named.tags = append(named.tags, strings.TrimSpace(tag))
+		}
+		named.hasTags = len(named.tags) > 0 || !named.additive
+		byName[l.Name] = named
+	}
+	return byName
+}
+
+// The global fields of the configuration
+func (xc *loggerConfig) fields() Fields {
+	fields := make(Fields, len(xc.Field))
+	for _, field := range xc.Field {
+		fields[field.Name] = strings.Trim(field.Value, " \r\n")
+	}
+	return fields
+}
+
+// The number of a property of a filter, with K/M/G suffixes based on
+// thousands (1000) or 2^10 (1024), reporting it if it is not one
+func (r *configReport) numProperty(kind string, xmlfilt filterConfig, prop configProperty, mult int) int {
+	value := strings.Trim(prop.Value, " \r\n")
+	num, ok := strToNumSuffix(value, mult)
+	if !ok {
+		r.warnf(prop.line, xmlfilt.Tag, "Property \"%s\" for %s filter is not a number: %s", prop.Name, kind, value)
+	}
+	return num
+}
+
+// The boolean of a property of a filter, anything but false being true,
+// reporting it if it is neither
+func (r *configReport) boolProperty(kind string, xmlfilt filterConfig, prop configProperty) bool {
+	value := strings.Trim(prop.Value, " \r\n")
+	if value != "true" && value != "false" {
+		r.warnf(prop.line, xmlfilt.Tag, "Property \"%s\" for %s filter is not true or false: %s", prop.Name, kind, value)
+	}
+	return value != "false"
 }
 
-func xmlToConsoleLogWriter(filename string, props []xmlProperty, enabled bool) (*ConsoleLogWriter, bool) {
+func xmlToConsoleLogWriter(r *configReport, xmlfilt filterConfig, enabled bool) (*ConsoleLogWriter, bool) {
+	format := ""
+	var formatter configProperty
+
 	// Parse properties
-	for _, prop := range props {
+	for _, prop := range xmlfilt.Property {
 		switch prop.Name {
+		case "format":
+			format = strings.Trim(prop.Value, " \r\n")
+		case "formatter":
+			formatter = prop
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for console filter in %s\n", prop.Name, filename)
+			r.warnf(prop.line, xmlfilt.Tag, "Unknown property \"%s\" for console filter", prop.Name)
 		}
 	}
 
+	// Check properties
+	f, ok := r.configFormatter("console", xmlfilt, formatter)
+	if !ok {
+		return nil, false
+	}
+
 	// If it's disabled, we're just checking syntax
 	if !enabled {
 		return nil, true
 	}
 
-	return NewConsoleLogWriter(), true
+	clw := NewConsoleLogWriter()
+	if format != "" {
+		clw.SetFormat(format)
+	}
+	if f != nil {
+		clw.SetFormatter(f)
+	}
+	return clw, true
 }
 
-// Parse a number with K/M/G suffixes based on thousands (1000) or 2^10 (1024)
-func strToNumSuffix(str string, mult int) int {
+// Parse a number with K/M/G suffixes based on thousands (1000) or 2^10 (1024),
+// and whether it is one
+func strToNumSuffix(str string, mult int) (int, bool) {
 	num := 1
 	if len(str) > 1 {
 		switch str[len(str)-1] {
@@ -164,40 +686,47 @@ func strToNumSuffix(str string, mult int) int {
 			str = str[0 : len(str)-1]
 		}
 	}
-	parsed, _ := strconv.Atoi(str)
-	return parsed * num
+	parsed, err := strconv.Atoi(str)
+	return parsed * num, err == nil
 }
-func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*FileLogWriter, bool) {
+func xmlToFileLogWriter(r *configReport, xmlfilt filterConfig, enabled bool) (*FileLogWriter, bool) {
 	file := ""
 	format := "[%D %T] [%L] (%S) %M"
+	var formatter configProperty
 	maxlines := 0
 	maxsize := 0
 	daily := false
 	rotate := false
 
 	// Parse properties
-	for _, prop := range props {
+	for _, prop := range xmlfilt.Property {
 		switch prop.Name {
 		case "filename":
 			file = strings.Trim(prop.Value, " \r\n")
 		case "format":
 			format = strings.Trim(prop.Value, " \r\n")
+		case "formatter":
+			formatter = prop
 		case "maxlines":
-			maxlines = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+			maxlines = r.numProperty("file", xmlfilt, prop, 1000)
 		case "maxsize":
-			maxsize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+			maxsize = r.numProperty("file", xmlfilt, prop, 1024)
 		case "daily":
-			daily = strings.Trim(prop.Value, " \r\n") != "false"
+			daily = r.boolProperty("file", xmlfilt, prop)
 		case "rotate":
-			rotate = strings.Trim(prop.Value, " \r\n") != "false"
+			rotate = r.boolProperty("file", xmlfilt, prop)
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter in %s\n", prop.Name, filename)
+			r.warnf(prop.line, xmlfilt.Tag, "Unknown property \"%s\" for file filter", prop.Name)
 		}
 	}
 
 	// Check properties
 	if len(file) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for file filter missing in %s\n", "filename", filename)
+		r.errorf(xmlfilt.line, xmlfilt.Tag, "Required property \"%s\" for file filter missing", "filename")
+		return nil, false
+	}
+	f, ok := r.configFormatter("file", xmlfilt, formatter)
+	if !ok {
 		return nil, false
 	}
 
@@ -211,10 +740,31 @@ func xmlToFileLogWriter(filename string, props []xmlProperty, enabled bool) (*Fi
 	flw.SetRotateLines(maxlines)
 	flw.SetRotateSize(maxsize)
 	flw.SetRotateDaily(daily)
+	if f != nil {
+		flw.SetFormatter(f)
+	}
 	return flw, true
 }
 
-func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*FileLogWriter, bool) {
+// The formatter of the name a console or file filter's "formatter" property
+// gives, or nil, for its format, if none is
+func (r *configReport) configFormatter(kind string, xmlfilt filterConfig, prop configProperty) (Formatter, bool) {
+	switch name := strings.Trim(prop.Value, " \r\n"); name {
+	case "":
+		return nil, true
+	case "json":
+		return NewJSONFormatter(), true
+	case "logfmt":
+		return NewLogfmtFormatter(), true
+	case "protobuf":
+		return &ProtobufFormatter{}, true
+	default:
+		r.errorf(prop.line, xmlfilt.Tag, "Property \"%s\" for %s filter has unknown value: %s", "formatter", kind, name)
+	}
+	return nil, false
+}
+
+func xmlToXMLLogWriter(r *configReport, xmlfilt filterConfig, enabled bool) (*FileLogWriter, bool) {
 	file := ""
 	maxrecords := 0
 	maxsize := 0
@@ -222,26 +772,26 @@ func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*Fil
 	rotate := false
 
 	// Parse properties
-	for _, prop := range props {
+	for _, prop := range xmlfilt.Property {
 		switch prop.Name {
 		case "filename":
 			file = strings.Trim(prop.Value, " \r\n")
 		case "maxrecords":
-			maxrecords = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1000)
+			maxrecords = r.numProperty("xml", xmlfilt, prop, 1000)
 		case "maxsize":
-			maxsize = strToNumSuffix(strings.Trim(prop.Value, " \r\n"), 1024)
+			maxsize = r.numProperty("xml", xmlfilt, prop, 1024)
 		case "daily":
-			daily = strings.Trim(prop.Value, " \r\n") != "false"
+			daily = r.boolProperty("xml", xmlfilt, prop)
 		case "rotate":
-			rotate = strings.Trim(prop.Value, " \r\n") != "false"
+			rotate = r.boolProperty("xml", xmlfilt, prop)
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for xml filter in %s\n", prop.Name, filename)
+			r.warnf(prop.line, xmlfilt.Tag, "Unknown property \"%s\" for xml filter", prop.Name)
 		}
 	}
 
 	// Check properties
 	if len(file) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for xml filter missing in %s\n", "filename", filename)
+		r.errorf(xmlfilt.line, xmlfilt.Tag, "Required property \"%s\" for xml filter missing", "filename")
 		return nil, false
 	}
 
@@ -257,25 +807,33 @@ func xmlToXMLLogWriter(filename string, props []xmlProperty, enabled bool) (*Fil
 	return xlw, true
 }
 
-func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (SocketLogWriter, bool) {
+func xmlToSocketLogWriter(r *configReport, xmlfilt filterConfig, enabled bool) (*SocketLogWriter, bool) {
 	endpoint := ""
 	protocol := "udp"
+	format := ""
+	framing := ""
 
 	// Parse properties
-	for _, prop := range props {
+	for _, prop := range xmlfilt.Property {
 		switch prop.Name {
 		case "endpoint":
 			endpoint = strings.Trim(prop.Value, " \r\n")
 		case "protocol":
-			protocol = strings.Trim(prop.Value, " \r\n")
+			if protocol = strings.Trim(prop.Value, " \r\n"); protocol != "tcp" && protocol != "udp" {
+				r.warnf(prop.line, xmlfilt.Tag, "Property \"%s\" for socket filter is not tcp or udp: %s", prop.Name, protocol)
+			}
+		case "format":
+			format = strings.Trim(prop.Value, " \r\n")
+		case "framing":
+			framing = strings.Trim(prop.Value, " \r\n")
 		default:
-			fmt.Fprintf(os.Stderr, "LoadConfiguration: Warning: Unknown property \"%s\" for file filter in %s\n", prop.Name, filename)
+			r.warnf(prop.line, xmlfilt.Tag, "Unknown property \"%s\" for socket filter", prop.Name)
 		}
 	}
 
 	// Check properties
 	if len(endpoint) == 0 {
-		fmt.Fprintf(os.Stderr, "LoadConfiguration: Error: Required property \"%s\" for file filter missing in %s\n", "endpoint", filename)
+		r.errorf(xmlfilt.line, xmlfilt.Tag, "Required property \"%s\" for socket filter missing", "endpoint")
 		return nil, false
 	}
 
@@ -284,5 +842,197 @@ func xmlToSocketLogWriter(filename string, props []xmlProperty, enabled bool) (S
 		return nil, true
 	}
 
-	return NewSocketLogWriter(protocol, endpoint), true
+	slw := NewSocketLogWriter(protocol, endpoint).SetFormat(format)
+	if framing != "" {
+		slw.SetFraming(framing)
+	}
+	return slw, true
+}
+
+// A node of a configuration file of a format read as a tree, as YAML and JSON
+// are: a scalar, a mapping or a sequence
+type configNode struct {
+	line   int    // where the node starts, or 0 if not known
+	value  string // a scalar's
+	keys   []string
+	values map[string]*configNode // a mapping's, by key, the keys in order
+	items  []*configNode          // a sequence's
+	kind   configNodeKind
+}
+
+type configNodeKind int
+
+const (
+	scalarNode configNodeKind = iota
+	mappingNode
+	sequenceNode
+)
+
+// The name of n's kind, for messages
+func (n *configNode) kindName() string {
+	switch n.kind {
+	case mappingNode:
+		return "mapping"
+	case sequenceNode:
+		return "sequence"
+	}
+	return "scalar"
+}
+
+// Read the configuration of a tree: filters, a sequence of mappings of tag,
+// type, level, enabled (true if not given) and properties, a mapping; and the
+// settings app_name, source_root, stacktrace_level and fields, a mapping.
+// Unknown keys are warned of; nil if it is wrong, as reported.
+func configFromNode(r *configReport, root *configNode) *loggerConfig {
+	xc := new(loggerConfig)
+	if root.kind == scalarNode && root.value == "" {
+		return xc // empty
+	}
+	if root.kind != mappingNode {
+		r.errorf(root.line, "", "Configuration is not a mapping")
+		return nil
+	}
+	bad := false // of the wrong shape, and not just with unknown keys
+	scalar := func(key string, n *configNode) string {
+		if n.kind != scalarNode {
+			r.errorf(n.line, "", "%s is not a scalar", key)
+			bad = true
+		}
+		return n.value
+	}
+	properties := func(key string, n *configNode) []configProperty {
+		if n.kind == scalarNode && n.value == "" {
+			return nil
+		}
+		if n.kind != mappingNode {
+			r.errorf(n.line, "", "%s is not a mapping", key)
+			bad = true
+			return nil
+		}
+		props := make([]configProperty, 0, len(n.keys))
+		for _, name := range n.keys {
+			value := n.values[name]
+			props = append(props, configProperty{Name: name, Value: scalar(key+"."+name, value), line: value.line})
+		}
+		return props
+	}
+
+	for _, key := range root.keys {
+		n := root.values[key]
+		switch key {
+		case "app_name":
+			xc.AppName = scalar(key, n)
+		case "source_root":
+			xc.SourceRoot = scalar(key, n)
+		case "stacktrace_level":
+			xc.StacktraceLevel, xc.stacktraceLine = scalar(key, n), n.line
+		case "fields":
+			xc.Field = properties(key, n)
+		case "include":
+			switch n.kind {
+			case scalarNode:
+				if n.value != "" {
+					xc.Include = append(xc.Include, configProperty{Value: n.value, line: n.line})
+				}
+			case sequenceNode:
+				for _, item := range n.items {
+					xc.Include = append(xc.Include, configProperty{Value: scalar(key, item), line: item.line})
+				}
+			default:
+				r.errorf(n.line, "", "include is not a sequence")
+				bad = true
+			}
+		case "loggers":
+			if n.kind == scalarNode && n.value == "" {
+				continue
+			}
+			if n.kind != mappingNode {
+				r.errorf(n.line, "", "loggers is not a mapping")
+				bad = true
+				continue
+			}
+			for _, name := range n.keys {
+				item := n.values[name]
+				l := namedLoggerConfig{Name: name, line: item.line}
+				if item.kind == scalarNode {
+					// name: LEVEL
+					l.Level, l.levelLine = item.value, item.line
+					xc.Logger = append(xc.Logger, l)
+					continue
+				}
+				if item.kind != mappingNode {
+					r.errorf(item.line, "", "logger %q is not a mapping", name)
+					bad = true
+					continue
+				}
+				for _, key := range item.keys {
+					n := item.values[key]
+					switch key {
+					case "level":
+						l.Level, l.levelLine = scalar(key, n), n.line
+					case "additive":
+						l.Additive = scalar(key, n)
+					case "filters":
+						switch n.kind {
+						case scalarNode:
+							// filters: stdout, file
+							for _, tag := range strings.Split(n.value, ",") {
+								if tag = strings.TrimSpace(tag); tag != "" {
+									l.Filter = append(l.Filter, tag)
+								}
+							}
+						case sequenceNode:
+							for _, tag := range n.items {
+								l.Filter = append(l.Filter, scalar(key, tag))
+							}
+						default:
+							r.errorf(n.line, "", "filters of logger %q is not a sequence", name)
+							bad = true
+						}
+					default:
+						r.warnf(n.line, "", "Unknown key %q for logger", key)
+					}
+				}
+				xc.Logger = append(xc.Logger, l)
+			}
+		case "filters":
+			if n.kind != sequenceNode {
+				r.errorf(n.line, "", "filters is not a sequence")
+				bad = true
+				continue
+			}
+			for _, item := range n.items {
+				if item.kind != mappingNode {
+					r.errorf(item.line, "", "filter is not a mapping")
+					bad = true
+					continue
+				}
+				filt := filterConfig{Enabled: "true", line: item.line}
+				for _, key := range item.keys {
+					n := item.values[key]
+					switch key {
+					case "enabled":
+						filt.Enabled = scalar(key, n)
+					case "tag":
+						filt.Tag = scalar(key, n)
+					case "type":
+						filt.Type, filt.typeLine = scalar(key, n), n.line
+					case "level":
+						filt.Level, filt.levelLine = scalar(key, n), n.line
+					case "properties":
+						filt.Property = properties(key, n)
+					default:
+						r.warnf(n.line, "", "Unknown key %q for filter", key)
+					}
+				}
+				xc.Filter = append(xc.Filter, filt)
+			}
+		default:
+			r.warnf(n.line, "", "Unknown key %q", key)
+		}
+	}
+	if bad {
+		return nil
+	}
+	return xc
 }
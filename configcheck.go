@@ -0,0 +1,142 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A ConfigError is a problem with a configuration file: one it could not be
+// read for, or a filter of an unknown type, a level unknown, a property
+// missing or of a bad value, or in strict mode, one unknown.
+type ConfigError struct {
+	File    string // the configuration file
+	Line    int    // where in it, or 0 if not known
+	Filter  string // the tag of the filter it is of, if any
+	Message string
+}
+
+// Error returns the error as "file:line: filter "tag": message".
+func (e *ConfigError) Error() string {
+	where := e.File
+	if e.Line > 0 {
+		if where != "" {
+			where += ":" + strconv.Itoa(e.Line)
+		} else {
+			where = "line " + strconv.Itoa(e.Line)
+		}
+	}
+	msg := e.Message
+	if e.Filter != "" {
+		msg = fmt.Sprintf("filter %q: %s", e.Filter, msg)
+	}
+	if where == "" {
+		return msg
+	}
+	return where + ": " + msg
+}
+
+// An error at a line of a configuration file, as its file is parsed
+func configErrorf(line int, format string, args ...interface{}) error {
+	return &ConfigError{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// ConfigErrors are all the problems ValidateConfiguration or
+// LoadConfigurationStrict found with a configuration file, in its order.
+type ConfigErrors []*ConfigError
+
+// Error returns the errors, one per line.
+func (errs ConfigErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The problems found reading and checking a configuration file, told on
+// stderr as they are found unless quiet
+type configReport struct {
+	caller   string // whose messages they are
+	filename string
+	strict   bool // warnings are errors
+	quiet    bool
+	errors   ConfigErrors
+
+	including []string // the files including the one read
+}
+
+// Report as of file, if it is given, what is reported as fn runs
+func (r *configReport) in(file string, fn func()) {
+	if file == "" {
+		fn()
+		return
+	}
+	filename := r.filename
+	r.filename = file
+	defer func() { r.filename = filename }()
+	fn()
+}
+
+// Report an error
+func (r *configReport) errorf(line int, filter, format string, args ...interface{}) {
+	err := &ConfigError{File: r.filename, Line: line, Filter: filter, Message: fmt.Sprintf(format, args...)}
+	r.errors = append(r.errors, err)
+	if !r.quiet {
+		fmt.Fprintf(os.Stderr, "%s: Error: %s\n", r.caller, err)
+	}
+}
+
+// Report a warning, an error if strict
+func (r *configReport) warnf(line int, filter, format string, args ...interface{}) {
+	if r.strict {
+		r.errorf(line, filter, format, args...)
+	} else if !r.quiet {
+		err := &ConfigError{File: r.filename, Line: line, Filter: filter, Message: fmt.Sprintf(format, args...)}
+		fmt.Fprintf(os.Stderr, "%s: Warning: %s\n", r.caller, err)
+	}
+}
+
+// The errors reported, or nil if there are none
+func (r *configReport) err() error {
+	if len(r.errors) == 0 {
+		return nil
+	}
+	return r.errors
+}
+
+// ValidateConfiguration checks a configuration file, of the format of its
+// extension as for WatchConfiguration, without loading it, and returns the
+// ConfigErrors of all that is wrong with it, what LoadConfiguration would exit
+// for and what it would warn of, such as an unknown property, or a bad number,
+// or nil if it is right.
+func ValidateConfiguration(filename string) error {
+	r := &configReport{caller: "ValidateConfiguration", filename: filename, strict: true, quiet: true}
+	if xc, ok := readConfiguration(r, configFormat(filename)); ok {
+		r.check(xc)
+	}
+	return r.err()
+}
+
+// LoadConfigurationStrict loads a configuration file, of the format of its
+// extension as for WatchConfiguration, if ValidateConfiguration finds nothing
+// wrong with it, and returns the ConfigErrors it finds otherwise, leaving log
+// as it was; nothing is told on stderr, and the program never exits.
+func (log Logger) LoadConfigurationStrict(filename string) error {
+	r := &configReport{caller: "LoadConfigurationStrict", filename: filename, strict: true, quiet: true}
+	xc, ok := readConfiguration(r, configFormat(filename))
+	if !ok || !r.check(xc) || len(r.errors) > 0 {
+		return r.errors
+	}
+	filters, ok := buildFilters(r, xc, nil)
+	if !ok {
+		return r.errors
+	}
+	log.Close()
+	for tag, filt := range filters {
+		log[tag] = filt
+	}
+	applySettings(xc)
+	return nil
+}
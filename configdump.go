@@ -0,0 +1,179 @@
+package log4go
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// A Configuration is the setup a Logger is running with, as DumpConfig tells
+// it, in the keys of the JSON configuration files, with the buffer lengths of
+// the writers as well.
+type Configuration struct {
+	Filters         []FilterConfiguration               `json:"filters"`
+	AppName         string                              `json:"app_name,omitempty"`
+	SourceRoot      string                              `json:"source_root,omitempty"`
+	StacktraceLevel string                              `json:"stacktrace_level,omitempty"`
+	Fields          Fields                              `json:"fields,omitempty"`
+	Loggers         map[string]NamedLoggerConfiguration `json:"loggers,omitempty"`
+}
+
+// A FilterConfiguration is a filter of a Configuration.  The type and the
+// properties are those of the configuration files, for the writers that are
+// ConfigDumpers, and the Go type of the writer, without properties, for the
+// others.
+type FilterConfiguration struct {
+	Tag          string            `json:"tag"`
+	Type         string            `json:"type"`
+	Level        string            `json:"level"`
+	Properties   map[string]string `json:"properties,omitempty"`
+	BufferLength int               `json:"buffer_length,omitempty"` // the records held before LogWrite blocks, 0 if not known
+}
+
+// A NamedLoggerConfiguration is the level and the filters set for a name of
+// the loggers GetLogger gives, as SetLoggerLevel and SetLoggerFilters set them.
+type NamedLoggerConfiguration struct {
+	Level    string   `json:"level,omitempty"`
+	Filters  []string `json:"filters,omitempty"`
+	Additive bool     `json:"additive"`
+}
+
+// A ConfigDumper is a LogWriter that tells its type, properties and buffer
+// length for DumpConfig.
+type ConfigDumper interface {
+	DumpConfig() FilterConfiguration
+}
+
+// DumpConfig returns the configuration log is running with: its filters, at
+// their levels now, those of a ConfigWatcher as it has loaded them, and the
+// settings of the package, the loggers' names included, so that what is in
+// effect after includes, environment variables and changes made as it runs
+// may be seen, e.g. as JSON:
+//
+//	dump, _ := json.MarshalIndent(log.DumpConfig(), "", "  ")
+//	fmt.Printf("%s\n", dump)
+//
+// The filters are in the order of their tags.
+func (log Logger) DumpConfig() *Configuration {
+	dump := &Configuration{
+		AppName:    appName,
+		SourceRoot: sourceRoot,
+		Filters:    []FilterConfiguration{},
+	}
+	if stacktraceLevel <= CRITICAL {
+		dump.StacktraceLevel = levelName(stacktraceLevel)
+	}
+	if fields, _ := globalFields.fields.Load().(Fields); len(fields) > 0 {
+		dump.Fields = mergeFields(nil, fields)
+	}
+	dump.Filters = dumpFilters(log, dump.Filters)
+	sort.Slice(dump.Filters, func(i, j int) bool { return dump.Filters[i].Tag < dump.Filters[j].Tag })
+
+	loggers.RLock()
+	defer loggers.RUnlock()
+	for name, l := range loggers.byName {
+		if dump.Loggers == nil {
+			dump.Loggers = make(map[string]NamedLoggerConfiguration)
+		}
+		named := NamedLoggerConfiguration{Additive: l.additive}
+		if l.hasLevel {
+			named.Level = levelName(l.level)
+		}
+		named.Filters = append(named.Filters, l.tags...)
+		dump.Loggers[name] = named
+	}
+	return dump
+}
+
+// Add the filters of log to dump
+func dumpFilters(log Logger, dump []FilterConfiguration) []FilterConfiguration {
+	for tag, filt := range log {
+		if w, ok := filt.LogWriter.(*ConfigWatcher); ok {
+			w.rw.RLock()
+			dump = dumpFilters(w.filters, dump)
+			w.rw.RUnlock()
+			continue
+		}
+		var filtdump FilterConfiguration
+		if dumper, ok := filt.LogWriter.(ConfigDumper); ok {
+			filtdump = dumper.DumpConfig()
+		} else {
+			filtdump.Type = fmt.Sprintf("%T", filt.LogWriter)
+		}
+		filtdump.Tag, filtdump.Level = tag, levelName(filt.Level)
+		dump = append(dump, filtdump)
+	}
+	return dump
+}
+
+// The name of lvl in the configuration files
+func levelName(lvl Level) string {
+	for _, name := range []string{"FINEST", "FINE", "DEBUG", "TRACE", "INFO", "WARNING", "ERROR", "CRITICAL"} {
+		if l, _ := parseLevel(name); l == lvl {
+			return name
+		}
+	}
+	return lvl.String()
+}
+
+// Set the format of a writer as a property of dump: "formatter" if it has one,
+// by its name in the configuration files or else its Go type, or "format"
+func dumpFormat(dump *FilterConfiguration, format string, formatter Formatter) {
+	switch formatter.(type) {
+	case nil:
+		dump.Properties["format"] = format
+	case *JSONFormatter:
+		dump.Properties["formatter"] = "json"
+	case *LogfmtFormatter:
+		dump.Properties["formatter"] = "logfmt"
+	case *ProtobufFormatter:
+		dump.Properties["formatter"] = "protobuf"
+	default:
+		dump.Properties["formatter"] = fmt.Sprintf("%T", formatter)
+	}
+}
+
+// DumpConfig tells the configuration of the writer, as a console filter.
+func (c *ConsoleLogWriter) DumpConfig() FilterConfiguration {
+	dump := FilterConfiguration{Type: "console", Properties: make(map[string]string), BufferLength: cap(c.w)}
+	dumpFormat(&dump, c.format, c.formatter)
+	return dump
+}
+
+// DumpConfig tells the configuration of the writer, as a file filter, or an
+// xml one if NewXMLLogWriter made it.
+func (w *FileLogWriter) DumpConfig() FilterConfiguration {
+	dump := FilterConfiguration{Type: "file", Properties: make(map[string]string), BufferLength: cap(w.rec)}
+	dump.Properties["filename"] = w.filename
+	dump.Properties["rotate"] = strconv.FormatBool(w.rotate)
+	dump.Properties["maxsize"] = strconv.Itoa(w.maxsize)
+	dump.Properties["daily"] = strconv.FormatBool(w.daily)
+	if w.header == "<log created=\"%D %T\">" && w.trailer == "</log>" {
+		dump.Type = "xml"
+		dump.Properties["maxrecords"] = strconv.Itoa(w.maxlines)
+		return dump
+	}
+	dump.Properties["maxlines"] = strconv.Itoa(w.maxlines)
+	dumpFormat(&dump, w.format, w.formatter)
+	return dump
+}
+
+// DumpConfig tells the configuration of the writer, as a socket filter.
+func (w *SocketLogWriter) DumpConfig() FilterConfiguration {
+	dump := FilterConfiguration{Type: "socket", Properties: make(map[string]string), BufferLength: cap(w.rec)}
+	dump.Properties["endpoint"] = w.hostport
+	dump.Properties["protocol"] = w.proto
+	dump.Properties["framing"] = w.framing
+	if w.format != "" || w.formatter != nil {
+		dumpFormat(&dump, w.format, w.formatter)
+	}
+	return dump
+}
+
+// DumpConfig tells the configuration of the writer it derives from.
+func (w *derivedLogWriter) DumpConfig() FilterConfiguration {
+	if dumper, ok := w.LogWriter.(ConfigDumper); ok {
+		return dumper.DumpConfig()
+	}
+	return FilterConfiguration{Type: fmt.Sprintf("%T", w.LogWriter)}
+}
@@ -0,0 +1,203 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+)
+
+// LoadConfigurationJSON loads the configuration of a JSON file, of the same
+// filters, properties and settings as the YAML one of LoadConfigurationYAML:
+//
+//	{
+//	  "app_name": "billing",
+//	  "fields": {"service": "billing", "region": "eu-west-1"},
+//	  "filters": [
+//	    {"tag": "stdout", "type": "console", "level": "INFO",
+//	     "properties": {"formatter": "json"}},
+//	    {"tag": "file", "type": "file", "level": "FINEST",
+//	     "properties": {"filename": "app.log", "rotate": true, "maxsize": "100M"}}
+//	  ]
+//	}
+//
+// Numbers and booleans are taken as they are written, and null as empty.
+func (log Logger) LoadConfigurationJSON(filename string) {
+	log.Close()
+
+	r := &configReport{caller: "LoadConfigurationJSON", filename: filename}
+	xc, ok := readConfiguration(r, "JSON")
+	if !ok || !log.applyConfiguration(r, xc) {
+		os.Exit(1)
+	}
+}
+
+// A reader of a JSON document into a tree of configNodes, keeping the order
+// of the keys of objects and the lines of the values, which encoding/json
+// does not
+type jsonConfigParser struct {
+	data []byte
+	pos  int
+}
+
+// Parse the JSON document of contents into a tree of configNodes
+func parseJSONConfig(contents []byte) (*configNode, error) {
+	p := &jsonConfigParser{data: contents}
+	if p.skipSpace() == len(p.data) {
+		return &configNode{kind: scalarNode}, nil
+	}
+	n, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace() < len(p.data) {
+		return nil, p.errorf("unexpected %q after the document", p.data[p.pos])
+	}
+	return n, nil
+}
+
+// The line of the position
+func (p *jsonConfigParser) line() int {
+	return 1 + bytes.Count(p.data[:p.pos], []byte("\n"))
+}
+
+// An error at the position
+func (p *jsonConfigParser) errorf(format string, args ...interface{}) error {
+	return configErrorf(p.line(), format, args...)
+}
+
+// Skip white space, returning the position after it
+func (p *jsonConfigParser) skipSpace() int {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		default:
+			return p.pos
+		}
+	}
+	return p.pos
+}
+
+// Parse the value at the position
+func (p *jsonConfigParser) parseValue() (*configNode, error) {
+	if p.skipSpace() == len(p.data) {
+		return nil, p.errorf("unexpected end of JSON")
+	}
+	n := &configNode{line: p.line()}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		n.kind, n.values = mappingNode, make(map[string]*configNode)
+		p.pos++
+		if p.skipSpace() < len(p.data) && p.data[p.pos] == '}' {
+			p.pos++
+			return n, nil
+		}
+		for {
+			if p.skipSpace() == len(p.data) || p.data[p.pos] != '"' {
+				return nil, p.errorf("expected the name of a member of the object at line %d", n.line)
+			}
+			line := p.line()
+			key, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := n.values[key]; dup {
+				return nil, configErrorf(line, "duplicate key %q", key)
+			}
+			if p.skipSpace() == len(p.data) || p.data[p.pos] != ':' {
+				return nil, p.errorf("expected : after %q", key)
+			}
+			p.pos++
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			n.keys = append(n.keys, key)
+			n.values[key] = value
+			if done, err := p.separator('}'); done || err != nil {
+				return n, err
+			}
+		}
+	case c == '[':
+		n.kind = sequenceNode
+		p.pos++
+		if p.skipSpace() < len(p.data) && p.data[p.pos] == ']' {
+			p.pos++
+			return n, nil
+		}
+		for {
+			item, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+			if done, err := p.separator(']'); done || err != nil {
+				return n, err
+			}
+		}
+	case c == '"':
+		value, err := p.parseString()
+		n.value = value
+		return n, err
+	}
+
+	// A number, true, false or null, as written
+	start := p.pos
+	for p.pos < len(p.data) && bytes.IndexByte([]byte(" \t\r\n,]}"), p.data[p.pos]) < 0 {
+		p.pos++
+	}
+	literal := p.data[start:p.pos]
+	var v interface{}
+	if err := json.Unmarshal(literal, &v); err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid value %q", literal)
+	}
+	if _, isString := v.(string); isString {
+		p.pos = start
+		return nil, p.errorf("invalid value %q", literal)
+	}
+	if v != nil {
+		n.value = string(literal)
+	}
+	return n, nil
+}
+
+// Parse the string at the position
+func (p *jsonConfigParser) parseString() (string, error) {
+	start := p.pos
+	for p.pos++; p.pos < len(p.data); p.pos++ {
+		switch p.data[p.pos] {
+		case '\\':
+			p.pos++
+		case '\n':
+			p.pos = len(p.data)
+		case '"':
+			p.pos++
+			var s string
+			if err := json.Unmarshal(p.data[start:p.pos], &s); err != nil {
+				text := p.data[start:p.pos]
+				p.pos = start
+				return "", p.errorf("invalid string %s", text)
+			}
+			return s, nil
+		}
+	}
+	p.pos = start
+	return "", p.errorf("unterminated string")
+}
+
+// Read the comma after a member or element, or the closing bracket, done at
+// it
+func (p *jsonConfigParser) separator(closing byte) (done bool, err error) {
+	if p.skipSpace() < len(p.data) {
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+			return false, nil
+		case closing:
+			p.pos++
+			return true, nil
+		}
+	}
+	return true, p.errorf("expected , or %c", closing)
+}
@@ -0,0 +1,240 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often a ConfigWatcher looks for changes to its file
+var ConfigPollInterval = 2 * time.Second
+
+// A ConfigWatcher is the writer of the filter WatchConfiguration adds to a
+// Logger, which passes records to the filters of a configuration file and
+// rebuilds them as it changes.
+type ConfigWatcher struct {
+	filename, format string
+
+	rw      sync.RWMutex // held to write, and to replace the filters
+	filters Logger
+	configs map[string]filterConfig // of the filters, by tag
+
+	reload  sync.Mutex // held to reload
+	modTime time.Time
+	size    int64
+	closed  bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// WatchConfiguration loads the configuration of a file, as LoadConfiguration,
+// LoadConfigurationYAML or LoadConfigurationJSON do for its extension (.yaml or
+// .yml, .json, or any other for XML), and reloads it whenever it changes, as
+// it is looked at every ConfigPollInterval, so that a level changed from INFO
+// to DEBUG takes effect without a restart.  Reload reloads it at once, e.g. on
+// SIGHUP:
+//
+//	watcher := log.WatchConfiguration("log.yaml")
+//	c := make(chan os.Signal, 1)
+//	signal.Notify(c, syscall.SIGHUP)
+//	go func() {
+//		for range c {
+//			watcher.Reload()
+//		}
+//	}()
+//
+// The filters of the file are replaced at once, between records, the writers
+// of those configured as they were kept at their new levels and the others
+// closed once the new ones are in place.  A configuration that is wrong is
+// told of and the one before it kept; once loaded, it must be right, or the
+// program exits, as for LoadConfiguration.  The global fields and the levels
+// and filters of the loggers' names are set again on each reload, if the file
+// gives them; the other settings are made only once, as they must be before
+// the first log message is written.
+//
+// Only the file itself is watched: the files it includes are read again as
+// it is reloaded.
+//
+// The Logger gets the one filter of the watcher, under the name of the file,
+// at FINEST, since its levels may change; closing it stops the watching.
+func (log Logger) WatchConfiguration(filename string) *ConfigWatcher {
+	log.Close()
+
+	w := &ConfigWatcher{
+		filename: filename,
+		format:   configFormat(filename),
+		done:     make(chan struct{}),
+	}
+	if info, err := os.Stat(filename); err == nil {
+		w.modTime, w.size = info.ModTime(), info.Size()
+	}
+	r := &configReport{caller: "WatchConfiguration", filename: filename}
+	xc, ok := readConfiguration(r, w.format)
+	w.filters = make(Logger)
+	if !ok || !w.filters.applyConfiguration(r, xc) {
+		os.Exit(1)
+	}
+	w.configs = filterConfigs(xc)
+
+	log[filename] = &Filter{FINEST, w}
+	w.wg.Add(1)
+	go w.watch()
+	return w
+}
+
+// The format of a configuration file, by its extension
+func configFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return "YAML"
+	case ".json":
+		return "JSON"
+	}
+	return "XML"
+}
+
+// The enabled filters of a configuration, by tag
+func filterConfigs(xc *loggerConfig) map[string]filterConfig {
+	configs := make(map[string]filterConfig, len(xc.Filter))
+	for _, filt := range xc.Filter {
+		if filt.Enabled != "false" {
+			configs[filt.Tag] = filt
+		}
+	}
+	return configs
+}
+
+// Whether the properties are the same, wherever they are
+func sameProperties(a, b []configProperty) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// Look for changes to the file every ConfigPollInterval, until closed
+func (w *ConfigWatcher) watch() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(ConfigPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(w.filename)
+		if err != nil {
+			continue // perhaps being replaced
+		}
+		w.reload.Lock()
+		changed := !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+		w.reload.Unlock()
+		if changed {
+			w.Reload()
+		}
+	}
+}
+
+// Reload reloads the configuration file now, and returns whether it could be:
+// if it is wrong, it is told of on stderr and the configuration before it
+// kept.
+func (w *ConfigWatcher) Reload() bool {
+	w.reload.Lock()
+	defer w.reload.Unlock()
+	if w.closed {
+		return false
+	}
+	if info, err := os.Stat(w.filename); err == nil {
+		w.modTime, w.size = info.ModTime(), info.Size()
+	}
+
+	r := &configReport{caller: "WatchConfiguration", filename: w.filename}
+	xc, ok := readConfiguration(r, w.format)
+	if !ok || !r.check(xc) {
+		fmt.Fprintf(os.Stderr, "WatchConfiguration: Error: Could not reload %q; keeping the configuration loaded before\n", w.filename)
+		return false
+	}
+
+	// Filters configured as they were keep their writers
+	kept := make(map[LogWriter]bool)
+	reuse := func(filt filterConfig) LogWriter {
+		old, ok := w.configs[filt.Tag]
+		if !ok || old.Type != filt.Type || !sameProperties(old.Property, filt.Property) {
+			return nil
+		}
+		writer := w.filters[filt.Tag].LogWriter
+		kept[writer] = true
+		return writer
+	}
+	filters, ok := buildFilters(r, xc, reuse)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "WatchConfiguration: Error: Could not reload %q; keeping the configuration loaded before\n", w.filename)
+		return false
+	}
+	if len(xc.Field) > 0 {
+		SetGlobalFields(xc.fields())
+	}
+	if len(xc.Logger) > 0 {
+		setLoggers(xc.namedLoggers())
+	}
+
+	w.rw.Lock()
+	old := w.filters
+	w.filters, w.configs = filters, filterConfigs(xc)
+	w.rw.Unlock()
+	for _, filt := range old {
+		if !kept[filt.LogWriter] {
+			filt.Close()
+		}
+	}
+	return true
+}
+
+// LogWrite passes rec to the filters of the configuration at its level.
+func (w *ConfigWatcher) LogWrite(rec *LogRecord) {
+	w.rw.RLock()
+	defer w.rw.RUnlock()
+	for _, filt := range w.filters {
+		if rec.Level >= filt.Level {
+			filt.LogWrite(rec)
+		}
+	}
+}
+
+// routeRecord passes rec to the filters of the configuration it goes to.
+func (w *ConfigWatcher) routeRecord(rec *LogRecord, writes func(tag string, lvl Level) bool) {
+	w.rw.RLock()
+	defer w.rw.RUnlock()
+	for tag, filt := range w.filters {
+		if writes(tag, filt.Level) {
+			filt.LogWrite(rec)
+		}
+	}
+}
+
+// Close stops the watching and closes the writers of the configuration.
+func (w *ConfigWatcher) Close() {
+	w.reload.Lock()
+	if w.closed {
+		w.reload.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.done)
+	w.reload.Unlock()
+	w.wg.Wait()
+
+	w.rw.Lock()
+	defer w.rw.Unlock()
+	w.filters.Close()
+}
@@ -0,0 +1,496 @@
+package log4go
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadConfigurationYAML loads the configuration of a YAML file, of the same
+// filters and properties as the XML one of LoadConfiguration (see
+// examples/example.xml), and the settings of the package:
+//
+//	app_name: billing
+//	stacktrace_level: ERROR
+//	fields: {service: billing, region: eu-west-1}
+//	filters:
+//	  - tag: stdout
+//	    type: console
+//	    level: INFO
+//	    properties:
+//	      formatter: json
+//	  - tag: file
+//	    type: file
+//	    level: FINEST
+//	    properties:
+//	      filename: app.log
+//	      format: "[%D %T] [%L] (%S) %M"
+//	      rotate: true
+//	      maxsize: 100M
+//	      daily: true
+//	loggers:
+//	  myapp.storage: DEBUG
+//	  myapp.storage.s3: {level: TRACE, filters: [file], additive: false}
+//
+// A filter is enabled unless it says "enabled: false", and its properties
+// are those of its type's XML filter, plus "formatter", of json, logfmt or
+// protobuf, for a console or file filter.  The loggers are the levels and
+// filters of the names GetLogger gives loggers of, and
+// "include: base.yaml", or a sequence, layers the file over others, as
+// <include> does in XML.  The YAML read is that of
+// configuration files: block and one-line flow mappings and sequences, plain
+// and quoted scalars, literal and folded block scalars and comments; anchors,
+// aliases, tags and documents after the first are not supported.
+func (log Logger) LoadConfigurationYAML(filename string) {
+	log.Close()
+
+	r := &configReport{caller: "LoadConfigurationYAML", filename: filename}
+	xc, ok := readConfiguration(r, "YAML")
+	if !ok || !log.applyConfiguration(r, xc) {
+		os.Exit(1)
+	}
+}
+
+// A line of a YAML file
+type yamlLine struct {
+	num    int    // from 1
+	indent int    // the spaces before text
+	text   string // without its indentation, comment and trailing space; empty if blank
+	raw    string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// Parse the YAML document of contents into a tree of configNodes, an empty
+// document being an empty scalar
+func parseYAML(contents []byte) (*configNode, error) {
+	p := new(yamlParser)
+	started := false
+	for i, raw := range strings.Split(strings.Replace(string(contents), "\r\n", "\n", -1), "\n") {
+		text := strings.TrimLeft(raw, " ")
+		line := yamlLine{num: i + 1, indent: len(raw) - len(text), raw: raw}
+		line.text = strings.TrimRight(stripYAMLComment(text), " \t")
+		if strings.HasPrefix(line.text, "\t") {
+			return nil, configErrorf(line.num, "tabs are not allowed in indentation")
+		}
+		if line.indent == 0 && !started && strings.HasPrefix(line.text, "%") {
+			line.text = "" // a directive
+		}
+		if line.indent == 0 && (line.text == "---" || line.text == "...") {
+			if line.text == "---" && started {
+				return nil, configErrorf(line.num, "only one document is supported")
+			}
+			started = true
+			line.text = ""
+		}
+		started = started || line.text != ""
+		p.lines = append(p.lines, line)
+	}
+
+	line := p.next()
+	if line == nil {
+		return &configNode{kind: scalarNode}, nil
+	}
+	root, err := p.parseNode(line.indent)
+	if err != nil {
+		return nil, err
+	}
+	if line := p.next(); line != nil {
+		return nil, configErrorf(line.num, "unexpected content after the document's %s", root.kindName())
+	}
+	return root, nil
+}
+
+// The text of a YAML line without its comment, a # at its start or after a
+// space, outside quotes
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" [{,", text[i-1]) >= 0):
+			quote = c
+		}
+	}
+	return text
+}
+
+// The next line that is not blank, or nil at the end
+func (p *yamlParser) next() *yamlLine {
+	for ; p.pos < len(p.lines); p.pos++ {
+		if p.lines[p.pos].text != "" {
+			return &p.lines[p.pos]
+		}
+	}
+	return nil
+}
+
+// Whether text is an item of a block sequence
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// Parse the node of the next lines indented at least indent, an empty scalar
+// if there are none
+func (p *yamlParser) parseNode(indent int) (*configNode, error) {
+	line := p.next()
+	if line == nil || line.indent < indent {
+		return &configNode{kind: scalarNode}, nil
+	}
+	if isYAMLItem(line.text) {
+		return p.parseSequence(line.indent)
+	}
+	if _, _, ok, err := splitYAMLKey(line); ok || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return p.parseMapping(line.indent)
+	}
+	p.pos++
+	n, err := parseYAMLValue(line, line.text)
+	if err != nil {
+		return nil, err
+	}
+	if next := p.next(); next != nil && next.indent > line.indent {
+		return nil, configErrorf(next.num, "multi-line plain scalars are not supported; quote the value or use | or >")
+	}
+	return n, nil
+}
+
+// Parse a block sequence of items indented by indent
+func (p *yamlParser) parseSequence(indent int) (*configNode, error) {
+	seq := &configNode{kind: sequenceNode, line: p.next().num}
+	for {
+		line := p.next()
+		if line == nil || line.indent < indent || line.indent == indent && !isYAMLItem(line.text) {
+			return seq, nil // the sequence may be the value of a key indented as it is
+		}
+		if line.indent > indent {
+			return nil, configErrorf(line.num, "expected an item of the sequence at line %d", seq.line)
+		}
+		var item *configNode
+		var err error
+		if rest := strings.TrimLeft(line.text[1:], " "); rest == "" {
+			p.pos++
+			item, err = p.parseNode(indent + 1)
+		} else {
+			// The rest of the line is the item's first, indented as it is
+			line.indent += len(line.text) - len(rest)
+			line.text = rest
+			item, err = p.parseNode(line.indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq.items = append(seq.items, item)
+	}
+}
+
+// Parse a block mapping of keys indented by indent
+func (p *yamlParser) parseMapping(indent int) (*configNode, error) {
+	m := &configNode{kind: mappingNode, line: p.next().num, values: make(map[string]*configNode)}
+	for {
+		line := p.next()
+		if line == nil || line.indent < indent {
+			return m, nil
+		}
+		if line.indent > indent {
+			return nil, configErrorf(line.num, "unexpected indentation")
+		}
+		key, rest, ok, err := splitYAMLKey(line)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, configErrorf(line.num, "expected a key of the mapping at line %d", m.line)
+		}
+		if _, dup := m.values[key]; dup {
+			return nil, configErrorf(line.num, "duplicate key %q", key)
+		}
+		p.pos++
+
+		var value *configNode
+		switch {
+		case rest == "":
+			// A sequence may be indented as its key is
+			if next := p.next(); next != nil && next.indent == indent && isYAMLItem(next.text) {
+				value, err = p.parseSequence(indent)
+			} else {
+				value, err = p.parseNode(indent + 1)
+			}
+			if err == nil && value.line == 0 {
+				value.line = line.num
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			value, err = p.parseBlockScalar(line, rest, indent)
+		default:
+			value, err = parseYAMLValue(line, rest)
+			if next := p.next(); err == nil && next != nil && next.indent > indent {
+				err = configErrorf(next.num, "unexpected indentation; quote a multi-line value or use | or >")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.keys = append(m.keys, key)
+		m.values[key] = value
+	}
+}
+
+// Split a line of a mapping into its key and the rest of it, after the colon;
+// ok is false if it is not one
+func splitYAMLKey(line *yamlLine) (key, rest string, ok bool, err error) {
+	text := line.text
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", false, configErrorf(line.num, "unterminated quoted string")
+		}
+		after := strings.TrimLeft(text[end+1:], " ")
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false, nil
+		}
+		n, err := parseYAMLScalar(line, text[:end+1])
+		if err != nil {
+			return "", "", false, err
+		}
+		return n.value, strings.TrimLeft(after[1:], " "), true, nil
+	}
+	if text[0] == '[' || text[0] == '{' {
+		return "", "", false, nil
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false, nil
+		}
+		i = len(text) - 1
+	}
+	return strings.TrimRight(text[:i], " "), strings.TrimLeft(text[i+1:], " "), true, nil
+}
+
+// The index of the quote closing the string text starts with, or -1
+func closingQuote(text string) int {
+	for i := 1; i < len(text); i++ {
+		switch {
+		case text[0] == '"' && text[i] == '\\':
+			i++
+		case text[i] == text[0]:
+			if text[0] == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+				i++ // '' is a quote
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// Parse the value of an entry or item given on its line: a flow collection or
+// a scalar
+func parseYAMLValue(line *yamlLine, text string) (*configNode, error) {
+	if text[0] != '[' && text[0] != '{' {
+		return parseYAMLScalar(line, text)
+	}
+	n, rest, err := parseYAMLFlow(line, text)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return nil, configErrorf(line.num, "unexpected %q after the flow collection", rest)
+	}
+	return n, nil
+}
+
+// Parse a scalar, plain or quoted
+func parseYAMLScalar(line *yamlLine, text string) (*configNode, error) {
+	n := &configNode{kind: scalarNode, line: line.num}
+	switch text[0] {
+	case '"':
+		if closingQuote(text) != len(text)-1 {
+			return nil, configErrorf(line.num, "bad quoted string %s", text)
+		}
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, configErrorf(line.num, "bad quoted string %s: %s", text, err)
+		}
+		n.value = value
+	case '\'':
+		if closingQuote(text) != len(text)-1 {
+			return nil, configErrorf(line.num, "bad quoted string %s", text)
+		}
+		n.value = strings.Replace(text[1:len(text)-1], "''", "'", -1)
+	case '&', '*', '!':
+		return nil, configErrorf(line.num, "anchors, aliases and tags are not supported")
+	case '@', '`':
+		return nil, configErrorf(line.num, "%q is reserved and cannot start a plain scalar", text[0])
+	default:
+		if text != "~" && text != "null" && text != "Null" && text != "NULL" {
+			n.value = text
+		}
+	}
+	return n, nil
+}
+
+// Parse the flow collection or scalar text starts with, returning the rest
+func parseYAMLFlow(line *yamlLine, text string) (*configNode, string, error) {
+	text = strings.TrimLeft(text, " ")
+	if text == "" {
+		return nil, "", configErrorf(line.num, "unterminated flow collection")
+	}
+	switch text[0] {
+	case '[':
+		seq := &configNode{kind: sequenceNode, line: line.num}
+		text = strings.TrimLeft(text[1:], " ")
+		for {
+			if strings.HasPrefix(text, "]") {
+				return seq, text[1:], nil
+			}
+			item, rest, err := parseYAMLFlow(line, text)
+			if err != nil {
+				return nil, "", err
+			}
+			seq.items = append(seq.items, item)
+			if text, err = flowSeparator(line, rest, ']'); err != nil {
+				return nil, "", err
+			}
+		}
+	case '{':
+		m := &configNode{kind: mappingNode, line: line.num, values: make(map[string]*configNode)}
+		text = strings.TrimLeft(text[1:], " ")
+		for {
+			if strings.HasPrefix(text, "}") {
+				return m, text[1:], nil
+			}
+			key, rest, err := parseYAMLFlow(line, text)
+			if err != nil {
+				return nil, "", err
+			}
+			if key.kind != scalarNode {
+				return nil, "", configErrorf(line.num, "the keys of a mapping must be scalars")
+			}
+			value := &configNode{kind: scalarNode, line: line.num}
+			if rest = strings.TrimLeft(rest, " "); strings.HasPrefix(rest, ":") {
+				if value, rest, err = parseYAMLFlow(line, rest[1:]); err != nil {
+					return nil, "", err
+				}
+			}
+			if _, dup := m.values[key.value]; dup {
+				return nil, "", configErrorf(line.num, "duplicate key %q", key.value)
+			}
+			m.keys = append(m.keys, key.value)
+			m.values[key.value] = value
+			if text, err = flowSeparator(line, rest, '}'); err != nil {
+				return nil, "", err
+			}
+		}
+	case '"', '\'':
+		end := closingQuote(text)
+		if end < 0 {
+			return nil, "", configErrorf(line.num, "unterminated quoted string")
+		}
+		n, err := parseYAMLScalar(line, text[:end+1])
+		return n, text[end+1:], err
+	}
+	// A plain scalar, up to an indicator of the flow
+	end := len(text)
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; c == ',' || c == ']' || c == '}' || c == ':' && (i+1 == len(text) || strings.IndexByte(" ,]}", text[i+1]) >= 0) {
+			end = i
+			break
+		}
+	}
+	plain := strings.TrimRight(text[:end], " ")
+	if plain == "" {
+		return &configNode{kind: scalarNode, line: line.num}, text[end:], nil
+	}
+	n, err := parseYAMLScalar(line, plain)
+	return n, text[end:], err
+}
+
+// The rest of a flow collection after an item: after its comma, or at its
+// closing bracket
+func flowSeparator(line *yamlLine, rest string, closing byte) (string, error) {
+	rest = strings.TrimLeft(rest, " ")
+	switch {
+	case strings.HasPrefix(rest, ","):
+		return strings.TrimLeft(rest[1:], " "), nil
+	case rest == "":
+		return "", configErrorf(line.num, "unterminated flow collection")
+	case rest[0] == closing:
+		return rest, nil
+	}
+	return "", configErrorf(line.num, "expected , or %c in the flow collection", closing)
+}
+
+// Parse the literal (|) or folded (>) block scalar of header, after the key
+// of line, indented by indent, of the lines after it indented further
+func (p *yamlParser) parseBlockScalar(line *yamlLine, header string, indent int) (*configNode, error) {
+	chomp := header[1:]
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, configErrorf(line.num, "unsupported block scalar header %q", header)
+	}
+
+	// The lines indented further, or blank, which are its text, by the
+	// indentation of the first
+	var text []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		raw := p.lines[p.pos].raw
+		content := strings.TrimLeft(raw, " ")
+		if content == "" {
+			text = append(text, "")
+			continue
+		}
+		if n := len(raw) - len(content); n <= indent || blockIndent >= 0 && n < blockIndent {
+			break
+		} else if blockIndent < 0 {
+			blockIndent = n
+		}
+		text = append(text, raw[blockIndent:])
+	}
+
+	// Its trailing blank lines are chomped, and may be part of the next
+	trailing := 0
+	for trailing < len(text) && text[len(text)-1-trailing] == "" {
+		trailing++
+	}
+	text = text[:len(text)-trailing]
+	p.pos -= trailing
+
+	var value string
+	if header[0] == '|' {
+		value = strings.Join(text, "\n")
+	} else {
+		for i, t := range text {
+			switch {
+			case i == 0, text[i-1] == "":
+			case t == "":
+				value += "\n"
+			default:
+				value += " "
+			}
+			value += t
+		}
+	}
+	if len(text) > 0 {
+		switch chomp {
+		case "":
+			value += "\n"
+		case "+":
+			value += strings.Repeat("\n", 1+trailing)
+		}
+	}
+	return &configNode{kind: scalarNode, line: line.num, value: value}, nil
+}
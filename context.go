@@ -0,0 +1,456 @@
+package log4go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	loggerKey struct{}
+	fieldsKey struct{}
+)
+
+// The functions AddContextFields has added
+var contextExtractors []func(ctx context.Context) Fields
+
+// NewContext returns a copy of ctx carrying log, for FromContext and the
+// package's Ctx functions to log with down the call stack.
+func NewContext(ctx context.Context, log Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// ContextWithFields returns a copy of ctx carrying fields, e.g. a request's
+// trace and request IDs, on top of those ctx carries already, for records
+// logged with it by the Ctx functions or a Logger FromContext.
+func ContextWithFields(ctx context.Context, fields Fields) context.Context {
+	merged := make(Fields)
+	if bound, ok := ctx.Value(fieldsKey{}).(Fields); ok {
+		for name, value := range bound {
+			merged[name] = value
+		}
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// AddContextFields adds a function taking fields from a context, for values
+// other packages put in it, such as an OpenTelemetry span's trace ID.  Its
+// fields are overridden by those of ContextWithFields.  Must be called before
+// the first log message is written.
+func AddContextFields(extract func(ctx context.Context) Fields) {
+	contextExtractors = append(contextExtractors, extract)
+}
+
+// FromContext returns the Logger ctx carries, or Global if none, With the
+// fields of ctx.
+func FromContext(ctx context.Context) Logger {
+	log := contextLogger(ctx)
+	if fields := contextFields(ctx); len(fields) > 0 {
+		return log.With(fields)
+	}
+	return log
+}
+
+// The Logger ctx carries, or Global
+func contextLogger(ctx context.Context) Logger {
+	if log, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return log
+	}
+	return Global
+}
+
+// The fields of ctx, from the functions AddContextFields added and
+// ContextWithFields
+func contextFields(ctx context.Context) Fields {
+	var fields Fields
+	add := func(f Fields) {
+		if len(f) == 0 {
+			return
+		}
+		if fields == nil {
+			fields = make(Fields, len(f))
+		}
+		for name, value := range f {
+			fields[name] = value
+		}
+	}
+	for _, extract := range contextExtractors {
+		add(extract(ctx))
+	}
+	bound, _ := ctx.Value(fieldsKey{}).(Fields)
+	add(bound)
+	return fields
+}
+
+// Args with the fields of ctx ahead of them, for their own to override
+func withContextFields(ctx context.Context, args []interface{}) []interface{} {
+	fields := contextFields(ctx)
+	if len(fields) == 0 {
+		return args
+	}
+	return append([]interface{}{fields}, args...)
+}
+
+// FinestCtx logs a message at the finest log level, with the fields of ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = FINEST
+	)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// FineCtx logs a message at the fine log level, with the fields of ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = FINE
+	)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// DebugCtx logs a message at the debug log level, with the fields of ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = DEBUG
+	)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// TraceCtx logs a message at the trace log level, with the fields of ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = TRACE
+	)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// InfoCtx logs a message at the info log level, with the fields of ctx.
+// See Debug for an explanation of the arguments.
+func (log Logger) InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = INFO
+	)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// WarnCtx logs a message at the warning log level, with the fields of ctx, and
+// returns the formatted error.  See Warn for an explanation of the performance
+// and Debug for an explanation of the parameters.
+func (log Logger) WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = WARNING
+	)
+	args, fields := splitFields(withContextFields(ctx, args))
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	log.intLogf(lvl, msg, fields)
+	return errors.New(msg)
+}
+
+// ErrorCtx logs a message at the error log level, with the fields of ctx, and
+// returns the formatted error.  See Warn for an explanation of the performance
+// and Debug for an explanation of the parameters.
+func (log Logger) ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = ERROR
+	)
+	args, fields := splitFields(withContextFields(ctx, args))
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	log.intLogf(lvl, msg, fields)
+	return errors.New(msg)
+}
+
+// CriticalCtx logs a message at the critical log level, with the fields of ctx, and
+// returns the formatted error.  See Warn for an explanation of the performance
+// and Debug for an explanation of the parameters.
+func (log Logger) CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = CRITICAL
+	)
+	args, fields := splitFields(withContextFields(ctx, args))
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	log.intLogf(lvl, msg, fields)
+	return errors.New(msg)
+}
+
+// FinestCtx logs a message at the finest log level with the Logger of ctx, or
+// Global, and the fields of ctx.  See Debug for an explanation of the
+// arguments.
+func FinestCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = FINEST
+	)
+	log := contextLogger(ctx)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// FineCtx logs a message at the fine log level with the Logger of ctx, or
+// Global, and the fields of ctx.  See Debug for an explanation of the
+// arguments.
+func FineCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = FINE
+	)
+	log := contextLogger(ctx)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// DebugCtx logs a message at the debug log level with the Logger of ctx, or
+// Global, and the fields of ctx.  See Debug for an explanation of the
+// arguments.
+func DebugCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = DEBUG
+	)
+	log := contextLogger(ctx)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// TraceCtx logs a message at the trace log level with the Logger of ctx, or
+// Global, and the fields of ctx.  See Debug for an explanation of the
+// arguments.
+func TraceCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = TRACE
+	)
+	log := contextLogger(ctx)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// InfoCtx logs a message at the info log level with the Logger of ctx, or
+// Global, and the fields of ctx.  See Debug for an explanation of the
+// arguments.
+func InfoCtx(ctx context.Context, arg0 interface{}, args ...interface{}) {
+	const (
+		lvl = INFO
+	)
+	log := contextLogger(ctx)
+	args = withContextFields(ctx, args)
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		log.intLogf(lvl, first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
+	default:
+		// Build a format string so that it will be similar to Sprint
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
+	}
+}
+
+// WarnCtx logs a message at the warning log level with the Logger of ctx, or
+// Global, and the fields of ctx, and returns the formatted error.  See Warn
+// for an explanation of the performance and Debug for an explanation of the
+// parameters.
+func WarnCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = WARNING
+	)
+	log := contextLogger(ctx)
+	args, fields := splitFields(withContextFields(ctx, args))
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	log.intLogf(lvl, msg, fields)
+	return errors.New(msg)
+}
+
+// ErrorCtx logs a message at the error log level with the Logger of ctx, or
+// Global, and the fields of ctx, and returns the formatted error.  See Warn
+// for an explanation of the performance and Debug for an explanation of the
+// parameters.
+func ErrorCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = ERROR
+	)
+	log := contextLogger(ctx)
+	args, fields := splitFields(withContextFields(ctx, args))
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	log.intLogf(lvl, msg, fields)
+	return errors.New(msg)
+}
+
+// CriticalCtx logs a message at the critical log level with the Logger of ctx, or
+// Global, and the fields of ctx, and returns the formatted error.  See Warn
+// for an explanation of the performance and Debug for an explanation of the
+// parameters.
+func CriticalCtx(ctx context.Context, arg0 interface{}, args ...interface{}) error {
+	const (
+		lvl = CRITICAL
+	)
+	log := contextLogger(ctx)
+	args, fields := splitFields(withContextFields(ctx, args))
+	var msg string
+	switch first := arg0.(type) {
+	case string:
+		// Use the string as a format string
+		msg = fmt.Sprintf(first, args...)
+	case func() string:
+		// Log the closure (of the other arguments, only Fields used)
+		msg = first()
+	default:
+		// Build a format string so that it will be similar to Sprint
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+	}
+	log.intLogf(lvl, msg, fields)
+	return errors.New(msg)
+}
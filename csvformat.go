@@ -0,0 +1,47 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+)
+
+// A CSVFormatter writes each record as a row of comma separated values, quoted
+// as RFC 4180 has it, for spreadsheets and COPY ... WITH (FORMAT csv):
+//
+//	f := NewCSVFormatter("%D %T", "%L", "%S", "%M")
+//	w := NewFileLogWriter("app.csv", false).SetHeadFoot("time,level,source,message", "")
+//	w.SetFormatter(f)
+//
+// Set its Comma to '\t' for tab separated values.
+type CSVFormatter struct {
+	// The format of each column, in order, as for FormatLogRecord
+	Columns []string
+
+	Comma   rune // between the columns
+	UseCRLF bool // to end the rows, rather than a newline
+}
+
+// NewCSVFormatter creates a new CSVFormatter with a column for each of
+// columns, separated by commas.
+func NewCSVFormatter(columns ...string) *CSVFormatter {
+	return &CSVFormatter{
+		Columns: columns,
+		Comma:   ',',
+	}
+}
+
+// Format appends rec to *buf as a row.
+func (f *CSVFormatter) Format(rec *LogRecord, buf *[]byte) {
+	row := make([]string, len(f.Columns))
+	for i, column := range f.Columns {
+		row[i] = strings.TrimRight(FormatLogRecord(column, rec), "\n")
+	}
+
+	out := bytes.NewBuffer(*buf)
+	w := csv.NewWriter(out)
+	w.Comma, w.UseCRLF = f.Comma, f.UseCRLF
+	w.Write(row)
+	w.Flush()
+	*buf = out.Bytes()
+}
@@ -0,0 +1,271 @@
+package log4go
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// This log writer inserts batches of records into a table through
+// database/sql, a transaction each, for PostgreSQL, MySQL or SQLite with the
+// driver of the application's choosing.
+type DBLogWriter struct {
+	httpBatcher
+
+	db      *sql.DB
+	dialect string   // "postgres", "mysql" or "sqlite"
+	table   string   // name, as is
+	columns []string // for the time, level, source and message
+	create  bool     // the table, if need be
+	insert  *sql.Stmt
+
+	// the SQLiteLogWriter's table: the time (in nanoseconds) and level stored
+	// as numbers, to be queried, with an index on each column but the message
+	numeric bool
+
+	maxAge     time.Duration // of the rows kept, if set
+	pruneEvery time.Duration
+	prunedAt   time.Time
+}
+
+// This is the DBLogWriter's output method
+func (w *DBLogWriter) LogWrite(rec *LogRecord) {
+	w.logWrite(rec)
+}
+
+// wait for the records to be inserted.  The database is left open.
+func (w *DBLogWriter) Close() {
+	w.close()
+}
+
+// Flush inserts the records batched so far, returning once they have been.
+func (w *DBLogWriter) Flush() {
+	w.flush()
+}
+
+// NewDBLogWriter creates a new LogWriter which inserts records into table in
+// db, whose driver is of dialect: "postgres", "mysql" or "sqlite".  The table
+// has the columns created, level, source and message, the record formatted
+// with "%M" until set otherwise; sources longer than the 255 characters of
+// their column are cut to fit, but for SQLite.  It returns nil for an unknown
+// dialect.
+//
+// Records are inserted in batches of up to 1000, or a second after the first
+// of a batch.
+func NewDBLogWriter(db *sql.DB, dialect, table string, opts ...Option) *DBLogWriter {
+	switch dialect {
+	case "postgres", "mysql", "sqlite":
+	default:
+		fmt.Fprintf(os.Stderr, "NewDBLogWriter(%q): unknown dialect %q\n", table, dialect)
+		return nil
+	}
+
+	w := &DBLogWriter{
+		httpBatcher: newHTTPBatcher("DBLogWriter", table, opts),
+		db:          db,
+		dialect:     dialect,
+		table:       table,
+		columns:     []string{"created", "level", "source", "message"},
+		pruneEvery:  time.Hour,
+	}
+	w.format = "%M"
+	w.finish = func() {
+		if w.insert != nil {
+			w.insert.Close()
+		}
+	}
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go w.run(w.send)
+
+	return w
+}
+
+// The width of the source column; longer sources are cut to fit, but for
+// SQLite, whose columns take any length
+const dbSourceWidth = 255
+
+// The statements creating the table
+func (w *DBLogWriter) schema() []string {
+	created, level := "TIMESTAMP", "VARCHAR(8)"
+	switch {
+	case w.numeric:
+		created, level = "INTEGER", "INTEGER"
+	case w.dialect == "postgres":
+		created = "TIMESTAMP WITH TIME ZONE"
+	case w.dialect == "mysql":
+		created = "DATETIME(6)"
+	}
+	schema := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s %s NOT NULL, %s %s NOT NULL, %s VARCHAR(%d) NOT NULL, %s TEXT NOT NULL)",
+		w.table, w.columns[0], created, w.columns[1], level, w.columns[2], dbSourceWidth, w.columns[3])}
+	if w.numeric {
+		for _, column := range w.columns[:3] {
+			schema = append(schema, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_%s ON %s (%s)", w.table, column, w.table, column))
+		}
+	}
+	return schema
+}
+
+// The source of rec as inserted, cut to the width of the column on a character
+// boundary, so that a long one does not fail the whole batch
+func (w *DBLogWriter) source(rec *LogRecord) string {
+	source := rec.Source
+	if w.dialect == "sqlite" || len(source) <= dbSourceWidth {
+		return source
+	}
+	cut := dbSourceWidth
+	for cut > 0 && !utf8.RuneStart(source[cut]) {
+		cut--
+	}
+	return source[:cut]
+}
+
+// The ith placeholder, from 1
+func (w *DBLogWriter) placeholder(i int) string {
+	if w.dialect == "postgres" {
+		return "$" + strconv.Itoa(i)
+	}
+	return "?"
+}
+
+// Prepare the insert, creating the table first if set
+func (w *DBLogWriter) prepare() error {
+	if w.create {
+		for _, statement := range w.schema() {
+			if _, err := w.db.Exec(statement); err != nil {
+				return err
+			}
+		}
+	}
+	var values []string
+	for i := range w.columns {
+		values = append(values, w.placeholder(i+1))
+	}
+	stmt, err := w.db.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		w.table, strings.Join(w.columns, ", "), strings.Join(values, ", ")))
+	if err != nil {
+		return err
+	}
+	w.insert = stmt
+	return nil
+}
+
+// Insert a batch in a transaction, then prune if it is time to
+func (w *DBLogWriter) send(batch []*LogRecord) error {
+	if w.insert == nil {
+		if err := w.prepare(); err != nil {
+			return err
+		}
+	}
+
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	insert := tx.Stmt(w.insert)
+	for _, rec := range batch {
+		message := string(rec.Binary)
+		if rec.Binary == nil {
+			message = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+		}
+		created, level := interface{}(rec.Created), interface{}(rec.Level.String())
+		if w.numeric {
+			created, level = rec.Created.UnixNano(), int64(rec.Level)
+		}
+		if _, err := insert.Exec(created, level, w.source(rec), message); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if now := time.Now(); w.maxAge > 0 && now.Sub(w.prunedAt) >= w.pruneEvery {
+		w.prunedAt = now
+		before := interface{}(now.Add(-w.maxAge))
+		if w.numeric {
+			before = now.Add(-w.maxAge).UnixNano()
+		}
+		if _, err := w.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s < %s", w.table, w.columns[0], w.placeholder(1)),
+			before); err != nil {
+			fmt.Fprintf(os.Stderr, "DBLogWriter(%q): pruning: %s\n", w.table, err)
+		}
+	}
+	return nil
+}
+
+// Set the logging format of the message (chainable).  Must be called before
+// the first log message is written.
+func (w *DBLogWriter) SetFormat(format string) *DBLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *DBLogWriter) SetFormatter(formatter Formatter) *DBLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the names of the columns for the time, level, source and message
+// (chainable).  Must be called before the first log message is written.
+func (w *DBLogWriter) SetColumns(created, level, source, message string) *DBLogWriter {
+	w.columns = []string{created, level, source, message}
+	return w
+}
+
+// Set whether the table is created, if it does not exist, before the first
+// insert (chainable).  Must be called before the first log message is written.
+func (w *DBLogWriter) SetCreateTable(create bool) *DBLogWriter {
+	w.create = create
+	return w
+}
+
+// Set the pruning policy (chainable): the rows older than maxAge are deleted,
+// after a batch, every so often.  The default is to keep every row.  Must be
+// called before the first log message is written.
+func (w *DBLogWriter) SetPrune(maxAge, every time.Duration) *DBLogWriter {
+	w.maxAge, w.pruneEvery = maxAge, every
+	return w
+}
+
+// Set the most records inserted at once, and the longest the first of them
+// waits to be inserted (chainable).  The default is 1000 records and a second.
+// Must be called before the first log message is written.
+func (w *DBLogWriter) SetBatch(size int, wait time.Duration) *DBLogWriter {
+	w.batchSize, w.batchWait = size, wait
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time a batch cannot
+// be inserted (chainable).  It must not log to this writer.  Must be called
+// before the first log message is written.
+func (w *DBLogWriter) SetErrorHandler(handler func(error)) *DBLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be inserted
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *DBLogWriter) SetStderrFallback(fallback bool) *DBLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the database again after a batch cannot
+// be inserted (chainable).  The wait doubles with each failure, up to max.
+// The default is from one second up to a minute.  Must be called before the
+// first log message is written.
+func (w *DBLogWriter) SetRetryBackoff(initial, max time.Duration) *DBLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
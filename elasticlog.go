@@ -0,0 +1,256 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// This log writer indexes batches of records into Elasticsearch or OpenSearch
+// through the _bulk API, into an index named after the day (by default) each
+// record was logged.
+type ElasticLogWriter struct {
+	httpBatcher
+
+	index  string                 // pattern of the index names, see indexName
+	fields map[string]interface{} // added to every document
+}
+
+// This is the ElasticLogWriter's output method
+func (w *ElasticLogWriter) LogWrite(rec *LogRecord) {
+	w.logWrite(rec)
+}
+
+// wait for the records to be indexed
+func (w *ElasticLogWriter) Close() {
+	w.close()
+}
+
+// Flush indexes the records batched so far, returning once they have been.
+func (w *ElasticLogWriter) Flush() {
+	w.flush()
+}
+
+// NewElasticLogWriter creates a new LogWriter which indexes records through
+// the _bulk API at baseURL (e.g. "http://localhost:9200"), into an index named
+// by the pattern index (e.g. "logs-%Y.%m.%d"), with %Y, %m, %d and %H standing
+// for the year, month, day and hour of the record's time in UTC.  Each
+// document has @timestamp, level, source and message, the record formatted
+// with "%M" until set otherwise.  Documents are created with the "create"
+// action, so the index may be a data stream.
+//
+// Records are indexed in batches of up to 1000, or a second after the first of
+// a batch.  Batches, and the records in them rejected with 429 Too Many
+// Requests, are retried up to five times with backoff.
+func NewElasticLogWriter(baseURL, index string, opts ...Option) *ElasticLogWriter {
+	w := &ElasticLogWriter{
+		httpBatcher: newHTTPBatcher("ElasticLogWriter", strings.TrimRight(baseURL, "/")+"/_bulk", opts),
+		index:       index,
+		fields:      make(map[string]interface{}),
+	}
+	w.format = "%M"
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go w.run(w.bulk)
+
+	return w
+}
+
+// The bulk action and document lines of rec
+func (w *ElasticLogWriter) document(rec *LogRecord) ([]byte, error) {
+	message := string(rec.Binary)
+	if rec.Binary == nil {
+		message = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+	}
+
+	doc := make(map[string]interface{}, 4+len(w.fields))
+	for name, value := range w.fields {
+		doc[name] = value
+	}
+	doc["@timestamp"] = rec.Created.UTC().Format(time.RFC3339Nano)
+	doc["level"] = rec.Level.String()
+	doc["source"] = rec.Source
+	doc["message"] = message
+
+	action := map[string]map[string]string{
+		"create": {"_index": indexName(w.index, rec.Created.UTC())},
+	}
+	a, err := json.Marshal(action)
+	if err != nil {
+		return nil, err
+	}
+	d, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(append(a, '\n'), d...), '\n'), nil
+}
+
+// indexName expands the %Y, %m, %d and %H of pattern (and %% to %) for t,
+// leaving the rest as it is.
+func indexName(pattern string, t time.Time) string {
+	var name strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			name.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&name, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&name, "%02d", t.Month())
+		case 'd':
+			fmt.Fprintf(&name, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&name, "%02d", t.Hour())
+		case '%':
+			name.WriteByte('%')
+		default:
+			name.WriteByte('%')
+			name.WriteByte(pattern[i])
+		}
+	}
+	return name.String()
+}
+
+type elasticBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// Index a batch, sending again the documents rejected as too many
+func (w *ElasticLogWriter) bulk(batch []*LogRecord) error {
+	docs := make([][]byte, 0, len(batch))
+	for _, rec := range batch {
+		doc, err := w.document(rec)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	}
+
+	failed, reason := 0, ""
+	wait := w.retryWait
+	for attempt := 0; ; attempt++ {
+		body, err := w.post(bytes.Join(docs, nil), "application/x-ndjson")
+		if err != nil {
+			return err
+		}
+		var resp elasticBulkResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("bulk response: %s", err)
+		}
+
+		var retry [][]byte
+		if resp.Errors {
+			for i, item := range resp.Items {
+				for _, result := range item {
+					switch {
+					case result.Status == http.StatusTooManyRequests && i < len(docs):
+						retry = append(retry, docs[i])
+					case result.Status/100 != 2:
+						failed++
+						reason = string(result.Error)
+					}
+				}
+			}
+		}
+
+		if len(retry) > 0 && attempt < w.maxRetries {
+			docs = retry
+			time.Sleep(wait)
+			wait *= 2
+			continue
+		}
+		failed += len(retry)
+		if failed > 0 {
+			return fmt.Errorf("%d of %d records not indexed: %s", failed, len(batch), reason)
+		}
+		return nil
+	}
+}
+
+// Set the logging format of the message (chainable).  Must be called before
+// the first log message is written.
+func (w *ElasticLogWriter) SetFormat(format string) *ElasticLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *ElasticLogWriter) SetFormatter(formatter Formatter) *ElasticLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Add a field to every document (chainable), e.g. the service name.  Must be
+// called before the first log message is written.
+func (w *ElasticLogWriter) SetField(name string, value interface{}) *ElasticLogWriter {
+	w.fields[name] = value
+	return w
+}
+
+// Set the user and password to index with (chainable).  Must be called before
+// the first log message is written.
+func (w *ElasticLogWriter) SetBasicAuth(username, password string) *ElasticLogWriter {
+	w.username, w.password = username, password
+	return w
+}
+
+// Set an API key to index with, as for the Authorization: ApiKey header
+// (chainable).  Must be called before the first log message is written.
+func (w *ElasticLogWriter) SetAPIKey(key string) *ElasticLogWriter {
+	w.header.Set("Authorization", "ApiKey "+key)
+	return w
+}
+
+// Set the most records indexed at once, and the longest the first of them
+// waits to be indexed (chainable).  The default is 1000 records and a second.
+// Must be called before the first log message is written.
+func (w *ElasticLogWriter) SetBatch(size int, wait time.Duration) *ElasticLogWriter {
+	w.batchSize, w.batchWait = size, wait
+	return w
+}
+
+// Set how many more times a batch, or the records rejected from it as too
+// many, is sent, and the wait before the first retry, doubling after
+// (chainable).  The default is five times, from half a second.  Must be called
+// before the first log message is written.
+func (w *ElasticLogWriter) SetRetry(retries int, wait time.Duration) *ElasticLogWriter {
+	w.maxRetries, w.retryWait = retries, wait
+	return w
+}
+
+// Set the timeout of each bulk request (chainable).  The default is 30
+// seconds.  Must be called before the first log message is written.
+func (w *ElasticLogWriter) SetTimeout(timeout time.Duration) *ElasticLogWriter {
+	w.client.Timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time a batch cannot
+// be indexed (chainable).  It must not log to this writer.  Must be called
+// before the first log message is written.
+func (w *ElasticLogWriter) SetErrorHandler(handler func(error)) *ElasticLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be indexed
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *ElasticLogWriter) SetStderrFallback(fallback bool) *ElasticLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
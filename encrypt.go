@@ -0,0 +1,154 @@
+package log4go
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// An encrypted log file is a series of blocks, one per record (or header or
+// footer line), each a 4 byte big-endian length followed by that many bytes:
+// a random nonce and the AES-GCM sealed text.  Blocks stand alone, so a file
+// may be appended to, copied and truncated, and a block cut short by a crash
+// only loses its own record.
+
+// maxEncryptedBlock bounds the blocks DecryptLog accepts, so that garbage does
+// not make it allocate without limit.
+const maxEncryptedBlock = 64 << 20
+
+// ErrShortBlock is returned by DecryptLog for an encrypted log which ends part
+// way through a block, as when the writer was killed in the middle of a write.
+var ErrShortBlock = errors.New("encrypted log ends in a partial block")
+
+// A KeyProvider supplies the key log files are encrypted with, e.g. from a
+// secrets manager or an environment variable.  It is asked once, when
+// encryption is set up.
+type KeyProvider interface {
+	// Key returns the AES key: 16, 24 or 32 bytes for AES-128, AES-192 or
+	// AES-256.
+	Key() ([]byte, error)
+}
+
+// StaticKey is a KeyProvider for a key known up front.
+type StaticKey []byte
+
+// Key returns k.
+func (k StaticKey) Key() ([]byte, error) {
+	return k, nil
+}
+
+func newLogCipher(keys KeyProvider) (cipher.AEAD, error) {
+	key, err := keys.Key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// logSealer encrypts what a file writer writes.  A nil *logSealer encrypts
+// nothing.
+type logSealer struct {
+	aead cipher.AEAD
+	err  error // why there is no aead; every write fails with it
+}
+
+// newLogSealer returns a logSealer for the key keys gives.  Should there be no
+// usable key, the writes fail instead, rather than logging in the clear.
+func newLogSealer(keys KeyProvider) *logSealer {
+	aead, err := newLogCipher(keys)
+	if err != nil {
+		return &logSealer{err: fmt.Errorf("encryption: %s", err)}
+	}
+	return &logSealer{aead: aead}
+}
+
+// wrap returns out, encrypting each write into a block if s is set.
+func (s *logSealer) wrap(out io.Writer) io.Writer {
+	if s == nil {
+		return out
+	}
+	return sealWriter{s, out}
+}
+
+type sealWriter struct {
+	*logSealer
+	out io.Writer
+}
+
+func (w sealWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	size := w.aead.NonceSize() + len(p) + w.aead.Overhead()
+	block := make([]byte, 4+w.aead.NonceSize(), 4+size)
+	binary.BigEndian.PutUint32(block, uint32(size))
+	nonce := block[4:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return 0, err
+	}
+	block = w.aead.Seal(block, nonce, p, nil)
+
+	if _, err := w.out.Write(block); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// DecryptLog writes to w the plain text of the encrypted log read from r, such
+// as a file written by a FileLogWriter, TimeFileLogWriter or
+// PanicFileLogWriter after SetEncryption(keys).  It stops at the first block
+// it cannot decrypt, returning an error, having written out every block before
+// it.
+func DecryptLog(w io.Writer, r io.Reader, keys KeyProvider) error {
+	aead, err := newLogCipher(keys)
+	if err != nil {
+		return err
+	}
+
+	var head [4]byte
+	var block []byte
+	for {
+		if _, err := io.ReadFull(r, head[:]); err == io.EOF {
+			return nil
+		} else if err == io.ErrUnexpectedEOF {
+			return ErrShortBlock
+		} else if err != nil {
+			return err
+		}
+
+		size := binary.BigEndian.Uint32(head[:])
+		if size < uint32(aead.NonceSize()+aead.Overhead()) || size > maxEncryptedBlock {
+			return fmt.Errorf("encrypted log block of %d bytes is not valid", size)
+		}
+		if cap(block) < int(size) {
+			block = make([]byte, size)
+		}
+		block = block[:size]
+		if _, err := io.ReadFull(r, block); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrShortBlock
+		} else if err != nil {
+			return err
+		}
+
+		nonce, sealed := block[:aead.NonceSize()], block[aead.NonceSize():]
+		text, err := aead.Open(sealed[:0], nonce, sealed, nil)
+		if err != nil {
+			return fmt.Errorf("encrypted log block: %s", err)
+		}
+		if _, err := w.Write(text); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package log4go
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// The field ErrorWithErr logs the error as, and %e writes
+const errorField = "error"
+
+// The field SetStacktraceLevel captures stack traces as
+const stacktraceField = "stacktrace"
+
+// The most errors followed down a chain, lest a cycle go on forever
+const maxErrorCauses = 100
+
+// The most frames of a stack trace SetStacktraceLevel captures
+const maxStackFrames = 64
+
+// An error ErrorWithErr returns: its message and the error logged
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e *wrappedError) Error() string { return e.msg + ": " + e.err.Error() }
+func (e *wrappedError) Unwrap() error { return e.err }
+func (e *wrappedError) Cause() error  { return e.err }
+
+// ErrorWithErr logs a message at the error log level with err as the field
+// "error", and returns an error of the message and err that wraps err:
+//
+//	if err != nil {
+//		return log.ErrorWithErr(err, "reading %s", path)
+//	}
+//
+// The field is written with the errors err wraps and its stack trace, if it or
+// one of them has one, by %e, and as the field "errorVerbose" by the JSON and
+// logfmt formatters.  Fields among args are logged as for Error.
+func (log Logger) ErrorWithErr(err error, msg string, args ...interface{}) error {
+	args = computeArgs(args)
+	if err != nil {
+		args = append([]interface{}{Fields{errorField: err}}, args...)
+	}
+	log.intLogf(ERROR, msg, args...)
+	return errorWithErr(err, msg, args)
+}
+
+// Wrapper for (*Logger).ErrorWithErr
+func ErrorWithErr(err error, msg string, args ...interface{}) error {
+	args = computeArgs(args)
+	if err != nil {
+		args = append([]interface{}{Fields{errorField: err}}, args...)
+	}
+	Global.intLogf(ERROR, msg, args...)
+	return errorWithErr(err, msg, args)
+}
+
+// The error ErrorWithErr returns
+func errorWithErr(err error, msg string, args []interface{}) error {
+	if plain := plainArgs(args); len(plain) > 0 {
+		msg = fmt.Sprintf(msg, plain...)
+	}
+	if err == nil {
+		return errors.New(msg)
+	}
+	return &wrappedError{msg: msg, err: err}
+}
+
+// The errors err wraps, outermost first: by Unwrap, as fmt.Errorf's %w makes
+// them, or by Cause, as github.com/pkg/errors does
+func errorCauses(err error) []error {
+	var causes []error
+	var walk func(err error)
+	walk = func(err error) {
+		for len(causes) < maxErrorCauses {
+			var next error
+			switch e := err.(type) {
+			case interface{ Unwrap() []error }:
+				for _, inner := range e.Unwrap() {
+					if inner != nil && len(causes) < maxErrorCauses {
+						causes = append(causes, inner)
+						walk(inner)
+					}
+				}
+				return
+			case interface{ Unwrap() error }:
+				next = e.Unwrap()
+			case interface{ Cause() error }:
+				next = e.Cause()
+			}
+			if next == nil {
+				return
+			}
+			causes = append(causes, next)
+			err = next
+		}
+	}
+	walk(err)
+	return causes
+}
+
+// The program counters of the stack trace err has, as a StackTrace method
+// returns them in github.com/pkg/errors or a Callers method in
+// github.com/go-errors/errors, or nil
+func errorStackTrace(err error) []uintptr {
+	v := reflect.ValueOf(err)
+	for _, name := range []string{"StackTrace", "Callers"} {
+		m := v.MethodByName(name)
+		if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+			continue
+		}
+		if t := m.Type().Out(0); t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Uintptr {
+			continue
+		}
+		trace := m.Call(nil)[0]
+		pcs := make([]uintptr, trace.Len())
+		for i := range pcs {
+			pcs[i] = uintptr(trace.Index(i).Uint())
+		}
+		return pcs
+	}
+	return nil
+}
+
+// The text of err, then a line for each error it wraps of a message of its
+// own, and one for each frame of the stack trace of the innermost of them that
+// has one
+func errorDetails(err error) string {
+	var b strings.Builder
+	b.WriteString(err.Error())
+	last := err.Error()
+	pcs := errorStackTrace(err)
+	for _, cause := range errorCauses(err) {
+		if msg := cause.Error(); msg != last {
+			b.WriteString("\ncaused by: ")
+			b.WriteString(msg)
+			last = msg
+		}
+		if trace := errorStackTrace(cause); len(trace) > 0 {
+			pcs = trace
+		}
+	}
+	if len(pcs) > 0 {
+		frames := runtime.CallersFrames(pcs)
+		for {
+			frame, more := frames.Next()
+			if frame.Function != "" || frame.File != "" {
+				fmt.Fprintf(&b, "\n\tat %s (%s:%d)", trimSourceRoot(frame.Function), frame.File, frame.Line)
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+// The details of a field's value, if it is an error with more to it than its
+// text
+func fieldDetails(value interface{}) (string, bool) {
+	err, ok := lazyValue(value).(error)
+	if !ok {
+		return "", false
+	}
+	details := errorDetails(err)
+	return details, details != err.Error()
+}
+
+// Fields with the field "stacktrace", unless they have one: the stack trace of
+// the calling goroutine, less skip frames, as runtime.Callers counts them
+func withStacktrace(fields Fields, skip int) Fields {
+	if _, ok := fields[stacktraceField]; ok {
+		return fields
+	}
+	pcs := make([]uintptr, maxStackFrames)
+	pcs = pcs[:runtime.Callers(skip, pcs)]
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" || frame.File != "" {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			fmt.Fprintf(&b, "%s\n\t%s:%d", trimSourceRoot(frame.Function), frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	if fields == nil {
+		fields = make(Fields, 1)
+	}
+	fields[stacktraceField] = b.String()
+	return fields
+}
@@ -0,0 +1,110 @@
+package log4go
+
+import "time"
+
+// An Event is a structured record in the making, of an event named for a
+// schema analytics pipelines can rely on, rather than free text:
+//
+//	log.Event("cache_miss").Int("shard", 3).Str("key", key).Send()
+//
+// Its record has the name as its message and as the field "event", and the
+// fields, typed, as the methods add them; a field "schema" too if Schema sets
+// a version.  Events are INFO unless Level says otherwise.  An Event is for one
+// goroutine to build and send once.
+type Event struct {
+	log    Logger
+	level  Level
+	name   string
+	fields Fields
+}
+
+// Event starts an event of name, to be logged to log by Send.
+func (log Logger) Event(name string) *Event {
+	return &Event{log: log, level: INFO, name: name, fields: make(Fields)}
+}
+
+// Wrapper for (*Logger).Event
+func NewEvent(name string) *Event {
+	return Global.Event(name)
+}
+
+// Level sets the level the event is logged at (chainable).
+func (e *Event) Level(lvl Level) *Event {
+	e.level = lvl
+	return e
+}
+
+// Schema sets the version of the event's schema, logged as the field "schema"
+// (chainable).
+func (e *Event) Schema(version string) *Event {
+	e.fields["schema"] = version
+	return e
+}
+
+// Str adds the field of key with a string value (chainable).
+func (e *Event) Str(key, value string) *Event {
+	e.fields[key] = value
+	return e
+}
+
+// Int adds the field of key with an int value (chainable).
+func (e *Event) Int(key string, value int) *Event {
+	e.fields[key] = value
+	return e
+}
+
+// Int64 adds the field of key with an int64 value (chainable).
+func (e *Event) Int64(key string, value int64) *Event {
+	e.fields[key] = value
+	return e
+}
+
+// Uint64 adds the field of key with a uint64 value (chainable).
+func (e *Event) Uint64(key string, value uint64) *Event {
+	e.fields[key] = value
+	return e
+}
+
+// Float64 adds the field of key with a float64 value (chainable).
+func (e *Event) Float64(key string, value float64) *Event {
+	e.fields[key] = value
+	return e
+}
+
+// Bool adds the field of key with a bool value (chainable).
+func (e *Event) Bool(key string, value bool) *Event {
+	e.fields[key] = value
+	return e
+}
+
+// Duration adds the field of key with a time.Duration value (chainable).
+func (e *Event) Duration(key string, value time.Duration) *Event {
+	e.fields[key] = value
+	return e
+}
+
+// Time adds the field of key with a time.Time value (chainable).
+func (e *Event) Time(key string, value time.Time) *Event {
+	e.fields[key] = value
+	return e
+}
+
+// Err adds the field "error" with err, unless it is nil (chainable).
+func (e *Event) Err(err error) *Event {
+	if err != nil {
+		e.fields[errorField] = err
+	}
+	return e
+}
+
+// Any adds the field of key with a value of any type (chainable).
+func (e *Event) Any(key string, value interface{}) *Event {
+	e.fields[key] = value
+	return e
+}
+
+// Send logs the event, with the caller as its source.
+func (e *Event) Send() {
+	e.fields["event"] = e.name
+	e.log.intLogf(e.level, e.name, e.fields)
+}
@@ -0,0 +1,189 @@
+package log4go
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// This log writer streams records to the standard input of a program, such as
+// logger, svlogd or a shipper of one's own, as syslog-ng's program()
+// destination does.  The program is started with the first record, and again
+// should it exit.
+type ExecLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	name      string
+	args      []string
+	format    string
+	formatter Formatter // in place of format, if set
+
+	cmd   *exec.Cmd // while it runs
+	stdin io.WriteCloser
+
+	recovery writeRecovery // keeps going while the program fails
+}
+
+// This is the ExecLogWriter's output method
+func (w *ExecLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
+}
+
+// wait for the records to be written, then close the program's input and wait
+// for it to exit, for up to five seconds
+func (w *ExecLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewExecLogWriter creates a new LogWriter which writes records, formatted
+// with "[%D %T] [%L] (%S) %M" until set otherwise, to the standard input of the
+// program name run with args.  Its standard output and error are those of this
+// process.
+//
+// A record the program does not take is written again to the program started
+// anew; should that fail too, it is started again after a wait, doubling with
+// each failure.
+func NewExecLogWriter(name string, args ...string) *ExecLogWriter {
+	w := &ExecLogWriter{
+		rec:      make(chan *LogRecord, LogBufferLength),
+		blocking: LogWithBlocking,
+		name:     name,
+		args:     args,
+		format:   "[%D %T] [%L] (%S) %M",
+		recovery: newWriteRecovery(),
+	}
+	w.recovery.kind = "ExecLogWriter"
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		for rec := range w.rec {
+			if rec == nil {
+				w.stop()
+			}
+			if w.EndNotify(rec) {
+				return
+			}
+			if w.recovery.waiting(time.Now()) {
+				w.recovery.setAside(rec, w.format, w.formatter)
+				continue
+			}
+			if err := w.write(rec); err != nil {
+				w.recovery.failed(w.name, err, rec, w.format, w.formatter)
+				continue
+			}
+			w.recovery.succeeded(w.name)
+		}
+	}()
+
+	return w
+}
+
+// Write rec to the program, starting it if need be, and again once if it has
+// exited
+func (w *ExecLogWriter) write(rec *LogRecord) error {
+	msg := rec.Binary
+	if msg == nil {
+		msg = []byte(formatRecord(w.format, w.formatter, rec))
+	}
+
+	if w.cmd != nil {
+		if _, err := w.stdin.Write(msg); err == nil {
+			return nil
+		}
+		w.kill()
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+	if _, err := w.stdin.Write(msg); err != nil {
+		w.kill()
+		return err
+	}
+	return nil
+}
+
+func (w *ExecLogWriter) start() error {
+	cmd := exec.Command(w.name, w.args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	w.cmd, w.stdin = cmd, stdin
+	return nil
+}
+
+// Be done with a program that no longer takes records
+func (w *ExecLogWriter) kill() {
+	w.stdin.Close()
+	w.cmd.Process.Kill()
+	w.cmd.Wait()
+	w.cmd, w.stdin = nil, nil
+}
+
+// Close the program's input and give it time to exit
+func (w *ExecLogWriter) stop() {
+	if w.cmd == nil {
+		return
+	}
+	w.stdin.Close()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- w.cmd.Wait()
+	}()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		w.cmd.Process.Kill()
+		<-exited
+	}
+	w.cmd, w.stdin = nil, nil
+}
+
+// Set the logging format (chainable).  Must be called before the first log
+// message is written.
+func (w *ExecLogWriter) SetFormat(format string) *ExecLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *ExecLogWriter) SetFormatter(formatter Formatter) *ExecLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time the program
+// cannot be started or take a record (chainable).  It must not log to this
+// writer.  Must be called before the first log message is written.
+func (w *ExecLogWriter) SetErrorHandler(handler func(error)) *ExecLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether the records the program could not take are written to stderr
+// (chainable); otherwise they are lost.  Must be called before the first log
+// message is written.
+func (w *ExecLogWriter) SetStderrFallback(fallback bool) *ExecLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before starting the program again after it fails twice
+// in a row (chainable).  The wait doubles with each failure, up to max.  The
+// default is from one second up to a minute.  Must be called before the first
+// log message is written.
+func (w *ExecLogWriter) SetRetryBackoff(initial, max time.Duration) *ExecLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
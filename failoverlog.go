@@ -0,0 +1,103 @@
+package log4go
+
+import (
+	"sync"
+	"time"
+)
+
+// This log writer sends records to the first of its writers, the primary, and
+// while that is failing to the next, and so on, as to a local file while a
+// remote sink is down.  A writer reports its failures through the handler
+// ErrorHandler gives, set with its SetErrorHandler; after a failure it is left
+// alone for a while, then sent records again to see whether it is back.
+type FailoverLogWriter struct {
+	writers []LogWriter
+	retry   time.Duration
+
+	mu       sync.Mutex
+	failedAt map[LogWriter]time.Time // of the writers failing
+}
+
+// NewFailoverLogWriter creates a new FailoverLogWriter sending records to
+// primary, or to the secondaries in turn while it fails.  A writer that failed
+// is tried again after 30 seconds, until set otherwise.  The records a writer
+// had taken as it failed are its own to set aside, as its SetStderrFallback
+// says.
+//
+//	http := NewHTTPLogWriter(url)
+//	failover := NewFailoverLogWriter(http, NewFileLogWriter("spool.log", false))
+//	http.SetErrorHandler(failover.ErrorHandler(http))
+func NewFailoverLogWriter(primary LogWriter, secondaries ...LogWriter) *FailoverLogWriter {
+	return &FailoverLogWriter{
+		writers:  append([]LogWriter{primary}, secondaries...),
+		retry:    30 * time.Second,
+		failedAt: make(map[LogWriter]time.Time),
+	}
+}
+
+// ErrorHandler returns the function to set as writer's error handler, so that
+// records go to the next writer while it fails.
+func (w *FailoverLogWriter) ErrorHandler(writer LogWriter) func(error) {
+	return func(err error) {
+		w.Failed(writer)
+	}
+}
+
+// Failed notes that writer is failing, sending records to the next writer for
+// now.
+func (w *FailoverLogWriter) Failed(writer LogWriter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failedAt[writer] = time.Now()
+}
+
+// Set how long a writer that failed is left alone before it is sent records
+// again (chainable).  The default is 30 seconds.  Must be called before the
+// first log message is written.
+func (w *FailoverLogWriter) SetRetry(retry time.Duration) *FailoverLogWriter {
+	w.retry = retry
+	return w
+}
+
+// Active returns the writer records are sent to now: the first that has not
+// failed lately, or the last if they all have.
+func (w *FailoverLogWriter) Active() LogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	for _, writer := range w.writers {
+		failedAt, failed := w.failedAt[writer]
+		if !failed {
+			return writer
+		}
+		if now.Sub(failedAt) >= w.retry {
+			// try it again, with the next record
+			delete(w.failedAt, writer)
+			return writer
+		}
+	}
+	return w.writers[len(w.writers)-1]
+}
+
+// This is the FailoverLogWriter's output method
+func (w *FailoverLogWriter) LogWrite(rec *LogRecord) {
+	w.Active().LogWrite(rec)
+}
+
+// Flush flushes the writers that can be.
+func (w *FailoverLogWriter) Flush() {
+	for _, writer := range w.writers {
+		if fw, ok := writer.(interface {
+			Flush()
+		}); ok {
+			fw.Flush()
+		}
+	}
+}
+
+// Close closes every writer.
+func (w *FailoverLogWriter) Close() {
+	for _, writer := range w.writers {
+		writer.Close()
+	}
+}
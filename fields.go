@@ -0,0 +1,306 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Fields are the structured data of a record, by name, to be logged after the
+// arguments of its message:
+//
+//	log.Info("served %s", path, Fields{"user": id, "latency_ms": 12})
+//
+// They are written by the %X format code, and as members of their own by the
+// JSON and logfmt formatters.  A Field, as String and Int make, is logged as
+// one of them.
+type Fields map[string]interface{}
+
+// A LazyValue is an argument of a message, or the value of a field, computed
+// only once the record is to be written, for one expensive to compute, such
+// as a JSON dump of a large struct:
+//
+//	log.Debug("state: %s", LazyValue(func() interface{} { return dump(state) }))
+//
+// A func() interface{} is taken as one too.  The value is computed once for
+// the record, after the filters' levels are checked, or for Warn, Error and
+// Critical, as they format their errors, always.  Values bound With a Logger
+// or in a diagnostic context are computed as each writer writes them.
+type LazyValue func() interface{}
+
+// The value of v, computed if it is lazy
+func lazyValue(v interface{}) interface{} {
+	switch lazy := v.(type) {
+	case LazyValue:
+		return lazy()
+	case func() interface{}:
+		return lazy()
+	}
+	return v
+}
+
+// Whether v is a LazyValue or a func() interface{}
+func isLazy(v interface{}) bool {
+	switch v.(type) {
+	case LazyValue, func() interface{}:
+		return true
+	}
+	return false
+}
+
+// Args with their lazy values, and those of their Fields and each Field,
+// computed
+func computeArgs(args []interface{}) []interface{} {
+	lazy := false
+	for _, arg := range args {
+		switch f := arg.(type) {
+		case Fields:
+			for _, value := range f {
+				lazy = lazy || isLazy(value)
+			}
+		case Field:
+			lazy = lazy || isLazy(f.Value)
+		}
+		lazy = lazy || isLazy(arg)
+	}
+	if !lazy {
+		return args
+	}
+	computed := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch f := arg.(type) {
+		case Fields:
+			values := make(Fields, len(f))
+			for name, value := range f {
+				values[name] = lazyValue(value)
+			}
+			arg = values
+		case Field:
+			arg = Field{Key: f.Key, Value: lazyValue(f.Value)}
+		}
+		computed[i] = lazyValue(arg)
+	}
+	return computed
+}
+
+// Args without their Fields and each Field, and those merged, the later
+// overriding, their lazy values computed
+func splitFields(args []interface{}) ([]interface{}, Fields) {
+	args = computeArgs(args)
+	n := argCount(args)
+	if n == len(args) {
+		return args, nil
+	}
+	plain := make([]interface{}, 0, n)
+	var fields Fields
+	for _, arg := range args {
+		switch f := arg.(type) {
+		case Fields:
+			if fields == nil {
+				fields = make(Fields, len(f))
+			}
+			for name, value := range f {
+				fields[name] = value
+			}
+		case Field:
+			if fields == nil {
+				fields = make(Fields)
+			}
+			fields[f.Key] = f.Value
+		default:
+			plain = append(plain, arg)
+		}
+	}
+	return plain, fields
+}
+
+// How many of args are not Fields or a Field
+func argCount(args []interface{}) int {
+	n := 0
+	for _, arg := range args {
+		switch arg.(type) {
+		case Fields, Field:
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// The names of the fields, sorted
+func (f Fields) names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The text of a field's value
+func fieldText(value interface{}) string {
+	value = lazyValue(value)
+	switch v := value.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	}
+	if b, ok := appendTypedText(nil, value); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
+
+// Append a field's value to b as JSON, errors and values JSON cannot encode as
+// their text
+func appendFieldJSON(b []byte, value interface{}) []byte {
+	value = lazyValue(value)
+	switch v := value.(type) {
+	case string:
+		return appendJSONString(b, v)
+	case error:
+		return appendJSONString(b, v.Error())
+	}
+	if b, ok := appendTypedJSON(b, value); ok {
+		return b
+	}
+	js, err := json.Marshal(value)
+	if err != nil {
+		return appendJSONString(b, fmt.Sprint(value))
+	}
+	return append(b, js...)
+}
+
+// Args without their Fields
+func plainArgs(args []interface{}) []interface{} {
+	plain, _ := splitFields(args)
+	return plain
+}
+
+// With returns a Logger whose records carry fields, as well as those they are
+// logged with, which override them, e.g. for a request:
+//
+//	reqLog := log.With(Fields{"request_id": id, "component": "api"})
+//	reqLog.Info("served %s", path)
+//
+// The Logger derived has the filters of log, at their levels, over the same
+// writers; they are log's to close, and closing the derived Logger leaves them
+// open.  Filters added to log later are not in it.
+func (log Logger) With(fields Fields) Logger {
+	return log.derive(fields, 0)
+}
+
+// A Logger with the filters of log over derivedLogWriters holding fields over
+// the ones log has, and skip added to its caller skip
+func (log Logger) derive(fields Fields, skip int) Logger {
+	derived := make(Logger, len(log))
+	for name, filt := range log {
+		w := &derivedLogWriter{LogWriter: filt.LogWriter, fields: fields, callerSkip: skip}
+		if bound, ok := filt.LogWriter.(*derivedLogWriter); ok {
+			w.LogWriter = bound.LogWriter
+			w.callerSkip += bound.callerSkip
+			w.middleware = bound.middleware
+			if len(bound.fields) > 0 {
+				w.fields = mergeFields(bound.fields, fields)
+			}
+		}
+		derived[name] = &Filter{filt.Level, w}
+	}
+	return derived
+}
+
+// This log writer is the writer of a filter of a Logger derived With fields or
+// WithCallerSkip, or given middleware to Use, which holds them for the Logger
+// and passes records on
+type derivedLogWriter struct {
+	LogWriter
+	fields     Fields
+	callerSkip int
+	middleware []func(rec *LogRecord) *LogRecord
+	owned      bool // the Logger's own writer, not one shared with another
+}
+
+// Close closes the writer if it is the Logger's own, and leaves it open
+// otherwise, for the Logger it is shared with.
+func (w *derivedLogWriter) Close() {
+	if w.owned {
+		w.LogWriter.Close()
+	}
+}
+
+// The derivedLogWriter of a filter of log, if it was derived
+func (log Logger) derivedWriter() *derivedLogWriter {
+	for _, filt := range log {
+		if w, ok := filt.LogWriter.(*derivedLogWriter); ok {
+			return w
+		}
+	}
+	return nil
+}
+
+// The global fields, as set by SetGlobalFields and AddGlobalField; the map is
+// replaced, never changed
+var globalFields struct {
+	sync.Mutex // for changes
+	fields     atomic.Value
+}
+
+// SetGlobalFields sets the fields added to every record of every Logger, such
+// as the service's name and version, its region or its pod, replacing any set
+// before.  The fields a record is logged with, of its Logger's With and of the
+// diagnostic contexts override them.  It may be called at any time.
+func SetGlobalFields(fields Fields) {
+	globalFields.Lock()
+	defer globalFields.Unlock()
+	globalFields.fields.Store(mergeFields(nil, fields))
+}
+
+// AddGlobalField adds the field of key to the global fields, or changes it.
+// It may be called at any time.
+func AddGlobalField(key string, value interface{}) {
+	globalFields.Lock()
+	defer globalFields.Unlock()
+	current, _ := globalFields.fields.Load().(Fields)
+	globalFields.fields.Store(mergeFields(current, Fields{key: value}))
+}
+
+// RemoveGlobalField removes the field of key from the global fields.  It may be
+// called at any time.
+func RemoveGlobalField(key string) {
+	globalFields.Lock()
+	defer globalFields.Unlock()
+	current, _ := globalFields.fields.Load().(Fields)
+	fields := mergeFields(current, nil)
+	delete(fields, key)
+	globalFields.fields.Store(fields)
+}
+
+// A new map of the fields of under, and of fields over them
+func mergeFields(under, fields Fields) Fields {
+	merged := make(Fields, len(under)+len(fields))
+	for name, value := range under {
+		merged[name] = value
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+	return merged
+}
+
+// The fields of a record log logs from goroutine id with fields: the global
+// fields, under those log was derived With, under the goroutine's diagnostic
+// contexts, under fields
+func (log Logger) recordFields(id uint64, fields Fields) Fields {
+	under, _ := globalFields.fields.Load().(Fields)
+	if w := log.derivedWriter(); w != nil && len(w.fields) > 0 {
+		if len(under) == 0 {
+			under = w.fields
+		} else {
+			under = mergeFields(under, w.fields)
+		}
+	}
+	return withDiagnostics(id, under, fields)
+}
@@ -3,25 +3,97 @@
 package log4go
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 )
 
+// fileBackupFilter matches the suffixes FileLogWriter gives its backups:
+// ".###" when rotating, ".2006-01-02.###" when rotating daily.
+var fileBackupFilter = regexp.MustCompile(`^(\d+|\d{4}-\d{2}-\d{2}\.\d{3})$`)
+
+// flushRecord is sent down a file writer's record channel by Flush, so that
+// everything logged before it is written first.
+var flushRecord = &LogRecord{}
+
+// reopenRecord is sent down a file writer's record channel by Reopen.
+var reopenRecord = &LogRecord{}
+
+// writeHeadFootLine writes the line given by f, if f is set, ending it with a
+// newline if it does not have one.
+func writeHeadFootLine(out io.Writer, f func() string) {
+	if f == nil {
+		return
+	}
+	line := f()
+	if line != "" && !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	io.WriteString(out, line)
+}
+
+// fileOptions are the permissions and owner given to the log files a writer
+// opens.
+type fileOptions struct {
+	mode     os.FileMode // zero for the writer's default
+	chown    bool
+	uid, gid int
+}
+
+// open opens name for appending, creating it with mode (unless overridden)
+// if it does not exist.
+func (o *fileOptions) open(name string, mode os.FileMode) (*os.File, error) {
+	if o.mode != 0 {
+		mode = o.mode
+	}
+	fd, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.apply(fd.Name()); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return fd, nil
+}
+
+// apply sets the configured mode and owner on an existing file.  The mode is
+// set explicitly, so it is exact regardless of the umask.
+func (o *fileOptions) apply(name string) error {
+	if o.mode != 0 {
+		if err := os.Chmod(name, o.mode); err != nil {
+			return err
+		}
+	}
+	if o.chown {
+		if err := os.Chown(name, o.uid, o.gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // This log writer sends output to a file
 type FileLogWriter struct {
-	rec chan *LogRecord
-	rot chan bool
+	rec      chan *LogRecord
+	rot      chan bool
+	blocking bool // as WithBlocking sets
 
 	// The opened file
 	filename string
 	file     *os.File
 
 	// The logging format
-	format string
+	format    string
+	formatter Formatter // in place of format, if set
 
-	// File header/trailer
-	header, trailer string
+	// File header/trailer, and functions adding lines to them
+	header, trailer         string
+	headerfunc, trailerfunc func() string
 
 	// Rotate at linecount
 	maxlines          int
@@ -38,14 +110,51 @@ type FileLogWriter struct {
 	// Keep old logfiles (.001, .002, etc)
 	rotate    bool
 	maxbackup int
+
+	// Cap the combined size and the age of the old logfiles
+	maxtotalsize int64
+	maxage       time.Duration
+	backupglob   string // the old logfiles, if not the ones named as above
+
+	// Notified of each rotation
+	hooks rotationHooks
+
+	// Reopen if the file was moved away or deleted
+	reopencheck      time.Duration
+	reopencheck_last time.Time
+
+	// Permissions and owner of the log files
+	perm fileOptions
+
+	// Copy to the backup and truncate, rather than rename
+	copytruncate bool
+
+	// When to fsync: "none", "interval" or "every" record
+	syncmode     string
+	syncinterval time.Duration
+
+	// Buffer writes, flushing at least every flushinterval
+	buf           *bufio.Writer
+	flushinterval time.Duration
+	flushed       chan bool
+
+	// Keep going, and retry, when the file cannot be written
+	recovery writeRecovery
+
+	// Encrypt what is written, and chain an HMAC to each record, if set
+	encrypt *logSealer
+	audit   *auditChain
 }
 
 // This is the FileLogWriter's output method
 func (w *FileLogWriter) LogWrite(rec *LogRecord) {
-	w.rec <- rec
+	if !sendRecord(w.rec, rec, w.blocking) {
+		releaseRecord(rec)
+	}
 }
 
 func (w *FileLogWriter) Close() {
+	unregisterReopener(w)
 	close(w.rec)
 	w.file.Sync()
 }
@@ -58,83 +167,211 @@ func (w *FileLogWriter) Close() {
 // to configure log rotation based on lines, size, and daily.
 //
 // The standard log-line format is:
-//   [%D %T] [%L] (%S) %M
-func NewFileLogWriter(fname string, rotate bool) *FileLogWriter {
+//
+//	[%D %T] [%L] (%S) %M
+func NewFileLogWriter(fname string, rotate bool, opts ...Option) *FileLogWriter {
+	o := newWriterOptions(opts)
 	w := &FileLogWriter{
-		rec:       make(chan *LogRecord, LogBufferLength),
-		rot:       make(chan bool),
-		filename:  fname,
-		format:    "[%D %T] [%L] (%S) %M",
-		rotate:    rotate,
-		maxbackup: 999,
+		rec:           make(chan *LogRecord, o.bufferLength),
+		blocking:      o.blocking,
+		rot:           make(chan bool),
+		filename:      fname,
+		format:        "[%D %T] [%L] (%S) %M",
+		rotate:        rotate,
+		maxbackup:     999,
+		syncmode:      "none",
+		syncinterval:  time.Second,
+		flushinterval: time.Second,
+		flushed:       make(chan bool),
+		recovery:      newWriteRecovery(),
 	}
 
-	// open the file for the first time
+	// finish a rotation cut short by a crash, then open the file
+	if err := adoptOrphan(w.filename); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
 	if err := w.intRotate(); err != nil {
 		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
 		return nil
 	}
 
 	go func() {
+		// ticks in "interval" sync mode and while buffering, respectively
+		var synctick, flushtick <-chan time.Time
+		dirty, unflushed := false, false
+
 		defer func() {
 			if w.file != nil {
-				fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
+				w.flushBuffer()
+				w.writeTrailer()
+				if w.syncmode != "none" {
+					w.file.Sync()
+				}
 				w.file.Close()
 			}
 		}()
 
 		for {
 			select {
+			case <-flushtick:
+				if unflushed {
+					w.flushBuffer()
+					unflushed = false
+				}
+			case <-synctick:
+				if dirty {
+					w.flushBuffer()
+					w.file.Sync()
+					dirty = false
+				}
 			case <-w.rot:
 				if err := w.intRotate(); err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-					return
+					w.recovery.failed(w.filename, err, nil, "", nil)
 				}
 			case rec, ok := <-w.rec:
 				if !ok {
 					return
 				}
+				if rec == flushRecord {
+					w.flushBuffer()
+					unflushed = false
+					w.flushed <- true
+					continue
+				}
+				if rec == reopenRecord {
+					if err := w.reopen(); err != nil {
+						w.recovery.failed(w.filename, err, nil, "", nil)
+					}
+					continue
+				}
 				now := time.Now()
+				if w.recovery.waiting(now) {
+					w.recovery.setAside(rec, w.format, w.formatter)
+					releaseRecord(rec)
+					continue
+				}
+				if w.recovery.failing {
+					if err := w.reopen(); err != nil {
+						w.recovery.failed(w.filename, err, rec, w.format, w.formatter)
+						releaseRecord(rec)
+						continue
+					}
+				}
+				if w.reopencheck > 0 && now.Sub(w.reopencheck_last) >= w.reopencheck {
+					w.reopencheck_last = now
+					if err := w.checkReopen(); err != nil {
+						w.recovery.failed(w.filename, err, rec, w.format, w.formatter)
+						releaseRecord(rec)
+						continue
+					}
+				}
 				if (w.maxlines > 0 && w.maxlines_curlines >= w.maxlines) ||
 					(w.maxsize > 0 && w.maxsize_cursize >= w.maxsize) ||
 					(w.daily && now.Day() != w.daily_opendate) {
 					if err := w.intRotate(); err != nil {
-						fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-						return
+						w.recovery.failed(w.filename, err, rec, w.format, w.formatter)
+						releaseRecord(rec)
+						continue
 					}
 				}
 
 				// Perform the write
-				n, err := fmt.Fprint(w.file, FormatLogRecord(w.format, rec))
+				n, err := fmt.Fprint(w.output(), formatRecord(w.format, w.formatter, rec))
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-					return
+					w.recovery.failed(w.filename, err, rec, w.format, w.formatter)
+					releaseRecord(rec)
+					continue
 				}
+				releaseRecord(rec)
+				w.recovery.succeeded(w.filename)
 
 				// Update the counts
 				w.maxlines_curlines++
 				w.maxsize_cursize += n
+
+				if w.buf != nil && w.flushinterval > 0 {
+					unflushed = true
+					if flushtick == nil {
+						ticker := time.NewTicker(w.flushinterval)
+						defer ticker.Stop()
+						flushtick = ticker.C
+					}
+				}
+
+				switch w.syncmode {
+				case "every":
+					w.flushBuffer()
+					w.file.Sync()
+				case "interval":
+					dirty = true
+					if synctick == nil {
+						ticker := time.NewTicker(w.syncinterval)
+						defer ticker.Stop()
+						synctick = ticker.C
+					}
+				}
 			}
 		}
 	}()
 
+	o.setup(w)
+	registerReopener(w)
 	return w
 }
 
+// NewFileWriter creates a new FileLogWriter writing to fname, set up by the
+// options, such as WithRotate, WithRotateSize and WithFormat, as
+// NewFileLogWriter and its setters do.  It returns nil if the file cannot be
+// opened.
+func NewFileWriter(fname string, opts ...Option) *FileLogWriter {
+	return NewFileLogWriter(fname, newWriterOptions(opts).rotate, opts...)
+}
+
 // Request that the logs rotate
 func (w *FileLogWriter) Rotate() {
 	w.rot <- true
 }
 
+// Reopen closes the log file and opens it again under the same name, once the
+// records logged so far are written, without rotating it.  Use it after an
+// outside tool such as logrotate has moved the file away.
+func (w *FileLogWriter) Reopen() {
+	w.rec <- reopenRecord
+}
+
+// Flush writes out the records buffered so far (see SetBufferSize), returning
+// once they have been written.
+func (w *FileLogWriter) Flush() {
+	w.rec <- flushRecord
+	<-w.flushed
+}
+
+// Where records are written: the buffer, if any, else the file
+func (w *FileLogWriter) output() io.Writer {
+	if w.buf != nil {
+		return w.wrapOutput(w.buf)
+	}
+	return w.wrapOutput(w.file)
+}
+
+// Encrypt and audit what is written to out, as set
+func (w *FileLogWriter) wrapOutput(out io.Writer) io.Writer {
+	return w.audit.wrap(w.encrypt.wrap(out))
+}
+
 // If this is called in a threaded context, it MUST be synchronized
-func (w *FileLogWriter) intRotate() error {
-	// Close any log file that may be open
-	if w.file != nil {
-		fmt.Fprint(w.file, FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
-		w.file.Close()
+func (w *FileLogWriter) flushBuffer() {
+	if w.buf != nil && !w.recovery.failing {
+		if err := w.buf.Flush(); err != nil {
+			w.recovery.failed(w.filename, err, nil, "", nil)
+		}
 	}
+}
 
+// If this is called in a threaded context, it MUST be synchronized
+func (w *FileLogWriter) intRotate() error {
 	// If we are keeping log files, move it to the next available number
+	backup := ""
 	if w.rotate {
 		_, err := os.Lstat(w.filename)
 		if err == nil { // file exists
@@ -164,24 +401,62 @@ func (w *FileLogWriter) intRotate() error {
 				}
 			}
 
-			w.file.Close()
-			// Rename the file to its newfound home
-			err = os.Rename(w.filename, fname)
-			if err != nil {
+			backup = fname
+		}
+	}
+
+	open := func(name string) (*os.File, error) {
+		return w.perm.open(name, 0660)
+	}
+	var fd *os.File
+	var err error
+	if backup != "" && !w.copytruncate {
+		// Rename the file to its newfound home, the next one being opened
+		// first
+		fd, err = rollOver(w.filename, open, func() error {
+			w.closeFile()
+			w.hooks.before(w.filename)
+			return os.Rename(w.filename, backup)
+		})
+		if err != nil {
+			return fmt.Errorf("Rotate: %s\n", err)
+		}
+	} else {
+		// Close any log file that may be open
+		w.closeFile()
+		if backup != "" {
+			w.hooks.before(w.filename)
+			if err := copyTruncate(w.filename, backup); err != nil {
 				return fmt.Errorf("Rotate: %s\n", err)
 			}
 		}
+
+		// Open the log file
+		if fd, err = open(w.filename); err != nil {
+			return err
+		}
 	}
 
-	// Open the log file
-	fd, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
-	if err != nil {
-		return err
+	if backup != "" {
+		if w.maxage > 0 {
+			removeBackupsOlderThan(w.backups(), w.maxage)
+		}
+		if w.maxtotalsize > 0 {
+			removeBackupsOverSize(w.backups(), w.maxtotalsize)
+		}
 	}
+
 	w.file = fd
+	if w.buf != nil {
+		w.buf.Reset(fd)
+	}
+
+	if backup != "" {
+		w.hooks.after(backup, w.filename)
+	}
 
 	now := time.Now()
-	fmt.Fprint(w.file, FormatLogRecord(w.header, &LogRecord{Created: now}))
+	w.writeHeader()
 
 	// Set the daily open date to the current date
 	w.daily_opendate = now.Day()
@@ -193,10 +468,93 @@ func (w *FileLogWriter) intRotate() error {
 	return nil
 }
 
+// Reopen the file if it was moved away or deleted since it was opened, and
+// catch up with it if it was truncated.  If this is called in a threaded
+// context, it MUST be synchronized
+func (w *FileLogWriter) checkReopen() error {
+	cur, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(w.filename)
+	if err == nil && os.SameFile(fi, cur) {
+		// O_APPEND already writes at the new end, only the count is off
+		if fi.Size() < int64(w.maxsize_cursize) {
+			w.maxsize_cursize = int(fi.Size())
+		}
+		return nil
+	}
+	return w.reopen()
+}
+
+// Close the file, if it is open, and open it again without rotating.  If this
+// is called in a threaded context, it MUST be synchronized
+func (w *FileLogWriter) reopen() error {
+	w.closeFile()
+
+	fd, err := w.perm.open(w.filename, 0660)
+	if err != nil {
+		return err
+	}
+	w.file = fd
+	if w.buf != nil {
+		w.buf.Reset(fd)
+	}
+	w.writeHeader()
+
+	w.maxlines_curlines = 0
+	w.maxsize_cursize = 0
+	return nil
+}
+
+// Close the file, if it is open.  If this is called in a threaded context, it
+// MUST be synchronized
+func (w *FileLogWriter) closeFile() {
+	if w.file != nil {
+		w.flushBuffer()
+		w.writeTrailer()
+		w.file.Close()
+		w.file = nil
+	}
+}
+
+// Set the function called, on the writer's goroutine, each time the file
+// cannot be opened or written (chainable).  It must not log to this writer.
+// Must be called before the first log message is written.
+func (w *FileLogWriter) SetErrorHandler(handler func(error)) *FileLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr while the file cannot be written
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *FileLogWriter) SetStderrFallback(fallback bool) *FileLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the file again after it fails
+// (chainable).  The wait doubles with each failure, up to max.  The default is
+// from one second up to a minute.  The records logged meanwhile are dropped, or
+// written to stderr after SetStderrFallback, not written once the file can be.
+// Must be called before the first log message is written.
+func (w *FileLogWriter) SetRetryBackoff(initial, max time.Duration) *FileLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
+
 // Set the logging format (chainable).  Must be called before the first log
 // message is written.
 func (w *FileLogWriter) SetFormat(format string) *FileLogWriter {
-	w.format = format
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *FileLogWriter) SetFormatter(formatter Formatter) *FileLogWriter {
+	w.formatter = formatter
 	return w
 }
 
@@ -206,11 +564,41 @@ func (w *FileLogWriter) SetFormat(format string) *FileLogWriter {
 func (w *FileLogWriter) SetHeadFoot(head, foot string) *FileLogWriter {
 	w.header, w.trailer = head, foot
 	if w.maxlines_curlines == 0 {
-		fmt.Fprint(w.file, FormatLogRecord(w.header, &LogRecord{Created: time.Now()}))
+		fmt.Fprint(w.wrapOutput(w.file), FormatLogRecord(w.header, &LogRecord{Created: time.Now()}))
+	}
+	return w
+}
+
+// Set a function giving a line, such as the build version or column names, to
+// write at the top of each file after the header (chainable).  Must be called
+// before the first log message is written.
+func (w *FileLogWriter) SetHeader(header func() string) *FileLogWriter {
+	w.headerfunc = header
+	if w.maxlines_curlines == 0 {
+		writeHeadFootLine(w.wrapOutput(w.file), w.headerfunc)
 	}
 	return w
 }
 
+// Set a function giving a line to write at the end of each file, before the
+// trailer, when it is rotated or closed (chainable).  Must be called before
+// the first log message is written.
+func (w *FileLogWriter) SetFooter(footer func() string) *FileLogWriter {
+	w.trailerfunc = footer
+	return w
+}
+
+func (w *FileLogWriter) writeHeader() {
+	fmt.Fprint(w.wrapOutput(w.file), FormatLogRecord(w.header, &LogRecord{Created: time.Now()}))
+	writeHeadFootLine(w.wrapOutput(w.file), w.headerfunc)
+}
+
+func (w *FileLogWriter) writeTrailer() {
+	writeHeadFootLine(w.wrapOutput(w.file), w.trailerfunc)
+	fmt.Fprint(w.wrapOutput(w.file), FormatLogRecord(w.trailer, &LogRecord{Created: time.Now()}))
+	w.audit.seal(w.encrypt.wrap(w.file))
+}
+
 // Set rotate at linecount (chainable). Must be called before the first log
 // message is written.
 func (w *FileLogWriter) SetRotateLines(maxlines int) *FileLogWriter {
@@ -242,6 +630,160 @@ func (w *FileLogWriter) SetRotateMaxBackup(maxbackup int) *FileLogWriter {
 	return w
 }
 
+// Set max combined size in bytes of the backup files (chainable).  Each time
+// the log is rotated, the oldest backups are deleted until the total is under
+// the cap.  Zero means no cap.  Must be called before the first log message
+// is written.
+func (w *FileLogWriter) SetMaxTotalSize(maxtotalsize int64) *FileLogWriter {
+	w.maxtotalsize = maxtotalsize
+	return w
+}
+
+// Encrypt the log files with AES-GCM, using the key keys gives (chainable).
+// Each record is written as a block of its own, which DecryptLog turns back
+// into text.  Should keys give no usable key, nothing is written rather than
+// written in the clear.  Must be called before the first log message is
+// written, and before SetHeadFoot and SetHeader, on a file not yet holding
+// plain text.
+func (w *FileLogWriter) SetEncryption(keys KeyProvider) *FileLogWriter {
+	w.encrypt = newLogSealer(keys)
+	if w.encrypt.err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, w.encrypt.err)
+	}
+	return w
+}
+
+// Make the log an audit log, ending each record, header and trailer in an
+// HMAC-SHA256 keyed with key and chained to the one before (chainable), so
+// that VerifyLogFile can tell if the file was modified or truncated.  The
+// chain is sealed when the file is rotated or closed.  Must be called before
+// the first log message is written, and before SetHeadFoot and SetHeader, on
+// a file not yet holding records.
+func (w *FileLogWriter) SetAudit(key []byte) *FileLogWriter {
+	w.audit = &auditChain{key: key}
+	return w
+}
+
+// Set max age of the backup files (chainable).  Each time the log is rotated,
+// backups last written more than maxage ago are deleted.  Zero means keep
+// them regardless of age.  Must be called before the first log message is
+// written.
+func (w *FileLogWriter) SetMaxAge(maxage time.Duration) *FileLogWriter {
+	w.maxage = maxage
+	return w
+}
+
+// Set a shell pattern (as in filepath.Match) picking out the backup files
+// that SetMaxAge and SetMaxTotalSize may delete, among the files in the log's
+// directory (chainable), e.g. "app.log.*.zst" for backups compressed by a
+// hook.  The default takes the names rotation gives backups, optionally
+// gzipped.  Must be called before the first log message is written.
+func (w *FileLogWriter) SetBackupGlob(pattern string) *FileLogWriter {
+	if err := checkBackupGlob(pattern); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): backup glob %q: %s\n", w.filename, pattern, err)
+		return w
+	}
+	w.backupglob = pattern
+	return w
+}
+
+// The backups cleanup may delete, oldest first
+func (w *FileLogWriter) backups() []backupFile {
+	if w.backupglob != "" {
+		return globBackups(w.filename, w.backupglob)
+	}
+	return listBackups(w.filename, fileBackupFilter.MatchString)
+}
+
+// Add a hook to be notified of each rotation (chainable).  Must be called
+// before the first log message is written.
+func (w *FileLogWriter) AddRotationHook(hook RotationHook) *FileLogWriter {
+	w.hooks = append(w.hooks, hook)
+	return w
+}
+
+// Check at most every interval whether the log file was moved, deleted or
+// truncated by something else, such as logrotate, and if so reopen it at its
+// path (chainable).  Zero disables the check.
+func (w *FileLogWriter) SetReopenCheck(interval time.Duration) *FileLogWriter {
+	w.reopencheck = interval
+	return w
+}
+
+// Set the permissions of the log files (chainable).  The mode is applied with
+// chmod, so the umask does not change it.  Must be called before the first
+// log message is written.
+func (w *FileLogWriter) SetFileMode(mode os.FileMode) *FileLogWriter {
+	w.perm.mode = mode
+	if err := w.perm.apply(w.filename); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+	return w
+}
+
+// Set the owner of the log files (chainable).  A uid or gid of -1 is left
+// unchanged.  Must be called before the first log message is written.
+func (w *FileLogWriter) SetFileOwner(uid, gid int) *FileLogWriter {
+	w.perm.chown, w.perm.uid, w.perm.gid = true, uid, gid
+	if err := w.perm.apply(w.filename); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+	return w
+}
+
+// SetCopyTruncate makes rotation copy the log to its backup and truncate it in
+// place, rather than rename it and open a new file (chainable).  Use it when
+// other processes hold the log file open.  Must be called before the first log
+// message is written.
+func (w *FileLogWriter) SetCopyTruncate(copytruncate bool) *FileLogWriter {
+	w.copytruncate = copytruncate
+	return w
+}
+
+// Set when the log file is fsynced to disk (chainable): "none" leaves it to
+// the operating system, "interval" syncs every interval (see SetSyncInterval)
+// when something was written, and "every" syncs after each record; any other
+// mode is reported and ignored.  Must be called before the first log message
+// is written.
+func (w *FileLogWriter) SetSync(mode string) *FileLogWriter {
+	switch mode {
+	case "none", "interval", "every":
+		w.syncmode = mode
+	default:
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): unknown sync mode %q\n", w.filename, mode)
+	}
+	return w
+}
+
+// Set how often the "interval" sync mode syncs (chainable).  The default is
+// one second.  Must be called before the first log message is written.
+func (w *FileLogWriter) SetSyncInterval(interval time.Duration) *FileLogWriter {
+	w.syncinterval = interval
+	return w
+}
+
+// Buffer up to size bytes of records in memory rather than issuing a write per
+// record (chainable).  The buffer is flushed when full, every flush interval
+// (see SetFlushInterval), on Flush, rotation and Close.  Zero disables
+// buffering.  Must be called before the first log message is written.
+func (w *FileLogWriter) SetBufferSize(size int) *FileLogWriter {
+	w.flushBuffer()
+	if size > 0 {
+		w.buf = bufio.NewWriterSize(w.file, size)
+	} else {
+		w.buf = nil
+	}
+	return w
+}
+
+// Set how long buffered records may wait before they are flushed
+// (chainable).  The default is one second; zero means only flush when the
+// buffer fills up.  Must be called before the first log message is written.
+func (w *FileLogWriter) SetFlushInterval(flushinterval time.Duration) *FileLogWriter {
+	w.flushinterval = flushinterval
+	return w
+}
+
 // SetRotate changes whether or not the old logs are kept. (chainable) Must be
 // called before the first log message is written.  If rotate is false, the
 // files are overwritten; otherwise, they are rotated to another file before the
@@ -254,8 +796,8 @@ func (w *FileLogWriter) SetRotate(rotate bool) *FileLogWriter {
 
 // NewXMLLogWriter is a utility method for creating a FileLogWriter set up to
 // output XML record log messages instead of line-based ones.
-func NewXMLLogWriter(fname string, rotate bool) *FileLogWriter {
-	return NewFileLogWriter(fname, rotate).SetFormat(
+func NewXMLLogWriter(fname string, rotate bool, opts ...Option) *FileLogWriter {
+	return NewFileLogWriter(fname, rotate, opts...).SetFormat(
 		`	<record level="%L">
 		<timestamp>%D %T</timestamp>
 		<source>%S</source>
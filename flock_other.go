@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package log4go
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoLocking = errors.New("file locking is not supported on this platform")
+
+func lockFile(f *os.File) error {
+	return errNoLocking
+}
+
+func unlockFile(f *os.File) error {
+	return errNoLocking
+}
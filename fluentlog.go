@@ -0,0 +1,270 @@
+package log4go
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This log writer sends output to Fluentd, or Fluent Bit, over the forward
+// protocol: each record is a msgpack event of the form
+// {"level", "source", "message"} and any fields set, sent under a tag.
+type FluentLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	hostport string
+	conn     net.Conn
+	reader   *bufio.Reader
+
+	tag       string
+	format    string
+	formatter Formatter         // in place of format, if set
+	fields    map[string]string // sent with every event
+
+	ack        bool          // wait for the server to acknowledge each event
+	ackTimeout time.Duration // longest to wait for an ack
+
+	recovery writeRecovery // reconnects with backoff while the server is down
+}
+
+// This is the FluentLogWriter's output method
+func (w *FluentLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
+}
+
+// wait for the records to be sent and close the connection
+func (w *FluentLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewFluentLogWriter creates a new LogWriter which sends records to the
+// Fluentd forward input at hostport (e.g. "localhost:24224") under tag.  The
+// message is the record formatted with "%M", until set otherwise.
+//
+// The connection is made when the first record is sent, and made again should
+// it fail.  While the server cannot be reached, records are dropped, or written
+// to stderr after SetStderrFallback; they are not sent once it can.
+func NewFluentLogWriter(hostport, tag string, opts ...Option) *FluentLogWriter {
+	o := newWriterOptions(opts)
+	w := &FluentLogWriter{
+		rec:        make(chan *LogRecord, o.bufferLength),
+		blocking:   o.blocking,
+		hostport:   hostport,
+		tag:        tag,
+		format:     "%M",
+		fields:     make(map[string]string),
+		ackTimeout: 10 * time.Second,
+		recovery:   newWriteRecovery(),
+	}
+	w.recovery.kind = "FluentLogWriter"
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		defer func() {
+			if w.conn != nil {
+				w.conn.Close()
+			}
+		}()
+
+		for rec := range w.rec {
+			if w.EndNotify(rec) {
+				return
+			}
+			if w.recovery.waiting(time.Now()) {
+				w.recovery.setAside(rec, w.format, w.formatter)
+				continue
+			}
+			if err := w.send(rec); err != nil {
+				w.recovery.failed(w.hostport, err, rec, w.format, w.formatter)
+				continue
+			}
+			w.recovery.succeeded(w.hostport)
+		}
+	}()
+
+	return w
+}
+
+// Send rec, connecting first if need be, and connecting again once if the
+// connection was lost.
+func (w *FluentLogWriter) send(rec *LogRecord) error {
+	event, chunk, err := w.event(rec)
+	if err != nil {
+		return err
+	}
+
+	if w.conn != nil {
+		if err := w.write(event, chunk); err == nil {
+			return nil
+		}
+		w.disconnect()
+	}
+
+	conn, err := net.DialTimeout("tcp", w.hostport, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	w.conn, w.reader = conn, bufio.NewReader(conn)
+	if err := w.write(event, chunk); err != nil {
+		w.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (w *FluentLogWriter) disconnect() {
+	w.conn.Close()
+	w.conn, w.reader = nil, nil
+}
+
+// Write an event, and wait for its ack if chunk is set
+func (w *FluentLogWriter) write(event []byte, chunk string) error {
+	if _, err := w.conn.Write(event); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	w.conn.SetReadDeadline(time.Now().Add(w.ackTimeout))
+	defer w.conn.SetReadDeadline(time.Time{})
+	resp, err := readMsgpackStringMap(w.reader)
+	if err != nil {
+		return fmt.Errorf("ack: %s", err)
+	}
+	if resp["ack"] != chunk {
+		return fmt.Errorf("ack: got %q, want %q", resp["ack"], chunk)
+	}
+	return nil
+}
+
+// The forward protocol message for rec, [tag, time, record, option], and the
+// chunk ID it is to be acknowledged with, if any
+func (w *FluentLogWriter) event(rec *LogRecord) ([]byte, string, error) {
+	message := string(rec.Binary)
+	if rec.Binary == nil {
+		message = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+	}
+
+	chunk := ""
+	if w.ack {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return nil, "", err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+	}
+
+	names := make([]string, 0, len(w.fields))
+	for name := range w.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := make([]byte, 0, 64+len(message))
+	if chunk != "" {
+		b = appendMsgpackArrayHeader(b, 4)
+	} else {
+		b = appendMsgpackArrayHeader(b, 3)
+	}
+	b = appendMsgpackString(b, w.tag)
+	b = appendMsgpackEventTime(b, rec.Created)
+
+	b = appendMsgpackMapHeader(b, 3+len(names))
+	b = appendMsgpackString(b, "level")
+	b = appendMsgpackString(b, rec.Level.String())
+	b = appendMsgpackString(b, "source")
+	b = appendMsgpackString(b, rec.Source)
+	b = appendMsgpackString(b, "message")
+	b = appendMsgpackString(b, message)
+	for _, name := range names {
+		b = appendMsgpackString(b, name)
+		b = appendMsgpackString(b, w.fields[name])
+	}
+
+	if chunk != "" {
+		b = appendMsgpackMapHeader(b, 1)
+		b = appendMsgpackString(b, "chunk")
+		b = appendMsgpackString(b, chunk)
+	}
+	return b, chunk, nil
+}
+
+// Set the logging format of the message (chainable).  Must be called before
+// the first log message is written.
+func (w *FluentLogWriter) SetFormat(format string) *FluentLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *FluentLogWriter) SetFormatter(formatter Formatter) *FluentLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the tag events are sent under (chainable).  Must be called before the
+// first log message is written.
+func (w *FluentLogWriter) SetTag(tag string) *FluentLogWriter {
+	w.tag = tag
+	return w
+}
+
+// Add a field sent with every event (chainable), e.g. the service name.  Must
+// be called before the first log message is written.
+func (w *FluentLogWriter) SetField(name, value string) *FluentLogWriter {
+	w.fields[name] = value
+	return w
+}
+
+// Set whether to wait for the server to acknowledge each event, as with
+// require_ack_response in Fluent Bit (chainable).  An event not acknowledged
+// within the ack timeout is treated as lost.  Must be called before the first
+// log message is written.
+func (w *FluentLogWriter) SetAck(ack bool) *FluentLogWriter {
+	w.ack = ack
+	return w
+}
+
+// Set how long to wait for an ack (chainable).  The default is ten seconds.
+// Must be called before the first log message is written.
+func (w *FluentLogWriter) SetAckTimeout(timeout time.Duration) *FluentLogWriter {
+	w.ackTimeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time the server
+// cannot be reached (chainable).  It must not log to this writer.  Must be
+// called before the first log message is written.
+func (w *FluentLogWriter) SetErrorHandler(handler func(error)) *FluentLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr while the server cannot be
+// reached (chainable); otherwise they are dropped.  Must be called before the
+// first log message is written.
+func (w *FluentLogWriter) SetStderrFallback(fallback bool) *FluentLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the server again after it cannot be
+// reached (chainable).  The wait doubles with each failure, up to max.  The
+// default is from one second up to a minute.  Must be called before the first
+// log message is written.
+func (w *FluentLogWriter) SetRetryBackoff(initial, max time.Duration) *FluentLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
@@ -0,0 +1,67 @@
+package log4go
+
+import (
+	"strings"
+	"sync"
+)
+
+// A Formatter lays out records for a writer, in place of a format's verbs, for
+// a layout they cannot express, such as CEF, CSV or protobuf.  Format appends
+// rec to *buf, with a newline after it if the layout is line by line.  It may
+// be called from many writers' goroutines at once.
+//
+// Every writer with a format can be given a Formatter instead:
+//
+//	writer.SetFormatter(NewJSONFormatter())
+type Formatter interface {
+	Format(rec *LogRecord, buf *[]byte)
+}
+
+// A FormatterFunc is a function used as a Formatter.
+type FormatterFunc func(rec *LogRecord, buf *[]byte)
+
+// Format calls f(rec, buf).
+func (f FormatterFunc) Format(rec *LogRecord, buf *[]byte) {
+	f(rec, buf)
+}
+
+// The formats registered by name; a format with no % in it is looked up here
+var (
+	namedFormatsLock sync.RWMutex
+	namedFormats     = map[string]Formatter{
+		FORMAT_JSON:     NewJSONFormatter(),
+		FORMAT_LOGFMT:   NewLogfmtFormatter(),
+		FORMAT_COMMON:   &AccessLogFormatter{},
+		FORMAT_COMBINED: &AccessLogFormatter{Combined: true},
+	}
+)
+
+// RegisterFormat makes name, which must not contain a %, a format any writer
+// can be set to, writing records with formatter.  FORMAT_JSON, FORMAT_LOGFMT,
+// FORMAT_COMMON and FORMAT_COMBINED are registered already.
+func RegisterFormat(name string, formatter Formatter) {
+	namedFormatsLock.Lock()
+	defer namedFormatsLock.Unlock()
+	namedFormats[name] = formatter
+}
+
+// The formatter registered as name, if any
+func namedFormat(name string) Formatter {
+	if strings.IndexByte(name, '%') >= 0 {
+		return nil
+	}
+	namedFormatsLock.RLock()
+	defer namedFormatsLock.RUnlock()
+	return namedFormats[name]
+}
+
+// Format rec as a writer does: with formatter, the writer's in place of a
+// format, if it is set, or else with format
+func formatRecord(format string, formatter Formatter, rec *LogRecord) string {
+	if formatter == nil {
+		return FormatLogRecord(format, rec)
+	}
+	buf := make([]byte, 0, 128)
+	formatter.Format(rec, &buf)
+	return string(buf)
+}
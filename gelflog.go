@@ -0,0 +1,307 @@
+package log4go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// GELF chunking, for UDP messages bigger than a datagram
+const (
+	gelfChunkSize = 1420 // fits an Ethernet frame
+	gelfMaxChunks = 128
+)
+
+// This log writer sends output to Graylog, or any GELF input, as GELF 1.1
+// messages: over UDP, compressed and chunked when too big for a datagram, or
+// over TCP, each message ended by a NUL byte.
+type GELFLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	network  string // "udp" or "tcp"
+	hostport string
+	conn     net.Conn
+
+	host        string
+	format      string
+	formatter   Formatter              // in place of format, if set
+	fields      map[string]interface{} // additional fields, names starting with _
+	compression string                 // "gzip", "zlib" or "none", for UDP
+	chunkSize   int
+
+	recovery writeRecovery // keeps going while the server is down
+}
+
+// This is the GELFLogWriter's output method
+func (w *GELFLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
+}
+
+// wait for the records to be sent and close the connection
+func (w *GELFLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewGELFLogWriter creates a new LogWriter which sends records as GELF to
+// hostport over network, "udp" or "tcp".  The short_message is the first line
+// of the record formatted with "%M", the full_message all of it if there are
+// more, the level its syslog severity and the _source additional field its
+// source.  UDP messages are gzipped, unless set otherwise.
+//
+// The connection is made when the first record is sent, and made again should
+// it fail.  While the server cannot be reached, records are dropped, or written
+// to stderr after SetStderrFallback; they are not sent once it can.
+func NewGELFLogWriter(network, hostport string, opts ...Option) *GELFLogWriter {
+	o := newWriterOptions(opts)
+	host, _ := os.Hostname()
+
+	w := &GELFLogWriter{
+		rec:         make(chan *LogRecord, o.bufferLength),
+		blocking:    o.blocking,
+		network:     network,
+		hostport:    hostport,
+		host:        host,
+		format:      "%M",
+		fields:      make(map[string]interface{}),
+		compression: "gzip",
+		chunkSize:   gelfChunkSize,
+		recovery:    newWriteRecovery(),
+	}
+	w.recovery.kind = "GELFLogWriter"
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		defer func() {
+			if w.conn != nil {
+				w.conn.Close()
+			}
+		}()
+
+		for rec := range w.rec {
+			if w.EndNotify(rec) {
+				return
+			}
+			if w.recovery.waiting(time.Now()) {
+				w.recovery.setAside(rec, w.format, w.formatter)
+				continue
+			}
+			if err := w.send(rec); err != nil {
+				w.recovery.failed(w.hostport, err, rec, w.format, w.formatter)
+				continue
+			}
+			w.recovery.succeeded(w.hostport)
+		}
+	}()
+
+	return w
+}
+
+// Send rec, connecting first if need be, and connecting again once if the
+// connection was lost.
+func (w *GELFLogWriter) send(rec *LogRecord) error {
+	msg, err := w.message(rec)
+	if err != nil {
+		return err
+	}
+	packets, err := w.packets(msg)
+	if err != nil {
+		return err
+	}
+
+	if w.conn != nil {
+		if err := w.write(packets); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if w.conn, err = net.DialTimeout(w.network, w.hostport, 10*time.Second); err != nil {
+		return err
+	}
+	if err := w.write(packets); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (w *GELFLogWriter) write(packets [][]byte) error {
+	for _, p := range packets {
+		if _, err := w.conn.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The GELF message for rec, as JSON
+func (w *GELFLogWriter) message(rec *LogRecord) ([]byte, error) {
+	text := string(rec.Binary)
+	if rec.Binary == nil {
+		text = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+	}
+
+	msg := make(map[string]interface{}, 7+len(w.fields))
+	for name, value := range w.fields {
+		msg[name] = value
+	}
+	msg["version"] = "1.1"
+	msg["host"] = w.host
+	msg["timestamp"] = float64(rec.Created.UnixNano()/int64(time.Millisecond)) / 1000
+	msg["level"] = syslogSeverity(rec.Level)
+	if i := strings.Index(text, "\n"); i >= 0 {
+		msg["short_message"] = text[:i]
+		msg["full_message"] = text
+	} else {
+		msg["short_message"] = text
+	}
+	if rec.Source != "" {
+		msg["_source"] = rec.Source
+	}
+	return json.Marshal(msg)
+}
+
+// The packets msg is sent as: for TCP the message and a NUL, for UDP the
+// compressed message, in chunks if it does not fit in one
+func (w *GELFLogWriter) packets(msg []byte) ([][]byte, error) {
+	if !strings.HasPrefix(w.network, "udp") {
+		return [][]byte{append(msg, 0)}, nil
+	}
+
+	if w.compression != "none" {
+		var buf bytes.Buffer
+		var zw io.WriteCloser
+		if w.compression == "zlib" {
+			zw = zlib.NewWriter(&buf)
+		} else {
+			zw = gzip.NewWriter(&buf)
+		}
+		zw.Write(msg)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		msg = buf.Bytes()
+	}
+	if len(msg) <= w.chunkSize {
+		return [][]byte{msg}, nil
+	}
+
+	// chunks: magic bytes, message ID, sequence number and count, data
+	data := w.chunkSize - 12
+	count := (len(msg) + data - 1) / data
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("GELF message of %d bytes is too big", len(msg))
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	packets := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := msg[i*data:]
+		if len(chunk) > data {
+			chunk = chunk[:data]
+		}
+		p := make([]byte, 0, 12+len(chunk))
+		p = append(p, 0x1e, 0x0f)
+		p = append(p, id...)
+		p = append(p, byte(i), byte(count))
+		packets = append(packets, append(p, chunk...))
+	}
+	return packets, nil
+}
+
+// Set the logging format of the message (chainable).  Must be called before
+// the first log message is written.
+func (w *GELFLogWriter) SetFormat(format string) *GELFLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *GELFLogWriter) SetFormatter(formatter Formatter) *GELFLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the host messages are sent from (chainable).  The default is the name of
+// this host.  Must be called before the first log message is written.
+func (w *GELFLogWriter) SetHost(host string) *GELFLogWriter {
+	w.host = host
+	return w
+}
+
+// Add an additional field sent with every message (chainable), e.g. the
+// environment.  The name gets the leading underscore GELF requires if it lacks
+// one.  Must be called before the first log message is written.
+func (w *GELFLogWriter) SetField(name string, value interface{}) *GELFLogWriter {
+	if !strings.HasPrefix(name, "_") {
+		name = "_" + name
+	}
+	w.fields[name] = value
+	return w
+}
+
+// Set how UDP messages are compressed (chainable): "gzip", the default,
+// "zlib" or "none".  TCP messages are never compressed.  Must be called before
+// the first log message is written.
+func (w *GELFLogWriter) SetCompression(compression string) *GELFLogWriter {
+	switch compression {
+	case "gzip", "zlib", "none":
+		w.compression = compression
+	default:
+		fmt.Fprintf(os.Stderr, "GELFLogWriter(%q): unknown compression %q\n", w.hostport, compression)
+	}
+	return w
+}
+
+// Set the largest UDP datagram sent, chunks included (chainable).  The default
+// of 1420 bytes fits an Ethernet frame; up to 8192 suits a local network.
+// Must be called before the first log message is written.
+func (w *GELFLogWriter) SetChunkSize(size int) *GELFLogWriter {
+	if size > 12 {
+		w.chunkSize = size
+	}
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time the server
+// cannot be reached (chainable).  It must not log to this writer.  Must be
+// called before the first log message is written.
+func (w *GELFLogWriter) SetErrorHandler(handler func(error)) *GELFLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr while the server cannot be
+// reached (chainable); otherwise they are dropped.  Must be called before the
+// first log message is written.
+func (w *GELFLogWriter) SetStderrFallback(fallback bool) *GELFLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the server again after it cannot be
+// reached (chainable).  The wait doubles with each failure, up to max.  The
+// default is from one second up to a minute.  Must be called before the first
+// log message is written.
+func (w *GELFLogWriter) SetRetryBackoff(initial, max time.Duration) *GELFLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
@@ -0,0 +1,477 @@
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The method of log4go.proto's collector service
+const grpcPushMethod = "/log4go.LogCollector/Push"
+
+// This log writer streams batches of records to a collector service, such as
+// a sidecar or node agent, with the LogCollector.Push method of log4go.proto.
+// It speaks gRPC itself, and the HTTP/2 under it, so needs no generated code
+// nor a newer Go.
+//
+// A stream is kept open for a minute or 10000 records, then ended, the
+// collector acknowledging how many records it has received on it.  Should a
+// stream fail, the records not yet acknowledged are sent again on a new one.
+type GRPCLogWriter struct {
+	httpBatcher
+
+	target    string // host:port
+	tlsConfig *tls.Config
+	timeout   time.Duration // of connecting, and of ending a stream
+	fields    map[string]string
+
+	stream        *grpcStream
+	streamAge     time.Duration
+	streamRecords int
+	unacked       [][]*LogRecord // batches sent, not acknowledged
+	unackedCount  int
+}
+
+// An open call of the Push method
+type grpcStream struct {
+	body     *io.PipeWriter
+	cancel   context.CancelFunc
+	done     chan error // the outcome of the call, once it is over
+	received uint64     // acknowledged, set before done is
+	opened   time.Time
+}
+
+// This is the GRPCLogWriter's output method
+func (w *GRPCLogWriter) LogWrite(rec *LogRecord) {
+	w.logWrite(rec)
+}
+
+// wait for the records to be acknowledged and end the stream
+func (w *GRPCLogWriter) Close() {
+	w.close()
+}
+
+// Flush sends the records batched so far on the stream, returning once they
+// have been.
+func (w *GRPCLogWriter) Flush() {
+	w.flush()
+}
+
+// NewGRPCLogWriter creates a new LogWriter which streams records to the
+// collector at target ("host:port") in plaintext, or over TLS after
+// SetTLSConfig.  Each record is sent whole, with its fields and any Binary
+// payload, its message formatted with "%M" until set otherwise.
+//
+// Records are sent in batches of up to 1000, or a second after the first of a
+// batch.  A failed stream is retried up to five times with backoff; should it
+// still fail, the records are dropped, or written to stderr after
+// SetStderrFallback(true).
+func NewGRPCLogWriter(target string, opts ...Option) *GRPCLogWriter {
+	w := &GRPCLogWriter{
+		httpBatcher:   newHTTPBatcher("GRPCLogWriter", "http://"+target+grpcPushMethod, opts),
+		target:        target,
+		timeout:       10 * time.Second,
+		fields:        make(map[string]string),
+		streamAge:     time.Minute,
+		streamRecords: 10000,
+	}
+	w.format = "%M"
+	w.finish = w.end
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go w.run(w.send)
+
+	return w
+}
+
+// Send a batch, on the open stream or on a new one
+func (w *GRPCLogWriter) send(batch []*LogRecord) error {
+	w.unacked = append(w.unacked, batch)
+	w.unackedCount += len(batch)
+
+	err := w.retry(w.push())
+	if err != nil {
+		// the batch itself is set aside as it fails, the ones before it here
+		for _, b := range w.unacked[:len(w.unacked)-1] {
+			w.setAside(b)
+		}
+		w.unacked, w.unackedCount = nil, 0
+	}
+	return err
+}
+
+// retry pushes the unacknowledged batches again, on a new stream, while err
+// is worth retrying, up to maxRetries times
+func (w *GRPCLogWriter) retry(err error) error {
+	wait := w.retryWait
+	for attempt := 0; err != nil && attempt < w.maxRetries && grpcTemporary(err); attempt++ {
+		time.Sleep(wait)
+		wait *= 2
+		if wait > 30*time.Second {
+			wait = 30 * time.Second
+		}
+		err = w.push()
+	}
+	return err
+}
+
+// push writes the last unacknowledged batch on the open stream, or all of them
+// on a new one should there be none or it have failed, then ends the stream if
+// it has been open long enough.
+func (w *GRPCLogWriter) push() error {
+	batches := w.unacked
+	if w.stream != nil {
+		if err := w.stream.write(w.message(batches[len(batches)-1])); err == nil {
+			return w.rotate()
+		}
+		w.stream.abort()
+		w.stream = nil
+	}
+
+	s, err := w.open()
+	if err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		if err := s.write(w.message(batch)); err != nil {
+			// the call's own error says more than the pipe's
+			if cerr := s.abort(); cerr != nil {
+				err = cerr
+			}
+			return err
+		}
+	}
+	w.stream = s
+	return w.rotate()
+}
+
+// End the stream once it has been open long enough, or has enough records
+// unacknowledged
+func (w *GRPCLogWriter) rotate() error {
+	if time.Since(w.stream.opened) < w.streamAge && w.unackedCount < w.streamRecords {
+		return nil
+	}
+	s := w.stream
+	w.stream = nil
+	if err := w.acknowledge(s); err != nil {
+		return err
+	}
+	w.unacked, w.unackedCount = nil, 0
+	return nil
+}
+
+// end ends the stream on close, setting aside what it cannot have acknowledged
+func (w *GRPCLogWriter) end() {
+	if w.stream == nil {
+		return
+	}
+	s := w.stream
+	w.stream = nil
+	// a stream opened again is ended as soon as its records are sent
+	w.streamAge = 0
+	if err := w.retry(w.acknowledge(s)); err != nil {
+		w.recovery.failed(w.url, err, nil, "", nil)
+		for _, batch := range w.unacked {
+			w.setAside(batch)
+		}
+	}
+	w.unacked, w.unackedCount = nil, 0
+}
+
+// Close the stream and wait for the collector to acknowledge its records
+func (w *GRPCLogWriter) acknowledge(s *grpcStream) error {
+	s.body.Close()
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case err = <-s.done:
+	case <-timer.C:
+		s.cancel()
+		<-s.done
+		err = fmt.Errorf("no response from the collector in %s", w.timeout)
+	}
+	if err == nil && s.received != uint64(w.unackedCount) {
+		err = fmt.Errorf("collector acknowledged %d of %d records", s.received, w.unackedCount)
+	}
+	return err
+}
+
+// Open a stream, making the client first if need be
+func (w *GRPCLogWriter) open() (*grpcStream, error) {
+	if w.client.Transport == nil {
+		w.client = w.newClient()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest("POST", w.url, pr)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range w.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	s := &grpcStream{body: pw, cancel: cancel, done: make(chan error, 1), opened: time.Now()}
+	go func() {
+		err := s.call(w.client, req)
+		// writes after the call is over fail, rather than block
+		if err != nil {
+			pr.CloseWithError(err)
+		} else {
+			pr.CloseWithError(io.ErrClosedPipe)
+		}
+		cancel()
+		s.done <- err
+	}()
+	return s, nil
+}
+
+// An HTTP/2 client, without the timeout of a request, as a stream lasts
+func (w *GRPCLogWriter) newClient() *http.Client {
+	return &http.Client{
+		Transport: &h2Transport{dialer: net.Dialer{Timeout: w.timeout}, tlsConfig: w.tlsConfig},
+	}
+}
+
+// Make the call, reading the response
+func (s *grpcStream) call(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{status: resp.StatusCode, body: string(bytes.TrimSpace(body))}
+	}
+
+	// a failure may come with the headers alone
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		if m, err := url.PathUnescape(message); err == nil {
+			message = m
+		}
+		return &grpcStatusError{code: status, message: message}
+	}
+
+	if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		return fmt.Errorf("malformed response of %d bytes", len(body))
+	}
+	s.received = grpcReceived(body[5:])
+	return nil
+}
+
+// Send a message on the stream
+func (s *grpcStream) write(msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	_, err := s.body.Write(append(frame, msg...))
+	return err
+}
+
+// Give up the stream, returning the error it ended with
+func (s *grpcStream) abort() error {
+	s.cancel()
+	s.body.Close()
+	return <-s.done
+}
+
+// A grpcStatusError is a call that ended with a status other than OK
+type grpcStatusError struct {
+	code    string
+	message string
+}
+
+func (e *grpcStatusError) Error() string {
+	return fmt.Sprintf("gRPC status %s: %s", e.code, e.message)
+}
+
+// Whether a failed stream is worth opening again: anything but a status
+// saying the call itself is wrong
+func grpcTemporary(err error) bool {
+	switch err := err.(type) {
+	case *grpcStatusError:
+		// DEADLINE_EXCEEDED, RESOURCE_EXHAUSTED, ABORTED, UNAVAILABLE
+		switch err.code {
+		case "4", "8", "10", "14":
+			return true
+		}
+		return false
+	case *httpStatusError:
+		return err.temporary()
+	}
+	return true
+}
+
+// The LogBatch message of batch, protobuf encoded
+func (w *GRPCLogWriter) message(batch []*LogRecord) []byte {
+	var msg []byte
+	for _, rec := range batch {
+		text := strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+		msg = protoBytes(msg, 1, appendProtoRecord(nil, rec, text))
+	}
+
+	names := make([]string, 0, len(w.fields))
+	for name := range w.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := protoBytes(protoBytes(nil, 1, []byte(name)), 2, []byte(w.fields[name]))
+		msg = protoBytes(msg, 2, entry)
+	}
+	return msg
+}
+
+// The received field of a PushResponse, skipping any other
+func grpcReceived(msg []byte) uint64 {
+	var received uint64
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			break
+		}
+		msg = msg[n:]
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return received
+			}
+			if key>>3 == 1 {
+				received = v
+			}
+			msg = msg[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(msg) < size {
+				return received
+			}
+			msg = msg[size:]
+		case 2:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return received
+			}
+			msg = msg[n+int(l):]
+		default:
+			return received
+		}
+	}
+	return received
+}
+
+// Set the logging format of the message (chainable).  Must be called before
+// the first log message is written.
+func (w *GRPCLogWriter) SetFormat(format string) *GRPCLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *GRPCLogWriter) SetFormatter(formatter Formatter) *GRPCLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Add a field to every batch (chainable), e.g. the service name.  Must be
+// called before the first log message is written.
+func (w *GRPCLogWriter) SetField(name, value string) *GRPCLogWriter {
+	w.fields[name] = value
+	return w
+}
+
+// Set metadata sent with every stream (chainable), e.g. "authorization".  Must
+// be called before the first log message is written.
+func (w *GRPCLogWriter) SetMetadata(name, value string) *GRPCLogWriter {
+	w.header.Set(name, value)
+	return w
+}
+
+// Set the TLS configuration to connect with (chainable); without one, the
+// connection is in plaintext.  Must be called before the first log message is
+// written.
+func (w *GRPCLogWriter) SetTLSConfig(config *tls.Config) *GRPCLogWriter {
+	w.tlsConfig = config
+	w.url = "https://" + w.target + grpcPushMethod
+	return w
+}
+
+// Set the most records sent in a message, and the longest the first of them
+// waits to be sent (chainable).  The default is 1000 records and a second.
+// Must be called before the first log message is written.
+func (w *GRPCLogWriter) SetBatch(size int, wait time.Duration) *GRPCLogWriter {
+	w.batchSize, w.batchWait = size, wait
+	return w
+}
+
+// Set how long a stream is kept open, and how many records it carries at most,
+// before it is ended and its records acknowledged (chainable).  The default is
+// a minute and 10000 records.  Must be called before the first log message is
+// written.
+func (w *GRPCLogWriter) SetStream(age time.Duration, records int) *GRPCLogWriter {
+	w.streamAge, w.streamRecords = age, records
+	return w
+}
+
+// Set how many more times a stream is opened when it fails, and the wait
+// before the first retry, doubling after (chainable).  The default is five
+// times, from half a second.  Must be called before the first log message is
+// written.
+func (w *GRPCLogWriter) SetRetry(retries int, wait time.Duration) *GRPCLogWriter {
+	w.maxRetries, w.retryWait = retries, wait
+	return w
+}
+
+// Set how long connecting, and the collector acknowledging a stream, may take
+// (chainable).  The default is 10 seconds.  Must be called before the first
+// log message is written.
+func (w *GRPCLogWriter) SetTimeout(timeout time.Duration) *GRPCLogWriter {
+	w.timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time records cannot
+// be sent (chainable).  It must not log to this writer.  Must be called before
+// the first log message is written.
+func (w *GRPCLogWriter) SetErrorHandler(handler func(error)) *GRPCLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be sent
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *GRPCLogWriter) SetStderrFallback(fallback bool) *GRPCLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
@@ -0,0 +1,114 @@
+package log4go
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGRPCLogWriter(t *testing.T) {
+	// each stream's messages, the first answered UNAVAILABLE when fail is set
+	var mu sync.Mutex
+	var streams [][][]byte
+	fail := false
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var msgs [][]byte
+		header := make([]byte, 5)
+		for {
+			if _, err := io.ReadFull(req.Body, header); err != nil {
+				break
+			}
+			msg := make([]byte, binary.BigEndian.Uint32(header[1:]))
+			if _, err := io.ReadFull(req.Body, msg); err != nil {
+				break
+			}
+			msgs = append(msgs, msg)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		streams = append(streams, msgs)
+		if req.URL.Path != grpcPushMethod || req.Header.Get("X-Token") != "token" {
+			t.Errorf("GRPCLogWriter: called %s with %q", req.URL.Path, req.Header)
+		}
+		rw.Header().Set("Content-Type", "application/grpc")
+		if fail {
+			fail = false
+			rw.Header().Set("Grpc-Status", "14")
+			return
+		}
+		rw.Header().Set("Trailer", "Grpc-Status")
+		// count the records, the LogBatch's first field
+		received := 0
+		for _, msg := range msgs {
+			for len(msg) > 0 {
+				if msg[0] == 1<<3|2 {
+					received++
+				}
+				l, n := binary.Uvarint(msg[1:])
+				msg = msg[1+n+int(l):]
+			}
+		}
+		ack := protoVarint(protoVarint(nil, 1<<3), uint64(received))
+		frame := make([]byte, 5)
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(ack)))
+		rw.Write(append(frame, ack...))
+		rw.Header().Set("Grpc-Status", "0")
+	}))
+	// the server speaks HTTP/2 to a client asking for it
+	srv.TLS = &tls.Config{NextProtos: []string{"h2"}}
+	srv.StartTLS()
+	defer srv.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	w := NewGRPCLogWriter(strings.TrimPrefix(srv.URL, "https://")).SetMetadata("X-Token", "token").
+		SetField("app", "test").SetStream(time.Hour, 2).SetRetry(2, time.Millisecond).
+		SetTLSConfig(&tls.Config{RootCAs: roots})
+
+	rec := newLogRecord(ERROR, "source", "first")
+	rec.Goroutine = 7
+	rec.Binary = []byte{0xff}
+	rec.Fields = Fields{"user": "ann"}
+	w.LogWrite(rec)
+	w.Flush()
+	w.LogWrite(newLogRecord(INFO, "source", "second"))
+	w.Flush()
+
+	// the stream ends with its second record
+	mu.Lock()
+	if len(streams) != 1 || len(streams[0]) != 2 {
+		t.Fatalf("GRPCLogWriter: got %d streams, want 1 of 2 messages", len(streams))
+	}
+	var r []byte
+	r = protoVarint(protoVarint(r, 1<<3), uint64(ERROR))
+	r = protoVarint(protoVarint(r, 2<<3), uint64(now.UnixNano()))
+	r = protoBytes(r, 3, []byte("source"))
+	r = protoBytes(r, 4, []byte("first"))
+	r = protoVarint(protoVarint(r, 5<<3), 7)
+	r = protoBytes(r, 6, []byte{0xff})
+	r = protoBytes(r, 7, protoBytes(protoBytes(nil, 1, []byte("user")), 2, []byte("ann")))
+	want := protoBytes(protoBytes(nil, 1, r), 2, protoBytes(protoBytes(nil, 1, []byte("app")), 2, []byte("test")))
+	if got := streams[0][0]; string(got) != string(want) {
+		t.Errorf("GRPCLogWriter: sent %x, want %x", got, want)
+	}
+	fail = true
+	mu.Unlock()
+
+	// the failed stream's record is sent again on the next one
+	w.LogWrite(newLogRecord(INFO, "source", "third"))
+	w.Flush()
+	w.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(streams) != 3 || len(streams[1]) != 1 || string(streams[2][0]) != string(streams[1][0]) {
+		t.Errorf("GRPCLogWriter: got %d streams, want the third record sent twice", len(streams))
+	}
+}
@@ -0,0 +1,197 @@
+package log4go
+
+import (
+	"strings"
+	"sync"
+)
+
+// The field naming the logger GetLogger gives a record of
+const loggerField = "logger"
+
+// The levels and filters set for the names of loggers, as log4j's categories;
+// "" is the root
+type loggerRegistry struct {
+	sync.RWMutex
+	byName map[string]*namedLogger
+	owned  map[string]bool // the tags of filters set for a name but the root
+}
+
+var loggers = &loggerRegistry{byName: make(map[string]*namedLogger), owned: make(map[string]bool)}
+
+type namedLogger struct {
+	level    Level
+	hasLevel bool
+	tags     []string
+	hasTags  bool
+	additive bool
+}
+
+// GetLogger returns the Logger of name, one of a hierarchy of names separated
+// by dots, such as "myapp.storage.s3", whose parents are "myapp.storage",
+// "myapp" and the root, log.  Its records carry the name as the field
+// "logger", and are written as set for the nearest of the names set:
+//
+//	log4go.SetLoggerLevel("myapp", log4go.INFO)
+//	log4go.SetLoggerLevel("myapp.storage", log4go.DEBUG)
+//	log4go.SetLoggerFilters("myapp.storage.s3", true, "s3file")
+//	s3log := log4go.GetLogger("myapp.storage.s3")
+//	s3log.Debug("put %s", key) // to s3file, and to the root's filters
+//
+// A record is written if it is at or above the level set for the nearest of
+// its names that has one, or else at or above each filter's level.  It goes
+// to the filters of log set for its name and each parent's, up to a name set
+// not additive; or, if none is, to those of the root, which are the filters of
+// log that are not set for any name but the root, unless the root has filters
+// set.  A record logged to log itself goes to all of its filters, as ever.
+//
+// The levels and filters may be set at any time, as well as in the
+// configuration files, and are looked up as each record is written.  The
+// Logger has the one filter of its name, at FINEST, since its level may
+// change; it is log's to close.
+func (log Logger) GetLogger(name string) Logger {
+	named := Logger{name: &Filter{FINEST, &namedLogWriter{root: log, name: name}}}
+	return named.With(Fields{loggerField: name})
+}
+
+// SetLoggerLevel sets the level of the logger of name, and of those under it
+// with none of their own.  It may be called at any time.
+func SetLoggerLevel(name string, lvl Level) {
+	loggers.Lock()
+	defer loggers.Unlock()
+	l := loggers.named(name)
+	l.level, l.hasLevel = lvl, true
+}
+
+// SetLoggerFilters sets the filters the records of the logger of name, and of
+// those under it with none of their own, are written to, by their tags, and
+// whether they are also written to its parent's, if additive.  It may be called
+// at any time.
+func SetLoggerFilters(name string, additive bool, tags ...string) {
+	loggers.Lock()
+	defer loggers.Unlock()
+	l := loggers.named(name)
+	l.tags, l.hasTags, l.additive = append([]string(nil), tags...), true, additive
+	loggers.own()
+}
+
+// ResetLoggers unsets the levels and filters of all the loggers' names, so
+// that their records are written as the root's.  It may be called at any time.
+func ResetLoggers() {
+	loggers.Lock()
+	defer loggers.Unlock()
+	loggers.byName = make(map[string]*namedLogger)
+	loggers.owned = make(map[string]bool)
+}
+
+// Replace the levels and filters of all the loggers' names at once, as a
+// configuration file sets them
+func setLoggers(byName map[string]*namedLogger) {
+	loggers.Lock()
+	defer loggers.Unlock()
+	loggers.byName = byName
+	loggers.own()
+}
+
+// Find which filters are set for a name but the root; it must be locked
+func (reg *loggerRegistry) own() {
+	reg.owned = make(map[string]bool)
+	for name, l := range reg.byName {
+		if name == "" {
+			continue
+		}
+		for _, tag := range l.tags {
+			reg.owned[tag] = true
+		}
+	}
+}
+
+// The logger of name, made if it was not set; it must be locked
+func (reg *loggerRegistry) named(name string) *namedLogger {
+	l := reg.byName[name]
+	if l == nil {
+		l = &namedLogger{additive: true}
+		reg.byName[name] = l
+	}
+	return l
+}
+
+// How the records of a logger are written: at or above level, if it is set,
+// to the filters of tags, and the root's if all
+type loggerRoute struct {
+	level    Level
+	hasLevel bool
+	tags     map[string]bool
+	all      bool
+	owned    map[string]bool // not the root's
+}
+
+// The route of the records of the logger of name
+func routeOf(name string) *loggerRoute {
+	loggers.RLock()
+	defer loggers.RUnlock()
+	route := &loggerRoute{tags: make(map[string]bool), all: true, owned: loggers.owned}
+	for {
+		if l := loggers.byName[name]; l != nil {
+			if l.hasLevel && !route.hasLevel {
+				route.level, route.hasLevel = l.level, true
+			}
+			if l.hasTags && route.all {
+				for _, tag := range l.tags {
+					route.tags[tag] = true
+				}
+				// The root's filters set are all it has
+				route.all = l.additive && name != ""
+			}
+		}
+		if name == "" {
+			return route
+		}
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			name = name[:i]
+		} else {
+			name = ""
+		}
+	}
+}
+
+// Whether a record at lvl goes to the filter of tag at its level
+func (route *loggerRoute) writes(lvl Level, tag string, filtLevel Level) bool {
+	if !route.tags[tag] && (!route.all || route.owned[tag]) {
+		return false
+	}
+	if route.hasLevel {
+		return lvl >= route.level
+	}
+	return lvl >= filtLevel
+}
+
+// A writer routing the records of a logger by its route to filters of its
+// own, as a ConfigWatcher does to the filters of its configuration
+type filterRouter interface {
+	routeRecord(rec *LogRecord, writes func(tag string, lvl Level) bool)
+}
+
+// This log writer is the filter of a logger GetLogger gives, which writes
+// records to the filters of the root Logger as set for its name.
+type namedLogWriter struct {
+	root Logger
+	name string
+}
+
+// LogWrite writes rec to the filters of the root it goes to.
+func (w *namedLogWriter) LogWrite(rec *LogRecord) {
+	route := routeOf(w.name)
+	writes := func(tag string, lvl Level) bool {
+		return route.writes(rec.Level, tag, lvl)
+	}
+	for tag, filt := range w.root {
+		if router, ok := filt.LogWriter.(filterRouter); ok {
+			router.routeRecord(rec, writes)
+		} else if writes(tag, filt.Level) {
+			filt.LogWrite(rec)
+		}
+	}
+}
+
+// Close does nothing: the filters are the root's.
+func (w *namedLogWriter) Close() {}
@@ -0,0 +1,955 @@
+package log4go
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This is as much of HTTP/2 as GRPCLogWriter needs for its calls, in
+// plaintext with prior knowledge or over TLS: a request on a connection of its
+// own, its body streamed as it is written, and the response read with its
+// trailers.  The request's headers are sent without compression; those of the
+// response are read with HPACK in full.
+
+const (
+	h2FrameData         = 0x0
+	h2FrameHeaders      = 0x1
+	h2FrameRSTStream    = 0x3
+	h2FrameSettings     = 0x4
+	h2FramePushPromise  = 0x5
+	h2FramePing         = 0x6
+	h2FrameGoAway       = 0x7
+	h2FrameWindowUpdate = 0x8
+	h2FrameContinuation = 0x9
+
+	h2FlagEndStream  = 0x1
+	h2FlagAck        = 0x1
+	h2FlagEndHeaders = 0x4
+	h2FlagPadded     = 0x8
+	h2FlagPriority   = 0x20
+
+	h2SettingEnablePush        = 0x2
+	h2SettingInitialWindowSize = 0x4
+	h2SettingMaxFrameSize      = 0x5
+
+	h2ErrorCancel = 0x8
+
+	h2Stream       = 1         // the only stream, of the one request
+	h2DefaultFrame = 16384     // the longest frame, unless the peer takes more
+	h2DefaultWin   = 65535     // the initial window of each side
+	h2MaxHeaders   = 1 << 20   // the longest header block read
+	h2MaxWindow    = 1<<31 - 1 // the widest a window may be
+	h2HPACKTable   = 4096      // the dynamic table the peer may use
+	h2Preface      = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+)
+
+// The headers not carried by HTTP/2
+var h2ConnectionHeaders = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+var errH2Closed = errors.New("HTTP/2 connection closed")
+
+// An h2Transport makes each request on a new HTTP/2 connection, in plaintext
+// or, with a TLS configuration, over TLS.
+type h2Transport struct {
+	dialer    net.Dialer
+	tlsConfig *tls.Config
+}
+
+// RoundTrip makes the request, returning once the response's headers are read
+func (t *h2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := t.dial(req.Context(), req.URL.Host)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return newH2Conn(conn).roundTrip(req)
+}
+
+// Connect to addr, negotiating HTTP/2 should it be over TLS
+func (t *h2Transport) dial(ctx context.Context, addr string) (net.Conn, error) {
+	conn, err := t.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil || t.tlsConfig == nil {
+		return conn, err
+	}
+
+	config := t.tlsConfig.Clone()
+	config.NextProtos = []string{"h2"}
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+	tconn := tls.Client(conn, config)
+	if t.dialer.Timeout > 0 {
+		tconn.SetDeadline(time.Now().Add(t.dialer.Timeout))
+	}
+	if err := tconn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tconn.SetDeadline(time.Time{})
+	if proto := tconn.ConnectionState().NegotiatedProtocol; proto != "h2" {
+		conn.Close()
+		return nil, fmt.Errorf("server at %s did not negotiate HTTP/2", addr)
+	}
+	return tconn, nil
+}
+
+// An h2Conn is a connection carrying one request, its frames read on a
+// goroutine of its own.
+type h2Conn struct {
+	conn   net.Conn
+	wmu    sync.Mutex // held while writing a frame
+	hpack  hpackDecoder
+	closed chan struct{}
+
+	mu            sync.Mutex
+	cond          *sync.Cond // broadcast as any of the below changes
+	connWindow    int64      // what may be sent yet, on the connection
+	streamWindow  int64      // and on the stream
+	initialWindow int64      // the stream's, as the server last set it
+	maxFrame      int
+	resp          *http.Response // once its headers are read
+	body          bytes.Buffer   // of the response, not yet read
+	ended         bool           // the response is all read
+	err           error          // the connection is over
+}
+
+func newH2Conn(conn net.Conn) *h2Conn {
+	c := &h2Conn{
+		conn:          conn,
+		hpack:         hpackDecoder{maxSize: h2HPACKTable},
+		closed:        make(chan struct{}),
+		connWindow:    h2DefaultWin,
+		streamWindow:  h2DefaultWin,
+		initialWindow: h2DefaultWin,
+		maxFrame:      h2DefaultFrame,
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Make the request, its body written on a goroutine as it comes
+func (c *h2Conn) roundTrip(req *http.Request) (*http.Response, error) {
+	go c.readFrames()
+	go func() {
+		select {
+		case <-req.Context().Done():
+			c.close(req.Context().Err())
+		case <-c.closed:
+		}
+	}()
+
+	settings := make([]byte, 6)
+	binary.BigEndian.PutUint16(settings, h2SettingEnablePush)
+	flags := byte(h2FlagEndHeaders)
+	if req.Body == nil {
+		flags |= h2FlagEndStream
+	}
+	if _, err := io.WriteString(c.conn, h2Preface); err != nil {
+		c.close(err)
+	} else if err := c.writeFrame(h2FrameSettings, 0, 0, settings); err == nil {
+		c.writeHeaders(flags, h2RequestHeaders(req))
+	}
+	if req.Body != nil {
+		go c.writeBody(req.Body)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.resp == nil && c.err == nil {
+		c.cond.Wait()
+	}
+	if c.resp == nil {
+		return nil, c.err
+	}
+	c.resp.Request = req
+	return c.resp, nil
+}
+
+// The request's header block, its names in lower case and its fields literal,
+// not indexed
+func h2RequestHeaders(req *http.Request) []byte {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	scheme := "http"
+	if req.URL.Scheme == "https" {
+		scheme = "https"
+	}
+
+	var b []byte
+	field := func(name, value string) {
+		b = append(b, 0)
+		b = append(hpackInt(b, 7, uint64(len(name))), name...)
+		b = append(hpackInt(b, 7, uint64(len(value))), value...)
+	}
+	field(":method", req.Method)
+	field(":scheme", scheme)
+	field(":authority", host)
+	field(":path", req.URL.RequestURI())
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if h2ConnectionHeaders[name] || name == "host" {
+			continue
+		}
+		for _, value := range values {
+			field(name, value)
+		}
+	}
+	return b
+}
+
+// Write a header block, as a HEADERS frame and as many CONTINUATION frames as
+// it takes
+func (c *h2Conn) writeHeaders(flags byte, block []byte) error {
+	c.mu.Lock()
+	max := c.maxFrame
+	c.mu.Unlock()
+
+	typ := byte(h2FrameHeaders)
+	for {
+		n := len(block)
+		f := flags &^ h2FlagEndHeaders
+		if n > max {
+			n = max
+		} else {
+			f = flags
+		}
+		if err := c.writeFrame(typ, f, h2Stream, block[:n]); err != nil {
+			return err
+		}
+		block = block[n:]
+		if len(block) == 0 {
+			return nil
+		}
+		typ, flags = h2FrameContinuation, flags&h2FlagEndHeaders
+	}
+}
+
+// Send the request's body, then end the stream, cancelling it should the body
+// fail
+func (c *h2Conn) writeBody(body io.ReadCloser) {
+	defer body.Close()
+	buf := make([]byte, h2DefaultFrame)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if werr := c.writeData(buf[:n], false); werr != nil {
+				return
+			}
+		}
+		if err == io.EOF {
+			c.writeData(nil, true)
+			return
+		}
+		if err != nil {
+			c.writeUint32(h2FrameRSTStream, h2Stream, h2ErrorCancel)
+			c.close(err)
+			return
+		}
+	}
+}
+
+// Write p as DATA frames, as the windows allow, the last ending the stream if
+// end is set
+func (c *h2Conn) writeData(p []byte, end bool) error {
+	for {
+		c.mu.Lock()
+		for c.err == nil && len(p) > 0 && (c.connWindow <= 0 || c.streamWindow <= 0) {
+			c.cond.Wait()
+		}
+		if c.err != nil {
+			err := c.err
+			c.mu.Unlock()
+			return err
+		}
+		n := int64(len(p))
+		for _, max := range []int64{c.connWindow, c.streamWindow, int64(c.maxFrame)} {
+			if n > max {
+				n = max
+			}
+		}
+		c.connWindow -= n
+		c.streamWindow -= n
+		c.mu.Unlock()
+
+		var flags byte
+		if end && n == int64(len(p)) {
+			flags = h2FlagEndStream
+		}
+		if err := c.writeFrame(h2FrameData, flags, h2Stream, p[:n]); err != nil {
+			return err
+		}
+		p = p[n:]
+		if len(p) == 0 {
+			return nil
+		}
+	}
+}
+
+// Write a frame whose payload is a 32-bit value, a WINDOW_UPDATE or a
+// RST_STREAM
+func (c *h2Conn) writeUint32(typ byte, stream uint32, v uint32) error {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, v)
+	return c.writeFrame(typ, 0, stream, payload)
+}
+
+// Write a frame, the connection closing should it fail
+func (c *h2Conn) writeFrame(typ, flags byte, stream uint32, payload []byte) error {
+	frame := make([]byte, 9, 9+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload))<<8|uint32(typ))
+	frame[4] = flags
+	binary.BigEndian.PutUint32(frame[5:], stream)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.conn.Write(append(frame, payload...))
+	if err != nil {
+		c.close(err)
+	}
+	return err
+}
+
+// End the connection, err being why, for the first to end it
+func (c *h2Conn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.conn.Close()
+	close(c.closed)
+	c.cond.Broadcast()
+}
+
+// Read frames until the connection is over, answering those that ask for it
+func (c *h2Conn) readFrames() {
+	header := make([]byte, 9)
+	var block []byte // what has been read of a header block
+	var blockEnd bool
+	for {
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			c.close(err)
+			return
+		}
+		length := int(binary.BigEndian.Uint32(header) >> 8)
+		typ, flags := header[3], header[4]
+		stream := binary.BigEndian.Uint32(header[5:]) & h2MaxWindow
+		if length > h2DefaultFrame {
+			c.close(fmt.Errorf("HTTP/2 frame of %d bytes", length))
+			return
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.conn, payload); err != nil {
+			c.close(err)
+			return
+		}
+		if block != nil && typ != h2FrameContinuation {
+			c.close(errors.New("HTTP/2 header block not ended"))
+			return
+		}
+
+		var err error
+		switch typ {
+		case h2FrameData:
+			err = c.readData(flags, stream, payload)
+		case h2FrameHeaders:
+			if payload, err = h2Unpad(flags, payload); err != nil {
+				break
+			}
+			if flags&h2FlagPriority != 0 {
+				if len(payload) < 5 {
+					err = errors.New("malformed HTTP/2 HEADERS frame")
+					break
+				}
+				payload = payload[5:]
+			}
+			block, blockEnd = append([]byte{}, payload...), flags&h2FlagEndStream != 0
+			if flags&h2FlagEndHeaders != 0 {
+				err = c.readHeaders(stream, block, blockEnd)
+				block = nil
+			}
+		case h2FrameContinuation:
+			if block == nil {
+				err = errors.New("HTTP/2 CONTINUATION frame without HEADERS")
+				break
+			}
+			if block = append(block, payload...); len(block) > h2MaxHeaders {
+				err = errors.New("HTTP/2 header block too long")
+				break
+			}
+			if flags&h2FlagEndHeaders != 0 {
+				err = c.readHeaders(stream, block, blockEnd)
+				block = nil
+			}
+		case h2FrameRSTStream:
+			if len(payload) == 4 {
+				err = fmt.Errorf("HTTP/2 stream reset, error code %d", binary.BigEndian.Uint32(payload))
+			} else {
+				err = errors.New("malformed HTTP/2 RST_STREAM frame")
+			}
+		case h2FrameSettings:
+			err = c.readSettings(flags, payload)
+		case h2FramePushPromise:
+			err = errors.New("HTTP/2 push promised, though disabled")
+		case h2FramePing:
+			if flags&h2FlagAck == 0 {
+				err = c.writeFrame(h2FramePing, h2FlagAck, 0, payload)
+			}
+		case h2FrameGoAway:
+			// a stream the server has begun to process it may yet finish
+			if len(payload) < 8 {
+				err = errors.New("malformed HTTP/2 GOAWAY frame")
+			} else if binary.BigEndian.Uint32(payload)&h2MaxWindow < h2Stream {
+				err = fmt.Errorf("HTTP/2 connection refused, error code %d", binary.BigEndian.Uint32(payload[4:]))
+			}
+		case h2FrameWindowUpdate:
+			err = c.readWindowUpdate(stream, payload)
+		}
+		if err != nil {
+			c.close(err)
+			return
+		}
+	}
+}
+
+// Strip the padding of a DATA or HEADERS frame
+func h2Unpad(flags byte, payload []byte) ([]byte, error) {
+	if flags&h2FlagPadded == 0 {
+		return payload, nil
+	}
+	if len(payload) == 0 || int(payload[0]) >= len(payload) {
+		return nil, errors.New("malformed HTTP/2 padding")
+	}
+	return payload[1 : len(payload)-int(payload[0])], nil
+}
+
+// Take in the response's body, the window given back as it is read
+func (c *h2Conn) readData(flags byte, stream uint32, payload []byte) error {
+	data, err := h2Unpad(flags, payload)
+	if err != nil {
+		return err
+	}
+	if stream != h2Stream {
+		return fmt.Errorf("HTTP/2 DATA frame on stream %d", stream)
+	}
+	// the padding is given back at once
+	if padding := len(payload) - len(data); padding > 0 {
+		if err := c.writeUint32(h2FrameWindowUpdate, 0, uint32(padding)); err != nil {
+			return err
+		}
+		if err := c.writeUint32(h2FrameWindowUpdate, h2Stream, uint32(padding)); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resp == nil || c.ended {
+		return errors.New("HTTP/2 DATA frame out of place")
+	}
+	c.body.Write(data)
+	c.ended = flags&h2FlagEndStream != 0
+	c.cond.Broadcast()
+	return nil
+}
+
+// Take in a header block, the response's headers, or its trailers
+func (c *h2Conn) readHeaders(stream uint32, block []byte, end bool) error {
+	header := make(http.Header)
+	status := ""
+	err := c.hpack.decode(block, func(name, value string) {
+		if name == ":status" {
+			status = value
+		} else if !strings.HasPrefix(name, ":") {
+			header.Add(name, value)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if stream != h2Stream {
+		return fmt.Errorf("HTTP/2 HEADERS frame on stream %d", stream)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ended {
+		return errors.New("HTTP/2 HEADERS frame after the stream ended")
+	}
+	if c.resp != nil {
+		if !end {
+			return errors.New("HTTP/2 trailers not ending the stream")
+		}
+		for name, values := range header {
+			c.resp.Trailer[name] = values
+		}
+		c.ended = true
+		c.cond.Broadcast()
+		return nil
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 100 || code > 999 {
+		return fmt.Errorf("HTTP/2 response of status %q", status)
+	}
+	if code < 200 {
+		return nil // informational, the response to follow
+	}
+	c.resp = &http.Response{
+		Status:        status + " " + http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        header,
+		Body:          &h2Body{c},
+		ContentLength: -1,
+		Trailer:       make(http.Header),
+	}
+	c.ended = end
+	c.cond.Broadcast()
+	return nil
+}
+
+// Apply the server's settings, and acknowledge them
+func (c *h2Conn) readSettings(flags byte, payload []byte) error {
+	if flags&h2FlagAck != 0 {
+		return nil
+	}
+	if len(payload)%6 != 0 {
+		return errors.New("malformed HTTP/2 SETTINGS frame")
+	}
+
+	c.mu.Lock()
+	for ; len(payload) > 0; payload = payload[6:] {
+		v := binary.BigEndian.Uint32(payload[2:])
+		switch binary.BigEndian.Uint16(payload) {
+		case h2SettingInitialWindowSize:
+			if v > h2MaxWindow {
+				c.mu.Unlock()
+				return errors.New("HTTP/2 initial window too wide")
+			}
+			// the stream's window moves by as much as the initial one
+			c.streamWindow += int64(v) - c.initialWindow
+			c.initialWindow = int64(v)
+		case h2SettingMaxFrameSize:
+			if v >= h2DefaultFrame && v <= 1<<24-1 {
+				c.maxFrame = int(v)
+			}
+		}
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	return c.writeFrame(h2FrameSettings, h2FlagAck, 0, nil)
+}
+
+// Widen the window of the connection, or of the stream
+func (c *h2Conn) readWindowUpdate(stream uint32, payload []byte) error {
+	if len(payload) != 4 {
+		return errors.New("malformed HTTP/2 WINDOW_UPDATE frame")
+	}
+	n := int64(binary.BigEndian.Uint32(payload) & h2MaxWindow)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	window := &c.connWindow
+	if stream != 0 {
+		window = &c.streamWindow
+	}
+	if *window += n; *window > h2MaxWindow {
+		return errors.New("HTTP/2 window too wide")
+	}
+	c.cond.Broadcast()
+	return nil
+}
+
+// An h2Body is the body of the response, its end read once its trailers are
+type h2Body struct {
+	c *h2Conn
+}
+
+func (b *h2Body) Read(p []byte) (int, error) {
+	c := b.c
+	c.mu.Lock()
+	for c.body.Len() == 0 && !c.ended && c.err == nil {
+		c.cond.Wait()
+	}
+	if c.body.Len() == 0 {
+		err := c.err
+		if c.ended {
+			err = io.EOF
+		}
+		c.mu.Unlock()
+		return 0, err
+	}
+	n, _ := c.body.Read(p)
+	c.mu.Unlock()
+
+	// give back to the server what has been read
+	if n > 0 {
+		c.writeUint32(h2FrameWindowUpdate, 0, uint32(n))
+		c.writeUint32(h2FrameWindowUpdate, h2Stream, uint32(n))
+	}
+	return n, nil
+}
+
+// Close ends the connection, the request with it, should it not be over
+func (b *h2Body) Close() error {
+	b.c.close(errH2Closed)
+	return nil
+}
+
+// hpackDecoder decodes the header blocks of a connection, keeping its dynamic
+// table between them.
+type hpackDecoder struct {
+	table   [][2]string // the newest first
+	size    int
+	maxSize int
+}
+
+// Decode block, calling f with each field in turn
+func (d *hpackDecoder) decode(block []byte, f func(name, value string)) error {
+	for len(block) > 0 {
+		var index uint64
+		var err error
+		switch b := block[0]; {
+		case b&0x80 != 0: // indexed
+			if index, block, err = hpackReadInt(block, 7); err != nil {
+				return err
+			}
+			field, err := d.field(index)
+			if err != nil {
+				return err
+			}
+			f(field[0], field[1])
+			continue
+		case b&0xe0 == 0x20: // a size update of the dynamic table
+			if index, block, err = hpackReadInt(block, 5); err != nil {
+				return err
+			}
+			if index > h2HPACKTable {
+				return errors.New("HPACK table too large")
+			}
+			d.maxSize = int(index)
+			d.evict()
+			continue
+		}
+
+		// a literal, indexed with its name or with its name literal too
+		indexing := block[0]&0xc0 == 0x40
+		prefix := uint(4)
+		if indexing {
+			prefix = 6
+		}
+		if index, block, err = hpackReadInt(block, prefix); err != nil {
+			return err
+		}
+		var name, value string
+		if index == 0 {
+			if name, block, err = hpackReadString(block); err != nil {
+				return err
+			}
+		} else {
+			field, err := d.field(index)
+			if err != nil {
+				return err
+			}
+			name = field[0]
+		}
+		if value, block, err = hpackReadString(block); err != nil {
+			return err
+		}
+		if indexing {
+			d.add(name, value)
+		}
+		f(name, value)
+	}
+	return nil
+}
+
+// The field of the index, of the static table or then of the dynamic one
+func (d *hpackDecoder) field(index uint64) ([2]string, error) {
+	switch {
+	case index == 0:
+		return [2]string{}, errors.New("HPACK index 0")
+	case index <= uint64(len(hpackStaticTable)):
+		return hpackStaticTable[index-1], nil
+	case index-uint64(len(hpackStaticTable)) <= uint64(len(d.table)):
+		return d.table[index-uint64(len(hpackStaticTable))-1], nil
+	}
+	return [2]string{}, fmt.Errorf("HPACK index %d not in the table", index)
+}
+
+// Add a field to the dynamic table, evicting the oldest as need be
+func (d *hpackDecoder) add(name, value string) {
+	d.table = append([][2]string{{name, value}}, d.table...)
+	d.size += len(name) + len(value) + 32
+	d.evict()
+}
+
+func (d *hpackDecoder) evict() {
+	for d.size > d.maxSize {
+		oldest := d.table[len(d.table)-1]
+		d.table = d.table[:len(d.table)-1]
+		d.size -= len(oldest[0]) + len(oldest[1]) + 32
+	}
+}
+
+// Append v as an HPACK integer of the prefix's bits, those of the byte above
+// them left 0
+func hpackInt(b []byte, prefix uint, v uint64) []byte {
+	max := uint64(1)<<prefix - 1
+	if v < max {
+		return append(b, byte(v))
+	}
+	b = append(b, byte(max))
+	for v -= max; v >= 0x80; v >>= 7 {
+		b = append(b, byte(v)|0x80)
+	}
+	return append(b, byte(v))
+}
+
+var errHPACKInt = errors.New("malformed HPACK integer")
+
+// Read an HPACK integer of the prefix's bits from the front of b
+func hpackReadInt(b []byte, prefix uint) (uint64, []byte, error) {
+	if len(b) == 0 {
+		return 0, nil, errHPACKInt
+	}
+	max := uint64(1)<<prefix - 1
+	v := uint64(b[0]) & max
+	b = b[1:]
+	if v < max {
+		return v, b, nil
+	}
+	for shift := uint(0); shift < 28; shift += 7 {
+		if len(b) == 0 {
+			return 0, nil, errHPACKInt
+		}
+		c := b[0]
+		b = b[1:]
+		v += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, b, nil
+		}
+	}
+	return 0, nil, errHPACKInt
+}
+
+// Read an HPACK string from the front of b, Huffman coded or not
+func hpackReadString(b []byte) (string, []byte, error) {
+	if len(b) == 0 {
+		return "", nil, errors.New("malformed HPACK string")
+	}
+	huffman := b[0]&0x80 != 0
+	n, b, err := hpackReadInt(b, 7)
+	if err != nil {
+		return "", nil, err
+	}
+	if n > uint64(len(b)) {
+		return "", nil, errors.New("malformed HPACK string")
+	}
+	s := b[:n]
+	if !huffman {
+		return string(s), b[n:], nil
+	}
+	decoded, err := huffmanDecode(s)
+	return decoded, b[n:], err
+}
+
+// The Huffman code as a tree, each node's children indexed by the next bit,
+// a child being a node's index, or the negative of a byte's plus one
+var (
+	huffmanTree     [][2]int32
+	huffmanTreeOnce sync.Once
+)
+
+func buildHuffmanTree() {
+	huffmanTree = [][2]int32{{}}
+	for sym, code := range hpackHuffmanCodes {
+		n := 0
+		for i := int(hpackHuffmanCodeLen[sym]) - 1; i >= 0; i-- {
+			bit := code >> uint(i) & 1
+			if i == 0 {
+				huffmanTree[n][bit] = -int32(sym) - 1
+				break
+			}
+			if huffmanTree[n][bit] == 0 {
+				huffmanTree = append(huffmanTree, [2]int32{})
+				huffmanTree[n][bit] = int32(len(huffmanTree) - 1)
+			}
+			n = int(huffmanTree[n][bit])
+		}
+	}
+}
+
+var errHuffman = errors.New("malformed HPACK Huffman code")
+
+// Decode the Huffman coded s, which may end with up to 7 bits of ones
+func huffmanDecode(s []byte) (string, error) {
+	huffmanTreeOnce.Do(buildHuffmanTree)
+	var out []byte
+	n, bits, ones := int32(0), 0, true
+	for _, c := range s {
+		for i := 7; i >= 0; i-- {
+			bit := c >> uint(i) & 1
+			next := huffmanTree[n][bit]
+			switch {
+			case next == 0:
+				return "", errHuffman
+			case next < 0:
+				out = append(out, byte(-next-1))
+				n, bits, ones = 0, 0, true
+			default:
+				n, bits, ones = next, bits+1, ones && bit == 1
+			}
+		}
+	}
+	if bits > 7 || !ones {
+		return "", errHuffman
+	}
+	return string(out), nil
+}
+
+// The static table of HPACK, from index 1
+var hpackStaticTable = [...][2]string{
+	{":authority", ""},
+	{":method", "GET"},
+	{":method", "POST"},
+	{":path", "/"},
+	{":path", "/index.html"},
+	{":scheme", "http"},
+	{":scheme", "https"},
+	{":status", "200"},
+	{":status", "204"},
+	{":status", "206"},
+	{":status", "304"},
+	{":status", "400"},
+	{":status", "404"},
+	{":status", "500"},
+	{"accept-charset", ""},
+	{"accept-encoding", "gzip, deflate"},
+	{"accept-language", ""},
+	{"accept-ranges", ""},
+	{"accept", ""},
+	{"access-control-allow-origin", ""},
+	{"age", ""},
+	{"allow", ""},
+	{"authorization", ""},
+	{"cache-control", ""},
+	{"content-disposition", ""},
+	{"content-encoding", ""},
+	{"content-language", ""},
+	{"content-length", ""},
+	{"content-location", ""},
+	{"content-range", ""},
+	{"content-type", ""},
+	{"cookie", ""},
+	{"date", ""},
+	{"etag", ""},
+	{"expect", ""},
+	{"expires", ""},
+	{"from", ""},
+	{"host", ""},
+	{"if-match", ""},
+	{"if-modified-since", ""},
+	{"if-none-match", ""},
+	{"if-range", ""},
+	{"if-unmodified-since", ""},
+	{"last-modified", ""},
+	{"link", ""},
+	{"location", ""},
+	{"max-forwards", ""},
+	{"proxy-authenticate", ""},
+	{"proxy-authorization", ""},
+	{"range", ""},
+	{"referer", ""},
+	{"refresh", ""},
+	{"retry-after", ""},
+	{"server", ""},
+	{"set-cookie", ""},
+	{"strict-transport-security", ""},
+	{"transfer-encoding", ""},
+	{"user-agent", ""},
+	{"vary", ""},
+	{"via", ""},
+	{"www-authenticate", ""},
+}
+
+// The Huffman code of HPACK for each byte, and its length in bits
+var hpackHuffmanCodes = [256]uint32{
+	0x1ff8, 0x7fffd8, 0xfffffe2, 0xfffffe3, 0xfffffe4, 0xfffffe5, 0xfffffe6, 0xfffffe7,
+	0xfffffe8, 0xffffea, 0x3ffffffc, 0xfffffe9, 0xfffffea, 0x3ffffffd, 0xfffffeb, 0xfffffec,
+	0xfffffed, 0xfffffee, 0xfffffef, 0xffffff0, 0xffffff1, 0xffffff2, 0x3ffffffe, 0xffffff3,
+	0xffffff4, 0xffffff5, 0xffffff6, 0xffffff7, 0xffffff8, 0xffffff9, 0xffffffa, 0xffffffb,
+	0x14, 0x3f8, 0x3f9, 0xffa, 0x1ff9, 0x15, 0xf8, 0x7fa,
+	0x3fa, 0x3fb, 0xf9, 0x7fb, 0xfa, 0x16, 0x17, 0x18,
+	0x0, 0x1, 0x2, 0x19, 0x1a, 0x1b, 0x1c, 0x1d,
+	0x1e, 0x1f, 0x5c, 0xfb, 0x7ffc, 0x20, 0xffb, 0x3fc,
+	0x1ffa, 0x21, 0x5d, 0x5e, 0x5f, 0x60, 0x61, 0x62,
+	0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a,
+	0x6b, 0x6c, 0x6d, 0x6e, 0x6f, 0x70, 0x71, 0x72,
+	0xfc, 0x73, 0xfd, 0x1ffb, 0x7fff0, 0x1ffc, 0x3ffc, 0x22,
+	0x7ffd, 0x3, 0x23, 0x4, 0x24, 0x5, 0x25, 0x26,
+	0x27, 0x6, 0x74, 0x75, 0x28, 0x29, 0x2a, 0x7,
+	0x2b, 0x76, 0x2c, 0x8, 0x9, 0x2d, 0x77, 0x78,
+	0x79, 0x7a, 0x7b, 0x7ffe, 0x7fc, 0x3ffd, 0x1ffd, 0xffffffc,
+	0xfffe6, 0x3fffd2, 0xfffe7, 0xfffe8, 0x3fffd3, 0x3fffd4, 0x3fffd5, 0x7fffd9,
+	0x3fffd6, 0x7fffda, 0x7fffdb, 0x7fffdc, 0x7fffdd, 0x7fffde, 0xffffeb, 0x7fffdf,
+	0xffffec, 0xffffed, 0x3fffd7, 0x7fffe0, 0xffffee, 0x7fffe1, 0x7fffe2, 0x7fffe3,
+	0x7fffe4, 0x1fffdc, 0x3fffd8, 0x7fffe5, 0x3fffd9, 0x7fffe6, 0x7fffe7, 0xffffef,
+	0x3fffda, 0x1fffdd, 0xfffe9, 0x3fffdb, 0x3fffdc, 0x7fffe8, 0x7fffe9, 0x1fffde,
+	0x7fffea, 0x3fffdd, 0x3fffde, 0xfffff0, 0x1fffdf, 0x3fffdf, 0x7fffeb, 0x7fffec,
+	0x1fffe0, 0x1fffe1, 0x3fffe0, 0x1fffe2, 0x7fffed, 0x3fffe1, 0x7fffee, 0x7fffef,
+	0xfffea, 0x3fffe2, 0x3fffe3, 0x3fffe4, 0x7ffff0, 0x3fffe5, 0x3fffe6, 0x7ffff1,
+	0x3ffffe0, 0x3ffffe1, 0xfffeb, 0x7fff1, 0x3fffe7, 0x7ffff2, 0x3fffe8, 0x1ffffec,
+	0x3ffffe2, 0x3ffffe3, 0x3ffffe4, 0x7ffffde, 0x7ffffdf, 0x3ffffe5, 0xfffff1, 0x1ffffed,
+	0x7fff2, 0x1fffe3, 0x3ffffe6, 0x7ffffe0, 0x7ffffe1, 0x3ffffe7, 0x7ffffe2, 0xfffff2,
+	0x1fffe4, 0x1fffe5, 0x3ffffe8, 0x3ffffe9, 0xffffffd, 0x7ffffe3, 0x7ffffe4, 0x7ffffe5,
+	0xfffec, 0xfffff3, 0xfffed, 0x1fffe6, 0x3fffe9, 0x1fffe7, 0x1fffe8, 0x7ffff3,
+	0x3fffea, 0x3fffeb, 0x1ffffee, 0x1ffffef, 0xfffff4, 0xfffff5, 0x3ffffea, 0x7ffff4,
+	0x3ffffeb, 0x7ffffe6, 0x3ffffec, 0x3ffffed, 0x7ffffe7, 0x7ffffe8, 0x7ffffe9, 0x7ffffea,
+	0x7ffffeb, 0xffffffe, 0x7ffffec, 0x7ffffed, 0x7ffffee, 0x7ffffef, 0x7fffff0, 0x3ffffee,
+}
+
+var hpackHuffmanCodeLen = [256]uint8{
+	13, 23, 28, 28, 28, 28, 28, 28, 28, 24, 30, 28, 28, 30, 28, 28,
+	28, 28, 28, 28, 28, 28, 30, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+	6, 10, 10, 12, 13, 6, 8, 11, 10, 10, 8, 11, 8, 6, 6, 6,
+	5, 5, 5, 6, 6, 6, 6, 6, 6, 6, 7, 8, 15, 6, 12, 10,
+	13, 6, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7,
+	7, 7, 7, 7, 7, 7, 7, 7, 8, 7, 8, 13, 19, 13, 14, 6,
+	15, 5, 6, 5, 6, 5, 6, 6, 6, 5, 7, 7, 6, 6, 6, 5,
+	6, 7, 6, 5, 5, 6, 7, 7, 7, 7, 7, 15, 11, 14, 13, 28,
+	20, 22, 20, 20, 22, 22, 22, 23, 22, 23, 23, 23, 23, 23, 24, 23,
+	24, 24, 22, 23, 24, 23, 23, 23, 23, 21, 22, 23, 22, 23, 23, 24,
+	22, 21, 20, 22, 22, 23, 23, 21, 23, 22, 22, 24, 21, 22, 23, 23,
+	21, 21, 22, 21, 23, 22, 23, 23, 20, 22, 22, 22, 23, 22, 22, 23,
+	26, 26, 20, 19, 22, 23, 22, 25, 26, 26, 26, 27, 27, 26, 24, 25,
+	19, 21, 26, 27, 27, 26, 27, 24, 21, 21, 26, 26, 28, 27, 27, 27,
+	20, 24, 20, 21, 22, 21, 21, 23, 22, 22, 25, 25, 24, 24, 26, 23,
+	26, 27, 26, 26, 27, 27, 27, 27, 27, 28, 27, 27, 27, 27, 27, 26,
+}
@@ -0,0 +1,251 @@
+package log4go
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// httpBatcher is what the writers shipping records over HTTP (Loki,
+// Elasticsearch, webhooks) have in common: records are collected into
+// batches, sent when batchSize have been logged or batchWait after the first,
+// and posted with retries.  The database writer batches its inserts with it
+// too, its table standing for the URL.  While a batch is being retried the
+// records behind it wait in the channel, so that logging blocks once it is
+// full; given WithBlocking(false) they are dropped instead, and counted.
+type httpBatcher struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	kind     string // names the writer in messages
+	url      string
+	client   *http.Client
+	header   http.Header
+	username string // for basic auth, if set
+	password string
+	sign     func(req *http.Request, body []byte) // if set, on each request
+
+	batchSize  int
+	batchWait  time.Duration
+	maxRetries int           // of a batch, after the first attempt
+	retryWait  time.Duration // before the first retry, doubling after
+	format     string        // for records set aside
+	formatter  Formatter     // in place of format, if set
+
+	dropped  int64         // records dropped with the channel full, atomic
+	flushed  chan bool     // signalled when Flush has been done
+	recovery writeRecovery // keeps going while the server is down
+	finish   func()        // if set, called after the last batch on close
+}
+
+func newHTTPBatcher(kind, url string, opts []Option) httpBatcher {
+	o := newWriterOptions(opts)
+	b := httpBatcher{
+		rec:        make(chan *LogRecord, o.bufferLength),
+		blocking:   o.blocking,
+		kind:       kind,
+		url:        url,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		header:     make(http.Header),
+		batchSize:  1000,
+		batchWait:  time.Second,
+		maxRetries: 5,
+		retryWait:  500 * time.Millisecond,
+		format:     "[%D %T] [%L] (%S) %M",
+		flushed:    make(chan bool),
+		recovery:   newWriteRecovery(),
+	}
+	b.recovery.kind = kind
+	return b
+}
+
+func (b *httpBatcher) logWrite(rec *LogRecord) {
+	if !sendRecord(b.rec, rec, b.blocking) {
+		atomic.AddInt64(&b.dropped, 1)
+	}
+}
+
+// send the batch collected so far, returning once it has been sent
+func (b *httpBatcher) flush() {
+	b.rec <- flushRecord
+	<-b.flushed
+}
+
+// wait for the batches to be sent and close the channel
+func (b *httpBatcher) close() {
+	b.WaitForEnd(b.rec)
+	close(b.rec)
+}
+
+// run collects records into batches, having send deliver each, until the
+// writer is closed.
+func (b *httpBatcher) run(send func(batch []*LogRecord) error) {
+	// ticks while a batch is being collected
+	var wait <-chan time.Time
+	var timer *time.Timer
+	batch := make([]*LogRecord, 0, b.batchSize)
+
+	deliver := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, wait = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		b.deliver(batch, send)
+		batch = make([]*LogRecord, 0, b.batchSize)
+	}
+
+	for {
+		select {
+		case <-wait:
+			timer, wait = nil, nil
+			deliver()
+		case rec, ok := <-b.rec:
+			if !ok {
+				return
+			}
+			if rec == flushRecord {
+				deliver()
+				b.flushed <- true
+				continue
+			}
+			if rec == nil {
+				deliver()
+				if b.finish != nil {
+					b.finish()
+				}
+				b.EndNotify(rec)
+				return
+			}
+
+			batch = append(batch, rec)
+			if len(batch) >= b.batchSize {
+				deliver()
+			} else if timer == nil {
+				timer = time.NewTimer(b.batchWait)
+				wait = timer.C
+			}
+		}
+	}
+}
+
+func (b *httpBatcher) deliver(batch []*LogRecord, send func(batch []*LogRecord) error) {
+	if n := atomic.SwapInt64(&b.dropped, 0); n > 0 {
+		fmt.Fprintf(os.Stderr, "%s(%q): dropped %d records with the buffer full\n", b.kind, b.url, n)
+	}
+	if b.recovery.waiting(time.Now()) {
+		b.setAside(batch)
+		return
+	}
+	if err := send(batch); err != nil {
+		b.recovery.failed(b.url, err, nil, "", nil)
+		b.setAside(batch)
+		return
+	}
+	b.recovery.succeeded(b.url)
+}
+
+func (b *httpBatcher) setAside(batch []*LogRecord) {
+	for _, rec := range batch {
+		b.recovery.setAside(rec, b.format, b.formatter)
+	}
+}
+
+// An httpStatusError is a response that was not a success
+type httpStatusError struct {
+	status     int
+	body       string
+	retryAfter time.Duration // asked for by the server, if set
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.status, e.body)
+}
+
+// Whether the request is worth sending again: the server was busy, or failed
+func (e *httpStatusError) temporary() bool {
+	return e.status == http.StatusTooManyRequests || e.status == http.StatusRequestTimeout || e.status >= 500
+}
+
+// post sends body to the writer's URL, retrying on network errors, 429s and
+// 5xx responses, waiting retryWait (doubling each time) or as long as the
+// server asks with Retry-After.  It returns the response body of the success.
+func (b *httpBatcher) post(body []byte, contentType string) ([]byte, error) {
+	return b.postHeader(body, contentType, nil)
+}
+
+// postHeader posts as post does, with header on top of the writer's.
+func (b *httpBatcher) postHeader(body []byte, contentType string, header http.Header) ([]byte, error) {
+	wait := b.retryWait
+	for attempt := 0; ; attempt++ {
+		resp, err := b.postOnce(body, contentType, header)
+		if err == nil {
+			return resp, nil
+		}
+		serr, isStatus := err.(*httpStatusError)
+		if attempt >= b.maxRetries || isStatus && !serr.temporary() {
+			return nil, err
+		}
+
+		if isStatus && serr.retryAfter > 0 {
+			if serr.retryAfter > time.Minute {
+				serr.retryAfter = time.Minute
+			}
+			time.Sleep(serr.retryAfter)
+		} else {
+			time.Sleep(wait)
+		}
+		wait *= 2
+		if wait > 30*time.Second {
+			wait = 30 * time.Second
+		}
+	}
+}
+
+func (b *httpBatcher) postOnce(body []byte, contentType string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest("POST", b.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range b.header {
+		req.Header[name] = values
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+	if b.username != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+	if b.sign != nil {
+		b.sign(req, body)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		serr := &httpStatusError{status: resp.StatusCode, body: string(bytes.TrimSpace(respBody))}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			serr.retryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, serr
+	}
+	return respBody, nil
+}
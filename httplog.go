@@ -0,0 +1,204 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// This log writer POSTs batches of records, as JSON, to an HTTP endpoint such
+// as a webhook or an in-house ingestion service.
+type HTTPLogWriter struct {
+	httpBatcher
+
+	ndjson bool                   // a JSON object per line, rather than an array
+	fields map[string]interface{} // added to every record
+}
+
+// This is the HTTPLogWriter's output method
+func (w *HTTPLogWriter) LogWrite(rec *LogRecord) {
+	w.logWrite(rec)
+}
+
+// wait for the records to be posted
+func (w *HTTPLogWriter) Close() {
+	w.close()
+}
+
+// Flush posts the records batched so far, returning once they have been.
+func (w *HTTPLogWriter) Flush() {
+	w.flush()
+}
+
+// NewHTTPLogWriter creates a new LogWriter which POSTs records to url as a
+// JSON array of objects with time, level, source and message, the record
+// formatted with "%M" until set otherwise.
+//
+// Records are posted in batches of up to 1000, or a second after the first of
+// a batch.  A batch is retried up to five times with backoff on network errors,
+// 429s and 5xx responses; should it still fail, the records are dropped, or
+// written to stderr after SetStderrFallback(true).
+func NewHTTPLogWriter(url string, opts ...Option) *HTTPLogWriter {
+	w := &HTTPLogWriter{
+		httpBatcher: newHTTPBatcher("HTTPLogWriter", url, opts),
+		fields:      make(map[string]interface{}),
+	}
+	w.format = "%M"
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go w.run(w.send)
+
+	return w
+}
+
+// Post a batch
+func (w *HTTPLogWriter) send(batch []*LogRecord) error {
+	docs := make([]map[string]interface{}, 0, len(batch))
+	for _, rec := range batch {
+		message := string(rec.Binary)
+		if rec.Binary == nil {
+			message = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+		}
+
+		doc := make(map[string]interface{}, 4+len(w.fields))
+		for name, value := range w.fields {
+			doc[name] = value
+		}
+		doc["time"] = rec.Created.Format(time.RFC3339Nano)
+		doc["level"] = rec.Level.String()
+		doc["source"] = rec.Source
+		doc["message"] = message
+		docs = append(docs, doc)
+	}
+
+	if !w.ndjson {
+		body, err := json.Marshal(docs)
+		if err != nil {
+			return err
+		}
+		_, err = w.post(body, "application/json")
+		return err
+	}
+
+	var body []byte
+	for _, doc := range docs {
+		line, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		body = append(append(body, line...), '\n')
+	}
+	_, err := w.post(body, "application/x-ndjson")
+	return err
+}
+
+// Set the logging format of the message (chainable).  Must be called before
+// the first log message is written.
+func (w *HTTPLogWriter) SetFormat(format string) *HTTPLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *HTTPLogWriter) SetFormatter(formatter Formatter) *HTTPLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set how a batch is encoded (chainable): "json", the default, as an array, or
+// "ndjson", an object per line.  Must be called before the first log message
+// is written.
+func (w *HTTPLogWriter) SetEncoding(encoding string) *HTTPLogWriter {
+	switch encoding {
+	case "json", "ndjson":
+		w.ndjson = encoding == "ndjson"
+	default:
+		fmt.Fprintf(os.Stderr, "HTTPLogWriter(%q): unknown encoding %q\n", w.url, encoding)
+	}
+	return w
+}
+
+// Add a field to every record (chainable), e.g. the service name.  Must be
+// called before the first log message is written.
+func (w *HTTPLogWriter) SetField(name string, value interface{}) *HTTPLogWriter {
+	w.fields[name] = value
+	return w
+}
+
+// Set a header sent with every request (chainable).  Must be called before the
+// first log message is written.
+func (w *HTTPLogWriter) SetHeader(name, value string) *HTTPLogWriter {
+	w.header.Set(name, value)
+	return w
+}
+
+// Set the user and password to post with (chainable).  Must be called before
+// the first log message is written.
+func (w *HTTPLogWriter) SetBasicAuth(username, password string) *HTTPLogWriter {
+	w.username, w.password = username, password
+	return w
+}
+
+// Set a bearer token to post with, in the Authorization header (chainable).
+// Must be called before the first log message is written.
+func (w *HTTPLogWriter) SetBearerToken(token string) *HTTPLogWriter {
+	w.header.Set("Authorization", "Bearer "+token)
+	return w
+}
+
+// Set the most records posted at once, and the longest the first of them
+// waits to be posted (chainable).  The default is 1000 records and a second.
+// Must be called before the first log message is written.
+func (w *HTTPLogWriter) SetBatch(size int, wait time.Duration) *HTTPLogWriter {
+	w.batchSize, w.batchWait = size, wait
+	return w
+}
+
+// Set how many more times a batch is posted when the endpoint fails, and the
+// wait before the first retry, doubling after (chainable).  The default is
+// five times, from half a second.  Must be called before the first log
+// message is written.
+func (w *HTTPLogWriter) SetRetry(retries int, wait time.Duration) *HTTPLogWriter {
+	w.maxRetries, w.retryWait = retries, wait
+	return w
+}
+
+// Set the timeout of each request (chainable).  The default is 30 seconds.
+// Must be called before the first log message is written.
+func (w *HTTPLogWriter) SetTimeout(timeout time.Duration) *HTTPLogWriter {
+	w.client.Timeout = timeout
+	return w
+}
+
+// Set the circuit breaker (chainable): after failures batches in a row fail,
+// retries and all, the endpoint is left alone for cooldown, the batches logged
+// meanwhile being dropped, or written to stderr after SetStderrFallback, and
+// then tried with the next batch.  By default
+// it opens after the first failure, for a second up to a minute.  Must be
+// called before the first log message is written.
+func (w *HTTPLogWriter) SetCircuitBreaker(failures int, cooldown time.Duration) *HTTPLogWriter {
+	w.recovery.threshold = failures
+	w.recovery.minWait, w.recovery.maxWait = cooldown, cooldown
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time a batch cannot
+// be posted (chainable).  It must not log to this writer.  Must be called
+// before the first log message is written.
+func (w *HTTPLogWriter) SetErrorHandler(handler func(error)) *HTTPLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be posted
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *HTTPLogWriter) SetStderrFallback(fallback bool) *HTTPLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
@@ -0,0 +1,26 @@
+package log4go
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+)
+
+// sendJournalFile passes entry to journald as a file, for an entry too big
+// for a datagram: the file is written to /dev/shm, unlinked, and its
+// descriptor sent over conn.
+func sendJournalFile(conn *net.UnixConn, entry []byte) error {
+	f, err := ioutil.TempFile("/dev/shm", "log4go-journal-")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	os.Remove(f.Name())
+
+	if _, err := f.Write(entry); err != nil {
+		return err
+	}
+	_, _, err = conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), nil)
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package log4go
+
+import (
+	"errors"
+	"net"
+)
+
+// sendJournalFile passes an entry too big for a datagram to journald, which
+// only runs on Linux.
+func sendJournalFile(conn *net.UnixConn, entry []byte) error {
+	return errors.New("journal entry too big to send")
+}
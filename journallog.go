@@ -0,0 +1,244 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The socket journald reads native protocol entries from
+var journalSocket = "/run/systemd/journal/socket"
+
+// This log writer sends output to the systemd journal, over its native
+// protocol, so that fields and multi-line messages arrive intact.
+type JournalLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	conn *net.UnixConn
+
+	format     string
+	formatter  Formatter                              // in place of format, if set
+	identifier string                                 // SYSLOG_IDENTIFIER
+	fields     map[string]string                      // sent with every entry
+	fieldFunc  func(rec *LogRecord) map[string]string // more fields, per record
+
+	recovery writeRecovery // keeps going while journald is down
+}
+
+// This is the JournalLogWriter's output method
+func (w *JournalLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
+}
+
+// wait for the records to be sent and close the connection
+func (w *JournalLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewJournalLogWriter creates a new LogWriter which sends records to the
+// systemd journal as identifier, by default the program name.  Each entry has
+// the record formatted with "%M" as its MESSAGE, the level as its PRIORITY,
+// with the syslog severities, and CODE_FUNC and CODE_LINE (or CODE_FILE, for a
+// file:line source) from the record's source.
+//
+// The journal socket is connected to when the first record is sent, and again
+// should it fail.  While journald cannot be reached, records are dropped, or
+// written to stderr after SetStderrFallback; they are not sent once it can.
+func NewJournalLogWriter(identifier string, opts ...Option) *JournalLogWriter {
+	o := newWriterOptions(opts)
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+
+	w := &JournalLogWriter{
+		rec:        make(chan *LogRecord, o.bufferLength),
+		blocking:   o.blocking,
+		format:     "%M",
+		identifier: identifier,
+		fields:     make(map[string]string),
+		recovery:   newWriteRecovery(),
+	}
+	w.recovery.kind = "JournalLogWriter"
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		defer func() {
+			if w.conn != nil {
+				w.conn.Close()
+			}
+		}()
+
+		for rec := range w.rec {
+			if w.EndNotify(rec) {
+				return
+			}
+			if w.recovery.waiting(time.Now()) {
+				w.recovery.setAside(rec, w.format, w.formatter)
+				continue
+			}
+			if err := w.send(w.entry(rec)); err != nil {
+				w.recovery.failed(journalSocket, err, rec, w.format, w.formatter)
+				continue
+			}
+			w.recovery.succeeded(journalSocket)
+		}
+	}()
+
+	return w
+}
+
+// Send an entry, connecting first if need be.  An entry too big for a
+// datagram is passed as a file instead.
+func (w *JournalLogWriter) send(entry []byte) error {
+	if w.conn == nil {
+		conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+
+	if _, err := w.conn.Write(entry); err != nil {
+		if ferr := sendJournalFile(w.conn, entry); ferr != nil {
+			w.conn.Close()
+			w.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// The journal entry for rec, in the native protocol
+func (w *JournalLogWriter) entry(rec *LogRecord) []byte {
+	message := string(rec.Binary)
+	if rec.Binary == nil {
+		message = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+	}
+
+	var entry bytes.Buffer
+	writeJournalField(&entry, "MESSAGE", message)
+	writeJournalField(&entry, "PRIORITY", string('0'+byte(syslogSeverity(rec.Level))))
+	writeJournalField(&entry, "SYSLOG_IDENTIFIER", w.identifier)
+
+	if i := strings.LastIndex(rec.Source, ":"); i > 0 {
+		if where := rec.Source[:i]; strings.HasSuffix(where, ".go") {
+			writeJournalField(&entry, "CODE_FILE", where)
+		} else {
+			writeJournalField(&entry, "CODE_FUNC", where)
+		}
+		writeJournalField(&entry, "CODE_LINE", rec.Source[i+1:])
+	}
+
+	fields := w.fields
+	if w.fieldFunc != nil {
+		fields = make(map[string]string, len(w.fields))
+		for name, value := range w.fields {
+			fields[name] = value
+		}
+		for name, value := range w.fieldFunc(rec) {
+			fields[journalFieldName(name)] = value
+		}
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeJournalField(&entry, name, fields[name])
+	}
+
+	return entry.Bytes()
+}
+
+// Write a field of a journal entry, as NAME=value, or for a value of more than
+// one line, as NAME, its length as 64 bit little-endian and the value.
+func writeJournalField(entry *bytes.Buffer, name, value string) {
+	entry.WriteString(name)
+	if strings.Contains(value, "\n") {
+		entry.WriteByte('\n')
+		binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+	} else {
+		entry.WriteByte('=')
+	}
+	entry.WriteString(value)
+	entry.WriteByte('\n')
+}
+
+// journalFieldName makes name a valid journal field name: upper case letters,
+// digits and underscores, not starting with an underscore, which marks fields
+// only journald may set.
+func journalFieldName(name string) string {
+	b := []byte(strings.ToUpper(name))
+	for i, c := range b {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	return strings.TrimLeft(string(b), "_")
+}
+
+// Set the logging format of the MESSAGE field (chainable).  Must be called
+// before the first log message is written.
+func (w *JournalLogWriter) SetFormat(format string) *JournalLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *JournalLogWriter) SetFormatter(formatter Formatter) *JournalLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Add a field sent with every entry (chainable).  The name is made a valid
+// field name, upper case with underscores.  Must be called before the first
+// log message is written.
+func (w *JournalLogWriter) SetField(name, value string) *JournalLogWriter {
+	w.fields[journalFieldName(name)] = value
+	return w
+}
+
+// Set a function giving more fields for each record's entry (chainable), e.g.
+// a request ID.  It is called on the writer's goroutine.  Must be called before
+// the first log message is written.
+func (w *JournalLogWriter) SetFieldFunc(fieldFunc func(rec *LogRecord) map[string]string) *JournalLogWriter {
+	w.fieldFunc = fieldFunc
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time the journal
+// cannot be reached (chainable).  It must not log to this writer.  Must be
+// called before the first log message is written.
+func (w *JournalLogWriter) SetErrorHandler(handler func(error)) *JournalLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr while the journal cannot be
+// reached (chainable); otherwise they are dropped.  Must be called before the
+// first log message is written.
+func (w *JournalLogWriter) SetStderrFallback(fallback bool) *JournalLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the journal again after it cannot be
+// reached (chainable).  The wait doubles with each failure, up to max.  The
+// default is from one second up to a minute.  Must be called before the first
+// log message is written.
+func (w *JournalLogWriter) SetRetryBackoff(initial, max time.Duration) *JournalLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
@@ -0,0 +1,179 @@
+package log4go
+
+import (
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// A JSONFormatter writes each record as a JSON object on a line of its own, as
+// ELK, Loki and most log pipelines take them:
+//
+//	{"ts":"2026-01-02T15:04:05.123456789Z","level":"EROR","source":"main.main:12","msg":"failed"}
+//
+// The formatter of FORMAT_JSON is the one NewJSONFormatter returns; to change
+// the keys or the layout, give a writer one of one's own, or register it as a
+// named format:
+//
+//	f := NewJSONFormatter()
+//	f.TimeKey, f.MessageKey = "@timestamp", "message"
+//	writer.SetFormatter(f)
+type JSONFormatter struct {
+	// The keys of the record's time, level, source and message; an empty key
+	// leaves the member out.
+	TimeKey, LevelKey, SourceKey, MessageKey string
+
+	// The time.Format layout of the time, or "epoch" for the Unix time in
+	// seconds as a number with a fraction.
+	TimeLayout string
+	UTC        bool // rather than the time's own location
+
+	// The key of an object the record's fields are nested in; if empty, they
+	// are members of their own, in key order, a field named as one of the
+	// record's keys as "fields." and its name.  An error with more to it than
+	// its text, as ErrorWithErr logs, is followed by its details as the field
+	// of its name and "Verbose".
+	FieldsKey string
+
+	// Members added to every object, after the record's, in key order, e.g. the
+	// service's name or host, unless the record has a field of the name.
+	Fields map[string]interface{}
+}
+
+// NewJSONFormatter creates a new JSONFormatter with the keys ts, level, source
+// and msg, and times in RFC 3339 with nanoseconds.
+func NewJSONFormatter() *JSONFormatter {
+	return &JSONFormatter{
+		TimeKey:    "ts",
+		LevelKey:   "level",
+		SourceKey:  "source",
+		MessageKey: "msg",
+		TimeLayout: time.RFC3339Nano,
+	}
+}
+
+// Format appends rec to *buf as a JSON object and a newline.
+func (f *JSONFormatter) Format(rec *LogRecord, buf *[]byte) {
+	b := append(*buf, '{')
+	first := true
+	member := func(key string) {
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = appendJSONString(b, key)
+		b = append(b, ':')
+	}
+
+	if f.TimeKey != "" {
+		member(f.TimeKey)
+		created := rec.Created
+		if f.UTC {
+			created = created.UTC()
+		}
+		if f.TimeLayout == "epoch" {
+			b = strconv.AppendFloat(b, float64(created.UnixNano())/1e9, 'f', -1, 64)
+		} else {
+			b = appendJSONString(b, created.Format(f.TimeLayout))
+		}
+	}
+	if f.LevelKey != "" {
+		member(f.LevelKey)
+		b = appendJSONString(b, rec.Level.String())
+	}
+	if f.SourceKey != "" && rec.Source != "" {
+		member(f.SourceKey)
+		b = appendJSONString(b, trimSourceRoot(rec.Source))
+	}
+	if f.MessageKey != "" {
+		member(f.MessageKey)
+		b = appendJSONString(b, rec.Message)
+	}
+
+	if f.FieldsKey != "" && len(rec.Fields) > 0 {
+		member(f.FieldsKey)
+		b = append(b, '{')
+		for i, name := range rec.Fields.names() {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, name)
+			b = append(b, ':')
+			b = appendFieldJSON(b, rec.Fields[name])
+			if details, ok := fieldDetails(rec.Fields[name]); ok {
+				b = appendJSONString(append(appendJSONString(append(b, ','), name+"Verbose"), ':'), details)
+			}
+		}
+		b = append(b, '}')
+	} else {
+		for _, name := range rec.Fields.names() {
+			key := name
+			if f.reserved(name) {
+				key = "fields." + name
+			}
+			member(key)
+			b = appendFieldJSON(b, rec.Fields[name])
+			if details, ok := fieldDetails(rec.Fields[name]); ok {
+				member(key + "Verbose")
+				b = appendJSONString(b, details)
+			}
+		}
+	}
+	for _, name := range Fields(f.Fields).names() {
+		if _, ok := rec.Fields[name]; ok && f.FieldsKey == "" {
+			continue
+		}
+		member(name)
+		b = appendFieldJSON(b, f.Fields[name])
+	}
+
+	*buf = append(b, '}', '\n')
+}
+
+// Whether name is one of the keys of the record's own members
+func (f *JSONFormatter) reserved(name string) bool {
+	return name == f.TimeKey || name == f.LevelKey || name == f.SourceKey || name == f.MessageKey
+}
+
+// Append s to b as a JSON string, invalid UTF-8 replaced
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' && c < utf8.RuneSelf {
+			i++
+			continue
+		}
+		if c < utf8.RuneSelf {
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
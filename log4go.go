@@ -2,7 +2,7 @@
 
 // Package log4go provides level-based and highly configurable logging.
 //
-// Enhanced Logging
+// # Enhanced Logging
 //
 // This is inspired by the logging functionality in Java.  Essentially, you create a Logger
 // object and create output filters for it.  You can send whatever you want to the Logger,
@@ -24,25 +24,25 @@
 // log.Info("The time is now: %s", time.LocalTime().Format("15:04:05 MST 2006/01/02"))
 //
 // Usage notes:
-// - The ConsoleLogWriter does not display the source of the message to standard
-//   output, but the FileLogWriter does.
-// - The utility functions (Info, Debug, Warn, etc) derive their source from the
-//   calling function, and this incurs extra overhead.
+//   - The ConsoleLogWriter does not display the source of the message to standard
+//     output, but the FileLogWriter does.
+//   - The utility functions (Info, Debug, Warn, etc) derive their source from the
+//     calling function, and this incurs extra overhead.
 //
 // Changes from 2.0:
-// - The external interface has remained mostly stable, but a lot of the
-//   internals have been changed, so if you depended on any of this or created
-//   your own LogWriter, then you will probably have to update your code.  In
-//   particular, Logger is now a map and ConsoleLogWriter is now a channel
-//   behind-the-scenes, and the LogWrite method no longer has return values.
+//   - The external interface has remained mostly stable, but a lot of the
+//     internals have been changed, so if you depended on any of this or created
+//     your own LogWriter, then you will probably have to update your code.  In
+//     particular, Logger is now a map and ConsoleLogWriter is now a channel
+//     behind-the-scenes, and the LogWrite method no longer has return values.
 //
 // Future work: (please let me know if you think I should work on any of these particularly)
-// - Log file rotation
-// - Logging configuration files ala log4j
-// - Have the ability to remove filters?
-// - Have GetInfoChannel, GetDebugChannel, etc return a chan string that allows
-//   for another method of logging
-// - Add an XML filter type
+//   - Log file rotation
+//   - Logging configuration files ala log4j
+//   - Have the ability to remove filters?
+//   - Have GetInfoChannel, GetDebugChannel, etc return a chan string that allows
+//     for another method of logging
+//   - Add an XML filter type
 package log4go
 
 import (
@@ -51,6 +51,7 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -92,30 +93,74 @@ var (
 )
 
 func (l Level) String() string {
-	if l < 0 || int(l) > len(levelStrings) {
+	if l < 0 || int(l) >= len(levelStrings) {
 		return "UNKNOWN"
 	}
 	return levelStrings[int(l)]
 }
 
+// Set the name lvl is written as, by the %L format code, the JSON and logfmt
+// formatters and wherever else a level is shown, e.g. "WARN" or "W" or
+// "AVERTISSEMENT".  Must be called before the first log message is written.
+func SetLevelName(lvl Level, name string) {
+	if lvl >= 0 && int(lvl) < len(levelStrings) {
+		levelStrings[lvl] = name
+	}
+}
+
+// Set the names of the levels in names, as SetLevelName does.  Must be called
+// before the first log message is written.
+func SetLevelNames(names map[Level]string) {
+	for lvl, name := range names {
+		SetLevelName(lvl, name)
+	}
+}
+
+// Capture the stack trace of the goroutine logging a record at or above lvl,
+// from the caller down, as the record's field "stacktrace", which the JSON and
+// logfmt formatters write, and patterns with %X{stacktrace}.  A level above
+// CRITICAL, as is the default, captures none.  Must be called before the first
+// log message is written.
+func SetStacktraceLevel(lvl Level) {
+	stacktraceLevel = lvl
+}
+
 /****** Variables ******/
 var (
+	// the level from which records carry stack traces
+	stacktraceLevel = CRITICAL + 1
+
 	// LogBufferLength specifies how many log messages a particular log4go
 	// logger can buffer at a time before writing them.
+	//
+	// Deprecated: give the writers WithBufferLength; this is only the default
+	// of those made without it, and changing it is racy once they are made.
 	LogBufferLength = 10240
 	// whether blocking, if log buffer is full
+	//
+	// Deprecated: give the writers WithBlocking; this is only the default of
+	// those made without it, and changing it is racy once they are made.
 	LogWithBlocking = true
 )
 
 /****** LogRecord ******/
 
-// A LogRecord contains all of the pertinent information for each message
+// A LogRecord contains all of the pertinent information for each message.  The
+// records a Logger makes are pooled, to be used again once each writer of the
+// package it goes to has written it; middleware, and writers that are not the
+// package's, are to keep none of them after their call, unless they copy it.
 type LogRecord struct {
 	Level   Level     // The log level
 	Created time.Time // The time at which the log message was created (nanoseconds)
 	Source  string    // The message source
 	Message string    // The log message
 	Binary  []byte
+
+	Goroutine uint64           `json:",omitempty"` // The ID of the goroutine it was logged on, or 0 if not known
+	Access    *AccessLogRecord `json:",omitempty"` // The request served, if logged with Access
+	Fields    Fields           `json:",omitempty"` // The structured data of the record, if any
+
+	refs int32 // the writers yet to release it, if it is from the pool
 }
 
 /****** LogCloser ******/
@@ -196,6 +241,37 @@ func NewDefaultLogger(lvl Level) Logger {
 	}
 }
 
+// Create a new logger for development, with a "stdout" filter sending log
+// messages at or above DEBUG to standard output, their levels colored when it
+// is a terminal.
+func NewDevelopmentLogger() Logger {
+	return Logger{
+		"stdout": &Filter{DEBUG, NewConsoleLogWriter()},
+	}
+}
+
+// Create a new logger for production, with a "file" filter writing log
+// messages at or above INFO to filename as JSON, one object per line.  The
+// file is rotated daily and at 100M, and the last 7 old ones kept.  If the
+// file cannot be opened, the messages are written to standard output instead,
+// under a "stdout" filter.
+func NewProductionLogger(filename string) Logger {
+	flw := NewFileLogWriter(filename, true)
+	if flw == nil {
+		clw := NewConsoleLogWriter()
+		clw.SetFormatter(NewJSONFormatter())
+		return Logger{
+			"stdout": &Filter{INFO, clw},
+		}
+	}
+	flw.SetFormatter(NewJSONFormatter())
+	flw.SetRotateDaily(true).SetRotateSize(100 << 20).SetRotateMaxBackup(7)
+	flw.SetStderrFallback(true)
+	return Logger{
+		"file": &Filter{INFO, flw},
+	}
+}
+
 // Closes all log writers in preparation for exiting the program or a
 // reconfiguration of logging.  Calling this is not really imperative, unless
 // you want to guarantee that all log messages are written.  Close removes
@@ -217,6 +293,28 @@ func (log Logger) AddFilter(name string, lvl Level, writer LogWriter) Logger {
 }
 
 /******* Logging *******/
+// Buffers for the first line of a stack trace, which runtime.Stack keeps
+var stackBuffers = sync.Pool{New: func() interface{} { return new([64]byte) }}
+
+// The ID of the calling goroutine, from the first line of its stack trace
+func goroutineID() uint64 {
+	const prefix = "goroutine "
+	buf := stackBuffers.Get().(*[64]byte)
+	defer stackBuffers.Put(buf)
+	trace := buf[:runtime.Stack(buf[:], false)]
+	if len(trace) < len(prefix) || string(trace[:len(prefix)]) != prefix {
+		return 0
+	}
+	var id uint64
+	for _, c := range trace[len(prefix):] {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + uint64(c-'0')
+	}
+	return id
+}
+
 // Send a formatted log message internally
 func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
 	skip := true
@@ -233,36 +331,40 @@ func (log Logger) intLogf(lvl Level, format string, args ...interface{}) {
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
-	}
+	src, depth := callerSource(2 + log.callerSkip())
 
+	args, fields := splitFields(args)
+	if lvl >= stacktraceLevel {
+		fields = withStacktrace(fields, depth+2)
+	}
 	msg := format
 	if len(args) > 0 {
 		msg = fmt.Sprintf(format, args...)
 	}
 
 	// Make the log record
-	rec := &LogRecord{
+	made := acquireRecord()
+	*made = LogRecord{
 		Level:   lvl,
 		Created: time.Now(),
 		Source:  src,
 		Message: msg,
-	}
+		Fields:  fields,
 
-	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
+		Goroutine: goroutineID(),
 	}
+	made.Fields = log.recordFields(made.Goroutine, made.Fields)
+	rec := log.prepareRecord(made)
+	if rec == nil {
+		return
+	}
+
+	// Dispatch the logs, pooling the record if the middleware left it as made
+	log.dispatch(rec, rec == made)
 }
 
-// Send a closure log message internally
-func (log Logger) intLogc(lvl Level, closure func() string) {
+// Send a closure log message internally, with the Fields among args
+func (log Logger) intLogc(lvl Level, closure func() string, args ...interface{}) {
 	skip := true
 
 	// Determine if any logging will be done
@@ -277,27 +379,32 @@ func (log Logger) intLogc(lvl Level, closure func() string) {
 	}
 
 	// Determine caller func
-	pc, _, lineno, ok := runtime.Caller(2)
-	src := ""
-	if ok {
-		src = fmt.Sprintf("%s:%d", runtime.FuncForPC(pc).Name(), lineno)
+	src, depth := callerSource(2 + log.callerSkip())
+
+	_, fields := splitFields(args)
+	if lvl >= stacktraceLevel {
+		fields = withStacktrace(fields, depth+2)
 	}
 
 	// Make the log record
-	rec := &LogRecord{
+	made := acquireRecord()
+	*made = LogRecord{
 		Level:   lvl,
 		Created: time.Now(),
 		Source:  src,
 		Message: closure(),
-	}
+		Fields:  fields,
 
-	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
+		Goroutine: goroutineID(),
 	}
+	made.Fields = log.recordFields(made.Goroutine, made.Fields)
+	rec := log.prepareRecord(made)
+	if rec == nil {
+		return
+	}
+
+	// Dispatch the logs, pooling the record if the middleware left it as made
+	log.dispatch(rec, rec == made)
 }
 
 // Send a log message with manual level, source, and message.
@@ -315,21 +422,30 @@ func (log Logger) Log(lvl Level, source, message string) {
 		return
 	}
 
+	var fields Fields
+	if lvl >= stacktraceLevel {
+		fields = withStacktrace(nil, 3+log.callerSkip())
+	}
+
 	// Make the log record
-	rec := &LogRecord{
+	made := acquireRecord()
+	*made = LogRecord{
 		Level:   lvl,
 		Created: time.Now(),
 		Source:  source,
 		Message: message,
-	}
+		Fields:  fields,
 
-	// Dispatch the logs
-	for _, filt := range log {
-		if lvl < filt.Level {
-			continue
-		}
-		filt.LogWrite(rec)
+		Goroutine: goroutineID(),
+	}
+	made.Fields = log.recordFields(made.Goroutine, made.Fields)
+	rec := log.prepareRecord(made)
+	if rec == nil {
+		return
 	}
+
+	// Dispatch the logs, pooling the record if the middleware left it as made
+	log.dispatch(rec, rec == made)
 }
 
 // Logf logs a formatted log message at the given log level, using the caller as
@@ -355,11 +471,11 @@ func (log Logger) Finest(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		log.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
@@ -374,26 +490,30 @@ func (log Logger) Fine(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		log.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
 // Debug is a utility method for debug log messages.
 // The behavior of Debug depends on the first argument:
-// - arg0 is a string
-//   When given a string as the first argument, this behaves like Logf but with
-//   the DEBUG log level: the first argument is interpreted as a format for the
-//   latter arguments.
-// - arg0 is a func()string
-//   When given a closure of type func()string, this logs the string returned by
-//   the closure iff it will be logged.  The closure runs at most one time.
-// - arg0 is interface{}
-//   When given anything else, the log message will be each of the arguments
-//   formatted with %v and separated by spaces (ala Sprint).
+//   - arg0 is a string
+//     When given a string as the first argument, this behaves like Logf but with
+//     the DEBUG log level: the first argument is interpreted as a format for the
+//     latter arguments.
+//   - arg0 is a func()string
+//     When given a closure of type func()string, this logs the string returned by
+//     the closure iff it will be logged.  The closure runs at most one time.
+//   - arg0 is interface{}
+//     When given anything else, the log message will be each of the arguments
+//     formatted with %v and separated by spaces (ala Sprint).
+//
+// Fields among the other arguments are logged as the record's, and the other
+// arguments and values of fields that are a LazyValue are computed only if the
+// message will be logged.
 func (log Logger) Debug(arg0 interface{}, args ...interface{}) {
 	const (
 		lvl = DEBUG
@@ -403,11 +523,11 @@ func (log Logger) Debug(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		log.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
@@ -422,11 +542,11 @@ func (log Logger) Trace(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		log.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
@@ -441,11 +561,11 @@ func (log Logger) Info(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		log.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		log.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		log.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		log.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
@@ -458,19 +578,20 @@ func (log Logger) Warn(arg0 interface{}, args ...interface{}) error {
 	const (
 		lvl = WARNING
 	)
+	args, fields := splitFields(args)
 	var msg string
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
 		msg = fmt.Sprintf(first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
+		// Log the closure (of the other arguments, only Fields used)
 		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", argCount(args)), args...)
 	}
-	log.intLogf(lvl, msg)
+	log.intLogf(lvl, msg, fields)
 	return errors.New(msg)
 }
 
@@ -481,19 +602,20 @@ func (log Logger) Error(arg0 interface{}, args ...interface{}) error {
 	const (
 		lvl = ERROR
 	)
+	args, fields := splitFields(args)
 	var msg string
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
 		msg = fmt.Sprintf(first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
+		// Log the closure (of the other arguments, only Fields used)
 		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", argCount(args)), args...)
 	}
-	log.intLogf(lvl, msg)
+	log.intLogf(lvl, msg, fields)
 	return errors.New(msg)
 }
 
@@ -504,18 +626,19 @@ func (log Logger) Critical(arg0 interface{}, args ...interface{}) error {
 	const (
 		lvl = CRITICAL
 	)
+	args, fields := splitFields(args)
 	var msg string
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
 		msg = fmt.Sprintf(first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
+		// Log the closure (of the other arguments, only Fields used)
 		msg = first()
 	default:
 		// Build a format string so that it will be similar to Sprint
-		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
+		msg = fmt.Sprintf(fmt.Sprint(first)+strings.Repeat(" %v", argCount(args)), args...)
 	}
-	log.intLogf(lvl, msg)
+	log.intLogf(lvl, msg, fields)
 	return errors.New(msg)
 }
@@ -0,0 +1,112 @@
+package log4go
+
+import (
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// A LogfmtFormatter writes each record as key=value pairs on a line of its own,
+// as Heroku and the Grafana agent take them:
+//
+//	ts=2026-01-02T15:04:05.123456789Z level=EROR source=main.main:12 msg="failed to start"
+//
+// The formatter of FORMAT_LOGFMT is the one NewLogfmtFormatter returns; to
+// change the keys or the layout, give a writer one of one's own, as for a
+// JSONFormatter.
+type LogfmtFormatter struct {
+	// The keys of the record's time, level, source and message; an empty key
+	// leaves the pair out.
+	TimeKey, LevelKey, SourceKey, MessageKey string
+
+	// The time.Format layout of the time, or "epoch" for the Unix time in
+	// seconds with a fraction.
+	TimeLayout string
+	UTC        bool // rather than the time's own location
+
+	// Pairs added to every line, after the record's and its fields, in key
+	// order, unless the record has a field of the key.  The record's fields are
+	// pairs of their own, in key order, a field named as one of the record's
+	// keys as "fields." and its name; an error with more to it than its text
+	// is followed by its details, keyed by its name and "Verbose".
+	Fields map[string]interface{}
+}
+
+// NewLogfmtFormatter creates a new LogfmtFormatter with the keys ts, level,
+// source and msg, and times in RFC 3339 with nanoseconds.
+func NewLogfmtFormatter() *LogfmtFormatter {
+	return &LogfmtFormatter{
+		TimeKey:    "ts",
+		LevelKey:   "level",
+		SourceKey:  "source",
+		MessageKey: "msg",
+		TimeLayout: time.RFC3339Nano,
+	}
+}
+
+// Format appends rec to *buf as logfmt pairs and a newline.
+func (f *LogfmtFormatter) Format(rec *LogRecord, buf *[]byte) {
+	b := *buf
+	start := len(b)
+	pair := func(key, value string) {
+		if len(b) > start {
+			b = append(b, ' ')
+		}
+		b = append(b, key...)
+		b = append(b, '=')
+		b = appendLogfmtValue(b, value)
+	}
+
+	if f.TimeKey != "" {
+		created := rec.Created
+		if f.UTC {
+			created = created.UTC()
+		}
+		if f.TimeLayout == "epoch" {
+			pair(f.TimeKey, strconv.FormatFloat(float64(created.UnixNano())/1e9, 'f', -1, 64))
+		} else {
+			pair(f.TimeKey, created.Format(f.TimeLayout))
+		}
+	}
+	if f.LevelKey != "" {
+		pair(f.LevelKey, rec.Level.String())
+	}
+	if f.SourceKey != "" && rec.Source != "" {
+		pair(f.SourceKey, trimSourceRoot(rec.Source))
+	}
+	if f.MessageKey != "" {
+		pair(f.MessageKey, rec.Message)
+	}
+
+	for _, name := range rec.Fields.names() {
+		key := name
+		if name == f.TimeKey || name == f.LevelKey || name == f.SourceKey || name == f.MessageKey {
+			key = "fields." + name
+		}
+		pair(key, fieldText(rec.Fields[name]))
+		if details, ok := fieldDetails(rec.Fields[name]); ok {
+			pair(key+"Verbose", details)
+		}
+	}
+	for _, name := range Fields(f.Fields).names() {
+		if _, ok := rec.Fields[name]; !ok {
+			pair(name, fieldText(f.Fields[name]))
+		}
+	}
+
+	*buf = append(b, '\n')
+}
+
+// Append value to b, quoted if it is empty or has a space, an equals sign, a
+// quote or a control character in it
+func appendLogfmtValue(b []byte, value string) []byte {
+	if value == "" {
+		return append(b, `""`...)
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || r == 0x7f {
+			return appendJSONString(b, value)
+		}
+	}
+	return append(b, value...)
+}
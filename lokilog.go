@@ -0,0 +1,211 @@
+package log4go
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This log writer pushes batches of records to Grafana Loki, as streams
+// labelled with the static labels and those the label function gives.
+type LokiLogWriter struct {
+	httpBatcher
+
+	labels    map[string]string                      // of every stream
+	labelFunc func(rec *LogRecord) map[string]string // more labels, per record
+}
+
+// This is the LokiLogWriter's output method
+func (w *LokiLogWriter) LogWrite(rec *LogRecord) {
+	w.logWrite(rec)
+}
+
+// wait for the records to be pushed
+func (w *LokiLogWriter) Close() {
+	w.close()
+}
+
+// Flush pushes the records batched so far, returning once they have been.
+func (w *LokiLogWriter) Flush() {
+	w.flush()
+}
+
+// NewLokiLogWriter creates a new LogWriter which pushes records to the Loki at
+// baseURL (e.g. "http://localhost:3100"; a URL with a path is used as is)
+// through /loki/api/v1/push.  Each line is the record formatted with
+// "[%D %T] [%L] (%S) %M", until set otherwise, labelled job=job.
+//
+// Records are pushed in batches of up to 1000, or a second after the first of
+// a batch, and retried up to five times while Loki is unavailable or
+// rate-limiting.
+func NewLokiLogWriter(baseURL, job string, opts ...Option) *LokiLogWriter {
+	if u, err := url.Parse(baseURL); err == nil && strings.Trim(u.Path, "/") == "" {
+		u.Path = "/loki/api/v1/push"
+		baseURL = u.String()
+	}
+
+	w := &LokiLogWriter{
+		httpBatcher: newHTTPBatcher("LokiLogWriter", baseURL, opts),
+		labels:      map[string]string{"job": job},
+	}
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go w.run(w.push)
+
+	return w
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// Push a batch, grouped into streams by label set
+func (w *LokiLogWriter) push(batch []*LogRecord) error {
+	streams := make(map[string]*lokiStream)
+	var order []string
+	for _, rec := range batch {
+		labels := w.labels
+		if w.labelFunc != nil {
+			labels = make(map[string]string, len(w.labels))
+			for name, value := range w.labels {
+				labels[name] = value
+			}
+			for name, value := range w.labelFunc(rec) {
+				labels[name] = value
+			}
+		}
+
+		key := lokiLabelKey(labels)
+		s := streams[key]
+		if s == nil {
+			s = &lokiStream{Stream: labels}
+			streams[key] = s
+			order = append(order, key)
+		}
+
+		line := string(rec.Binary)
+		if rec.Binary == nil {
+			line = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(rec.Created.UnixNano(), 10), line})
+	}
+
+	push := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range order {
+		push.Streams = append(push.Streams, streams[key])
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return err
+	}
+	_, err = w.post(body, "application/json")
+	return err
+}
+
+// lokiLabelKey identifies a label set, whatever the order of the map
+func lokiLabelKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	for _, name := range names {
+		key.WriteString(strconv.Quote(name))
+		key.WriteString(strconv.Quote(labels[name]))
+	}
+	return key.String()
+}
+
+// Set the logging format of the lines (chainable).  Must be called before the
+// first log message is written.
+func (w *LokiLogWriter) SetFormat(format string) *LokiLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *LokiLogWriter) SetFormatter(formatter Formatter) *LokiLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Add a label to every stream (chainable).  Must be called before the first
+// log message is written.
+func (w *LokiLogWriter) SetLabel(name, value string) *LokiLogWriter {
+	w.labels[name] = value
+	return w
+}
+
+// Set a function giving more labels for each record (chainable), such as its
+// level.  Records with different labels go to different streams, so keep the
+// values few.  It is called on the writer's goroutine.  Must be called before
+// the first log message is written.
+func (w *LokiLogWriter) SetLabelFunc(labelFunc func(rec *LogRecord) map[string]string) *LokiLogWriter {
+	w.labelFunc = labelFunc
+	return w
+}
+
+// Set the tenant records are pushed for, with the X-Scope-OrgID header
+// (chainable).  Must be called before the first log message is written.
+func (w *LokiLogWriter) SetTenant(tenant string) *LokiLogWriter {
+	w.header.Set("X-Scope-OrgID", tenant)
+	return w
+}
+
+// Set the user and password to push with (chainable).  Must be called before
+// the first log message is written.
+func (w *LokiLogWriter) SetBasicAuth(username, password string) *LokiLogWriter {
+	w.username, w.password = username, password
+	return w
+}
+
+// Set the most records pushed at once, and the longest the first of them waits
+// to be pushed (chainable).  The default is 1000 records and a second.  Must
+// be called before the first log message is written.
+func (w *LokiLogWriter) SetBatch(size int, wait time.Duration) *LokiLogWriter {
+	w.batchSize, w.batchWait = size, wait
+	return w
+}
+
+// Set how many more times a batch is pushed when Loki is unavailable or
+// rate-limiting, and the wait before the first retry, doubling after
+// (chainable).  The default is five times, from half a second.  Must be called
+// before the first log message is written.
+func (w *LokiLogWriter) SetRetry(retries int, wait time.Duration) *LokiLogWriter {
+	w.maxRetries, w.retryWait = retries, wait
+	return w
+}
+
+// Set the timeout of each push (chainable).  The default is 30 seconds.  Must
+// be called before the first log message is written.
+func (w *LokiLogWriter) SetTimeout(timeout time.Duration) *LokiLogWriter {
+	w.client.Timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time a batch cannot
+// be pushed (chainable).  It must not log to this writer.  Must be called
+// before the first log message is written.
+func (w *LokiLogWriter) SetErrorHandler(handler func(error)) *LokiLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be pushed
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *LokiLogWriter) SetStderrFallback(fallback bool) *LokiLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
@@ -0,0 +1,195 @@
+package log4go
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The diagnostic contexts of a goroutine
+type diagnosticContext struct {
+	fields Fields
+	ndc    []string
+}
+
+var diagnostics = struct {
+	sync.RWMutex
+	contexts map[uint64]*diagnosticContext
+}{contexts: make(map[uint64]*diagnosticContext)}
+
+// How many goroutines have a diagnostic context, read without the lock
+var diagnosticCount int32
+
+// The context of the calling goroutine, created if need be; the lock is held
+func currentDiagnostics() (uint64, *diagnosticContext) {
+	id := goroutineID()
+	dc := diagnostics.contexts[id]
+	if dc == nil {
+		dc = &diagnosticContext{}
+		diagnostics.contexts[id] = dc
+		atomic.StoreInt32(&diagnosticCount, int32(len(diagnostics.contexts)))
+	}
+	return id, dc
+}
+
+// Forget the context of goroutine id if it is empty; the lock is held
+func dropDiagnostics(id uint64, dc *diagnosticContext) {
+	if len(dc.fields) == 0 && len(dc.ndc) == 0 {
+		delete(diagnostics.contexts, id)
+		atomic.StoreInt32(&diagnosticCount, int32(len(diagnostics.contexts)))
+	}
+}
+
+// MDCPut sets the value of key in the calling goroutine's mapped diagnostic
+// context.  The mapped and nested diagnostic contexts, as log4j has them, are
+// values set for the calling goroutine and added to the fields of every record
+// it logs, under those it logs with, for a request's ID, say, to be on every
+// line of its handling without passing a Logger around:
+//
+//	MDCPut("request_id", id)
+//	defer MDCClear()
+//
+//	defer MDCScope(Fields{"user": name})()
+//
+// The nested context is a stack of texts the goroutine pushes and pops, logged
+// as the field "ndc", the texts separated by spaces.  Both are written by %X,
+// and by the JSON and logfmt formatters as the other fields.  A goroutine must
+// clear its contexts before it ends, or pop what it pushed, as they are kept by
+// its ID otherwise.
+func MDCPut(key string, value interface{}) {
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+	_, dc := currentDiagnostics()
+	if dc.fields == nil {
+		dc.fields = make(Fields)
+	}
+	dc.fields[key] = value
+}
+
+// MDCGet returns the value of key in the calling goroutine's mapped diagnostic
+// context, or nil.
+func MDCGet(key string) interface{} {
+	diagnostics.RLock()
+	defer diagnostics.RUnlock()
+	if dc := diagnostics.contexts[goroutineID()]; dc != nil {
+		return dc.fields[key]
+	}
+	return nil
+}
+
+// MDCRemove removes key from the calling goroutine's mapped diagnostic context.
+func MDCRemove(key string) {
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+	id, dc := currentDiagnostics()
+	delete(dc.fields, key)
+	dropDiagnostics(id, dc)
+}
+
+// MDCClear empties the calling goroutine's mapped diagnostic context.
+func MDCClear() {
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+	id, dc := currentDiagnostics()
+	dc.fields = nil
+	dropDiagnostics(id, dc)
+}
+
+// MDCScope sets fields in the calling goroutine's mapped diagnostic context,
+// and returns a function setting them back as they were, to be deferred.
+func MDCScope(fields Fields) func() {
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+	_, dc := currentDiagnostics()
+	if dc.fields == nil {
+		dc.fields = make(Fields)
+	}
+	previous := make(Fields, len(fields))
+	unset := make(map[string]bool)
+	for name, value := range fields {
+		if old, ok := dc.fields[name]; ok {
+			previous[name] = old
+		} else {
+			unset[name] = true
+		}
+		dc.fields[name] = value
+	}
+
+	return func() {
+		diagnostics.Lock()
+		defer diagnostics.Unlock()
+		id, dc := currentDiagnostics()
+		for name := range unset {
+			delete(dc.fields, name)
+		}
+		for name, value := range previous {
+			if dc.fields == nil {
+				dc.fields = make(Fields)
+			}
+			dc.fields[name] = value
+		}
+		dropDiagnostics(id, dc)
+	}
+}
+
+// NDCPush pushes text onto the calling goroutine's nested diagnostic context.
+func NDCPush(text string) {
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+	_, dc := currentDiagnostics()
+	dc.ndc = append(dc.ndc, text)
+}
+
+// NDCPop pops the text last pushed onto the calling goroutine's nested
+// diagnostic context, and returns it, or "" if there is none.
+func NDCPop() string {
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+	id, dc := currentDiagnostics()
+	text := ""
+	if n := len(dc.ndc); n > 0 {
+		text, dc.ndc = dc.ndc[n-1], dc.ndc[:n-1]
+	}
+	dropDiagnostics(id, dc)
+	return text
+}
+
+// NDCClear empties the calling goroutine's nested diagnostic context.
+func NDCClear() {
+	diagnostics.Lock()
+	defer diagnostics.Unlock()
+	id, dc := currentDiagnostics()
+	dc.ndc = nil
+	dropDiagnostics(id, dc)
+}
+
+// Fields with the diagnostic contexts of goroutine id under them, and under
+// those the fields under
+func withDiagnostics(id uint64, under, fields Fields) Fields {
+	var dc *diagnosticContext
+	if atomic.LoadInt32(&diagnosticCount) > 0 {
+		diagnostics.RLock()
+		defer diagnostics.RUnlock()
+		dc = diagnostics.contexts[id]
+	}
+	if dc == nil {
+		if len(under) == 0 {
+			return fields
+		}
+		return mergeFields(under, fields)
+	}
+	merged := make(Fields, len(under)+len(dc.fields)+len(fields)+1)
+	for name, value := range under {
+		merged[name] = value
+	}
+	for name, value := range dc.fields {
+		merged[name] = value
+	}
+	if len(dc.ndc) > 0 {
+		merged["ndc"] = strings.Join(dc.ndc, " ")
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+	return merged
+}
@@ -0,0 +1,107 @@
+package log4go
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// This log writer keeps the last records logged in memory, for a crash report
+// or a /debug/logs page to show what led up to it.  It writes nothing out.
+type MemoryLogWriter struct {
+	mu        sync.Mutex
+	ring      []LogRecord // copies, as the records may be reused
+	next      int         // where the next record goes
+	full      bool        // the ring has wrapped
+	format    string
+	formatter Formatter // in place of format, if set
+}
+
+// NewMemoryLogWriter creates a new MemoryLogWriter keeping the last size
+// records, dumped with FORMAT_DEFAULT until set otherwise.
+func NewMemoryLogWriter(size int) *MemoryLogWriter {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryLogWriter{
+		ring:   make([]LogRecord, size),
+		format: FORMAT_DEFAULT,
+	}
+}
+
+// This is the MemoryLogWriter's output method
+func (w *MemoryLogWriter) LogWrite(rec *LogRecord) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ring[w.next] = *rec
+	if w.next++; w.next == len(w.ring) {
+		w.next, w.full = 0, true
+	}
+}
+
+// Close does nothing; the records are still there to be had.
+func (w *MemoryLogWriter) Close() {
+}
+
+// Set the logging format of DumpTo (chainable).
+func (w *MemoryLogWriter) SetFormat(format string) *MemoryLogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *MemoryLogWriter) SetFormatter(formatter Formatter) *MemoryLogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.formatter = formatter
+	return w
+}
+
+// GetRecords returns copies of the records kept, oldest first.
+func (w *MemoryLogWriter) GetRecords() []*LogRecord {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := w.next
+	if w.full {
+		n = len(w.ring)
+	}
+	recs := make([]*LogRecord, 0, n)
+	for i := 0; i < n; i++ {
+		rec := w.ring[(w.next-n+i+len(w.ring))%len(w.ring)]
+		recs = append(recs, &rec)
+	}
+	return recs
+}
+
+// DumpTo writes the records kept to out, oldest first, formatted as set.
+func (w *MemoryLogWriter) DumpTo(out io.Writer) error {
+	w.mu.Lock()
+	format, formatter := w.format, w.formatter
+	w.mu.Unlock()
+
+	for _, rec := range w.GetRecords() {
+		if rec.Binary != nil {
+			if _, err := out.Write(rec.Binary); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.WriteString(out, formatRecord(format, formatter, rec)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP dumps the records kept as plain text, so that the writer can be
+// served as a /debug/logs page:
+//
+//	http.Handle("/debug/logs", memory)
+func (w *MemoryLogWriter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.DumpTo(rw)
+}
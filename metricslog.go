@@ -0,0 +1,178 @@
+package log4go
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// This log writer keeps no messages, only counts of the records per level and
+// source, for alerting on the error rate: served to Prometheus by ServeHTTP,
+// published with expvar.Publish, as it is an expvar.Var, or sent on to statsd
+// as they are logged.
+type MetricsLogWriter struct {
+	mu     sync.Mutex
+	counts map[metricsKey]uint64
+
+	name   string                     // of the Prometheus counter
+	source func(source string) string // the source label of a record's source
+
+	statsd     net.Conn // if set
+	statsdName string   // the metric's name
+	statsdTags bool     // in the DogStatsD way, rather than none
+}
+
+type metricsKey struct {
+	level  Level
+	source string
+}
+
+// NewMetricsLogWriter creates a new MetricsLogWriter counting records by level
+// and by the package they were logged from, as log4go_records_total until set
+// otherwise.
+func NewMetricsLogWriter() *MetricsLogWriter {
+	return &MetricsLogWriter{
+		counts: make(map[metricsKey]uint64),
+		name:   "log4go_records_total",
+		source: sourcePackage,
+	}
+}
+
+// The package of source, as log4go sets it: the function's name, a colon and
+// the line
+func sourcePackage(source string) string {
+	if colon := strings.LastIndex(source, ":"); colon >= 0 {
+		source = source[:colon]
+	}
+	slash := strings.LastIndex(source, "/")
+	if dot := strings.Index(source[slash+1:], "."); dot >= 0 {
+		return source[:slash+1+dot]
+	}
+	return source
+}
+
+// This is the MetricsLogWriter's output method
+func (w *MetricsLogWriter) LogWrite(rec *LogRecord) {
+	source := ""
+	if w.source != nil {
+		source = w.source(rec.Source)
+	}
+	w.mu.Lock()
+	w.counts[metricsKey{rec.Level, source}]++
+	w.mu.Unlock()
+
+	if w.statsd != nil {
+		line := w.statsdName + ":1|c"
+		if w.statsdTags {
+			line += "|#level:" + rec.Level.String()
+			if source != "" {
+				line += ",source:" + strings.NewReplacer(",", "_", "|", "_", "#", "_").Replace(source)
+			}
+		}
+		// a lost datagram is a count missed, not worth a complaint each time
+		w.statsd.Write([]byte(line))
+	}
+}
+
+// Close closes the connection to statsd, if any; the counts are still there to
+// be had.
+func (w *MetricsLogWriter) Close() {
+	if w.statsd != nil {
+		w.statsd.Close()
+	}
+}
+
+// Set the name of the Prometheus counter (chainable).  Must be called before
+// the first log message is written.
+func (w *MetricsLogWriter) SetName(name string) *MetricsLogWriter {
+	w.name = name
+	return w
+}
+
+// Set the function giving the source label of a record from its source
+// (chainable), e.g. to count by function rather than package; nil counts by
+// level alone.  Must be called before the first log message is written.
+func (w *MetricsLogWriter) SetSourceFunc(source func(source string) string) *MetricsLogWriter {
+	w.source = source
+	return w
+}
+
+// Send a count to the statsd at addr as each record is logged (chainable), as
+// the counter name, tagged with the level and source in the DogStatsD way if
+// tags is set.  Must be called before the first log message is written.
+func (w *MetricsLogWriter) SetStatsd(addr, name string, tags bool) *MetricsLogWriter {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "MetricsLogWriter(%q): %s\n", addr, err)
+		return w
+	}
+	w.statsd, w.statsdName, w.statsdTags = conn, name, tags
+	return w
+}
+
+// Count returns how many records at lvl have been logged from source, as the
+// source function gives it.
+func (w *MetricsLogWriter) Count(lvl Level, source string) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.counts[metricsKey{lvl, source}]
+}
+
+// The counts, sorted by level then source
+func (w *MetricsLogWriter) sorted() ([]metricsKey, []uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	keys := make([]metricsKey, 0, len(w.counts))
+	for key := range w.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].level != keys[j].level {
+			return keys[i].level < keys[j].level
+		}
+		return keys[i].source < keys[j].source
+	})
+	counts := make([]uint64, len(keys))
+	for i, key := range keys {
+		counts[i] = w.counts[key]
+	}
+	return keys, counts
+}
+
+// String returns the counts as JSON, by level then source, so that the writer
+// is an expvar.Var:
+//
+//	expvar.Publish("log4go", metrics)
+func (w *MetricsLogWriter) String() string {
+	keys, counts := w.sorted()
+	byLevel := make(map[string]map[string]uint64)
+	for i, key := range keys {
+		lvl := key.level.String()
+		if byLevel[lvl] == nil {
+			byLevel[lvl] = make(map[string]uint64)
+		}
+		byLevel[lvl][key.source] = counts[i]
+	}
+	js, _ := json.Marshal(byLevel)
+	return string(js)
+}
+
+// ServeHTTP serves the counts in the Prometheus text format, so that the
+// writer can be scraped:
+//
+//	http.Handle("/metrics", metrics)
+func (w *MetricsLogWriter) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintf(rw, "# HELP %s Records logged, by level and source.\n", w.name)
+	fmt.Fprintf(rw, "# TYPE %s counter\n", w.name)
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	keys, counts := w.sorted()
+	for i, key := range keys {
+		fmt.Fprintf(rw, "%s{level=\"%s\",source=\"%s\"} %d\n", w.name, key.level, escape.Replace(key.source), counts[i])
+	}
+}
@@ -0,0 +1,48 @@
+package log4go
+
+// Use adds middleware to log (chainable), each to be called in turn on every
+// record it logs, before the record is redacted and sent to the writers, to
+// change it, enrich it or drop it:
+//
+//	log.Use(func(rec *LogRecord) *LogRecord {
+//		if strings.HasPrefix(rec.Message, "health check") {
+//			return nil // dropped
+//		}
+//		rec.Message = strings.TrimSpace(rec.Message)
+//		return rec
+//	})
+//
+// A middleware may change the record and its fields in place, or return
+// another; the filters take the record at the level it is left at.  Loggers
+// derived from log With fields or WithCallerSkip have its middleware, though
+// not middleware added to log after.  Like AddFilter, this function should not
+// be called from multiple goroutines.
+func (log Logger) Use(middleware ...func(rec *LogRecord) *LogRecord) Logger {
+	base := &derivedLogWriter{}
+	if w := log.derivedWriter(); w != nil {
+		base = w
+	}
+	chain := append(base.middleware[:len(base.middleware):len(base.middleware)], middleware...)
+	for name, filt := range log {
+		w := &derivedLogWriter{LogWriter: filt.LogWriter, owned: true}
+		if bound, ok := filt.LogWriter.(*derivedLogWriter); ok {
+			w.LogWriter, w.owned = bound.LogWriter, bound.owned
+		}
+		w.fields, w.callerSkip, w.middleware = base.fields, base.callerSkip, chain
+		log[name] = &Filter{filt.Level, w}
+	}
+	return log
+}
+
+// Rec as the middleware of log leave it, and redacted, or nil if dropped
+func (log Logger) prepareRecord(rec *LogRecord) *LogRecord {
+	if w := log.derivedWriter(); w != nil {
+		for _, middleware := range w.middleware {
+			if rec = middleware(rec); rec == nil {
+				return nil
+			}
+		}
+	}
+	redactRecord(rec)
+	return rec
+}
@@ -0,0 +1,565 @@
+package log4go
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types, in the high nibble of the first byte
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttPubRec     = 5
+	mqttPubRel     = 6
+	mqttPubComp    = 7
+	mqttPingReq    = 12
+	mqttPingResp   = 13
+	mqttDisconnect = 14
+)
+
+// The reasons a broker refuses a connection, by return code
+var mqttRefusals = [...]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// This log writer publishes records to an MQTT broker, as on a device
+// forwarding its logs over the link it already has, at QoS 0, 1 or 2, with a
+// last will the broker publishes should the device drop off.
+type MQTTLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	addr      string // host:port
+	useTLS    bool
+	tlsConfig *tls.Config
+	clientID  string
+	username  string
+	password  string
+	keepAlive time.Duration
+	timeout   time.Duration
+	conn      *mqttConn
+
+	topic     string // format of the topics
+	format    string
+	formatter Formatter // in place of format, if set
+	qos       byte
+	retain    bool
+	id        uint16 // of the last packet
+
+	will       bool
+	willTopic  string
+	willMsg    string
+	willQoS    byte
+	willRetain bool
+
+	recovery writeRecovery // keeps going while the broker is down
+}
+
+// This is the MQTTLogWriter's output method
+func (w *MQTTLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
+}
+
+// wait for the records to be published and disconnect
+func (w *MQTTLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewMQTTLogWriter creates a new LogWriter which publishes records to the
+// broker, a URL such as "tcp://localhost:1883" or, over TLS,
+// "ssl://localhost:8883" ("mqtt://" and "mqtts://" work too), with the user
+// and password in it if any.  The topic of each message is the record
+// formatted with topic, e.g. "devices/pump1/log/%L", and its payload the
+// record formatted with "[%D %T] [%L] (%S) %M", until set otherwise.  Records
+// are published at QoS 0 until set otherwise.
+//
+// The connection is made when the first record is published, and made again
+// should it fail.  While the broker cannot be reached, records are dropped, or
+// written to stderr after SetStderrFallback; they are not published once it
+// can.  It returns nil if broker is not such a URL.
+func NewMQTTLogWriter(broker, topic string, opts ...Option) *MQTTLogWriter {
+	o := newWriterOptions(opts)
+	u, err := url.Parse(broker)
+	if err == nil && u.Host == "" {
+		err = errors.New("no host")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "MQTTLogWriter(%q): %s\n", broker, err)
+		return nil
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	w := &MQTTLogWriter{
+		rec:       make(chan *LogRecord, o.bufferLength),
+		blocking:  o.blocking,
+		addr:      u.Host,
+		clientID:  "log4go-" + hex.EncodeToString(id),
+		keepAlive: time.Minute,
+		timeout:   10 * time.Second,
+		topic:     topic,
+		format:    "[%D %T] [%L] (%S) %M",
+		recovery:  newWriteRecovery(),
+	}
+	w.recovery.kind = "MQTTLogWriter"
+	switch u.Scheme {
+	case "ssl", "tls", "mqtts":
+		w.useTLS = true
+	case "tcp", "mqtt":
+	default:
+		fmt.Fprintf(os.Stderr, "MQTTLogWriter(%q): unknown scheme %q\n", broker, u.Scheme)
+		return nil
+	}
+	if u.Port() == "" {
+		port := "1883"
+		if w.useTLS {
+			port = "8883"
+		}
+		w.addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	if u.User != nil {
+		w.username = u.User.Username()
+		w.password, _ = u.User.Password()
+	}
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		defer func() {
+			if w.conn != nil {
+				w.conn.disconnect()
+			}
+		}()
+
+		// pings the broker while idle, as it would drop the connection, once
+		// the first record has been taken with the settings
+		var ping <-chan time.Time
+		var timer *time.Timer
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+
+		for {
+			if timer == nil && w.conn != nil && w.keepAlive > 0 {
+				timer = time.NewTimer(w.keepAlive / 2)
+				ping = timer.C
+			}
+			select {
+			case <-ping:
+				timer, ping = nil, nil
+				if w.conn != nil && time.Since(w.conn.sent) >= w.keepAlive/2 {
+					if err := w.conn.write([]byte{mqttPingReq << 4, 0}); err != nil {
+						w.conn.close()
+						w.conn = nil
+					}
+				}
+				continue
+			case rec, ok := <-w.rec:
+				if !ok {
+					return
+				}
+				if w.EndNotify(rec) {
+					return
+				}
+				if w.recovery.waiting(time.Now()) {
+					w.recovery.setAside(rec, w.format, w.formatter)
+					continue
+				}
+				if err := w.send(rec); err != nil {
+					w.recovery.failed(w.addr, err, rec, w.format, w.formatter)
+					continue
+				}
+				w.recovery.succeeded(w.addr)
+			}
+		}
+	}()
+
+	return w
+}
+
+// Publish rec, connecting first if need be, and connecting again once if the
+// connection was lost, the message then marked as a duplicate.
+func (w *MQTTLogWriter) send(rec *LogRecord) error {
+	payload := rec.Binary
+	if payload == nil {
+		payload = []byte(strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n"))
+	}
+	topic := strings.TrimRight(FormatLogRecord(w.topic, rec), "\n")
+	var id uint16
+	if w.qos > 0 {
+		if w.id++; w.id == 0 {
+			w.id = 1
+		}
+		id = w.id
+	}
+
+	dup := false
+	if w.conn != nil {
+		if err := w.publish(topic, id, payload, false); err == nil {
+			return nil
+		}
+		w.conn.close()
+		w.conn = nil
+		dup = w.qos > 0
+	}
+
+	if err := w.connect(); err != nil {
+		return err
+	}
+	if err := w.publish(topic, id, payload, dup); err != nil {
+		w.conn.close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Publish a message, waiting for the broker to take it at QoS 1 and 2
+func (w *MQTTLogWriter) publish(topic string, id uint16, payload []byte, dup bool) error {
+	header := byte(mqttPublish<<4) | w.qos<<1
+	if dup {
+		header |= 1 << 3
+	}
+	if w.retain {
+		header |= 1
+	}
+	body := mqttString(nil, topic)
+	if w.qos > 0 {
+		body = append(body, byte(id>>8), byte(id))
+	}
+	if err := w.conn.write(mqttPacket(header, append(body, payload...))); err != nil {
+		return err
+	}
+
+	switch w.qos {
+	case 1:
+		return w.conn.expect(mqttPubAck, id)
+	case 2:
+		if err := w.conn.expect(mqttPubRec, id); err != nil {
+			return err
+		}
+		if err := w.conn.write(mqttPacket(mqttPubRel<<4|2, []byte{byte(id >> 8), byte(id)})); err != nil {
+			return err
+		}
+		return w.conn.expect(mqttPubComp, id)
+	}
+	return nil
+}
+
+func (w *MQTTLogWriter) connect() error {
+	dialer := &net.Dialer{Timeout: w.timeout}
+	var conn net.Conn
+	var err error
+	if w.useTLS {
+		config := w.tlsConfig
+		if config == nil {
+			host, _, _ := net.SplitHostPort(w.addr)
+			config = &tls.Config{ServerName: host}
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, config)
+	} else {
+		conn, err = dialer.Dial("tcp", w.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	flags := byte(0x02) // clean session
+	body := mqttString(nil, "MQTT")
+	payload := mqttString(nil, w.clientID)
+	if w.will {
+		flags |= 0x04 | w.willQoS<<3
+		if w.willRetain {
+			flags |= 0x20
+		}
+		payload = mqttString(mqttString(payload, w.willTopic), w.willMsg)
+	}
+	if w.username != "" {
+		flags |= 0x80
+		payload = mqttString(payload, w.username)
+		if w.password != "" {
+			flags |= 0x40
+			payload = mqttString(payload, w.password)
+		}
+	}
+	keepAlive := int(w.keepAlive / time.Second)
+	body = append(body, 4, flags, byte(keepAlive>>8), byte(keepAlive))
+
+	c := &mqttConn{conn: conn, packets: make(chan mqttAck, 16), timeout: w.timeout}
+	conn.SetDeadline(time.Now().Add(w.timeout))
+	r := bufio.NewReader(conn)
+	if err := c.write(mqttPacket(mqttConnect<<4, append(body, payload...))); err != nil {
+		conn.Close()
+		return err
+	}
+	typ, ack, err := readMQTTPacket(r)
+	if err == nil && (typ>>4 != mqttConnAck || len(ack) != 2) {
+		err = errors.New("no CONNACK from the broker")
+	}
+	if err == nil && ack[1] != 0 {
+		reason := "refused"
+		if int(ack[1]) < len(mqttRefusals) {
+			reason = mqttRefusals[ack[1]]
+		}
+		err = fmt.Errorf("connection refused: %s", reason)
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	go c.read(r)
+	w.conn = c
+	return nil
+}
+
+// An mqttConn is a connection to a broker, with the packets it sends read on
+// a goroutine of its own
+type mqttConn struct {
+	conn    net.Conn
+	packets chan mqttAck
+	err     error     // why packets was closed
+	sent    time.Time // when last written to
+	timeout time.Duration
+}
+
+// An acknowledgement of a packet, by id
+type mqttAck struct {
+	typ byte
+	id  uint16
+}
+
+func (c *mqttConn) write(packet []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	c.sent = time.Now()
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+func (c *mqttConn) read(r *bufio.Reader) {
+	var err error
+	defer func() {
+		c.err = err
+		close(c.packets)
+	}()
+
+	for {
+		var typ byte
+		var body []byte
+		if typ, body, err = readMQTTPacket(r); err != nil {
+			return
+		}
+		if len(body) < 2 {
+			continue // PINGRESP
+		}
+		select {
+		case c.packets <- mqttAck{typ: typ >> 4, id: binary.BigEndian.Uint16(body)}:
+		default:
+			// an acknowledgement no longer waited for
+		}
+	}
+}
+
+// Wait for the acknowledgement of the type of the packet id
+func (c *mqttConn) expect(typ byte, id uint16) error {
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case ack, ok := <-c.packets:
+			if !ok {
+				return c.err
+			}
+			if ack.typ == typ && ack.id == id {
+				return nil
+			}
+		case <-timer.C:
+			return fmt.Errorf("no acknowledgement in %s", c.timeout)
+		}
+	}
+}
+
+func (c *mqttConn) close() {
+	c.conn.Close()
+}
+
+// Disconnect, so that the broker does not publish the last will
+func (c *mqttConn) disconnect() {
+	c.write([]byte{mqttDisconnect << 4, 0})
+	c.conn.Close()
+}
+
+// A packet of the first byte and body, with the remaining length between
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// Append s as an MQTT string, its length first
+func mqttString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s)>>8), byte(len(s))), s...)
+}
+
+// readMQTTPacket reads a packet, returning its first byte and its body
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, shift := 0, uint(0)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// Set the logging format of the messages (chainable).  Must be called before
+// the first log message is written.
+func (w *MQTTLogWriter) SetFormat(format string) *MQTTLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *MQTTLogWriter) SetFormatter(formatter Formatter) *MQTTLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the QoS records are published at (chainable): 0, at most once, the
+// default; 1, at least once; or 2, exactly once, each record then waiting for
+// the broker.  Must be called before the first log message is written.
+func (w *MQTTLogWriter) SetQoS(qos byte) *MQTTLogWriter {
+	if qos > 2 {
+		fmt.Fprintf(os.Stderr, "MQTTLogWriter(%q): bad QoS %d\n", w.addr, qos)
+		return w
+	}
+	w.qos = qos
+	return w
+}
+
+// Set whether the broker retains the last record of each topic (chainable).
+// Must be called before the first log message is written.
+func (w *MQTTLogWriter) SetRetain(retain bool) *MQTTLogWriter {
+	w.retain = retain
+	return w
+}
+
+// Set the last will (chainable): the message the broker publishes to topic at
+// qos should the connection be lost rather than closed.  Must be called before
+// the first log message is written.
+func (w *MQTTLogWriter) SetWill(topic, message string, qos byte, retain bool) *MQTTLogWriter {
+	if qos > 2 {
+		fmt.Fprintf(os.Stderr, "MQTTLogWriter(%q): bad QoS %d\n", w.addr, qos)
+		return w
+	}
+	w.will = true
+	w.willTopic, w.willMsg, w.willQoS, w.willRetain = topic, message, qos, retain
+	return w
+}
+
+// Set the client identifier (chainable).  The default is "log4go-" then random
+// hex digits.  Must be called before the first log message is written.
+func (w *MQTTLogWriter) SetClientID(clientID string) *MQTTLogWriter {
+	w.clientID = clientID
+	return w
+}
+
+// Set the keep-alive interval (chainable): the broker deems the connection
+// lost after one and a half without a packet, so the writer pings it when
+// idle.  Zero turns it off.  The default is a minute.  Must be called before
+// the first log message is written.
+func (w *MQTTLogWriter) SetKeepAlive(keepAlive time.Duration) *MQTTLogWriter {
+	w.keepAlive = keepAlive
+	return w
+}
+
+// Set how long connecting, and the broker acknowledging a record, may take
+// (chainable).  The default is 10 seconds.  Must be called before the first
+// log message is written.
+func (w *MQTTLogWriter) SetTimeout(timeout time.Duration) *MQTTLogWriter {
+	w.timeout = timeout
+	return w
+}
+
+// Set the TLS configuration for an ssl:// broker (chainable).  The default
+// verifies the broker against the system roots.  Must be called before the
+// first log message is written.
+func (w *MQTTLogWriter) SetTLSConfig(config *tls.Config) *MQTTLogWriter {
+	w.tlsConfig = config
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time a record
+// cannot be published (chainable).  It must not log to this writer.  Must be
+// called before the first log message is written.
+func (w *MQTTLogWriter) SetErrorHandler(handler func(error)) *MQTTLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr while the broker cannot be
+// reached (chainable); otherwise they are dropped.  Must be called before the
+// first log message is written.
+func (w *MQTTLogWriter) SetStderrFallback(fallback bool) *MQTTLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the broker again after it cannot be
+// reached (chainable).  The wait doubles with each failure, up to max.  The
+// default is from one second up to a minute.  Must be called before the first
+// log message is written.
+func (w *MQTTLogWriter) SetRetryBackoff(initial, max time.Duration) *MQTTLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
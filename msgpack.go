@@ -0,0 +1,151 @@
+package log4go
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Just enough MessagePack (https://msgpack.org) to speak the Fluentd forward
+// protocol: the encoders append to a buffer, and readMsgpackStringMap reads a
+// map of strings back, as in an ack.
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n < 1<<16:
+		return append(b, 0xde, byte(n>>8), byte(n))
+	default:
+		return append(b, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n < 1<<16:
+		return append(b, 0xdc, byte(n>>8), byte(n))
+	default:
+		return append(b, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n < 1<<8:
+		b = append(b, 0xd9, byte(n))
+	case n < 1<<16:
+		b = append(b, 0xda, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	default:
+		b = append(b, 0xd3)
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(i))
+		return append(b, n[:]...)
+	}
+}
+
+// appendMsgpackEventTime appends t as the Fluentd EventTime extension (type 0):
+// seconds and nanoseconds, each 32 bits.
+func appendMsgpackEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	var n [8]byte
+	binary.BigEndian.PutUint32(n[:4], uint32(t.Unix()))
+	binary.BigEndian.PutUint32(n[4:], uint32(t.Nanosecond()))
+	return append(b, n[:]...)
+}
+
+// readMsgpackStringMap reads a map whose keys and values are all strings.
+func readMsgpackStringMap(r io.Reader) (map[string]string, error) {
+	var head [1]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch c := head[0]; {
+	case c&0xf0 == 0x80:
+		n = int(c & 0x0f)
+	case c == 0xde:
+		size, err := readMsgpackUint(r, 2)
+		if err != nil {
+			return nil, err
+		}
+		n = int(size)
+	default:
+		return nil, fmt.Errorf("msgpack: want a map, got 0x%02x", c)
+	}
+
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key, err := readMsgpackString(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readMsgpackString(r)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func readMsgpackString(r io.Reader) (string, error) {
+	var head [1]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return "", err
+	}
+
+	var n uint64
+	var err error
+	switch c := head[0]; {
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c == 0xd9, c == 0xc4:
+		n, err = readMsgpackUint(r, 1)
+	case c == 0xda, c == 0xc5:
+		n, err = readMsgpackUint(r, 2)
+	case c == 0xdb, c == 0xc6:
+		n, err = readMsgpackUint(r, 4)
+	default:
+		return "", fmt.Errorf("msgpack: want a string, got 0x%02x", c)
+	}
+	if err != nil {
+		return "", err
+	}
+	if n > 1<<20 {
+		return "", fmt.Errorf("msgpack: string of %d bytes", n)
+	}
+
+	s := make([]byte, n)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
+
+func readMsgpackUint(r io.Reader, size int) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[8-size:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
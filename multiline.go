@@ -0,0 +1,54 @@
+package log4go
+
+import (
+	"strings"
+)
+
+// How the newlines in a message are written
+type MultilinePolicy int
+
+const (
+	MULTILINE_ASIS   MultilinePolicy = iota // as they are
+	MULTILINE_ESCAPE                        // as \n, and carriage returns as \r
+	MULTILINE_INDENT                        // with each line after the first indented
+)
+
+// A MultilineFormatter writes records with a format, the newlines in their
+// messages, such as a stack trace's, handled by a policy, so that each record
+// stays on a line of its own or its continuation lines can be told apart:
+//
+//	writer.SetFormatter(NewMultilineFormatter(FORMAT_DEFAULT, MULTILINE_INDENT, "\t"))
+type MultilineFormatter struct {
+	format string
+	policy MultilinePolicy
+	indent *strings.Replacer
+}
+
+// NewMultilineFormatter creates a new MultilineFormatter writing records with
+// format, the newlines in their messages handled by policy, with prefix put
+// before each line after the first of a message by MULTILINE_INDENT.
+func NewMultilineFormatter(format string, policy MultilinePolicy, prefix string) *MultilineFormatter {
+	return &MultilineFormatter{
+		format: format,
+		policy: policy,
+		indent: strings.NewReplacer("\r\n", "\r\n"+prefix, "\n", "\n"+prefix),
+	}
+}
+
+// Format appends rec to *buf with the formatter's format.
+func (f *MultilineFormatter) Format(rec *LogRecord, buf *[]byte) {
+	if f.policy != MULTILINE_ASIS && strings.ContainsAny(rec.Message, "\r\n") {
+		copied := *rec
+		copied.Message = strings.TrimRight(rec.Message, "\r\n")
+		switch f.policy {
+		case MULTILINE_ESCAPE:
+			copied.Message = multilineEscape.Replace(copied.Message)
+		case MULTILINE_INDENT:
+			copied.Message = f.indent.Replace(copied.Message)
+		}
+		rec = &copied
+	}
+	*buf = append(*buf, FormatLogRecord(f.format, rec)...)
+}
+
+var multilineEscape = strings.NewReplacer("\r", `\r`, "\n", `\n`)
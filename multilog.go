@@ -0,0 +1,51 @@
+package log4go
+
+// This log writer sends each record to several writers, each with a level of
+// its own, so that a single filter can log to the console at INFO, to a file
+// at DEBUG and to a remote sink at ERROR.  Each writer formats records as it
+// is set to.  Add the MultiLogWriter to a Logger at the lowest of the levels,
+// as the filter's level comes first.
+type MultiLogWriter struct {
+	writers []*Filter
+}
+
+// NewMultiLogWriter creates a new MultiLogWriter, sending records nowhere
+// until writers are added.
+func NewMultiLogWriter() *MultiLogWriter {
+	return &MultiLogWriter{}
+}
+
+// Add sends records at lvl and above to writer (chainable), on top of the
+// writers already added.  Must be called before the first log message is
+// written.
+func (w *MultiLogWriter) Add(lvl Level, writer LogWriter) *MultiLogWriter {
+	w.writers = append(w.writers, &Filter{lvl, writer})
+	return w
+}
+
+// This is the MultiLogWriter's output method
+func (w *MultiLogWriter) LogWrite(rec *LogRecord) {
+	for _, f := range w.writers {
+		if rec.Level >= f.Level {
+			f.LogWrite(rec)
+		}
+	}
+}
+
+// Flush flushes the writers that can be.
+func (w *MultiLogWriter) Flush() {
+	for _, f := range w.writers {
+		if fw, ok := f.LogWriter.(interface {
+			Flush()
+		}); ok {
+			fw.Flush()
+		}
+	}
+}
+
+// Close closes every writer.
+func (w *MultiLogWriter) Close() {
+	for _, f := range w.writers {
+		f.Close()
+	}
+}
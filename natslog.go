@@ -0,0 +1,502 @@
+package log4go
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This log writer publishes records to a NATS subject, formatted from each
+// record so that subscribers can pick levels or sources, or with
+// SetJetStream(true) to a JetStream stream, waiting for it to store each one.
+type NATSLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	servers   []*url.URL // tried in turn
+	server    int        // the one connected to, or to try next
+	hosts     string     // of the servers, naming the writer in messages
+	tlsConfig *tls.Config
+	token     string // if set, rather than the user and password of the URL
+	name      string
+	timeout   time.Duration
+	conn      *natsConn
+
+	subject   string // format of the subjects
+	format    string
+	formatter Formatter // in place of format, if set
+	jetStream bool
+	id        string // of this writer, in the inbox and message ids
+	seq       uint64 // of the last record published
+
+	recovery writeRecovery // keeps going while the servers are down
+}
+
+// This is the NATSLogWriter's output method
+func (w *NATSLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
+}
+
+// wait for the records to be published and close the connection
+func (w *NATSLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewNATSLogWriter creates a new LogWriter which publishes records to the NATS
+// servers, a comma-separated list of URLs such as "nats://localhost:4222", or
+// "tls://..." to connect over TLS.  A user and password in a URL are logged in
+// with.  The subject of each message is the record formatted with subject, e.g.
+// "logs.%L", and its payload the record formatted with "[%D %T] [%L] (%S) %M",
+// until set otherwise.
+//
+// The connection is made when the first record is published, and should it
+// fail, made again to the next server.  While none can be reached, records are
+// dropped, or written to stderr after SetStderrFallback; they are not
+// published once one can.  It returns nil if a server is not a URL.
+func NewNATSLogWriter(servers, subject string, opts ...Option) *NATSLogWriter {
+	o := newWriterOptions(opts)
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	w := &NATSLogWriter{
+		rec:      make(chan *LogRecord, o.bufferLength),
+		blocking: o.blocking,
+		timeout:  10 * time.Second,
+		subject:  subject,
+		format:   "[%D %T] [%L] (%S) %M",
+		id:       hex.EncodeToString(id),
+		recovery: newWriteRecovery(),
+	}
+	w.recovery.kind = "NATSLogWriter"
+	for _, server := range strings.Split(servers, ",") {
+		server = strings.TrimSpace(server)
+		if !strings.Contains(server, "://") {
+			server = "nats://" + server
+		}
+		u, err := url.Parse(server)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "NATSLogWriter(%q): %s\n", servers, err)
+			return nil
+		}
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "4222")
+		}
+		w.servers = append(w.servers, u)
+	}
+	for i, u := range w.servers {
+		if i > 0 {
+			w.hosts += ","
+		}
+		w.hosts += u.Host
+	}
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		defer func() {
+			if w.conn != nil {
+				w.conn.close()
+			}
+		}()
+
+		for rec := range w.rec {
+			if w.EndNotify(rec) {
+				return
+			}
+			if w.recovery.waiting(time.Now()) {
+				w.recovery.setAside(rec, w.format, w.formatter)
+				continue
+			}
+			if err := w.send(rec); err != nil {
+				w.recovery.failed(w.hosts, err, rec, w.format, w.formatter)
+				continue
+			}
+			w.recovery.succeeded(w.hosts)
+		}
+	}()
+
+	return w
+}
+
+// Publish rec, connecting first if need be, and connecting again, to the next
+// server, once if the connection was lost.
+func (w *NATSLogWriter) send(rec *LogRecord) error {
+	payload := rec.Binary
+	if payload == nil {
+		payload = []byte(strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n"))
+	}
+	subject := strings.TrimRight(FormatLogRecord(w.subject, rec), "\n")
+	w.seq++
+	msgID := w.id + "." + strconv.FormatUint(w.seq, 10)
+
+	if w.conn != nil {
+		err := w.publish(subject, msgID, payload)
+		if _, isAck := err.(natsAckError); err == nil || isAck {
+			return err
+		}
+		w.lost()
+	}
+
+	if err := w.connect(); err != nil {
+		w.server = (w.server + 1) % len(w.servers)
+		return err
+	}
+	err := w.publish(subject, msgID, payload)
+	if _, isAck := err.(natsAckError); err != nil && !isAck {
+		w.lost()
+	}
+	return err
+}
+
+// Drop the connection, to connect to the next server
+func (w *NATSLogWriter) lost() {
+	w.conn.close()
+	w.conn = nil
+	w.server = (w.server + 1) % len(w.servers)
+}
+
+// A natsAckError is JetStream refusing a message, rather than the connection
+// failing
+type natsAckError string
+
+func (e natsAckError) Error() string {
+	return string(e)
+}
+
+func (w *NATSLogWriter) publish(subject, msgID string, payload []byte) error {
+	if !w.jetStream {
+		return w.conn.write(fmt.Sprintf("PUB %s %d\r\n%s\r\n", subject, len(payload), payload))
+	}
+
+	// with an id, so that JetStream drops the message sent again after a
+	// reconnect it had stored already
+	reply := "_INBOX." + w.id + "." + msgID[len(w.id)+1:]
+	header := "NATS/1.0\r\nNats-Msg-Id: " + msgID + "\r\n\r\n"
+	err := w.conn.write(fmt.Sprintf("HPUB %s %s %d %d\r\n%s%s\r\n",
+		subject, reply, len(header), len(header)+len(payload), header, payload))
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg, ok := <-w.conn.msgs:
+			if !ok {
+				return w.conn.err
+			}
+			if msg.subject != reply {
+				continue
+			}
+			if msg.status == "503" {
+				return natsAckError("no stream for subject " + subject)
+			}
+			var ack struct {
+				Error *struct {
+					Code        int    `json:"code"`
+					Description string `json:"description"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(msg.payload, &ack); err != nil {
+				return natsAckError("bad acknowledgement: " + err.Error())
+			}
+			if ack.Error != nil {
+				return natsAckError(fmt.Sprintf("JetStream error %d: %s", ack.Error.Code, ack.Error.Description))
+			}
+			return nil
+		case <-timer.C:
+			return fmt.Errorf("no acknowledgement in %s", w.timeout)
+		}
+	}
+}
+
+func (w *NATSLogWriter) connect() error {
+	u := w.servers[w.server]
+	conn, err := net.DialTimeout("tcp", u.Host, w.timeout)
+	if err != nil {
+		return err
+	}
+
+	options := map[string]interface{}{
+		"verbose":       false,
+		"pedantic":      false,
+		"lang":          "go",
+		"version":       "log4go",
+		"protocol":      1,
+		"headers":       true,
+		"no_responders": true,
+	}
+	if w.name != "" {
+		options["name"] = w.name
+	}
+	if w.token != "" {
+		options["auth_token"] = w.token
+	} else if u.User != nil {
+		options["user"] = u.User.Username()
+		options["pass"], _ = u.User.Password()
+	}
+
+	config := w.tlsConfig
+	if config == nil && u.Scheme == "tls" {
+		config = &tls.Config{ServerName: u.Hostname()}
+	}
+	c, err := openNATS(conn, options, config, w.timeout)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if w.jetStream {
+		if err := c.write("SUB _INBOX." + w.id + ".* 1\r\n"); err != nil {
+			c.close()
+			return err
+		}
+	}
+	w.conn = c
+	return nil
+}
+
+// A natsConn is a connection to a NATS server, its messages read on a
+// goroutine of its own, which answers the server's pings
+type natsConn struct {
+	conn net.Conn
+	mu   sync.Mutex // for writing
+	msgs chan natsMsg
+	err  error // why msgs was closed
+
+	timeout time.Duration
+}
+
+type natsMsg struct {
+	subject string
+	status  string // of the header, if any
+	payload []byte
+}
+
+// openNATS connects over conn, with TLS if the server requires it or config is
+// set, and waits for the server to accept the options.
+func openNATS(conn net.Conn, options map[string]interface{}, config *tls.Config, timeout time.Duration) (*natsConn, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return nil, fmt.Errorf("not a NATS server: %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(line[5:]), &info)
+
+	if info.TLSRequired || config != nil {
+		if config == nil {
+			host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+			config = &tls.Config{ServerName: host}
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		conn, r = tlsConn, bufio.NewReader(tlsConn)
+		options["tls_required"] = true
+	}
+
+	connect, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		return nil, err
+	}
+	// the server answers the ping once it has taken the options
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			return nil, errors.New(strings.TrimSpace(line[4:]))
+		}
+		if strings.HasPrefix(line, "PONG") {
+			break
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	c := &natsConn{conn: conn, msgs: make(chan natsMsg, 64), timeout: timeout}
+	go c.read(r)
+	return c, nil
+}
+
+func (c *natsConn) write(s string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := io.WriteString(c.conn, s)
+	return err
+}
+
+// read reads what the server sends until the connection fails, answering
+// pings and passing on messages
+func (c *natsConn) read(r *bufio.Reader) {
+	var err error
+	defer func() {
+		c.err = err
+		close(c.msgs)
+		c.conn.Close()
+	}()
+
+	for {
+		var line string
+		if line, err = r.ReadString('\n'); err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var msg natsMsg
+		var header, size int
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			c.write("PONG\r\n")
+			continue
+		case "-ERR":
+			err = errors.New(strings.TrimSpace(line[4:]))
+			return
+		case "MSG":
+			// MSG subject sid [reply] size
+			if len(fields) < 4 {
+				continue
+			}
+			size, _ = strconv.Atoi(fields[len(fields)-1])
+		case "HMSG":
+			// HMSG subject sid [reply] header-size size
+			if len(fields) < 5 {
+				continue
+			}
+			header, _ = strconv.Atoi(fields[len(fields)-2])
+			size, _ = strconv.Atoi(fields[len(fields)-1])
+		default:
+			continue
+		}
+
+		payload := make([]byte, size+2)
+		if _, err = io.ReadFull(r, payload); err != nil {
+			return
+		}
+		msg.subject, msg.payload = fields[1], payload[header:size]
+		if header > 0 {
+			// NATS/1.0 503
+			status := strings.Fields(strings.SplitN(string(payload[:header]), "\r\n", 2)[0])
+			if len(status) > 1 {
+				msg.status = status[1]
+			}
+		}
+		select {
+		case c.msgs <- msg:
+		default:
+			// an acknowledgement no longer waited for
+		}
+	}
+}
+
+func (c *natsConn) close() {
+	c.conn.Close()
+}
+
+// Set the logging format of the messages (chainable).  Must be called before
+// the first log message is written.
+func (w *NATSLogWriter) SetFormat(format string) *NATSLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *NATSLogWriter) SetFormatter(formatter Formatter) *NATSLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set whether records are published to JetStream (chainable), a stream having
+// to take in the subjects: each waits to be acknowledged as stored, and is
+// sent with a message id so that one sent again after a reconnect is stored
+// only once.  Must be called before the first log message is written.
+func (w *NATSLogWriter) SetJetStream(jetStream bool) *NATSLogWriter {
+	w.jetStream = jetStream
+	return w
+}
+
+// Set the token to log in with (chainable), rather than the user and password
+// of the URLs.  Must be called before the first log message is written.
+func (w *NATSLogWriter) SetToken(token string) *NATSLogWriter {
+	w.token = token
+	return w
+}
+
+// Set the name the connection is known by to the servers (chainable).  Must be
+// called before the first log message is written.
+func (w *NATSLogWriter) SetName(name string) *NATSLogWriter {
+	w.name = name
+	return w
+}
+
+// Set the TLS configuration to connect with (chainable).  Without one, TLS is
+// used for "tls://" servers, and those requiring it.  Must be called before
+// the first log message is written.
+func (w *NATSLogWriter) SetTLSConfig(config *tls.Config) *NATSLogWriter {
+	w.tlsConfig = config
+	return w
+}
+
+// Set how long connecting, and JetStream acknowledging a record, may take
+// (chainable).  The default is 10 seconds.  Must be called before the first
+// log message is written.
+func (w *NATSLogWriter) SetTimeout(timeout time.Duration) *NATSLogWriter {
+	w.timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time a record
+// cannot be published (chainable).  It must not log to this writer.  Must be
+// called before the first log message is written.
+func (w *NATSLogWriter) SetErrorHandler(handler func(error)) *NATSLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr while no server can be reached
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *NATSLogWriter) SetStderrFallback(fallback bool) *NATSLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the servers again after none can be
+// reached (chainable).  The wait doubles with each failure, up to max.  The
+// default is from one second up to a minute.  Must be called before the first
+// log message is written.
+func (w *NATSLogWriter) SetRetryBackoff(initial, max time.Duration) *NATSLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
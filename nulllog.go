@@ -0,0 +1,53 @@
+package log4go
+
+import (
+	"sync/atomic"
+)
+
+// This log writer discards records, only counting them per level: to measure
+// what log calls cost, or to silence a module while still seeing how much it
+// logs.
+type NullLogWriter struct {
+	counts [CRITICAL + 1]uint64 // first, to be aligned for atomic
+}
+
+// NewNullLogWriter creates a new NullLogWriter, with nothing counted yet.
+func NewNullLogWriter() *NullLogWriter {
+	return &NullLogWriter{}
+}
+
+// This is the NullLogWriter's output method
+func (w *NullLogWriter) LogWrite(rec *LogRecord) {
+	if rec.Level >= FINEST && rec.Level <= CRITICAL {
+		atomic.AddUint64(&w.counts[rec.Level], 1)
+	}
+	releaseRecord(rec)
+}
+
+// Close does nothing; the counts are still there to be had.
+func (w *NullLogWriter) Close() {
+}
+
+// Count returns how many records at lvl have been discarded.
+func (w *NullLogWriter) Count(lvl Level) uint64 {
+	if lvl < FINEST || lvl > CRITICAL {
+		return 0
+	}
+	return atomic.LoadUint64(&w.counts[lvl])
+}
+
+// Total returns how many records have been discarded, at every level.
+func (w *NullLogWriter) Total() uint64 {
+	var total uint64
+	for lvl := range w.counts {
+		total += atomic.LoadUint64(&w.counts[lvl])
+	}
+	return total
+}
+
+// Reset starts counting again from nothing.
+func (w *NullLogWriter) Reset() {
+	for lvl := range w.counts {
+		atomic.StoreUint64(&w.counts[lvl], 0)
+	}
+}
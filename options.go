@@ -0,0 +1,329 @@
+package log4go
+
+import (
+	"crypto/tls"
+	"os"
+	"time"
+)
+
+// An Option sets up a writer as its constructor makes it, in place of the
+// defaults of the package, such as the length of its buffer, or as its
+// chainable setters do; the writers taking none of their own last take them
+// last, and NewFileWriter, NewTimeFileWriter, NewPanicFileWriter and
+// NewSocketWriter take nothing else but the file or the address:
+//
+//	w := log4go.NewFileWriter("app.log",
+//		log4go.WithRotate(true),
+//		log4go.WithRotateSize(100<<20),
+//		log4go.WithFormatter(log4go.NewJSONFormatter()),
+//		log4go.WithBufferLength(100),
+//		log4go.WithBlocking(false))
+//
+// The options are applied in order, after the arguments before them.  An
+// Option a writer has no use for is ignored.  NewExecLogWriter and
+// NewSMTPLogWriter, whose last arguments are their own, take the defaults, and
+// a FormatLogWriter always blocks.
+type Option interface {
+	applyOption(o *writerOptions)
+}
+
+// What the Options set
+type writerOptions struct {
+	bufferLength int
+	blocking     bool
+	redirect     PanicFileOptions
+
+	// For the constructors of options only
+	rotate bool
+	when   string
+	proto  string
+
+	setups []func(w LogWriter) // setters called once the writer is made
+}
+
+type optionFunc func(o *writerOptions)
+
+func (f optionFunc) applyOption(o *writerOptions) {
+	f(o)
+}
+
+// WithBufferLength sets how many records the writer holds before it blocks,
+// or drops them, without WithBlocking; LogBufferLength by default.
+func WithBufferLength(length int) Option {
+	return optionFunc(func(o *writerOptions) {
+		if length < 0 {
+			length = 0
+		}
+		o.bufferLength = length
+	})
+}
+
+// WithBlocking sets whether logging blocks while the writer's buffer is full,
+// or the records are dropped; LogWithBlocking by default.
+func WithBlocking(blocking bool) Option {
+	return optionFunc(func(o *writerOptions) {
+		o.blocking = blocking
+	})
+}
+
+// The streams a PanicFileLogWriter redirects, as an Option
+func (p PanicFileOptions) applyOption(o *writerOptions) {
+	o.redirect.RedirectStdout = o.redirect.RedirectStdout || p.RedirectStdout
+	o.redirect.RedirectStderr = o.redirect.RedirectStderr || p.RedirectStderr
+}
+
+// An Option calling setters of the writer
+func setupOption(setup func(w LogWriter)) Option {
+	return optionFunc(func(o *writerOptions) {
+		o.setups = append(o.setups, setup)
+	})
+}
+
+// Call the setters of the options on w, once it is made
+func (o *writerOptions) setup(w LogWriter) {
+	for _, setup := range o.setups {
+		setup(w)
+	}
+}
+
+// WithRotate sets whether NewFileWriter renames the file to a backup as it
+// opens one, as NewFileLogWriter does given rotate.
+func WithRotate(rotate bool) Option {
+	return optionFunc(func(o *writerOptions) {
+		o.rotate = rotate
+	})
+}
+
+// WithRotateWhen sets when NewTimeFileWriter and NewPanicFileWriter roll the
+// file over, as NewTimeFileLogWriter does given when; "D", at midnight, by
+// default.
+func WithRotateWhen(when string) Option {
+	return optionFunc(func(o *writerOptions) {
+		o.when = when
+	})
+}
+
+// WithProtocol sets the protocol NewSocketWriter connects with, as
+// NewSocketLogWriter does given proto; "tcp" by default.
+func WithProtocol(proto string) Option {
+	return optionFunc(func(o *writerOptions) {
+		o.proto = proto
+	})
+}
+
+// WithFormat sets the format of the file writers and of the socket writer, as
+// their SetFormat does.
+func WithFormat(format string) Option {
+	return setupOption(func(w LogWriter) {
+		switch w := w.(type) {
+		case *FileLogWriter:
+			w.SetFormat(format)
+		case *TimeFileLogWriter:
+			w.SetFormat(format)
+		case *PanicFileLogWriter:
+			w.SetFormat(format)
+		case *SocketLogWriter:
+			w.SetFormat(format)
+		}
+	})
+}
+
+// WithFormatter sets the formatter of the file writers and of the socket
+// writer, as their SetFormatter does.
+func WithFormatter(formatter Formatter) Option {
+	return setupOption(func(w LogWriter) {
+		switch w := w.(type) {
+		case *FileLogWriter:
+			w.SetFormatter(formatter)
+		case *TimeFileLogWriter:
+			w.SetFormatter(formatter)
+		case *PanicFileLogWriter:
+			w.SetFormatter(formatter)
+		case *SocketLogWriter:
+			w.SetFormatter(formatter)
+		}
+	})
+}
+
+// WithErrorHandler sets the function told of the errors of the file writers
+// and of the socket writer, as their SetErrorHandler does.
+func WithErrorHandler(handler func(error)) Option {
+	return setupOption(func(w LogWriter) {
+		switch w := w.(type) {
+		case *FileLogWriter:
+			w.SetErrorHandler(handler)
+		case *TimeFileLogWriter:
+			w.SetErrorHandler(handler)
+		case *PanicFileLogWriter:
+			w.SetErrorHandler(handler)
+		case *SocketLogWriter:
+			w.SetErrorHandler(handler)
+		}
+	})
+}
+
+// WithRotateSize sets the size a FileLogWriter rotates at, as SetRotateSize
+// does.
+func WithRotateSize(maxsize int) Option {
+	return setupOption(func(w LogWriter) {
+		if w, ok := w.(*FileLogWriter); ok {
+			w.SetRotateSize(maxsize)
+		}
+	})
+}
+
+// WithRotateLines sets the lines a FileLogWriter rotates at, as SetRotateLines
+// does.
+func WithRotateLines(maxlines int) Option {
+	return setupOption(func(w LogWriter) {
+		if w, ok := w.(*FileLogWriter); ok {
+			w.SetRotateLines(maxlines)
+		}
+	})
+}
+
+// WithRotateDaily sets whether a FileLogWriter rotates daily, as
+// SetRotateDaily does.
+func WithRotateDaily(daily bool) Option {
+	return setupOption(func(w LogWriter) {
+		if w, ok := w.(*FileLogWriter); ok {
+			w.SetRotateDaily(daily)
+		}
+	})
+}
+
+// WithMaxBackup sets how many old files the file writers keep, as
+// SetRotateMaxBackup does and NewTimeFileLogWriter given backupCount; 0, for
+// all, for the ones rolled over by time.
+func WithMaxBackup(maxbackup int) Option {
+	return setupOption(func(w LogWriter) {
+		switch w := w.(type) {
+		case *FileLogWriter:
+			w.SetRotateMaxBackup(maxbackup)
+		case *TimeFileLogWriter:
+			w.backupCount = maxbackup
+		case *PanicFileLogWriter:
+			w.backupCount = maxbackup
+		}
+	})
+}
+
+// WithMaxTotalSize sets the combined size of the old files the file writers
+// keep, as their SetMaxTotalSize does.
+func WithMaxTotalSize(maxtotalsize int64) Option {
+	return setupOption(func(w LogWriter) {
+		switch w := w.(type) {
+		case *FileLogWriter:
+			w.SetMaxTotalSize(maxtotalsize)
+		case *TimeFileLogWriter:
+			w.SetMaxTotalSize(maxtotalsize)
+		case *PanicFileLogWriter:
+			w.SetMaxTotalSize(maxtotalsize)
+		}
+	})
+}
+
+// WithMaxAge sets the age of the old files the file writers delete, as their
+// SetMaxAge does.
+func WithMaxAge(maxage time.Duration) Option {
+	return setupOption(func(w LogWriter) {
+		switch w := w.(type) {
+		case *FileLogWriter:
+			w.SetMaxAge(maxage)
+		case *TimeFileLogWriter:
+			w.SetMaxAge(maxage)
+		case *PanicFileLogWriter:
+			w.SetMaxAge(maxage)
+		}
+	})
+}
+
+// WithFileMode sets the permissions of the files the file writers open, as
+// their SetFileMode does.
+func WithFileMode(mode os.FileMode) Option {
+	return setupOption(func(w LogWriter) {
+		switch w := w.(type) {
+		case *FileLogWriter:
+			w.SetFileMode(mode)
+		case *TimeFileLogWriter:
+			w.SetFileMode(mode)
+		case *PanicFileLogWriter:
+			w.SetFileMode(mode)
+		}
+	})
+}
+
+// WithBufferSize sets how many bytes of records the file writers buffer
+// before writing them to the file, as their SetBufferSize does; not to be
+// confused with WithBufferLength.
+func WithBufferSize(size int) Option {
+	return setupOption(func(w LogWriter) {
+		switch w := w.(type) {
+		case *FileLogWriter:
+			w.SetBufferSize(size)
+		case *TimeFileLogWriter:
+			w.SetBufferSize(size)
+		case *PanicFileLogWriter:
+			w.SetBufferSize(size)
+		}
+	})
+}
+
+// WithSync sets when a FileLogWriter or a PanicFileLogWriter fsyncs the file,
+// as their SetSync does.
+func WithSync(mode string) Option {
+	return setupOption(func(w LogWriter) {
+		switch w := w.(type) {
+		case *FileLogWriter:
+			w.SetSync(mode)
+		case *PanicFileLogWriter:
+			w.SetSync(mode)
+		}
+	})
+}
+
+// WithFraming sets how a SocketLogWriter frames the records, as SetFraming
+// does.
+func WithFraming(framing string) Option {
+	return setupOption(func(w LogWriter) {
+		if w, ok := w.(*SocketLogWriter); ok {
+			w.SetFraming(framing)
+		}
+	})
+}
+
+// WithTLSConfig sets the TLS configuration a SocketLogWriter connects with, as
+// SetTLSConfig does.
+func WithTLSConfig(config *tls.Config) Option {
+	return setupOption(func(w LogWriter) {
+		if w, ok := w.(*SocketLogWriter); ok {
+			w.SetTLSConfig(config)
+		}
+	})
+}
+
+// The options of a writer, over the defaults of the package
+func newWriterOptions(opts []Option) writerOptions {
+	o := writerOptions{bufferLength: LogBufferLength, blocking: LogWithBlocking}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.applyOption(&o)
+		}
+	}
+	return o
+}
+
+// Send rec to a writer's buffer, and return true, or, if it is full and the
+// writer does not block, return false
+func sendRecord(buffer chan *LogRecord, rec *LogRecord, blocking bool) bool {
+	if blocking {
+		buffer <- rec
+		return true
+	}
+	select {
+	case buffer <- rec:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,81 @@
+package log4go
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// CapturePanic logs a panic in the calling goroutine as a CRITICAL record and
+// then panics again with the same value.  Defer it first thing in main and in
+// each goroutine worth watching:
+//
+//	defer log.CapturePanic()
+//
+// The record's source is the function that panicked and its message is
+// "panic: " and the value, followed by the stack traces of every goroutine.
+// Writers with a Flush method are flushed before the panic goes on.  Fatal
+// runtime errors, such as a concurrent map write, cannot be recovered; only a
+// PanicFileLogWriter redirecting stderr catches those.
+func (log Logger) CapturePanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.logPanic(r)
+	panic(r)
+}
+
+func (log Logger) logPanic(r interface{}) {
+	rec := &LogRecord{
+		Level:   CRITICAL,
+		Created: time.Now(),
+		Source:  panicSource(),
+		Message: fmt.Sprintf("panic: %v\n\n%s", r, allStacks()),
+	}
+	redactRecord(rec)
+
+	for _, filt := range log {
+		if rec.Level < filt.Level {
+			continue
+		}
+		filt.LogWrite(rec)
+		if f, ok := filt.LogWriter.(interface {
+			Flush()
+		}); ok {
+			f.Flush()
+		}
+	}
+}
+
+// panicSource returns the function and line that panicked, as in
+// LogRecord.Source, from within a deferred call.
+func panicSource() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	for panicking := false; ; {
+		frame, more := frames.Next()
+		if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s:%d", frame.Function, frame.Line)
+		}
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// allStacks returns the stack traces of every goroutine.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
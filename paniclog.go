@@ -1,20 +1,33 @@
 package log4go
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 )
 
+// PanicFileOptions choose which of the process's standard streams a
+// PanicFileLogWriter takes over.  Whatever is written to a redirected stream,
+// such as the stack trace of a panic on stderr, ends up in the log file.
+// They are an Option, as NewPanicFileWriter takes them.
+type PanicFileOptions struct {
+	RedirectStdout bool
+	RedirectStderr bool
+}
+
 // This log writer sends output to a file
 type PanicFileLogWriter struct {
 	LogCloser //for Elegant exit
 
-	rec chan *LogRecord
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
 
 	// The opened file
 	filename     string
@@ -22,39 +35,65 @@ type PanicFileLogWriter struct {
 	file         *os.File
 
 	// The logging format
-	format string
+	format    string
+	formatter Formatter // in place of format, if set
 
-	when        string // 'D', 'H', 'M'
+	when        string // 'D', 'H', 'M', 'W0'-'W6', 'MONTH', '15M', '4H', ...
 	backupCount int    // If backupCount is > 0, when rollover is done,
 	// no more than backupCount files are kept
+	maxTotalSize int64 // If maxTotalSize is > 0, when rollover is done,
+	// the oldest files are deleted until the rest fit in maxTotalSize bytes
+	maxAge time.Duration // If maxAge is > 0, when rollover is done,
+	// files last written more than maxAge ago are deleted
 
 	interval   int64
 	suffix     string         // suffix of log file
 	fileFilter *regexp.Regexp // for removing old log files
+	backupGlob string         // for removing old log files, overriding fileFilter
+
+	hooks rotationHooks // notified of each rollover
+	utc   bool          // compute rollover and suffix in UTC, not local time
+	perm  fileOptions   // permissions and owner of the log files
+
+	copyTruncate bool          // copy to the backup and truncate, rather than rename
+	rotateAt     time.Duration // time of day daily rollover happens at
+	sequence     bool          // number backups .1, .2, ... instead of by date
+	syncMode     string        // when to fsync: "none", "interval" or "every"
+	syncInterval time.Duration // how often to fsync in "interval" mode
+
+	buf           *bufio.Writer // buffers writes to file, if set
+	flushInterval time.Duration // longest a buffered record waits to be written
+	flushed       chan bool     // signalled when Flush has been done
+	recovery      writeRecovery // keeps going when the file cannot be written
+
+	header, footer func() string // lines written when a file is opened and closed
+	encrypt        *logSealer    // encrypts what is written, if set
+	audit          *auditChain   // chains an HMAC to each record, if set
+
+	stdMu    sync.Mutex
+	redirect PanicFileOptions // standard streams pointed at the log file
+	savedStd [3]*os.File      // where they pointed before, by fd
 
 	rolloverAt    int64 // time.Unix()
 	firstRollover bool  // the flag of first Rollover
 }
 
-// This is the FileLogWriter's output method
+// This is the PanicFileLogWriter's output method.  This blocks while the
+// output buffer is full, or drops the record, given WithBlocking(false).
 func (w *PanicFileLogWriter) LogWrite(rec *LogRecord) {
-	if !LogWithBlocking {
-		if len(w.rec) >= LogBufferLength {
-			//            if WithModuleState {
-			//                log4goState.Inc("ERR_TIMEFILE_LOG_OVERFLOW", 1)
-			//            }
-
-			return
-		}
+	if !sendRecord(w.rec, rec, w.blocking) {
+		releaseRecord(rec)
 	}
-
-	w.rec <- rec
 }
 
-//wait for dump all log and close chan
+// wait for dump all log and close chan
 func (w *PanicFileLogWriter) Close() {
+	unregisterReopener(w)
 	w.WaitForEnd(w.rec)
 	close(w.rec)
+	if err := w.RestoreStdFds(); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
 }
 
 /* prepare according to "when"  */
@@ -74,25 +113,42 @@ func (w *PanicFileLogWriter) prepare() {
 		w.interval = 60 * 60 * 24
 		w.suffix = "%Y-%m-%d"
 		regRule = `^\d{4}-\d{2}-\d{2}$`
+	case "W0", "W1", "W2", "W3", "W4", "W5", "W6":
+		w.interval = 60 * 60 * 24 * 7
+		w.suffix = "%Y-%m-%d"
+		regRule = `^\d{4}-\d{2}-\d{2}$`
+	case "MONTH":
+		w.interval = 60 * 60 * 24 * 31
+		w.suffix = "%Y-%m"
+		regRule = `^\d{4}-\d{2}$`
 	default:
 		// default is "D"
 		w.interval = 60 * 60 * 24
 		w.suffix = "%Y-%m-%d"
 		regRule = `^\d{4}-\d{2}-\d{2}$`
 	}
+	if interval, ok := whenInterval(w.when); ok {
+		w.interval = interval
+		w.suffix, regRule = intervalSuffix(interval)
+	}
 	w.fileFilter = regexp.MustCompile(regRule)
+	w.startRollover()
+}
 
-	fInfo, err := os.Stat(w.filename)
-
-	var t time.Time
-	if err == nil {
+// Set the first rollover, the next after the log file was last written, or
+// after now if there is none
+func (w *PanicFileLogWriter) startRollover() {
+	t := time.Now()
+	if fInfo, err := os.Stat(w.filename); err == nil {
 		t = fInfo.ModTime()
-	} else {
-		t = time.Now()
 	}
 
 	w.firstRollover = true
-	w.rolloverAt = (t.Unix()/w.interval + 1) * w.interval
+	if at, ok := calendarRollover(w.when, w.inZone(t), w.rotateAt); ok {
+		w.rolloverAt = at
+	} else {
+		w.rolloverAt = (t.Unix()/w.interval + 1) * w.interval
+	}
 }
 
 /*
@@ -105,25 +161,48 @@ func (w *PanicFileLogWriter) prepare() {
 *       "H", hour
 *       "D", day
 *       "MIDNIGHT", roll over at midnight
+*       "W0"-"W6", roll over at the midnight ending the weekday (0=Monday)
+*       "MONTH", roll over at midnight on the first of the month
+*       "15M", "4H", "2D", ..., every so many minutes, hours or days
 *   - backupCount: If backupCount is > 0, when rollover is done, no more than
 *       backupCount files are kept - the oldest ones are deleted.
+*   - opts: the standard streams to redirect to the log file, if any
 *
 * RETURNS:
 *   pointer to PanicFileLogWriter, if succeed
 *   nil, if fail
  */
-func NewPanicFileLogWriter(fname string, when string, backupCount int) *PanicFileLogWriter {
+func NewPanicFileLogWriter(fname string, when string, backupCount int, opts ...Option) *PanicFileLogWriter {
 	when = strings.ToUpper(when)
 
+	o := newWriterOptions(opts)
 	w := &PanicFileLogWriter{
-		rec:         make(chan *LogRecord, LogBufferLength),
-		filename:    fname,
-		format:      "[%D %T] [%L] (%S) %M",
-		when:        when,
-		backupCount: backupCount,
+		rec:           make(chan *LogRecord, o.bufferLength),
+		blocking:      o.blocking,
+		filename:      fname,
+		format:        "[%D %T] [%L] (%S) %M",
+		when:          when,
+		backupCount:   backupCount,
+		syncMode:      "none",
+		syncInterval:  time.Second,
+		flushInterval: time.Second,
+		flushed:       make(chan bool),
+		recovery:      newWriteRecovery(),
+		redirect:      o.redirect,
+	}
+
+	if w = w.run(fname); w != nil {
+		o.setup(w)
 	}
+	return w
+}
 
-	return w.run(fname)
+// NewPanicFileWriter creates a new PanicFileLogWriter writing to fname, set up
+// by the options, PanicFileOptions among them, as NewPanicFileLogWriter and
+// its setters do; rolled over at midnight and keeping all the old files by
+// default.  It returns nil if the file cannot be opened.
+func NewPanicFileWriter(fname string, opts ...Option) *PanicFileLogWriter {
+	return NewPanicFileLogWriter(fname, optionsWhen(opts), 0, opts...)
 }
 
 /* rename file to backup name   */
@@ -139,6 +218,11 @@ func (w *PanicFileLogWriter) run(fname string) *PanicFileLogWriter {
 		w.baseFilename = path
 	}
 
+	// finish a rotation cut short by a crash
+	if err := adoptOrphan(w.filename); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+
 	// prepare for w.interval, w.suffix and w.fileFilter
 	w.prepare()
 
@@ -149,58 +233,643 @@ func (w *PanicFileLogWriter) run(fname string) *PanicFileLogWriter {
 	}
 
 	go func() {
+		// ticks in "interval" sync mode and while buffering, respectively
+		var syncTick, flushTick <-chan time.Time
+		dirty, unflushed := false, false
+
 		defer func() {
 			if w.file != nil {
+				w.flushBuffer()
+				writeHeadFootLine(w.wrapOutput(w.file), w.footer)
+				w.audit.seal(w.encrypt.wrap(w.file))
+				if w.syncMode != "none" {
+					w.file.Sync()
+				}
 				w.file.Close()
 			}
 		}()
 
 		for {
 			select {
+			case <-flushTick:
+				if unflushed {
+					w.flushBuffer()
+					unflushed = false
+				}
+			case <-syncTick:
+				if dirty {
+					w.flushBuffer()
+					w.file.Sync()
+					dirty = false
+				}
 			case rec, ok := <-w.rec:
 				if !ok {
 					return
 				}
 
+				if rec == flushRecord {
+					w.flushBuffer()
+					unflushed = false
+					w.flushed <- true
+					continue
+				}
+				if rec == reopenRecord {
+					if err := w.reopen(); err != nil {
+						w.recovery.failed(w.filename, err, nil, "", nil)
+					}
+					continue
+				}
+
 				if w.EndNotify(rec) {
 					return
 				}
 
+				if w.recovery.waiting(time.Now()) {
+					w.recovery.setAside(rec, w.format, w.formatter)
+					continue
+				}
+
+				// a failed file is reopened, rolling it over if due
+				if w.recovery.failing || w.shouldRollover() {
+					if err := w.intRotate(); err != nil {
+						w.recovery.failed(w.filename, err, rec, w.format, w.formatter)
+						continue
+					}
+				}
+
 				// Perform the write
 				var err error
 				if rec.Binary != nil {
-					_, err = w.file.Write(rec.Binary)
+					_, err = w.output().Write(rec.Binary)
 				} else {
-					_, err = fmt.Fprint(w.file, FormatLogRecord(w.format, rec))
+					_, err = fmt.Fprint(w.output(), formatRecord(w.format, w.formatter, rec))
 				}
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-					return
+					w.recovery.failed(w.filename, err, rec, w.format, w.formatter)
+					continue
+				}
+				w.recovery.succeeded(w.filename)
+
+				if w.buf != nil && w.flushInterval > 0 {
+					unflushed = true
+					if flushTick == nil {
+						ticker := time.NewTicker(w.flushInterval)
+						defer ticker.Stop()
+						flushTick = ticker.C
+					}
+				}
+
+				switch w.syncMode {
+				case "every":
+					w.flushBuffer()
+					w.file.Sync()
+				case "interval":
+					dirty = true
+					if syncTick == nil {
+						ticker := time.NewTicker(w.syncInterval)
+						defer ticker.Stop()
+						syncTick = ticker.C
+					}
 				}
 			}
 		}
 	}()
 
+	registerReopener(w)
 	return w
 }
 
+func (w *PanicFileLogWriter) computeRollover(currTime time.Time) int64 {
+	if result, ok := calendarRollover(w.when, w.inZone(currTime), w.rotateAt); ok {
+		w.firstRollover = false
+		return result
+	}
+	if w.firstRollover {
+		w.firstRollover = false
+		return (currTime.Unix()/w.interval + 1) * w.interval
+	}
+
+	if w.when == "MIDNIGHT" {
+		t := w.inZone(currTime)
+		/* r is the number of seconds left between now and midnight */
+		r := MIDNIGHT - ((t.Hour()*60+t.Minute())*60 + t.Second())
+		return currTime.Unix() + int64(r)
+	}
+	return currTime.Unix() + w.interval
+}
+
+func (w *PanicFileLogWriter) shouldRollover() bool {
+	return time.Now().Unix() >= w.rolloverAt
+}
+
+/* adjust rolloverAt    */
+func (w *PanicFileLogWriter) adjustRolloverAt() {
+	currTime := time.Now()
+	newRolloverAt := w.computeRollover(currTime)
+
+	for newRolloverAt <= currTime.Unix() {
+		newRolloverAt = newRolloverAt + w.interval
+	}
+
+	w.rolloverAt = newRolloverAt
+}
+
+/* Determine the files to delete when rolling over  */
+func (w *PanicFileLogWriter) getFilesToDelete() []string {
+	result := []string{}
+
+	backups := w.backups()
+	for len(backups) > w.backupCount {
+		result = append(result, backups[0].path)
+		backups = backups[1:]
+	}
+	return result
+}
+
+/* rename file to backup name   */
+func (w *PanicFileLogWriter) moveToBackup() (string, error) {
+	if _, err := os.Lstat(w.baseFilename); err != nil {
+		// nothing to back up
+		return "", nil
+	}
+
+	// get the time that this sequence started at
+	t := w.inZone(time.Unix(w.rolloverAt-w.interval, 0))
+	if w.when == "MONTH" {
+		// months vary in length, so use the last second of the sequence
+		t = w.inZone(time.Unix(w.rolloverAt-1, 0).Add(-w.rotateAt))
+	}
+	fname := w.baseFilename + "." + Format(w.suffix, t)
+	if w.sequence {
+		fname = w.baseFilename + ".1"
+		if err := shiftBackups(w.baseFilename, w.backupCount); err != nil {
+			return "", err
+		}
+	}
+	w.hooks.before(w.baseFilename)
+
+	if w.copyTruncate {
+		return fname, copyTruncate(w.baseFilename, fname)
+	}
+
+	// keep what is already there, append the current file to it
+	if _, err := os.Stat(fname); err == nil {
+		b, err := ioutil.ReadFile(w.baseFilename)
+		if err != nil {
+			return "", err
+		}
+		fd, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return "", err
+		}
+		_, err = fd.Write(b)
+		fd.Close()
+		if err != nil {
+			return "", err
+		}
+		return fname, os.Remove(w.baseFilename)
+	}
+
+	return fname, os.Rename(w.baseFilename, fname)
+}
+
+// If this is called in a threaded context, it MUST be synchronized
 func (w *PanicFileLogWriter) intRotate() error {
+	backup := ""
+	if w.shouldRollover() {
+		// rename file to backup name
+		var err error
+		if backup, err = w.rollFile(); err != nil {
+			return err
+		}
+	} else if err := w.reopen(); err != nil {
+		return err
+	}
+
+	// remove files, according to backupCount (shifting handles sequences)
+	if w.backupCount > 0 && !w.sequence {
+		for _, fileName := range w.getFilesToDelete() {
+			os.Remove(fileName)
+		}
+	}
+
+	// remove the old files, according to maxAge
+	if w.maxAge > 0 {
+		removeBackupsOlderThan(w.backups(), w.maxAge)
+	}
+
+	// remove the oldest files, according to maxTotalSize
+	if w.maxTotalSize > 0 {
+		removeBackupsOverSize(w.backups(), w.maxTotalSize)
+	}
+
+	if backup != "" {
+		w.hooks.after(backup, w.filename)
+	}
+
+	// adjust rolloverAt
+	w.adjustRolloverAt()
+
+	return nil
+}
+
+// Set the function called, on the writer's goroutine, each time the file
+// cannot be opened or written (chainable).  It must not log to this writer.
+// Must be called before the first log message is written.
+func (w *PanicFileLogWriter) SetErrorHandler(handler func(error)) *PanicFileLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set how long to wait before trying the file again after it fails
+// (chainable).  The wait doubles with each failure, up to max.  The default is
+// from one second up to a minute.  The records logged meanwhile are dropped,
+// not written once the file can be.  Must be called before the first log
+// message is written.
+func (w *PanicFileLogWriter) SetRetryBackoff(initial, max time.Duration) *PanicFileLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
+
+// Set a function giving a line, such as the build version or column names, to
+// write at the top of each file when it is opened (chainable).  Must be called
+// before the first log message is written.
+func (w *PanicFileLogWriter) SetHeader(header func() string) *PanicFileLogWriter {
+	w.header = header
+	writeHeadFootLine(w.wrapOutput(w.file), w.header)
+	return w
+}
+
+// Set a function giving a line to write at the end of each file when it is
+// rolled over or closed (chainable).  Must be called before the first log
+// message is written.
+func (w *PanicFileLogWriter) SetFooter(footer func() string) *PanicFileLogWriter {
+	w.footer = footer
+	return w
+}
+
+// Reopen closes the log file and opens it again under the same name, once the
+// records logged so far are written, without rolling it over.  Use it after
+// an outside tool such as logrotate has moved the file away.
+func (w *PanicFileLogWriter) Reopen() {
+	w.rec <- reopenRecord
+}
+
+// Close the file and open it again, without rolling over.  If this is called
+// in a threaded context, it MUST be synchronized
+func (w *PanicFileLogWriter) reopen() error {
+	w.closeFile()
+	return w.openFile()
+}
+
+// Close the file, if it is open.  If this is called in a threaded context, it
+// MUST be synchronized
+func (w *PanicFileLogWriter) closeFile() {
 	if w.file != nil {
+		w.flushBuffer()
+		writeHeadFootLine(w.wrapOutput(w.file), w.footer)
+		w.audit.seal(w.encrypt.wrap(w.file))
 		w.file.Close()
+		w.file = nil
 	}
-	fd, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+// Flush writes out the records buffered so far, returning once they have been
+// written.
+func (w *PanicFileLogWriter) Flush() {
+	w.rec <- flushRecord
+	<-w.flushed
+}
+
+// Where records are written: the buffer, if any, else the file
+func (w *PanicFileLogWriter) output() io.Writer {
+	if w.buf != nil {
+		return w.wrapOutput(w.buf)
+	}
+	return w.wrapOutput(w.file)
+}
+
+// Encrypt and audit what is written to out, as set
+func (w *PanicFileLogWriter) wrapOutput(out io.Writer) io.Writer {
+	return w.audit.wrap(w.encrypt.wrap(out))
+}
+
+func (w *PanicFileLogWriter) flushBuffer() {
+	if w.buf != nil && !w.recovery.failing {
+		if err := w.buf.Flush(); err != nil {
+			w.recovery.failed(w.filename, err, nil, "", nil)
+		}
+	}
+}
+
+// Move the log file to its backup, returned, and open the next one, the next
+// one first so that a failure part way leaves a file to log to.  If this is
+// called in a threaded context, it MUST be synchronized
+func (w *PanicFileLogWriter) rollFile() (backup string, err error) {
+	if w.copyTruncate {
+		w.closeFile()
+		if backup, err = w.moveToBackup(); err != nil {
+			return "", err
+		}
+		return backup, w.openFile()
+	}
+
+	fd, err := rollOver(w.filename, w.openLog, func() (err error) {
+		w.closeFile()
+		backup, err = w.moveToBackup()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	w.setFile(fd)
+	return backup, nil
+}
+
+// Open the log file, w.file being closed
+func (w *PanicFileLogWriter) openFile() error {
+	fd, err := w.openLog(w.filename)
 	if err != nil {
 		return err
 	}
+	w.setFile(fd)
+	return nil
+}
+
+func (w *PanicFileLogWriter) openLog(name string) (*os.File, error) {
+	return w.perm.open(name, 0644)
+}
+
+// Log to fd, newly opened
+func (w *PanicFileLogWriter) setFile(fd *os.File) {
 	w.file = fd
-	syscall.Dup2(int(fd.Fd()), 1)
-	syscall.Dup2(int(fd.Fd()), 2)
+	if w.buf != nil {
+		w.buf.Reset(fd)
+	}
+	writeHeadFootLine(w.wrapOutput(w.file), w.header)
+	if err := w.redirectStd(fd); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+}
+
+// Point the standard streams chosen at fd, remembering where they pointed
+// before.
+func (w *PanicFileLogWriter) redirectStd(fd *os.File) error {
+	w.stdMu.Lock()
+	defer w.stdMu.Unlock()
+
+	for n, on := range map[int]bool{1: w.redirect.RedirectStdout, 2: w.redirect.RedirectStderr} {
+		if !on {
+			continue
+		}
+		if w.savedStd[n] == nil {
+			saved, err := saveStdFd(n)
+			if err != nil {
+				return err
+			}
+			w.savedStd[n] = saved
+		}
+		if err := setStdFd(n, fd); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// RestoreStdFds points the redirected standard streams back where they
+// pointed before, and stops redirecting them at rollover.  Close calls it.
+func (w *PanicFileLogWriter) RestoreStdFds() error {
+	w.stdMu.Lock()
+	defer w.stdMu.Unlock()
+
+	w.redirect = PanicFileOptions{}
+	var first error
+	for n, saved := range w.savedStd {
+		if saved == nil {
+			continue
+		}
+		if err := restoreStdFd(n, saved); err != nil && first == nil {
+			first = err
+		}
+		w.savedStd[n] = nil
+	}
+	return first
+}
+
 // Set the logging format (chainable).  Must be called before the first log
 // message is written.
 func (w *PanicFileLogWriter) SetFormat(format string) *PanicFileLogWriter {
-	w.format = format
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *PanicFileLogWriter) SetFormatter(formatter Formatter) *PanicFileLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the max combined size in bytes of the backup files (chainable).  When
+// rollover is done, the oldest backups are deleted until the rest fit under
+// the cap.  Zero means no cap.
+func (w *PanicFileLogWriter) SetMaxTotalSize(maxTotalSize int64) *PanicFileLogWriter {
+	w.maxTotalSize = maxTotalSize
+	return w
+}
+
+// Encrypt the log files with AES-GCM, using the key keys gives (chainable).
+// Each record is written as a block of its own, which DecryptLog turns back
+// into text.  Should keys give no usable key, nothing is written rather than
+// written in the clear.  Must be called before the first log message is
+// written, and before SetHeader, on a file not yet holding plain text.  What
+// the process writes to a standard stream taken over, such as the stack trace
+// of a panic, is not encrypted, so DecryptLog stops there.
+func (w *PanicFileLogWriter) SetEncryption(keys KeyProvider) *PanicFileLogWriter {
+	w.encrypt = newLogSealer(keys)
+	if w.encrypt.err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, w.encrypt.err)
+	}
+	return w
+}
+
+// Make the log an audit log, ending each record, header and footer in an
+// HMAC-SHA256 keyed with key and chained to the one before (chainable), so
+// that VerifyLogFile can tell if the file was modified or truncated.  The
+// chain is sealed when the file rolls over or is closed.  What the process
+// writes to a standard stream taken over, such as the stack trace of a panic,
+// is not in the chain, so VerifyLogFile reports it as changed.  Must be called
+// before the first log message is written, and before SetHeader, on a file
+// not yet holding records.
+func (w *PanicFileLogWriter) SetAudit(key []byte) *PanicFileLogWriter {
+	w.audit = &auditChain{key: key}
+	return w
+}
+
+// Set the max age of the backup files (chainable).  When rollover is done,
+// backups last written more than maxAge ago are deleted.  Zero means keep
+// them regardless of age.
+func (w *PanicFileLogWriter) SetMaxAge(maxAge time.Duration) *PanicFileLogWriter {
+	w.maxAge = maxAge
+	return w
+}
+
+// Add a hook to be notified of each rollover (chainable).  Must be called
+// before the first log message is written.
+func (w *PanicFileLogWriter) AddRotationHook(hook RotationHook) *PanicFileLogWriter {
+	w.hooks = append(w.hooks, hook)
+	return w
+}
+
+// Compute rollover times and backup suffixes in UTC instead of local time
+// (chainable).  Must be called before the first log message is written.
+func (w *PanicFileLogWriter) SetUTC(utc bool) *PanicFileLogWriter {
+	w.utc = utc
+	if _, ok := calendarRollover(w.when, time.Now(), w.rotateAt); ok || w.when == "MIDNIGHT" {
+		w.startRollover()
+	}
+	return w
+}
+
+/* convert t to the zone rollover is computed in    */
+func (w *PanicFileLogWriter) inZone(t time.Time) time.Time {
+	if w.utc {
+		return t.UTC()
+	}
+	return t.Local()
+}
+
+// Set the permissions of the log files (chainable).  The mode is applied with
+// chmod, so the umask does not change it.  Must be called before the first
+// log message is written.
+func (w *PanicFileLogWriter) SetFileMode(mode os.FileMode) *PanicFileLogWriter {
+	w.perm.mode = mode
+	if err := w.perm.apply(w.filename); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+	return w
+}
+
+// Set the owner of the log files (chainable).  A uid or gid of -1 is left
+// unchanged.  Must be called before the first log message is written.
+func (w *PanicFileLogWriter) SetFileOwner(uid, gid int) *PanicFileLogWriter {
+	w.perm.chown, w.perm.uid, w.perm.gid = true, uid, gid
+	if err := w.perm.apply(w.filename); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+	return w
+}
+
+// SetCopyTruncate makes rollover copy the log to its backup and truncate it in
+// place, rather than rename it and open a new file (chainable).  Use it when
+// other processes hold the log file open.  Must be called before the first log
+// message is written.
+func (w *PanicFileLogWriter) SetCopyTruncate(copyTruncate bool) *PanicFileLogWriter {
+	w.copyTruncate = copyTruncate
+	return w
+}
+
+// Roll over at hour:minute instead of midnight (chainable).  It applies to the
+// "D", "MIDNIGHT", "W0"-"W6" and "MONTH" intervals, and offsets "H", "M" and
+// the "4H"-style intervals: with "H", SetRotateAt(0, 30) rolls over at half
+// past every hour.  Must be called before the first log message is written.
+func (w *PanicFileLogWriter) SetRotateAt(hour, minute int) *PanicFileLogWriter {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): invalid rotate time %02d:%02d\n", w.filename, hour, minute)
+		return w
+	}
+	w.rotateAt = time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+	w.startRollover()
+	return w
+}
+
+// Set how backups are named (chainable): "date" (the default) suffixes them
+// with the time of their sequence, "sequence" numbers them .1 (the newest),
+// .2, ... shifting them all on every rollover.  Must be called before the
+// first log message is written.
+func (w *PanicFileLogWriter) SetRotationScheme(scheme string) *PanicFileLogWriter {
+	switch scheme {
+	case "date":
+		w.sequence = false
+	case "sequence":
+		w.sequence = true
+	default:
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): unknown rotation scheme %q\n", w.filename, scheme)
+	}
+	return w
+}
+
+// Set a shell pattern (as in filepath.Match) picking out the backup files
+// that rollover may delete, among the files in the log's directory
+// (chainable), e.g. "app.log.*.zst" for backups compressed by a hook.  The
+// default takes the names the suffix gives backups, optionally gzipped.  Must
+// be called before the first log message is written.
+func (w *PanicFileLogWriter) SetBackupGlob(pattern string) *PanicFileLogWriter {
+	if err := checkBackupGlob(pattern); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): backup glob %q: %s\n", w.filename, pattern, err)
+		return w
+	}
+	w.backupGlob = pattern
+	return w
+}
+
+// The backups rollover may delete, oldest first
+func (w *PanicFileLogWriter) backups() []backupFile {
+	if w.backupGlob != "" {
+		return globBackups(w.baseFilename, w.backupGlob)
+	}
+	return listBackups(w.baseFilename, w.backupFilter().MatchString)
+}
+
+/* the filter matching the suffixes of this writer's backups    */
+func (w *PanicFileLogWriter) backupFilter() *regexp.Regexp {
+	if w.sequence {
+		return sequenceFilter
+	}
+	return w.fileFilter
+}
+
+// Set when the log file is fsynced to disk (chainable): "none" leaves it to
+// the operating system, "interval" syncs every interval (see SetSyncInterval)
+// when something was written, and "every" syncs after each record; any other
+// mode is reported and ignored.  Must be called before the first log message
+// is written.
+func (w *PanicFileLogWriter) SetSync(mode string) *PanicFileLogWriter {
+	switch mode {
+	case "none", "interval", "every":
+		w.syncMode = mode
+	default:
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): unknown sync mode %q\n", w.filename, mode)
+	}
+	return w
+}
+
+// Set how often the "interval" sync mode syncs (chainable).  The default is
+// one second.  Must be called before the first log message is written.
+func (w *PanicFileLogWriter) SetSyncInterval(syncInterval time.Duration) *PanicFileLogWriter {
+	w.syncInterval = syncInterval
+	return w
+}
+
+// Buffer up to size bytes of records rather than writing each one to the file
+// as it comes (chainable).  The buffer is written out when full, every flush
+// interval, on Flush, rollover and Close.  A panic goes straight to the file,
+// so the records buffered just before it are lost.  Zero turns buffering off.
+// Must be called before the first log message is written.
+func (w *PanicFileLogWriter) SetBufferSize(size int) *PanicFileLogWriter {
+	w.flushBuffer()
+	if size > 0 {
+		w.buf = bufio.NewWriterSize(w.file, size)
+	} else {
+		w.buf = nil
+	}
+	return w
+}
+
+// Set how long a buffered record may wait before it is written (chainable).
+// The default is one second; zero waits for the buffer to fill.  Must be
+// called before the first log message is written.
+func (w *PanicFileLogWriter) SetFlushInterval(flushInterval time.Duration) *PanicFileLogWriter {
+	w.flushInterval = flushInterval
 	return w
 }
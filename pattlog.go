@@ -6,13 +6,22 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const (
-	FORMAT_DEFAULT = "[%D %T] [%L] (%S) %M"
-	FORMAT_SHORT   = "[%t %d] [%L] %M"
-	FORMAT_ABBREV  = "[%L] %M"
+	FORMAT_DEFAULT  = "[%D %T] [%L] (%S) %M"
+	FORMAT_SHORT    = "[%t %d] [%L] %M"
+	FORMAT_ABBREV   = "[%L] %M"
+	FORMAT_JSON     = "json"
+	FORMAT_LOGFMT   = "logfmt"
+	FORMAT_COMMON   = "common"
+	FORMAT_COMBINED = "combined"
 )
 
 type formatCacheType struct {
@@ -23,16 +32,72 @@ type formatCacheType struct {
 
 var formatCache = &formatCacheType{}
 
+// What the %h, %P and %a format codes write
+var (
+	hostname, _ = os.Hostname()
+	pid         = strconv.Itoa(os.Getpid())
+	appName     = filepath.Base(os.Args[0])
+)
+
+// What is trimmed from the sources written
+var sourceRoot string
+
+// Set the module root, e.g. "github.com/me/app", trimmed with the slash after
+// it from the sources the %S and %F format codes, and the JSON and logfmt
+// formatters, write, so that "github.com/me/app/server.(*Server).Serve:42" is
+// written as "server.(*Server).Serve:42".  The default is none.  Must be called
+// before the first log message is written.
+func SetSourceRoot(root string) {
+	sourceRoot = strings.TrimSuffix(root, "/")
+}
+
+// Source with the module root trimmed
+func trimSourceRoot(source string) string {
+	if sourceRoot != "" && strings.HasPrefix(source, sourceRoot+"/") {
+		return source[len(sourceRoot)+1:]
+	}
+	return source
+}
+
+// Set the application name the %a format code writes.  The default is the
+// base name of the program.  Must be called before the first log message is
+// written.
+func SetAppName(name string) {
+	appName = name
+}
+
 // Known format codes:
 // %T - Time (15:04:05 MST)
 // %t - Time (15:04)
 // %D - Date (2006/01/02)
 // %d - Date (01/02/06)
+// %m - Time with milliseconds (15:04:05.000)
+// %u - Time with microseconds (15:04:05.000000)
+// %R - Date and time in RFC 3339 with nanoseconds (2006-01-02T15:04:05.999999999Z07:00)
+// %E - Unix time in seconds, with milliseconds (1136214245.000)
+// %{layout} - Time in a Go time layout, e.g. %{2006-01-02T15:04:05.000Z07:00}
+// %h - Host name
+// %P - Process ID
+// %a - Application name, as set by SetAppName
+// %G - ID of the goroutine logging, or 0 if not known
+// %X{key} - Value of the record's field key, if any
+// %X - Fields of the record, as key=value pairs separated by spaces
+// %e - Field "error", with the errors it wraps and its stack trace, if any, a line each
 // %L - Level (FNST, FINE, DEBG, TRAC, WARN, EROR, CRIT)
-// %S - Source
+// %S - Source, less the module root set by SetSourceRoot
+// %s - Source, from after the last slash
+// %F - Function of the source, without the line, less the module root
 // %M - Message
 // Ignores unknown formats
 // Recommended: "[%D %T] [%L] (%S) %M"
+//
+// A code may be given a width and a precision, as in printf: "%-5L" pads the
+// level with spaces to five characters on the right, "%.80M" cuts the message
+// to eighty, and "%20.20S" pads the source on the left, or cuts it, to
+// twenty.
+//
+// A format registered by name, such as FORMAT_JSON, is written by its own
+// Formatter instead.
 func FormatLogRecord(format string, rec *LogRecord) string {
 	if rec == nil {
 		return "<nil>"
@@ -40,6 +105,9 @@ func FormatLogRecord(format string, rec *LogRecord) string {
 	if len(format) == 0 {
 		return ""
 	}
+	if named := namedFormat(format); named != nil {
+		return formatRecord(format, named, rec)
+	}
 
 	out := bytes.NewBuffer(make([]byte, 0, 64))
 	secs := rec.Created.UnixNano() / 1e9
@@ -65,44 +133,158 @@ func FormatLogRecord(format string, rec *LogRecord) string {
 
 	// Iterate over the pieces, replacing known formats
 	for i, piece := range pieces {
-		if i > 0 && len(piece) > 0 {
-			switch piece[0] {
-			case 'T':
-				out.WriteString(cache.longTime)
-			case 't':
-				out.WriteString(cache.shortTime)
-			case 'D':
-				out.WriteString(cache.longDate)
-			case 'd':
-				out.WriteString(cache.shortDate)
-			case 'L':
-				out.WriteString(rec.Level.String())
-			case 'S':
-				out.WriteString(rec.Source)
-			case 's':
-				slice := strings.Split(rec.Source, "/")
-				out.WriteString(slice[len(slice)-1])
-			case 'M':
-				out.WriteString(rec.Message)
+		if i == 0 || len(piece) == 0 {
+			out.Write(piece)
+			continue
+		}
+
+		// The width and precision, as in %-5L or %.80M
+		j, left := 0, false
+		if piece[j] == '-' {
+			left, j = true, j+1
+		}
+		width, j := atoiPrefix(piece, j)
+		precision := -1
+		if j < len(piece) && piece[j] == '.' {
+			precision, j = atoiPrefix(piece, j+1)
+		}
+		if j == len(piece) {
+			continue
+		}
+
+		var value string
+		rest := piece[j+1:]
+		switch piece[j] {
+		case '{':
+			if end := bytes.IndexByte(rest, '}'); end >= 0 {
+				value = rec.Created.Format(string(rest[:end]))
+				rest = rest[end+1:]
 			}
-			if len(piece) > 1 {
-				out.Write(piece[1:])
+		case 'T':
+			value = cache.longTime
+		case 't':
+			value = cache.shortTime
+		case 'D':
+			value = cache.longDate
+		case 'd':
+			value = cache.shortDate
+		case 'm':
+			value = rec.Created.Format("15:04:05.000")
+		case 'u':
+			value = rec.Created.Format("15:04:05.000000")
+		case 'R':
+			value = rec.Created.Format(time.RFC3339Nano)
+		case 'E':
+			ms := rec.Created.UnixNano() / 1e6
+			value = fmt.Sprintf("%d.%03d", ms/1000, ms%1000)
+		case 'L':
+			value = rec.Level.String()
+		case 'S':
+			value = trimSourceRoot(rec.Source)
+		case 'F':
+			value = trimSourceRoot(sourceFunction(rec.Source))
+		case 's':
+			slice := strings.Split(rec.Source, "/")
+			value = slice[len(slice)-1]
+		case 'M':
+			value = rec.Message
+		case 'h':
+			value = hostname
+		case 'P':
+			value = pid
+		case 'a':
+			value = appName
+		case 'G':
+			value = strconv.FormatUint(rec.Goroutine, 10)
+		case 'X':
+			if len(rest) > 0 && rest[0] == '{' {
+				if end := bytes.IndexByte(rest, '}'); end >= 0 {
+					if field, ok := rec.Fields[string(rest[1:end])]; ok {
+						value = fieldText(field)
+					}
+					rest = rest[end+1:]
+					break
+				}
 			}
-		} else if len(piece) > 0 {
-			out.Write(piece)
+			var pairs []byte
+			for _, name := range rec.Fields.names() {
+				if len(pairs) > 0 {
+					pairs = append(pairs, ' ')
+				}
+				pairs = append(append(pairs, name...), '=')
+				pairs = appendLogfmtValue(pairs, fieldText(rec.Fields[name]))
+			}
+			value = string(pairs)
+		case 'e':
+			if field, ok := rec.Fields[errorField]; ok {
+				value = fieldText(field)
+				if err, ok := lazyValue(field).(error); ok {
+					value = errorDetails(err)
+				}
+			}
+		default:
+			out.Write(rest)
+			continue
 		}
+		out.WriteString(fitColumn(value, left, width, precision))
+		out.Write(rest)
 	}
 	out.WriteByte('\n')
 
 	return out.String()
 }
 
+// The number b starts with from j, or 0 if none, and where it ends
+func atoiPrefix(b []byte, j int) (int, int) {
+	n := 0
+	for ; j < len(b) && '0' <= b[j] && b[j] <= '9'; j++ {
+		n = n*10 + int(b[j]-'0')
+	}
+	return n, j
+}
+
+// Value cut to precision characters, unless it is negative, then padded with
+// spaces to width, on the right if left is set
+func fitColumn(value string, left bool, width, precision int) string {
+	if precision >= 0 && len(value) > precision {
+		n := 0
+		for i := range value {
+			if n == precision {
+				value = value[:i]
+				break
+			}
+			n++
+		}
+	}
+	if width == 0 {
+		return value
+	}
+	if pad := width - utf8.RuneCountInString(value); pad > 0 {
+		if left {
+			return value + strings.Repeat(" ", pad)
+		}
+		return strings.Repeat(" ", pad) + value
+	}
+	return value
+}
+
+// The function of source, as log4go sets it: the function's name, a colon and
+// the line
+func sourceFunction(source string) string {
+	if colon := strings.LastIndex(source, ":"); colon >= 0 {
+		if _, err := strconv.Atoi(source[colon+1:]); err == nil {
+			return source[:colon]
+		}
+	}
+	return source
+}
+
 // This is the standard writer that prints to standard output.
 type FormatLogWriter chan *LogRecord
 
 // This creates a new FormatLogWriter
-func NewFormatLogWriter(out io.Writer, format string) FormatLogWriter {
-	records := make(FormatLogWriter, LogBufferLength)
+func NewFormatLogWriter(out io.Writer, format string, opts ...Option) FormatLogWriter {
+	records := make(FormatLogWriter, newWriterOptions(opts).bufferLength)
 	go records.run(out, format)
 	return records
 }
@@ -110,6 +292,7 @@ func NewFormatLogWriter(out io.Writer, format string) FormatLogWriter {
 func (w FormatLogWriter) run(out io.Writer, format string) {
 	for rec := range w {
 		fmt.Fprint(out, FormatLogRecord(format, rec))
+		releaseRecord(rec)
 	}
 }
 
@@ -0,0 +1,193 @@
+package log4go
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// A ProtobufFormatter writes each record whole as the LogRecord message of
+// log4go.proto, each preceded by its length as a varint, as protobuf's
+// writeDelimitedTo does, for compact transport between services; a
+// RecordReader reads them back.  The values of fields are written as their
+// text.
+//
+//	w := NewFileLogWriter("app.pb", false)
+//	w.SetFormatter(&ProtobufFormatter{})
+//
+// A SocketLogWriter sends each record as a datagram of the message alone, or
+// on a stream, framed as set by SetFraming, with "newline" taken as varint
+// lengths.  As ever, a record with a Binary payload is written as the payload
+// by the other writers.
+type ProtobufFormatter struct{}
+
+// Format appends rec to *buf as a varint length and a LogRecord message.
+func (f *ProtobufFormatter) Format(rec *LogRecord, buf *[]byte) {
+	msg := appendProtoRecord(nil, rec, rec.Message)
+	*buf = append(protoVarint(*buf, uint64(len(msg))), msg...)
+}
+
+// Append rec as a LogRecord message, with message as its message field
+func appendProtoRecord(b []byte, rec *LogRecord, message string) []byte {
+	if rec.Level != 0 {
+		b = protoVarint(protoVarint(b, 1<<3), uint64(rec.Level))
+	}
+	b = protoVarint(protoVarint(b, 2<<3), uint64(rec.Created.UnixNano()))
+	b = protoBytes(b, 3, []byte(rec.Source))
+	b = protoBytes(b, 4, []byte(message))
+	if rec.Goroutine != 0 {
+		b = protoVarint(protoVarint(b, 5<<3), rec.Goroutine)
+	}
+	b = protoBytes(b, 6, rec.Binary)
+	for _, name := range rec.Fields.names() {
+		entry := protoBytes(nil, 1, []byte(name))
+		entry = protoBytes(entry, 2, []byte(fieldText(rec.Fields[name])))
+		b = protoVarint(b, 7<<3|2)
+		b = append(protoVarint(b, uint64(len(entry))), entry...)
+	}
+	return b
+}
+
+// Append v as a protobuf varint
+func protoVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// Append the length-delimited field of the number, omitted if empty
+func protoBytes(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protoVarint(b, uint64(field)<<3|2)
+	return append(protoVarint(b, uint64(len(v))), v...)
+}
+
+var errProtoRecord = errors.New("log4go: malformed LogRecord message")
+
+// The longest LogRecord message a RecordReader takes, lest a corrupt length
+// run it out of memory
+const maxProtoRecord = 64 << 20
+
+// UnmarshalRecord decodes a LogRecord message of log4go.proto, as a
+// ProtobufFormatter writes one after its length, or a SocketLogWriter sends in
+// a datagram.  Fields it does not know are skipped.
+func UnmarshalRecord(msg []byte) (*LogRecord, error) {
+	rec := &LogRecord{Created: time.Unix(0, 0)}
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errProtoRecord
+		}
+		msg = msg[n:]
+
+		var v uint64
+		var bytes []byte
+		switch key & 7 {
+		case 0:
+			if v, n = binary.Uvarint(msg); n <= 0 {
+				return nil, errProtoRecord
+			}
+		case 1:
+			n = 8
+		case 2:
+			length, m := binary.Uvarint(msg)
+			if m <= 0 || length > uint64(len(msg)-m) {
+				return nil, errProtoRecord
+			}
+			bytes, n = msg[m:m+int(length)], m+int(length)
+		case 5:
+			n = 4
+		default:
+			return nil, errProtoRecord
+		}
+		if n > len(msg) {
+			return nil, errProtoRecord
+		}
+		msg = msg[n:]
+
+		switch key {
+		case 1 << 3:
+			rec.Level = Level(v)
+		case 2 << 3:
+			rec.Created = time.Unix(0, int64(v))
+		case 3<<3 | 2:
+			rec.Source = string(bytes)
+		case 4<<3 | 2:
+			rec.Message = string(bytes)
+		case 5 << 3:
+			rec.Goroutine = v
+		case 6<<3 | 2:
+			rec.Binary = append([]byte(nil), bytes...)
+		case 7<<3 | 2:
+			name, value, err := unmarshalField(bytes)
+			if err != nil {
+				return nil, err
+			}
+			if rec.Fields == nil {
+				rec.Fields = make(Fields)
+			}
+			rec.Fields[name] = value
+		}
+	}
+	return rec, nil
+}
+
+// Decode an entry of the fields of a LogRecord message, its name and its text
+func unmarshalField(entry []byte) (name, value string, err error) {
+	for len(entry) > 0 {
+		key, n := binary.Uvarint(entry)
+		if n <= 0 || key&7 != 2 {
+			return "", "", errProtoRecord
+		}
+		length, m := binary.Uvarint(entry[n:])
+		if m <= 0 || length > uint64(len(entry)-n-m) {
+			return "", "", errProtoRecord
+		}
+		text := string(entry[n+m : n+m+int(length)])
+		entry = entry[n+m+int(length):]
+		switch key >> 3 {
+		case 1:
+			name = text
+		case 2:
+			value = text
+		}
+	}
+	return name, value, nil
+}
+
+// A RecordReader reads back the records a ProtobufFormatter wrote, from a file
+// or a stream.
+type RecordReader struct {
+	r *bufio.Reader
+}
+
+// NewRecordReader creates a new RecordReader reading from r.
+func NewRecordReader(r io.Reader) *RecordReader {
+	return &RecordReader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF once there are no more.  A record cut
+// short is io.ErrUnexpectedEOF.
+func (r *RecordReader) Read() (*LogRecord, error) {
+	length, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxProtoRecord {
+		return nil, errProtoRecord
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r.r, msg); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return UnmarshalRecord(msg)
+}
@@ -0,0 +1,99 @@
+package log4go
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The records the Logger makes, used again once the writers are done with
+// them, so that logging at a high rate does not make one for each call
+var recordPool = sync.Pool{
+	New: func() interface{} {
+		return new(LogRecord)
+	},
+}
+
+// A writer done with each record it is given once it has written or dropped
+// it, which then releases it with releaseRecord; it keeps nothing of it after.
+// The Logger pools a record only if every writer it goes to is one.
+type recordReleaser interface {
+	releasesRecords()
+}
+
+func (w *NullLogWriter) releasesRecords()    {}
+func (c *ConsoleLogWriter) releasesRecords() {}
+func (w *FileLogWriter) releasesRecords()    {}
+func (w *WriterLogWriter) releasesRecords()  {}
+func (w FormatLogWriter) releasesRecords()   {}
+
+// A record from the pool, to be filled in
+func acquireRecord() *LogRecord {
+	return recordPool.Get().(*LogRecord)
+}
+
+// Whether w releases the records it is given
+func releasesRecords(w LogWriter) bool {
+	if d, ok := w.(*derivedLogWriter); ok {
+		w = d.LogWriter
+	}
+	_, ok := w.(recordReleaser)
+	return ok
+}
+
+// Dispatch rec to the filters of log at or below its level.  If pooled, it is
+// from the pool and, if all of those filters release it, it is counted as held
+// by each, to go back to the pool once the last, the slowest, has released it;
+// else it is left to the garbage collector, as is one that is not pooled.
+func (log Logger) dispatch(rec *LogRecord, pooled bool) {
+	lvl := rec.Level // rec is not to be read once the last writer has it
+	if pooled {
+		var held int32
+		for _, filt := range log {
+			if lvl < filt.Level {
+				continue
+			}
+			if !releasesRecords(filt.LogWriter) {
+				held = -1
+				break
+			}
+			held++
+		}
+		switch {
+		case held == 0:
+			recycleRecord(rec)
+			return
+		case held > 0:
+			rec.refs = held
+		}
+	}
+
+	for _, filt := range log {
+		if lvl < filt.Level {
+			continue
+		}
+		filt.LogWrite(rec)
+	}
+}
+
+// Release rec, as a writer done with it; the last to release a record from the
+// pool puts it back.  Records not from the pool are left as they are.
+func releaseRecord(rec *LogRecord) {
+	for {
+		refs := atomic.LoadInt32(&rec.refs)
+		if refs <= 0 {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&rec.refs, refs, refs-1) {
+			if refs == 1 {
+				recycleRecord(rec)
+			}
+			return
+		}
+	}
+}
+
+// Clear rec, so that it holds on to nothing, and put it back in the pool
+func recycleRecord(rec *LogRecord) {
+	*rec = LogRecord{}
+	recordPool.Put(rec)
+}
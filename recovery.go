@@ -0,0 +1,88 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// writeRecovery keeps a file writer logging after its file fails to open or to
+// take a write, as when the disk is full, and a network writer logging while
+// its server is down.  Rather than give up, the writer sets aside the records
+// it cannot take and tries again after a wait which doubles with each failure,
+// up to maxWait.  Setting a record aside drops it, having written it to stderr
+// if fallback is set; it is not kept to be written once the writer recovers.
+type writeRecovery struct {
+	kind    string // names the writer in messages, FileLogWriter if unset
+	failing bool
+	wait    time.Duration // before the next attempt
+	retryAt time.Time
+
+	minWait, maxWait time.Duration
+	onError          func(error) // called on every failure, if set
+	fallback         bool        // write the records set aside to stderr
+
+	// As a circuit breaker: only wait once threshold failures in a row
+	failures, threshold int
+}
+
+func newWriteRecovery() writeRecovery {
+	return writeRecovery{minWait: time.Second, maxWait: time.Minute}
+}
+
+// failed notes that opening or writing name failed with err, and sets rec (if
+// any) aside, as formatter, if set, or else format lay it out.
+func (r *writeRecovery) failed(name string, err error, rec *LogRecord, format string, formatter Formatter) {
+	if !r.failing {
+		fmt.Fprintf(os.Stderr, "%s(%q): %s\n", r.writer(), name, err)
+		r.failing = true
+		r.wait = r.minWait
+	} else if r.failures >= r.threshold {
+		r.wait *= 2
+		if r.wait > r.maxWait {
+			r.wait = r.maxWait
+		}
+	}
+	if r.failures++; r.failures >= r.threshold {
+		r.retryAt = time.Now().Add(r.wait)
+	}
+
+	if r.onError != nil {
+		r.onError(err)
+	}
+	r.setAside(rec, format, formatter)
+}
+
+// succeeded notes that name can be written again.
+func (r *writeRecovery) succeeded(name string) {
+	if r.failing {
+		fmt.Fprintf(os.Stderr, "%s(%q): recovered\n", r.writer(), name)
+		r.failing = false
+	}
+	r.failures = 0
+}
+
+func (r *writeRecovery) writer() string {
+	if r.kind == "" {
+		return "FileLogWriter"
+	}
+	return r.kind
+}
+
+// waiting reports whether it is too early to try the file again.
+func (r *writeRecovery) waiting(now time.Time) bool {
+	return r.failing && now.Before(r.retryAt)
+}
+
+// setAside disposes of a record the file cannot take: it is written to stderr,
+// if fallback is set, and otherwise dropped.
+func (r *writeRecovery) setAside(rec *LogRecord, format string, formatter Formatter) {
+	if rec == nil || !r.fallback {
+		return
+	}
+	if rec.Binary != nil {
+		os.Stderr.Write(rec.Binary)
+	} else {
+		fmt.Fprint(os.Stderr, formatRecord(format, formatter, rec))
+	}
+}
@@ -0,0 +1,120 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Patterns of data commonly redacted, for Redactor.Pattern
+const (
+	REDACT_CREDIT_CARD = `\b(?:\d[ -]?){12,15}\d\b`                       // 13 to 16 digits, maybe grouped
+	REDACT_EMAIL       = `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}` // an email address
+	REDACT_BEARER      = `(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`             // an HTTP bearer token
+)
+
+// The text redacted data is replaced by, unless a rule is given another
+const REDACTED = "[REDACTED]"
+
+// A Redactor masks sensitive data in records, for compliance with the GDPR or
+// PCI DSS, before any writer sees them: the text matching its patterns in the
+// message and the values of the fields, and the values of fields of the names
+// of its rules whole.
+//
+//	SetRedactor(NewRedactor().
+//		Pattern(REDACT_CREDIT_CARD, "").
+//		Pattern(`token=\w+`, "token=***").
+//		Field("password", ""))
+type Redactor struct {
+	patterns []redactPattern
+	fields   map[string]string // the replacements of fields, by lowercase name
+}
+
+type redactPattern struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// The Redactor of SetRedactor
+var redactor *Redactor
+
+// NewRedactor creates a new Redactor, redacting nothing until rules are added.
+func NewRedactor() *Redactor {
+	return &Redactor{fields: make(map[string]string)}
+}
+
+// Pattern replaces the text matching the regular expression expr with
+// replacement, in which $1 and the like stand for the submatches, or with
+// REDACTED if it is empty (chainable).  An expression that cannot be compiled
+// is reported and ignored.  Must be called before the first log message is
+// written.
+func (r *Redactor) Pattern(expr, replacement string) *Redactor {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Redactor.Pattern(%q): %s\n", expr, err)
+		return r
+	}
+	if replacement == "" {
+		replacement = REDACTED
+	}
+	r.patterns = append(r.patterns, redactPattern{re, replacement})
+	return r
+}
+
+// Field replaces the value of the fields of name, in any case, with
+// replacement, or with REDACTED if it is empty (chainable).  Must be called
+// before the first log message is written.
+func (r *Redactor) Field(name, replacement string) *Redactor {
+	if replacement == "" {
+		replacement = REDACTED
+	}
+	r.fields[strings.ToLower(name)] = replacement
+	return r
+}
+
+// Redact returns s with the text matching the Redactor's patterns replaced.
+func (r *Redactor) Redact(s string) string {
+	for _, p := range r.patterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// Set the Redactor masking the data of every record, or nil for none, as is
+// the default.  A Redactor computes the lazy values of the fields it looks at.
+// Must be called before the first log message is written.
+func SetRedactor(r *Redactor) {
+	redactor = r
+}
+
+// Mask the data of rec the Redactor of SetRedactor would.  Rec is new, and its
+// fields its own.
+func redactRecord(rec *LogRecord) {
+	r := redactor
+	if r == nil {
+		return
+	}
+	rec.Message = r.Redact(rec.Message)
+	for name, value := range rec.Fields {
+		if replacement, ok := r.fields[strings.ToLower(name)]; ok {
+			rec.Fields[name] = replacement
+			continue
+		}
+		if len(r.patterns) == 0 {
+			continue
+		}
+		switch v := lazyValue(value).(type) {
+		case string:
+			rec.Fields[name] = r.Redact(v)
+		case error:
+			if text := r.Redact(v.Error()); text != v.Error() {
+				rec.Fields[name] = text
+			} else {
+				rec.Fields[name] = v
+			}
+		default:
+			rec.Fields[name] = v
+		}
+	}
+}
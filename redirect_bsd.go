@@ -0,0 +1,30 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package log4go
+
+import (
+	"os"
+	"syscall"
+)
+
+// saveStdFd returns a file for what the standard stream n (1 or 2) refers to
+// now, to give back with restoreStdFd.
+func saveStdFd(n int) (*os.File, error) {
+	fd, err := syscall.Dup(n)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "std"), nil
+}
+
+// setStdFd points file descriptor n at f, so that whatever is written to it,
+// a panic included, goes into f.
+func setStdFd(n int, f *os.File) error {
+	return syscall.Dup2(int(f.Fd()), n)
+}
+
+func restoreStdFd(n int, saved *os.File) error {
+	defer saved.Close()
+	return setStdFd(n, saved)
+}
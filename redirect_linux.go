@@ -0,0 +1,28 @@
+package log4go
+
+import (
+	"os"
+	"syscall"
+)
+
+// saveStdFd returns a file for what the standard stream n (1 or 2) refers to
+// now, to give back with restoreStdFd.
+func saveStdFd(n int) (*os.File, error) {
+	fd, err := syscall.Dup(n)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "std"), nil
+}
+
+// setStdFd points file descriptor n at f, so that whatever is written to it,
+// a panic included, goes into f.  Dup3 rather than Dup2, which some
+// architectures (arm64, riscv64) lack.
+func setStdFd(n int, f *os.File) error {
+	return syscall.Dup3(int(f.Fd()), n, 0)
+}
+
+func restoreStdFd(n int, saved *os.File) error {
+	defer saved.Close()
+	return setStdFd(n, saved)
+}
@@ -0,0 +1,31 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package log4go
+
+import "os"
+
+// saveStdFd returns the standard stream n (1 or 2), to give back with
+// restoreStdFd.
+func saveStdFd(n int) (*os.File, error) {
+	if n == 1 {
+		return os.Stdout, nil
+	}
+	return os.Stderr, nil
+}
+
+// setStdFd points os.Stdout (n = 1) or os.Stderr (n = 2) at f.  There is no
+// portable way to move the file descriptors themselves here, so a panic still
+// goes to the original stderr.
+func setStdFd(n int, f *os.File) error {
+	if n == 1 {
+		os.Stdout = f
+	} else {
+		os.Stderr = f
+	}
+	return nil
+}
+
+func restoreStdFd(n int, saved *os.File) error {
+	return setStdFd(n, saved)
+}
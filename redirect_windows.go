@@ -0,0 +1,36 @@
+package log4go
+
+import (
+	"os"
+	"syscall"
+)
+
+var procSetStdHandle = modkernel32.NewProc("SetStdHandle")
+
+// saveStdFd returns the standard stream n (1 or 2), to give back with
+// restoreStdFd.
+func saveStdFd(n int) (*os.File, error) {
+	if n == 1 {
+		return os.Stdout, nil
+	}
+	return os.Stderr, nil
+}
+
+// setStdFd makes f the process's standard output (n = 1) or error (n = 2)
+// handle, which the runtime writes panics to, and points os.Stdout or
+// os.Stderr at it.  Child processes started afterwards inherit the handle.
+func setStdFd(n int, f *os.File) error {
+	std, stdFile := syscall.STD_OUTPUT_HANDLE, &os.Stdout
+	if n == 2 {
+		std, stdFile = syscall.STD_ERROR_HANDLE, &os.Stderr
+	}
+	if r, _, err := procSetStdHandle.Call(uintptr(std), f.Fd()); r == 0 {
+		return err
+	}
+	*stdFile = f
+	return nil
+}
+
+func restoreStdFd(n int, saved *os.File) error {
+	return setStdFd(n, saved)
+}
@@ -0,0 +1,342 @@
+package log4go
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This log writer pushes records to a Redis list, for Logstash or the like to
+// pop them from, or adds them to a Redis stream.
+type RedisLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	addr      string // host:port
+	tlsConfig *tls.Config
+	username  string // for AUTH, if a password is set
+	password  string
+	db        int
+	timeout   time.Duration
+	conn      net.Conn
+	r         *bufio.Reader
+
+	key       string
+	mode      string    // "lpush", "rpush" or "xadd"
+	maxLen    int       // of the stream, roughly, if set
+	format    string    // if set, else as suits the mode
+	formatter Formatter // in place of format, if set
+
+	recovery writeRecovery // keeps going while the server is down
+}
+
+// A redisError is an error reply from the server, as to a command on a key of
+// the wrong type
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// This is the RedisLogWriter's output method
+func (w *RedisLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
+}
+
+// wait for the records to be pushed and close the connection
+func (w *RedisLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewRedisLogWriter creates a new LogWriter which LPUSHes records to the list
+// key on the Redis server at addr (host:port), formatted with
+// "[%D %T] [%L] (%S) %M", until set otherwise.  With SetMode("xadd") it adds
+// them to the stream key instead, with time, level, source and message fields,
+// the message formatted with "%M".
+//
+// The connection is made when the first record is pushed, and made again
+// should it fail.  While the server cannot be reached, records are dropped, or
+// written to stderr after SetStderrFallback; they are not pushed once it can.
+func NewRedisLogWriter(addr, key string, opts ...Option) *RedisLogWriter {
+	o := newWriterOptions(opts)
+	w := &RedisLogWriter{
+		rec:      make(chan *LogRecord, o.bufferLength),
+		blocking: o.blocking,
+		addr:     addr,
+		timeout:  10 * time.Second,
+		key:      key,
+		mode:     "lpush",
+		recovery: newWriteRecovery(),
+	}
+	w.recovery.kind = "RedisLogWriter"
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		defer func() {
+			if w.conn != nil {
+				w.conn.Close()
+			}
+		}()
+
+		for rec := range w.rec {
+			if w.EndNotify(rec) {
+				return
+			}
+			if w.recovery.waiting(time.Now()) {
+				w.recovery.setAside(rec, w.layout(), w.formatter)
+				continue
+			}
+			if err := w.send(rec); err != nil {
+				w.recovery.failed(w.addr, err, rec, w.layout(), w.formatter)
+				continue
+			}
+			w.recovery.succeeded(w.addr)
+		}
+	}()
+
+	return w
+}
+
+// The format of the records: a stream entry has the rest in fields of its own
+func (w *RedisLogWriter) layout() string {
+	switch {
+	case w.format != "":
+		return w.format
+	case w.mode == "xadd":
+		return "%M"
+	}
+	return "[%D %T] [%L] (%S) %M"
+}
+
+// The command rec is pushed with
+func (w *RedisLogWriter) command(rec *LogRecord) []string {
+	message := string(rec.Binary)
+	if rec.Binary == nil {
+		message = strings.TrimRight(formatRecord(w.layout(), w.formatter, rec), "\n")
+	}
+	if w.mode != "xadd" {
+		return []string{strings.ToUpper(w.mode), w.key, message}
+	}
+
+	cmd := []string{"XADD", w.key}
+	if w.maxLen > 0 {
+		cmd = append(cmd, "MAXLEN", "~", strconv.Itoa(w.maxLen))
+	}
+	return append(cmd, "*",
+		"time", rec.Created.Format(time.RFC3339Nano),
+		"level", rec.Level.String(),
+		"source", rec.Source,
+		"message", message)
+}
+
+// Send rec, connecting first if need be, and connecting again once if the
+// connection was lost.
+func (w *RedisLogWriter) send(rec *LogRecord) error {
+	cmd := w.command(rec)
+	if w.conn != nil {
+		_, err := w.do(cmd...)
+		if _, isReply := err.(redisError); err == nil || isReply {
+			return err
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if err := w.connect(); err != nil {
+		return err
+	}
+	_, err := w.do(cmd...)
+	if _, isReply := err.(redisError); err != nil && !isReply {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+// Connect, logging in and selecting the database if set
+func (w *RedisLogWriter) connect() (err error) {
+	dialer := &net.Dialer{Timeout: w.timeout}
+	if w.tlsConfig != nil {
+		w.conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, w.tlsConfig)
+	} else {
+		w.conn, err = dialer.Dial("tcp", w.addr)
+	}
+	if err != nil {
+		return err
+	}
+	w.r = bufio.NewReader(w.conn)
+
+	if w.password != "" {
+		if w.username != "" {
+			_, err = w.do("AUTH", w.username, w.password)
+		} else {
+			_, err = w.do("AUTH", w.password)
+		}
+	}
+	if err == nil && w.db != 0 {
+		_, err = w.do("SELECT", strconv.Itoa(w.db))
+	}
+	if err != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+// Send a command and read its reply
+func (w *RedisLogWriter) do(args ...string) (string, error) {
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	w.conn.SetDeadline(time.Now().Add(w.timeout))
+	if _, err := io.WriteString(w.conn, cmd.String()); err != nil {
+		return "", err
+	}
+	return readRedisReply(w.r)
+}
+
+// readRedisReply reads a RESP reply, returning it as a string unless it is an
+// array, the elements of which are skipped
+func readRedisReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("malformed reply")
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+', ':':
+		return line, nil
+	case '-':
+		return "", redisError(line)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return "", err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return "", err
+		}
+		for i := 0; i < n; i++ {
+			if _, err := readRedisReply(r); err != nil {
+				if _, isReply := err.(redisError); !isReply {
+					return "", err
+				}
+			}
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown reply %q", kind)
+}
+
+// Set the logging format of the records (chainable).  Must be called before
+// the first log message is written.
+func (w *RedisLogWriter) SetFormat(format string) *RedisLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *RedisLogWriter) SetFormatter(formatter Formatter) *RedisLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set how records are pushed (chainable): "lpush", the default, or "rpush" to
+// a list, or "xadd" to a stream.  Must be called before the first log message
+// is written.
+func (w *RedisLogWriter) SetMode(mode string) *RedisLogWriter {
+	switch mode {
+	case "lpush", "rpush", "xadd":
+		w.mode = mode
+	default:
+		fmt.Fprintf(os.Stderr, "RedisLogWriter(%q): unknown mode %q\n", w.addr, mode)
+	}
+	return w
+}
+
+// Set the length the stream is trimmed to, roughly (chainable); by default it
+// is not.  Must be called before the first log message is written.
+func (w *RedisLogWriter) SetMaxLen(maxLen int) *RedisLogWriter {
+	w.maxLen = maxLen
+	return w
+}
+
+// Set the password to AUTH with, and with Redis 6 ACLs the user, else ""
+// (chainable).  Must be called before the first log message is written.
+func (w *RedisLogWriter) SetAuth(username, password string) *RedisLogWriter {
+	w.username, w.password = username, password
+	return w
+}
+
+// Set the database to SELECT (chainable).  The default is 0.  Must be called
+// before the first log message is written.
+func (w *RedisLogWriter) SetDB(db int) *RedisLogWriter {
+	w.db = db
+	return w
+}
+
+// Set the TLS configuration to connect with (chainable); without one, the
+// connection is in plaintext.  Must be called before the first log message is
+// written.
+func (w *RedisLogWriter) SetTLSConfig(config *tls.Config) *RedisLogWriter {
+	w.tlsConfig = config
+	return w
+}
+
+// Set how long connecting, and each command, may take (chainable).  The
+// default is 10 seconds.  Must be called before the first log message is
+// written.
+func (w *RedisLogWriter) SetTimeout(timeout time.Duration) *RedisLogWriter {
+	w.timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time a record
+// cannot be pushed (chainable).  It must not log to this writer.  Must be
+// called before the first log message is written.
+func (w *RedisLogWriter) SetErrorHandler(handler func(error)) *RedisLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be pushed
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *RedisLogWriter) SetStderrFallback(fallback bool) *RedisLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the server again after it cannot be
+// reached (chainable).  The wait doubles with each failure, up to max.  The
+// default is from one second up to a minute.  Must be called before the first
+// log message is written.
+func (w *RedisLogWriter) SetRetryBackoff(initial, max time.Duration) *RedisLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
@@ -0,0 +1,45 @@
+package log4go
+
+import "sync"
+
+// A reopener is a file writer ReopenAll can reopen.
+type reopener interface {
+	Reopen()
+}
+
+// The file writers currently open, for ReopenAll
+var openFiles = struct {
+	sync.Mutex
+	writers map[reopener]bool
+}{writers: make(map[reopener]bool)}
+
+func registerReopener(w reopener) {
+	openFiles.Lock()
+	defer openFiles.Unlock()
+	openFiles.writers[w] = true
+}
+
+func unregisterReopener(w reopener) {
+	openFiles.Lock()
+	defer openFiles.Unlock()
+	delete(openFiles.writers, w)
+}
+
+// ReopenAll reopens the files of all the file writers that are open, as
+// Reopen does for one.  Wire it to SIGHUP to work with logrotate's default
+// (create) mode:
+//
+//	c := make(chan os.Signal, 1)
+//	signal.Notify(c, syscall.SIGHUP)
+//	go func() {
+//		for range c {
+//			log4go.ReopenAll()
+//		}
+//	}()
+func ReopenAll() {
+	openFiles.Lock()
+	defer openFiles.Unlock()
+	for w := range openFiles.writers {
+		w.Reopen()
+	}
+}
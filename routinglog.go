@@ -0,0 +1,134 @@
+package log4go
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// This log writer sends each record to a writer of its own key, such as the
+// tenant or subsystem it was logged for, making the writer of a key when it
+// is first seen.  Only so many writers are kept open; beyond that, the one
+// least recently written to is closed, to be made again should its key come
+// back.
+type RoutingLogWriter struct {
+	key     func(rec *LogRecord) string
+	factory func(key string) LogWriter // nil to drop the key's records
+
+	mu      sync.Mutex
+	writers map[string]*list.Element // of routes
+	lru     *list.List               // most recently written to first
+	max     int
+}
+
+type route struct {
+	key    string
+	writer LogWriter
+}
+
+// NewRoutingLogWriter creates a new RoutingLogWriter sending each record to the
+// writer factory makes of its key, keeping up to 100 writers open until set
+// otherwise.
+//
+//	tenants := NewRoutingLogWriter(tenantOf, FileRoute("logs/{key}.log"))
+func NewRoutingLogWriter(key func(rec *LogRecord) string, factory func(key string) LogWriter) *RoutingLogWriter {
+	return &RoutingLogWriter{
+		key:     key,
+		factory: factory,
+		writers: make(map[string]*list.Element),
+		lru:     list.New(),
+		max:     100,
+	}
+}
+
+// FileRoute returns a factory making a FileLogWriter, without rotation, for a
+// key, named by pattern with {key} replaced by the key.  Path separators in the
+// key, and a dot it starts with, are replaced by underscores, so that a key
+// cannot name a file elsewhere.
+func FileRoute(pattern string) func(key string) LogWriter {
+	return func(key string) LogWriter {
+		key = strings.NewReplacer("/", "_", `\`, "_").Replace(key)
+		if strings.HasPrefix(key, ".") {
+			key = "_" + key[1:]
+		}
+		if w := NewFileLogWriter(strings.Replace(pattern, "{key}", key, -1), false); w != nil {
+			return w
+		}
+		return nil
+	}
+}
+
+// Set how many writers are kept open (chainable), the least recently written
+// to closed beyond that.  The default is 100.  Must be called before the first
+// log message is written.
+func (w *RoutingLogWriter) SetMaxWriters(max int) *RoutingLogWriter {
+	if max > 0 {
+		w.max = max
+	}
+	return w
+}
+
+// This is the RoutingLogWriter's output method
+func (w *RoutingLogWriter) LogWrite(rec *LogRecord) {
+	if writer := w.writer(w.key(rec)); writer != nil {
+		writer.LogWrite(rec)
+	}
+}
+
+// The writer of key, made if need be
+func (w *RoutingLogWriter) writer(key string) LogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e, ok := w.writers[key]; ok {
+		w.lru.MoveToFront(e)
+		return e.Value.(*route).writer
+	}
+
+	writer := w.factory(key)
+	if writer == nil {
+		return nil
+	}
+	w.writers[key] = w.lru.PushFront(&route{key, writer})
+	for w.lru.Len() > w.max {
+		oldest := w.lru.Remove(w.lru.Back()).(*route)
+		delete(w.writers, oldest.key)
+		oldest.writer.Close()
+	}
+	return writer
+}
+
+// Keys returns the keys whose writers are open, most recently written to
+// first.
+func (w *RoutingLogWriter) Keys() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	keys := make([]string, 0, w.lru.Len())
+	for e := w.lru.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*route).key)
+	}
+	return keys
+}
+
+// Flush flushes the writers that can be.
+func (w *RoutingLogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for e := w.lru.Front(); e != nil; e = e.Next() {
+		if fw, ok := e.Value.(*route).writer.(interface {
+			Flush()
+		}); ok {
+			fw.Flush()
+		}
+	}
+}
+
+// Close closes every writer.
+func (w *RoutingLogWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for e := w.lru.Front(); e != nil; e = e.Next() {
+		e.Value.(*route).writer.Close()
+	}
+	w.writers = make(map[string]*list.Element)
+	w.lru.Init()
+}
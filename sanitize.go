@@ -0,0 +1,119 @@
+package log4go
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// What is done with the control characters in a message
+type SanitizePolicy int
+
+const (
+	SANITIZE_ESCAPE SanitizePolicy = iota // written as \x1b and the like
+	SANITIZE_STRIP                        // left out, with any escape sequence they begin
+)
+
+// A SanitizeFormatter writes records with a format, the control characters in
+// their messages, terminal escape sequences among them, escaped or stripped,
+// so that a message cannot recolor, retitle or clear the terminal of whoever
+// reads the log.  Tabs and newlines are kept; a MultilineFormatter takes care
+// of those.
+//
+//	writer.SetFormatter(NewSanitizeFormatter(FORMAT_DEFAULT, SANITIZE_ESCAPE))
+type SanitizeFormatter struct {
+	format string
+	policy SanitizePolicy
+}
+
+// NewSanitizeFormatter creates a new SanitizeFormatter writing records with
+// format, the control characters in their messages handled by policy.
+func NewSanitizeFormatter(format string, policy SanitizePolicy) *SanitizeFormatter {
+	return &SanitizeFormatter{format: format, policy: policy}
+}
+
+// Format appends rec to *buf with the formatter's format.
+func (f *SanitizeFormatter) Format(rec *LogRecord, buf *[]byte) {
+	if message := sanitize(rec.Message, f.policy); message != rec.Message {
+		copied := *rec
+		copied.Message = message
+		rec = &copied
+	}
+	*buf = append(*buf, FormatLogRecord(f.format, rec)...)
+}
+
+// Whether r is a control character to be sanitized
+func isControl(r rune) bool {
+	return r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0x7f || 0x80 <= r && r <= 0x9f
+}
+
+// S with its control characters handled by policy
+func sanitize(s string, policy SanitizePolicy) string {
+	i := 0
+	for ; i < len(s); i++ {
+		if c := s[i]; c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c >= 0x7f {
+			break
+		}
+	}
+	if i == len(s) {
+		return s
+	}
+
+	var out strings.Builder
+	out.WriteString(s[:i])
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !isControl(r) {
+			out.WriteString(s[i : i+size])
+			i += size
+			continue
+		}
+		if policy == SANITIZE_ESCAPE {
+			if r < 0x80 {
+				fmt.Fprintf(&out, `\x%02x`, r)
+			} else {
+				fmt.Fprintf(&out, `\u%04x`, r)
+			}
+			i += size
+			continue
+		}
+		i += size
+		if r == 0x1b {
+			i += escapeSequenceLength(s[i:])
+		}
+	}
+	return out.String()
+}
+
+// How long the rest of an escape sequence is that s starts with, after the ESC
+func escapeSequenceLength(s string) int {
+	if s == "" {
+		return 0
+	}
+	switch s[0] {
+	case '[': // CSI: parameters, intermediates and a final byte
+		for i := 1; i < len(s); i++ {
+			if 0x40 <= s[i] && s[i] <= 0x7e {
+				return i + 1
+			}
+			if s[i] < 0x20 || s[i] > 0x7e {
+				return i
+			}
+		}
+		return len(s)
+	case ']', 'P', 'X', '^', '_': // strings, ended by BEL or ESC \
+		for i := 1; i < len(s); i++ {
+			if s[i] == 0x07 {
+				return i + 1
+			}
+			if s[i] == 0x1b && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(s)
+	}
+	if 0x20 <= s[0] && s[0] <= 0x7e {
+		return 1
+	}
+	return 0
+}
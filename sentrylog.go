@@ -0,0 +1,316 @@
+package log4go
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This log writer sends the records at ERROR and above, until set otherwise,
+// to Sentry as events, for them to be grouped by where they were logged.
+// Events can be sampled and rate-limited; while Sentry itself rate-limits the
+// writer, events are dropped rather than retried.
+type SentryLogWriter struct {
+	httpBatcher
+
+	level       Level
+	environment string
+	release     string
+	serverName  string
+	tags        map[string]string
+	extra       map[string]interface{}
+
+	sampleRate   float64 // of the events sent, from 0 to 1
+	limit        int     // events per window, if set
+	window       time.Duration
+	windowStart  time.Time
+	windowEvents int
+	limitedUntil time.Time // as Sentry asked
+	dropped      int       // by the rate limits, since last noted
+}
+
+// This is the SentryLogWriter's output method
+func (w *SentryLogWriter) LogWrite(rec *LogRecord) {
+	if rec.Level < w.level {
+		return
+	}
+	w.logWrite(rec)
+}
+
+// wait for the events to be sent
+func (w *SentryLogWriter) Close() {
+	w.close()
+}
+
+// Flush sends the events batched so far, returning once they have been.
+func (w *SentryLogWriter) Flush() {
+	w.flush()
+}
+
+// NewSentryLogWriter creates a new LogWriter which sends records to the Sentry
+// project of dsn (e.g. "https://key@o1.ingest.sentry.io/42") as events with
+// the message, the level, and the function and line logged from as the
+// culprit and stack frame.  It returns nil if dsn cannot be parsed.
+//
+// Events are sent a second after the first of a batch of up to 100.
+func NewSentryLogWriter(dsn string, opts ...Option) *SentryLogWriter {
+	u, err := url.Parse(dsn)
+	if err == nil && (u.User == nil || u.User.Username() == "") {
+		err = fmt.Errorf("no public key")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "NewSentryLogWriter(%q): %s\n", dsn, err)
+		return nil
+	}
+	path := strings.TrimRight(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	project := path[slash+1:]
+	if project == "" {
+		fmt.Fprintf(os.Stderr, "NewSentryLogWriter(%q): no project\n", dsn)
+		return nil
+	}
+
+	hostname, _ := os.Hostname()
+	w := &SentryLogWriter{
+		httpBatcher: newHTTPBatcher("SentryLogWriter", u.Scheme+"://"+u.Host+path[:slash]+"/api/"+project+"/store/", opts),
+		level:       ERROR,
+		serverName:  hostname,
+		tags:        make(map[string]string),
+		extra:       make(map[string]interface{}),
+		sampleRate:  1,
+	}
+	w.batchSize = 100
+	auth := "Sentry sentry_version=7, sentry_client=log4go/1.0, sentry_key=" + u.User.Username()
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	w.header.Set("X-Sentry-Auth", auth)
+	w.finish = w.noteDropped
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go w.run(w.send)
+
+	return w
+}
+
+// The level of Sentry's of lvl
+func sentryLevel(lvl Level) string {
+	switch {
+	case lvl <= TRACE:
+		return "debug"
+	case lvl == INFO:
+		return "info"
+	case lvl == WARNING:
+		return "warning"
+	case lvl == ERROR:
+		return "error"
+	}
+	return "fatal"
+}
+
+// The stack frame of source, as log4go sets it: the function's name, a colon
+// and the line
+func sentryFrame(source string) map[string]interface{} {
+	frame := map[string]interface{}{"in_app": true}
+	function := source
+	if colon := strings.LastIndex(source, ":"); colon >= 0 {
+		if line, err := strconv.Atoi(source[colon+1:]); err == nil {
+			function = source[:colon]
+			frame["lineno"] = line
+		}
+	}
+	frame["function"] = function
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		frame["module"] = function[:slash+1+dot]
+	}
+	return frame
+}
+
+// Whether the rate limits, ours and Sentry's, let an event through now
+func (w *SentryLogWriter) allowed(now time.Time) bool {
+	if now.Before(w.limitedUntil) {
+		return false
+	}
+	if w.limit > 0 {
+		if now.Sub(w.windowStart) >= w.window {
+			w.windowStart, w.windowEvents = now, 0
+		}
+		if w.windowEvents >= w.limit {
+			return false
+		}
+		w.windowEvents++
+	}
+	return true
+}
+
+// Send a batch, an event at a time
+func (w *SentryLogWriter) send(batch []*LogRecord) error {
+	for _, rec := range batch {
+		if w.sampleRate < 1 && mathrand.Float64() >= w.sampleRate {
+			continue
+		}
+		if !w.allowed(time.Now()) {
+			w.dropped++
+			continue
+		}
+		w.noteDropped()
+
+		body, err := json.Marshal(w.event(rec))
+		if err != nil {
+			return err
+		}
+		if _, err := w.postOnce(body, "application/json", nil); err != nil {
+			if serr, ok := err.(*httpStatusError); ok && serr.status == http.StatusTooManyRequests {
+				wait := serr.retryAfter
+				if wait <= 0 {
+					wait = time.Minute
+				}
+				w.limitedUntil = time.Now().Add(wait)
+				w.dropped++
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Note the events dropped by the rate limits, if any
+func (w *SentryLogWriter) noteDropped() {
+	if w.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "SentryLogWriter(%q): dropped %d events over the rate limit\n", w.url, w.dropped)
+		w.dropped = 0
+	}
+}
+
+// The event of rec
+func (w *SentryLogWriter) event(rec *LogRecord) map[string]interface{} {
+	id := make([]byte, 16)
+	rand.Read(id)
+	message := string(rec.Binary)
+	if rec.Binary == nil {
+		message = rec.Message
+	}
+
+	event := map[string]interface{}{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": rec.Created.UTC().Format(time.RFC3339Nano),
+		"level":     sentryLevel(rec.Level),
+		"logger":    "log4go",
+		"platform":  "go",
+		"message":   message,
+	}
+	if rec.Source != "" {
+		frame := sentryFrame(rec.Source)
+		event["culprit"] = frame["function"]
+		event["stacktrace"] = map[string]interface{}{"frames": []interface{}{frame}}
+	}
+	if w.environment != "" {
+		event["environment"] = w.environment
+	}
+	if w.release != "" {
+		event["release"] = w.release
+	}
+	if w.serverName != "" {
+		event["server_name"] = w.serverName
+	}
+	if len(w.tags) > 0 {
+		event["tags"] = w.tags
+	}
+	if len(w.extra) > 0 {
+		event["extra"] = w.extra
+	}
+	return event
+}
+
+// Set the lowest level of the records sent (chainable).  The default is ERROR.
+// Must be called before the first log message is written.
+func (w *SentryLogWriter) SetLevel(lvl Level) *SentryLogWriter {
+	w.level = lvl
+	return w
+}
+
+// Set the environment of the events, e.g. "production" (chainable).  Must be
+// called before the first log message is written.
+func (w *SentryLogWriter) SetEnvironment(environment string) *SentryLogWriter {
+	w.environment = environment
+	return w
+}
+
+// Set the release of the events, e.g. "app@1.2.3" (chainable).  Must be called
+// before the first log message is written.
+func (w *SentryLogWriter) SetRelease(release string) *SentryLogWriter {
+	w.release = release
+	return w
+}
+
+// Set the server name of the events (chainable).  The default is the host
+// name.  Must be called before the first log message is written.
+func (w *SentryLogWriter) SetServerName(name string) *SentryLogWriter {
+	w.serverName = name
+	return w
+}
+
+// Add a tag to every event (chainable), searchable in Sentry.  Must be called
+// before the first log message is written.
+func (w *SentryLogWriter) SetTag(name, value string) *SentryLogWriter {
+	w.tags[name] = value
+	return w
+}
+
+// Add extra data to every event (chainable).  Must be called before the first
+// log message is written.
+func (w *SentryLogWriter) SetExtra(name string, value interface{}) *SentryLogWriter {
+	w.extra[name] = value
+	return w
+}
+
+// Set the share of the events sent, from 0 to 1 (chainable), the rest
+// dropped at random.  The default is 1, every event.  Must be called before
+// the first log message is written.
+func (w *SentryLogWriter) SetSampleRate(rate float64) *SentryLogWriter {
+	w.sampleRate = rate
+	return w
+}
+
+// Set the most events sent in each window of time (chainable), those over it
+// dropped and counted.  The default is no limit but Sentry's own.  Must be
+// called before the first log message is written.
+func (w *SentryLogWriter) SetRateLimit(events int, window time.Duration) *SentryLogWriter {
+	w.limit, w.window = events, window
+	return w
+}
+
+// Set the timeout of each request (chainable).  The default is 30 seconds.
+// Must be called before the first log message is written.
+func (w *SentryLogWriter) SetTimeout(timeout time.Duration) *SentryLogWriter {
+	w.client.Timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time events cannot
+// be sent (chainable).  It must not log to this writer.  Must be called before
+// the first log message is written.
+func (w *SentryLogWriter) SetErrorHandler(handler func(error)) *SentryLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be sent
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *SentryLogWriter) SetStderrFallback(fallback bool) *SentryLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
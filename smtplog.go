@@ -0,0 +1,339 @@
+package log4go
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// This log writer mails digests of the records at ERROR and above, until set
+// otherwise, sending at most one mail every five minutes: the first record is
+// mailed at once, and those logged in the following five minutes together once
+// they are up.
+type SMTPLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	addr      string // host:port
+	from      string
+	to        []string
+	auth      smtp.Auth
+	tlsConfig *tls.Config // for STARTTLS, or implicit TLS
+	implicit  bool        // TLS from the start, as on port 465
+	timeout   time.Duration
+
+	level     Level
+	subject   string // formatted with the first record of a digest
+	format    string
+	formatter Formatter     // in place of format, if set
+	interval  time.Duration // between mails
+
+	// records not yet mailed
+	pending    []*LogRecord
+	maxPending int
+	dropped    int
+	lastSent   time.Time
+
+	recovery writeRecovery // keeps going while the server is down
+}
+
+// This is the SMTPLogWriter's output method
+func (w *SMTPLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
+}
+
+// wait for the records to be mailed
+func (w *SMTPLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewSMTPLogWriter creates a new LogWriter which mails digests of the records
+// at ERROR and above from from to the addresses to, through the SMTP server at
+// addr (host:port).  STARTTLS is used if the server offers it.  A digest holds
+// up to 1000 records, the rest counted and dropped.
+func NewSMTPLogWriter(addr, from string, to ...string) *SMTPLogWriter {
+	w := &SMTPLogWriter{
+		rec:        make(chan *LogRecord, LogBufferLength),
+		blocking:   LogWithBlocking,
+		addr:       addr,
+		from:       from,
+		to:         to,
+		timeout:    30 * time.Second,
+		level:      ERROR,
+		subject:    "[%L] %M",
+		format:     FORMAT_DEFAULT,
+		interval:   5 * time.Minute,
+		maxPending: 1000,
+		recovery:   newWriteRecovery(),
+	}
+	w.recovery.kind = "SMTPLogWriter"
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		var timer *time.Timer
+		var due <-chan time.Time
+		schedule := func() {
+			if len(w.pending) == 0 || due != nil {
+				return
+			}
+			at := w.lastSent.Add(w.interval)
+			if w.recovery.failing && w.recovery.retryAt.After(at) {
+				at = w.recovery.retryAt
+			}
+			if wait := time.Until(at); wait > 0 {
+				timer = time.NewTimer(wait)
+				due = timer.C
+				return
+			}
+			w.flush()
+			if len(w.pending) > 0 {
+				// failed; the recovery has set when to try again
+				timer = time.NewTimer(time.Until(w.recovery.retryAt))
+				due = timer.C
+			}
+		}
+
+		for {
+			select {
+			case rec := <-w.rec:
+				if rec == nil {
+					if timer != nil {
+						timer.Stop()
+					}
+					if len(w.pending) > 0 {
+						w.flush()
+					}
+					for _, rec := range w.pending {
+						w.recovery.setAside(rec, w.format, w.formatter)
+					}
+					w.EndNotify(rec)
+					return
+				}
+				if rec.Level < w.level {
+					continue
+				}
+				w.keep(rec)
+				schedule()
+			case <-due:
+				due = nil
+				w.flush()
+				schedule()
+			}
+		}
+	}()
+
+	return w
+}
+
+// Keep a record to be mailed, making room if need be
+func (w *SMTPLogWriter) keep(rec *LogRecord) {
+	if len(w.pending) >= w.maxPending {
+		w.recovery.setAside(rec, w.format, w.formatter)
+		w.dropped++
+		return
+	}
+	w.pending = append(w.pending, rec)
+}
+
+// Mail the records kept, noting how it went
+func (w *SMTPLogWriter) flush() {
+	if err := w.send(w.message()); err != nil {
+		w.recovery.failed(w.addr, err, nil, "", nil)
+		return
+	}
+	w.recovery.succeeded(w.addr)
+	w.pending = nil
+	w.dropped = 0
+	w.lastSent = time.Now()
+}
+
+// The mail of the records kept
+func (w *SMTPLogWriter) message() []byte {
+	subject := strings.TrimRight(FormatLogRecord(w.subject, w.pending[0]), "\n")
+	subject = strings.Join(strings.Fields(subject), " ")
+	if more := len(w.pending) + w.dropped - 1; more > 0 {
+		subject += fmt.Sprintf(" (and %d more)", more)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", w.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(w.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	for _, rec := range w.pending {
+		if rec.Binary != nil {
+			msg.Write(rec.Binary)
+		} else {
+			msg.WriteString(formatRecord(w.format, w.formatter, rec))
+		}
+	}
+	if w.dropped > 0 {
+		fmt.Fprintf(&msg, "\n%d more records were dropped\n", w.dropped)
+	}
+	return msg.Bytes()
+}
+
+// Mail msg, as smtp.SendMail does, but within the timeout and over implicit
+// TLS if set
+func (w *SMTPLogWriter) send(msg []byte) error {
+	host, _, err := net.SplitHostPort(w.addr)
+	if err != nil {
+		return err
+	}
+	config := w.tlsConfig
+	if config == nil {
+		config = &tls.Config{ServerName: host}
+	} else if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	conn, err := net.DialTimeout("tcp", w.addr, w.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(w.timeout))
+	if w.implicit {
+		conn = tls.Client(conn, config)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok && !w.implicit {
+		if err := c.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if w.auth != nil {
+		if err := c.Auth(w.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(w.from); err != nil {
+		return err
+	}
+	for _, to := range w.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	data, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(msg); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Set the lowest level of the records mailed (chainable).  The default is
+// ERROR.  Must be called before the first log message is written.
+func (w *SMTPLogWriter) SetLevel(lvl Level) *SMTPLogWriter {
+	w.level = lvl
+	return w
+}
+
+// Set the least time between mails (chainable).  The default is five minutes.
+// Must be called before the first log message is written.
+func (w *SMTPLogWriter) SetInterval(interval time.Duration) *SMTPLogWriter {
+	w.interval = interval
+	return w
+}
+
+// Set the format of the subject (chainable), given the first record of the
+// digest and followed by how many more it holds.  The default is "[%L] %M".
+// Must be called before the first log message is written.
+func (w *SMTPLogWriter) SetSubject(subject string) *SMTPLogWriter {
+	w.subject = subject
+	return w
+}
+
+// Set the logging format of the records in the mail (chainable).  Must be
+// called before the first log message is written.
+func (w *SMTPLogWriter) SetFormat(format string) *SMTPLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *SMTPLogWriter) SetFormatter(formatter Formatter) *SMTPLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set how many records a digest holds (chainable), the rest counted and
+// dropped.  The default is 1000.  Must be called before the first log message
+// is written.
+func (w *SMTPLogWriter) SetMaxRecords(records int) *SMTPLogWriter {
+	if records > 0 {
+		w.maxPending = records
+	}
+	return w
+}
+
+// Set the username and password to authenticate with, by PLAIN auth
+// (chainable).  Go refuses to send them other than over TLS or to localhost.
+// Must be called before the first log message is written.
+func (w *SMTPLogWriter) SetAuth(username, password string) *SMTPLogWriter {
+	host, _, _ := net.SplitHostPort(w.addr)
+	w.auth = smtp.PlainAuth("", username, password, host)
+	return w
+}
+
+// Set the TLS configuration (chainable), for STARTTLS or, with implicit set,
+// for TLS from the start, as on port 465.  Must be called before the first log
+// message is written.
+func (w *SMTPLogWriter) SetTLSConfig(config *tls.Config, implicit bool) *SMTPLogWriter {
+	w.tlsConfig, w.implicit = config, implicit
+	return w
+}
+
+// Set how long mailing a digest may take (chainable).  The default is 30
+// seconds.  Must be called before the first log message is written.
+func (w *SMTPLogWriter) SetTimeout(timeout time.Duration) *SMTPLogWriter {
+	w.timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time the server
+// cannot be reached (chainable).  It must not log to this writer.  Must be
+// called before the first log message is written.
+func (w *SMTPLogWriter) SetErrorHandler(handler func(error)) *SMTPLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether the records dropped are written to stderr (chainable); otherwise
+// they are lost.  Must be called before the first log message is written.
+func (w *SMTPLogWriter) SetStderrFallback(fallback bool) *SMTPLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the server again after it cannot be
+// reached (chainable).  The wait doubles with each failure, up to max.  The
+// default is from one second up to a minute.  Must be called before the first
+// log message is written.
+func (w *SMTPLogWriter) SetRetryBackoff(initial, max time.Duration) *SMTPLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
@@ -3,55 +3,343 @@
 package log4go
 
 import (
+	"crypto/tls"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"strings"
+	"time"
 )
 
 // This log writer sends output to a socket
-type SocketLogWriter chan *LogRecord
+type SocketLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	proto     string // as for net.Dial, or "tls"
+	hostport  string
+	tlsConfig *tls.Config // for "tls", or TCP upgraded to it
+	conn      net.Conn
+
+	format    string    // if set, rather than the record as JSON
+	formatter Formatter // in place of format, if set
+	framing   string    // "none", "newline" or "length"
+
+	// messages not yet sent, kept while the peer is down
+	pending    []socketMessage
+	maxPending int
+	dropped    int
+
+	recovery writeRecovery // keeps going while the peer is down
+}
+
+type socketMessage struct {
+	rec *LogRecord
+	msg []byte // framed
+}
 
 // This is the SocketLogWriter's output method
-func (w SocketLogWriter) LogWrite(rec *LogRecord) {
-	w <- rec
+func (w *SocketLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
 }
 
-func (w SocketLogWriter) Close() {
-	close(w)
+// wait for the records to be sent and close the connection
+func (w *SocketLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
 }
 
-func NewSocketLogWriter(proto, hostport string) SocketLogWriter {
-	sock, err := net.Dial(proto, hostport)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "NewSocketLogWriter(%q): %s\n", hostport, err)
-		return nil
+// NewSocketLogWriter creates a new LogWriter which sends records, as JSON, to
+// hostport over proto: "udp", a datagram each, "tcp", a line each, or "tls",
+// TCP over TLS.
+//
+// The connection is made when the first record is sent, and made again should
+// it fail, waiting longer after each failure.  Meanwhile up to 1000 records
+// are kept to be sent once it is back, the oldest dropped beyond that.
+func NewSocketLogWriter(proto, hostport string, opts ...Option) *SocketLogWriter {
+	o := newWriterOptions(opts)
+	w := &SocketLogWriter{
+		rec:        make(chan *LogRecord, o.bufferLength),
+		blocking:   o.blocking,
+		proto:      proto,
+		hostport:   hostport,
+		framing:    "newline",
+		maxPending: 1000,
+		recovery:   newWriteRecovery(),
+	}
+	w.recovery.kind = "SocketLogWriter"
+	if !w.stream() {
+		w.framing = "none"
 	}
 
-	w := SocketLogWriter(make(chan *LogRecord, LogBufferLength))
+	//init LogCloser
+	w.LogCloserInit()
 
 	go func() {
 		defer func() {
-			if sock != nil && proto == "tcp" {
-				sock.Close()
+			if len(w.pending) > 0 && !w.recovery.waiting(time.Now()) {
+				w.flush()
+			}
+			for _, m := range w.pending {
+				w.recovery.setAside(m.rec, w.layout(), w.formatter)
+			}
+			if w.conn != nil {
+				w.conn.Close()
 			}
 		}()
 
-		for rec := range w {
-			// Marshall into JSON
-			js, err := json.Marshal(rec)
-			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
+		for rec := range w.rec {
+			if w.EndNotify(rec) {
 				return
 			}
-
-			_, err = sock.Write(js)
+			msg, err := w.message(rec)
 			if err != nil {
-				fmt.Fprint(os.Stderr, "SocketLogWriter(%q): %s", hostport, err)
-				return
+				fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s\n", w.hostport, err)
+				continue
 			}
+			w.keep(rec, msg)
+			if w.recovery.waiting(time.Now()) {
+				continue
+			}
+			w.flush()
 		}
 	}()
 
+	o.setup(w)
+	return w
+}
+
+// NewSocketWriter creates a new SocketLogWriter sending records to hostport,
+// set up by the options, such as WithProtocol, WithFraming and WithFormat, as
+// NewSocketLogWriter and its setters do; over TCP by default.
+func NewSocketWriter(hostport string, opts ...Option) *SocketLogWriter {
+	proto := newWriterOptions(opts).proto
+	if proto == "" {
+		proto = "tcp"
+	}
+	return NewSocketLogWriter(proto, hostport, opts...)
+}
+
+// NewUnixSocketLogWriter creates a new LogWriter which sends records, as JSON,
+// to the Unix domain socket at path, as a local agent such as Vector or Fluent
+// Bit listens on: a line each to a stream socket, or with datagram set, a
+// datagram each.  It is a SocketLogWriter, reconnecting and keeping records as
+// it does while the agent is down.
+func NewUnixSocketLogWriter(path string, datagram bool, opts ...Option) *SocketLogWriter {
+	if datagram {
+		return NewSocketLogWriter("unixgram", path, opts...)
+	}
+	return NewSocketLogWriter("unix", path, opts...)
+}
+
+// Whether the connection is a stream, rather than datagrams
+func (w *SocketLogWriter) stream() bool {
+	return !strings.HasPrefix(w.proto, "udp") && w.proto != "unixgram"
+}
+
+// The format records are set aside with
+func (w *SocketLogWriter) layout() string {
+	if w.format != "" {
+		return w.format
+	}
+	return "[%D %T] [%L] (%S) %M"
+}
+
+// The message rec is sent as, framed
+func (w *SocketLogWriter) message(rec *LogRecord) ([]byte, error) {
+	var msg []byte
+	formatter := w.formatter
+	if formatter == nil {
+		formatter = namedFormat(w.format)
+	}
+	_, proto := formatter.(*ProtobufFormatter)
+	switch {
+	case proto:
+		// the record whole, its length a varint rather than a newline after it
+		msg = appendProtoRecord(nil, rec, rec.Message)
+		if w.framing == "newline" {
+			return append(protoVarint(nil, uint64(len(msg))), msg...), nil
+		}
+	case rec.Binary != nil:
+		msg = rec.Binary
+	case w.format != "" || w.formatter != nil:
+		msg = []byte(strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n"))
+	default:
+		// Marshall into JSON
+		js, err := json.Marshal(rec)
+		if err != nil {
+			return nil, err
+		}
+		msg = js
+	}
+
+	switch w.framing {
+	case "newline":
+		return append(msg, '\n'), nil
+	case "length":
+		framed := make([]byte, 4, 4+len(msg))
+		binary.BigEndian.PutUint32(framed, uint32(len(msg)))
+		return append(framed, msg...), nil
+	}
+	return msg, nil
+}
+
+// Keep a message to be sent, making room if need be
+func (w *SocketLogWriter) keep(rec *LogRecord, msg []byte) {
+	if len(w.pending) >= w.maxPending && len(w.pending) > 0 {
+		w.recovery.setAside(w.pending[0].rec, w.layout(), w.formatter)
+		w.pending = w.pending[1:]
+		w.dropped++
+	}
+	w.pending = append(w.pending, socketMessage{rec: rec, msg: msg})
+}
+
+// Send the messages kept, noting how it went
+func (w *SocketLogWriter) flush() {
+	if err := w.send(); err != nil {
+		w.recovery.failed(w.hostport, err, nil, "", nil)
+		return
+	}
+	if w.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): dropped %d records while the peer was down\n", w.hostport, w.dropped)
+		w.dropped = 0
+	}
+	w.recovery.succeeded(w.hostport)
+}
+
+// Send the messages kept in order, connecting first if need be, and connecting
+// again once if the connection was lost.
+func (w *SocketLogWriter) send() error {
+	if w.conn != nil {
+		if err := w.write(); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if err := w.connect(); err != nil {
+		return err
+	}
+	if err := w.write(); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (w *SocketLogWriter) write() error {
+	for len(w.pending) > 0 {
+		if _, err := w.conn.Write(w.pending[0].msg); err != nil {
+			return err
+		}
+		w.pending[0] = socketMessage{}
+		w.pending = w.pending[1:]
+	}
+	w.pending = nil
+	return nil
+}
+
+func (w *SocketLogWriter) connect() (err error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch {
+	case w.proto == "tls":
+		w.conn, err = tls.DialWithDialer(dialer, "tcp", w.hostport, w.tlsConfig)
+	case w.tlsConfig != nil && strings.HasPrefix(w.proto, "tcp"):
+		w.conn, err = tls.DialWithDialer(dialer, w.proto, w.hostport, w.tlsConfig)
+	default:
+		w.conn, err = dialer.Dial(w.proto, w.hostport)
+	}
+	return err
+}
+
+// Set the logging format of the records (chainable), rather than sending them
+// as JSON.  Must be called before the first log message is written.
+func (w *SocketLogWriter) SetFormat(format string) *SocketLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *SocketLogWriter) SetFormatter(formatter Formatter) *SocketLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set how the records are delimited (chainable): "newline", after each one,
+// the default for streams; "length", each one after its length as four bytes,
+// big-endian; or "none", the default for datagrams.  Must be called before the
+// first log message is written.
+func (w *SocketLogWriter) SetFraming(framing string) *SocketLogWriter {
+	switch framing {
+	case "none", "newline", "length":
+		w.framing = framing
+	default:
+		fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): unknown framing %q\n", w.hostport, framing)
+	}
+	return w
+}
+
+// Set the TLS configuration for "tls", or to upgrade "tcp" to TLS (chainable).
+// Must be called before the first log message is written.
+func (w *SocketLogWriter) SetTLSConfig(config *tls.Config) *SocketLogWriter {
+	w.tlsConfig = config
+	return w
+}
+
+// Set the certificate to present to the peer over TLS (chainable), loaded from
+// the PEM files certFile and keyFile.  Must be called before the first log
+// message is written.
+func (w *SocketLogWriter) SetClientCert(certFile, keyFile string) *SocketLogWriter {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "SocketLogWriter(%q): %s\n", w.hostport, err)
+		return w
+	}
+	if w.tlsConfig == nil {
+		w.tlsConfig = &tls.Config{}
+	} else {
+		w.tlsConfig = w.tlsConfig.Clone()
+	}
+	w.tlsConfig.Certificates = append(w.tlsConfig.Certificates, cert)
+	return w
+}
+
+// Set how many records are kept while the peer is down (chainable), the
+// oldest dropped beyond that.  The default is 1000.  Must be called before the
+// first log message is written.
+func (w *SocketLogWriter) SetRetryBuffer(records int) *SocketLogWriter {
+	if records > 0 {
+		w.maxPending = records
+	}
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time the peer
+// cannot be reached (chainable).  It must not log to this writer.  Must be
+// called before the first log message is written.
+func (w *SocketLogWriter) SetErrorHandler(handler func(error)) *SocketLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether the records dropped are written to stderr (chainable); otherwise
+// they are lost.  Must be called before the first log message is written.
+func (w *SocketLogWriter) SetStderrFallback(fallback bool) *SocketLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the peer again after it cannot be reached
+// (chainable).  The wait doubles with each failure, up to max.  The default is
+// from one second up to a minute.  Must be called before the first log message
+// is written.
+func (w *SocketLogWriter) SetRetryBackoff(initial, max time.Duration) *SocketLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
 	return w
 }
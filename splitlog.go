@@ -0,0 +1,115 @@
+package log4go
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// This log writer sends records to different files according to their level,
+// each file with its own rotation and backupCount.  A record goes to the file
+// with the highest level that is not above its own.
+type LevelSplitFileLogWriter struct {
+	files []levelFile // sorted by level
+}
+
+type levelFile struct {
+	level Level
+	w     *TimeFileLogWriter
+}
+
+/*
+* NewLevelSplitFileLogWriter - creates a new LevelSplitFileLogWriter
+*
+* Records below WARNING go to fname, WARNING and above to fname + ".wf", both
+* rotated according to when and backupCount as for NewTimeFileLogWriter.
+* More files can be split off with AddFile.
+*
+* RETURNS:
+*   pointer to LevelSplitFileLogWriter, if succeed
+*   nil, if fail
+ */
+func NewLevelSplitFileLogWriter(fname string, when string, backupCount int) *LevelSplitFileLogWriter {
+	w := &LevelSplitFileLogWriter{}
+	if w.AddFile(FINEST, fname, when, backupCount) == nil {
+		return nil
+	}
+	if w.AddFile(WARNING, fname+".wf", when, backupCount) == nil {
+		w.Close()
+		return nil
+	}
+	return w
+}
+
+// AddFile sends records at lvl and above, up to the level of the next file, to
+// fname (chainable).  If a file was already set up for lvl it is replaced.
+// Returns nil if the file cannot be opened.  Must be called before the first
+// log message is written.
+func (w *LevelSplitFileLogWriter) AddFile(lvl Level, fname string, when string, backupCount int) *LevelSplitFileLogWriter {
+	tw := NewTimeFileLogWriter(fname, when, backupCount)
+	if tw == nil {
+		fmt.Fprintf(os.Stderr, "LevelSplitFileLogWriter(%q): cannot open file for %s\n", fname, lvl)
+		return nil
+	}
+
+	for i, f := range w.files {
+		if f.level == lvl {
+			f.w.Close()
+			w.files[i].w = tw
+			return w
+		}
+	}
+	w.files = append(w.files, levelFile{lvl, tw})
+	sort.Slice(w.files, func(i, j int) bool { return w.files[i].level < w.files[j].level })
+	return w
+}
+
+// Writer returns the file writer used for records at lvl, so that it can be
+// configured further, or nil if records at lvl are not written.
+func (w *LevelSplitFileLogWriter) Writer(lvl Level) *TimeFileLogWriter {
+	for i := len(w.files) - 1; i >= 0; i-- {
+		if w.files[i].level <= lvl {
+			return w.files[i].w
+		}
+	}
+	return nil
+}
+
+// Set the logging format of every file (chainable).  Must be called before the
+// first log message is written.
+func (w *LevelSplitFileLogWriter) SetFormat(format string) *LevelSplitFileLogWriter {
+	for _, f := range w.files {
+		f.w.SetFormat(format)
+	}
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *LevelSplitFileLogWriter) SetFormatter(formatter Formatter) *LevelSplitFileLogWriter {
+	for _, f := range w.files {
+		f.w.SetFormatter(formatter)
+	}
+	return w
+}
+
+// This is the LevelSplitFileLogWriter's output method
+func (w *LevelSplitFileLogWriter) LogWrite(rec *LogRecord) {
+	if tw := w.Writer(rec.Level); tw != nil {
+		tw.LogWrite(rec)
+	}
+}
+
+// Reopen reopens every file; see TimeFileLogWriter.Reopen.
+func (w *LevelSplitFileLogWriter) Reopen() {
+	for _, f := range w.files {
+		f.w.Reopen()
+	}
+}
+
+// Close closes every file.
+func (w *LevelSplitFileLogWriter) Close() {
+	for _, f := range w.files {
+		f.w.Close()
+	}
+}
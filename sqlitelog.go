@@ -0,0 +1,135 @@
+package log4go
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// This log writer keeps records in the table logs of a local SQLite file,
+// indexed by time, level and source, to be searched with Query: history for an
+// embedded application without a log server.  It is a DBLogWriter, whose
+// setters apply; the application imports the SQLite driver, registered as
+// "sqlite3" or "sqlite".
+type SQLiteLogWriter struct {
+	*DBLogWriter
+}
+
+// A LogQuery selects the records Query returns: those matching every field
+// set.
+type LogQuery struct {
+	Since, Until time.Time // logged at or after Since, and before Until
+	Level        Level     // at Level or above
+	Source       string    // logged from Source exactly
+	Contains     string    // with Contains in the message
+	Limit        int       // the most records returned, the latest
+}
+
+// NewSQLiteLogWriter creates a new LogWriter which inserts records into the
+// SQLite file at path, created with its table if need be.  It returns nil if
+// no SQLite driver is registered or the file cannot be opened.
+func NewSQLiteLogWriter(path string, opts ...Option) *SQLiteLogWriter {
+	var name string
+	for _, driver := range sql.Drivers() {
+		if driver == "sqlite3" || driver == "sqlite" {
+			name = driver
+			break
+		}
+	}
+	if name == "" {
+		fmt.Fprintf(os.Stderr, "NewSQLiteLogWriter(%q): no SQLite driver registered\n", path)
+		return nil
+	}
+	db, err := sql.Open(name, path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "NewSQLiteLogWriter(%q): %s\n", path, err)
+		return nil
+	}
+	// One writer at a time, so that inserts and queries do not find the file
+	// locked
+	db.SetMaxOpenConns(1)
+
+	w := &SQLiteLogWriter{NewDBLogWriter(db, "sqlite", "logs", opts...)}
+	w.kind, w.recovery.kind = "SQLiteLogWriter", "SQLiteLogWriter"
+	w.url = path
+	w.create, w.numeric = true, true
+	return w
+}
+
+// wait for the records to be inserted and close the file
+func (w *SQLiteLogWriter) Close() {
+	w.DBLogWriter.Close()
+	w.db.Close()
+}
+
+// Set the pruning policy (chainable): the records older than maxAge are
+// deleted, after a batch, every so often.  The default is to keep every
+// record.  Must be called before the first log message is written.
+func (w *SQLiteLogWriter) SetPrune(maxAge, every time.Duration) *SQLiteLogWriter {
+	w.DBLogWriter.SetPrune(maxAge, every)
+	return w
+}
+
+// Query returns the records kept which q selects, oldest first.  The records
+// still batched are not among them until flushed.
+func (w *SQLiteLogWriter) Query(q LogQuery) ([]*LogRecord, error) {
+	created, level, source, message := w.columns[0], w.columns[1], w.columns[2], w.columns[3]
+	var where []string
+	var args []interface{}
+	if !q.Since.IsZero() {
+		where = append(where, created+" >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, created+" < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+	if q.Level > FINEST {
+		where = append(where, level+" >= ?")
+		args = append(args, int64(q.Level))
+	}
+	if q.Source != "" {
+		where = append(where, source+" = ?")
+		args = append(args, q.Source)
+	}
+	if q.Contains != "" {
+		where = append(where, "instr("+message+", ?) > 0")
+		args = append(args, q.Contains)
+	}
+
+	query := fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s", created, level, source, message, w.table)
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY " + created + " DESC"
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	rows, err := w.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var recs []*LogRecord
+	for rows.Next() {
+		var nanos, lvl int64
+		rec := &LogRecord{}
+		if err := rows.Scan(&nanos, &lvl, &rec.Source, &rec.Message); err != nil {
+			return nil, err
+		}
+		rec.Created, rec.Level = time.Unix(0, nanos), Level(lvl)
+		recs = append(recs, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// latest first, for the limit
+	for i, j := 0, len(recs)-1; i < j; i, j = i+1, j-1 {
+		recs[i], recs[j] = recs[j], recs[i]
+	}
+	return recs, nil
+}
@@ -0,0 +1,233 @@
+package log4go
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The limits of an entries.write call
+const (
+	stackdriverMaxBytes   = 5 << 20 // of the payloads, leaving room below 10MB
+	stackdriverMaxPayload = 250 << 10
+)
+
+// This log writer writes batches of records to a log of Google Cloud Logging,
+// formerly Stackdriver, through entries.write.
+type StackdriverLogWriter struct {
+	httpBatcher
+
+	logName  string                 // projects/PROJECT/logs/LOG
+	resource map[string]interface{} // the monitored resource
+	labels   map[string]string      // of every entry
+
+	// token returns an OAuth2 access token with a logging write scope
+	token func() (string, error)
+}
+
+// This is the StackdriverLogWriter's output method
+func (w *StackdriverLogWriter) LogWrite(rec *LogRecord) {
+	w.logWrite(rec)
+}
+
+// wait for the records to be written
+func (w *StackdriverLogWriter) Close() {
+	w.close()
+}
+
+// Flush writes the records batched so far, returning once they have been.
+func (w *StackdriverLogWriter) Flush() {
+	w.flush()
+}
+
+// NewStackdriverLogWriter creates a new LogWriter which writes records to the
+// log logID of project, against the "global" resource until set otherwise.
+// Each entry has the record formatted with "%M" as its text payload, its level
+// as the severity and its source as the label "source".  By default the access
+// token comes from the GCE metadata server, which works on Compute Engine, GKE
+// and Cloud Run.
+//
+// Records are written in batches of up to 1000, or a second after the first of
+// a batch, split further to keep within the limits of entries.write.
+func NewStackdriverLogWriter(project, logID string, opts ...Option) *StackdriverLogWriter {
+	w := &StackdriverLogWriter{
+		httpBatcher: newHTTPBatcher("StackdriverLogWriter", "https://logging.googleapis.com/v2/entries:write", opts),
+		logName:     "projects/" + project + "/logs/" + url.PathEscape(logID),
+		resource:    map[string]interface{}{"type": "global"},
+		labels:      make(map[string]string),
+	}
+	w.format = "%M"
+	w.token = func() (string, error) {
+		return gceMetadataToken(w.client)
+	}
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go w.run(w.send)
+
+	return w
+}
+
+// The severity of lvl
+func stackdriverSeverity(lvl Level) string {
+	switch {
+	case lvl <= TRACE:
+		return "DEBUG"
+	case lvl == INFO:
+		return "INFO"
+	case lvl == WARNING:
+		return "WARNING"
+	case lvl == ERROR:
+		return "ERROR"
+	}
+	return "CRITICAL"
+}
+
+// Write a batch, in as many calls as the limits take
+func (w *StackdriverLogWriter) send(batch []*LogRecord) error {
+	token, err := w.token()
+	if err != nil {
+		return err
+	}
+
+	entries := make([]map[string]interface{}, 0, len(batch))
+	size := 0
+	for _, rec := range batch {
+		payload := string(rec.Binary)
+		if rec.Binary == nil {
+			payload = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+		}
+		if len(payload) > stackdriverMaxPayload {
+			payload = payload[:stackdriverMaxPayload]
+			for !utf8.ValidString(payload) {
+				payload = payload[:len(payload)-1]
+			}
+		}
+		if size += len(payload); size > stackdriverMaxBytes && len(entries) > 0 {
+			if err := w.write(entries, token); err != nil {
+				return err
+			}
+			entries, size = entries[:0], len(payload)
+		}
+
+		labels := make(map[string]string, len(w.labels)+1)
+		for name, value := range w.labels {
+			labels[name] = value
+		}
+		labels["source"] = rec.Source
+		entries = append(entries, map[string]interface{}{
+			"timestamp":   rec.Created.UTC().Format(time.RFC3339Nano),
+			"severity":    stackdriverSeverity(rec.Level),
+			"textPayload": payload,
+			"labels":      labels,
+		})
+	}
+	return w.write(entries, token)
+}
+
+func (w *StackdriverLogWriter) write(entries []map[string]interface{}, token string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"logName":        w.logName,
+		"resource":       w.resource,
+		"entries":        entries,
+		"partialSuccess": true,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.postHeader(body, "application/json", http.Header{
+		"Authorization": {"Bearer " + token},
+	})
+	return err
+}
+
+// Set the function that provides access tokens (chainable).  Must be called
+// before the first log message is written.
+func (w *StackdriverLogWriter) SetTokenSource(token func() (string, error)) *StackdriverLogWriter {
+	w.token = token
+	return w
+}
+
+// Set the monitored resource the entries are of (chainable), e.g. "gce_instance"
+// with its instance_id and zone.  Must be called before the first log message
+// is written.
+func (w *StackdriverLogWriter) SetResource(kind string, labels map[string]string) *StackdriverLogWriter {
+	w.resource = map[string]interface{}{"type": kind}
+	if len(labels) > 0 {
+		w.resource["labels"] = labels
+	}
+	return w
+}
+
+// Add a label to every entry (chainable).  Must be called before the first log
+// message is written.
+func (w *StackdriverLogWriter) SetLabel(name, value string) *StackdriverLogWriter {
+	w.labels[name] = value
+	return w
+}
+
+// Set an endpoint such as "http://localhost:8080" for a private endpoint or an
+// emulator (chainable).  Must be called before the first log message is
+// written.
+func (w *StackdriverLogWriter) SetEndpoint(endpoint string) *StackdriverLogWriter {
+	w.url = strings.TrimRight(endpoint, "/") + "/v2/entries:write"
+	return w
+}
+
+// Set the logging format of the text payload (chainable).  Must be called
+// before the first log message is written.
+func (w *StackdriverLogWriter) SetFormat(format string) *StackdriverLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *StackdriverLogWriter) SetFormatter(formatter Formatter) *StackdriverLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the most records written at once, and the longest the first of them
+// waits to be written (chainable).  The default is 1000 records and a second.
+// Must be called before the first log message is written.
+func (w *StackdriverLogWriter) SetBatch(size int, wait time.Duration) *StackdriverLogWriter {
+	w.batchSize, w.batchWait = size, wait
+	return w
+}
+
+// Set how many more times a call is made when Cloud Logging fails or
+// throttles, and the wait before the first retry, doubling after (chainable).
+// The default is five times, from half a second.  Must be called before the
+// first log message is written.
+func (w *StackdriverLogWriter) SetRetry(retries int, wait time.Duration) *StackdriverLogWriter {
+	w.maxRetries, w.retryWait = retries, wait
+	return w
+}
+
+// Set the timeout of each request (chainable).  The default is 30 seconds.
+// Must be called before the first log message is written.
+func (w *StackdriverLogWriter) SetTimeout(timeout time.Duration) *StackdriverLogWriter {
+	w.client.Timeout = timeout
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time a batch cannot
+// be written (chainable).  It must not log to this writer.  Must be called
+// before the first log message is written.
+func (w *StackdriverLogWriter) SetErrorHandler(handler func(error)) *StackdriverLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr when they cannot be written to
+// Cloud Logging (chainable); otherwise they are dropped.  Must be called
+// before the first log message is written.
+func (w *StackdriverLogWriter) SetStderrFallback(fallback bool) *StackdriverLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
@@ -0,0 +1,305 @@
+package log4go
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// syslogSeverities are the syslog severities of the log4go levels: debug (7)
+// up to TRACE, then informational (6), warning (4), error (3) and critical
+// (2).
+var syslogSeverities = [...]int{7, 7, 7, 7, 6, 4, 3, 2}
+
+func syslogSeverity(lvl Level) int {
+	if lvl < 0 || int(lvl) >= len(syslogSeverities) {
+		return 5 // notice
+	}
+	return syslogSeverities[lvl]
+}
+
+// The sockets the local syslog daemon may listen on
+var syslogLocalPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// This log writer sends output to syslog, locally or to a remote server, in the
+// RFC 3164 (BSD) format or, after SetRFC5424(true), the RFC 5424 one.
+type SyslogLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	network   string      // "udp", "tcp" or "tls", or "" for the local syslog
+	raddr     string      // host:port of the remote server
+	tlsConfig *tls.Config // for "tls"
+	conn      net.Conn
+	local     bool // conn is the local syslog socket
+	stream    bool // conn is a stream, rather than datagrams
+
+	tag       string // APP-NAME
+	hostname  string
+	pid       int
+	facility  int
+	rfc5424   bool
+	format    string
+	formatter Formatter // in place of format, if set
+	sd        string    // structured data, for RFC 5424
+
+	recovery writeRecovery // keeps going while the server is down
+}
+
+// This is the SyslogLogWriter's output method
+func (w *SyslogLogWriter) LogWrite(rec *LogRecord) {
+	sendRecord(w.rec, rec, w.blocking)
+}
+
+// wait for the records to be sent and close the connection
+func (w *SyslogLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewSyslogLogWriter creates a new LogWriter which sends records to syslog as
+// tag, by default the program name.  network is "udp", "tcp" or "tls" for the
+// server at raddr (host:port), or "" for the local syslog daemon, at /dev/log
+// or the like.  Records are sent as the user facility, in the RFC 3164 format
+// with "%M" as the message, until set otherwise.
+//
+// The connection is made when the first record is sent, and made again should
+// it fail.  While the server cannot be reached, records are dropped, or written
+// to stderr after SetStderrFallback; they are not sent once it can.
+func NewSyslogLogWriter(network, raddr, tag string, opts ...Option) *SyslogLogWriter {
+	o := newWriterOptions(opts)
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	hostname, _ := os.Hostname()
+
+	w := &SyslogLogWriter{
+		rec:      make(chan *LogRecord, o.bufferLength),
+		blocking: o.blocking,
+		network:  network,
+		raddr:    raddr,
+		tag:      tag,
+		hostname: hostname,
+		pid:      os.Getpid(),
+		facility: 1, // user
+		format:   "%M",
+		recovery: newWriteRecovery(),
+	}
+	w.recovery.kind = "SyslogLogWriter"
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		defer func() {
+			if w.conn != nil {
+				w.conn.Close()
+			}
+		}()
+
+		for rec := range w.rec {
+			if w.EndNotify(rec) {
+				return
+			}
+			if w.recovery.waiting(time.Now()) {
+				w.recovery.setAside(rec, w.format, w.formatter)
+				continue
+			}
+			if err := w.send(rec); err != nil {
+				w.recovery.failed(w.addr(), err, rec, w.format, w.formatter)
+				continue
+			}
+			w.recovery.succeeded(w.addr())
+		}
+	}()
+
+	return w
+}
+
+// Where records are sent, for messages
+func (w *SyslogLogWriter) addr() string {
+	if w.network == "" {
+		return "local"
+	}
+	return w.network + "://" + w.raddr
+}
+
+// Send rec, connecting first if need be, and connecting again once if the
+// connection was lost.
+func (w *SyslogLogWriter) send(rec *LogRecord) error {
+	if w.conn != nil {
+		if _, err := w.conn.Write(w.formatMessage(rec)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	// the framing depends on the connection
+	if err := w.connect(); err != nil {
+		return err
+	}
+	if _, err := w.conn.Write(w.formatMessage(rec)); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (w *SyslogLogWriter) connect() (err error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch w.network {
+	case "":
+		for _, network := range []string{"unixgram", "unix"} {
+			for _, path := range syslogLocalPaths {
+				if w.conn, err = dialer.Dial(network, path); err == nil {
+					w.local, w.stream = true, network == "unix"
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("no local syslog: %s", err)
+	case "tls":
+		w.conn, err = tls.DialWithDialer(dialer, "tcp", w.raddr, w.tlsConfig)
+		w.stream = true
+	default:
+		w.conn, err = dialer.Dial(w.network, w.raddr)
+		w.stream = !strings.HasPrefix(w.network, "udp")
+	}
+	return err
+}
+
+// Format rec as a syslog message, framed for the connection
+func (w *SyslogLogWriter) formatMessage(rec *LogRecord) []byte {
+	text := string(rec.Binary)
+	if rec.Binary == nil {
+		text = strings.TrimRight(formatRecord(w.format, w.formatter, rec), "\n")
+	}
+	pri := w.facility*8 + syslogSeverity(rec.Level)
+
+	var msg string
+	if w.rfc5424 {
+		hostname, sd := w.hostname, w.sd
+		if hostname == "" {
+			hostname = "-"
+		}
+		if sd == "" {
+			sd = "-"
+		}
+		msg = fmt.Sprintf("<%d>1 %s %s %s %d - %s %s", pri,
+			rec.Created.Format("2006-01-02T15:04:05.000000Z07:00"),
+			hostname, strings.Replace(w.tag, " ", "_", -1), w.pid, sd, text)
+	} else if w.local {
+		// the local daemon adds the hostname itself
+		msg = fmt.Sprintf("<%d>%s %s[%d]: %s", pri, rec.Created.Format(time.Stamp), w.tag, w.pid, text)
+	} else {
+		msg = fmt.Sprintf("<%d>%s %s %s[%d]: %s", pri, rec.Created.Format(time.Stamp), w.hostname, w.tag, w.pid, text)
+	}
+
+	switch {
+	case !w.stream:
+		return []byte(msg)
+	case w.rfc5424:
+		// octet counting, as in RFC 6587
+		return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+	default:
+		return []byte(msg + "\n")
+	}
+}
+
+// Set the logging format (chainable).  Must be called before the first log
+// message is written.
+func (w *SyslogLogWriter) SetFormat(format string) *SyslogLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *SyslogLogWriter) SetFormatter(formatter Formatter) *SyslogLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the syslog facility records are sent as (chainable), e.g. 1 for user,
+// 3 for daemon or 16 to 23 for local0 to local7.  Must be called before the
+// first log message is written.
+func (w *SyslogLogWriter) SetFacility(facility int) *SyslogLogWriter {
+	w.facility = facility
+	return w
+}
+
+// Set whether records are sent in the RFC 5424 format rather than the RFC 3164
+// one (chainable).  Must be called before the first log message is written.
+func (w *SyslogLogWriter) SetRFC5424(rfc5424 bool) *SyslogLogWriter {
+	w.rfc5424 = rfc5424
+	return w
+}
+
+// Set the hostname records are sent from (chainable).  The default is the
+// name of this host.  Must be called before the first log message is written.
+func (w *SyslogLogWriter) SetHostname(hostname string) *SyslogLogWriter {
+	w.hostname = hostname
+	return w
+}
+
+// Add an SD-ELEMENT, with the SD-ID id and params as its SD-PARAMs, to the
+// structured data of each record in the RFC 5424 format (chainable).  Must be
+// called before the first log message is written.
+func (w *SyslogLogWriter) AddStructuredData(id string, params map[string]string) *SyslogLogWriter {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sd := "[" + id
+	for _, name := range names {
+		sd += fmt.Sprintf(" %s=\"%s\"", name, syslogParamEscaper.Replace(params[name]))
+	}
+	w.sd += sd + "]"
+	return w
+}
+
+// The characters RFC 5424 has escaped in PARAM-VALUEs
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// Set the TLS configuration for the "tls" network (chainable).  The default
+// verifies the server against the system roots.  Must be called before the
+// first log message is written.
+func (w *SyslogLogWriter) SetTLSConfig(config *tls.Config) *SyslogLogWriter {
+	w.tlsConfig = config
+	return w
+}
+
+// Set the function called, on the writer's goroutine, each time syslog cannot
+// be reached (chainable).  It must not log to this writer.  Must be called
+// before the first log message is written.
+func (w *SyslogLogWriter) SetErrorHandler(handler func(error)) *SyslogLogWriter {
+	w.recovery.onError = handler
+	return w
+}
+
+// Set whether records are written to stderr while syslog cannot be reached
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *SyslogLogWriter) SetStderrFallback(fallback bool) *SyslogLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying syslog again after it cannot be reached
+// (chainable).  The wait doubles with each failure, up to max.  The default is
+// from one second up to a minute.  Must be called before the first log
+// message is written.
+func (w *SyslogLogWriter) SetRetryBackoff(initial, max time.Duration) *SyslogLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
@@ -0,0 +1,70 @@
+package log4go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// A TemplateFormatter writes each record with a text/template, executed on the
+// *LogRecord, for layouts the format codes cannot express:
+//
+//	f := NewTemplateFormatter(`{{.Created.Format "15:04:05.000"}} {{.Level | printf "%-4s"}} {{function .Source}}: {{.Message}}`)
+//
+// Besides the template package's own, the functions are json, quoting a value
+// as JSON; upper and lower; function, the function of a source, without the
+// line; and file, a source from after its last slash.  A newline is added
+// unless the output ends with one.  A record the template fails on is written
+// with FORMAT_DEFAULT instead.
+type TemplateFormatter struct {
+	template *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) string {
+		if s, ok := v.(fmt.Stringer); ok {
+			v = s.String()
+		}
+		if s, ok := v.(string); ok {
+			return string(appendJSONString(nil, s))
+		}
+		js, err := json.Marshal(v)
+		if err != nil {
+			return string(appendJSONString(nil, err.Error()))
+		}
+		return string(js)
+	},
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"function": sourceFunction,
+	"file": func(source string) string {
+		return source[strings.LastIndex(source, "/")+1:]
+	},
+}
+
+// NewTemplateFormatter creates a new TemplateFormatter with the template of
+// text.  It returns nil if text cannot be parsed.
+func NewTemplateFormatter(text string) *TemplateFormatter {
+	t, err := template.New("record").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "NewTemplateFormatter(%q): %s\n", text, err)
+		return nil
+	}
+	return &TemplateFormatter{template: t}
+}
+
+// Format appends rec to *buf as the template writes it.
+func (f *TemplateFormatter) Format(rec *LogRecord, buf *[]byte) {
+	out := bytes.NewBuffer(*buf)
+	start := out.Len()
+	if err := f.template.Execute(out, rec); err != nil {
+		out.Truncate(start)
+		out.WriteString(FormatLogRecord(FORMAT_DEFAULT, rec))
+	} else if out.Len() == start || out.Bytes()[out.Len()-1] != '\n' {
+		out.WriteByte('\n')
+	}
+	*buf = out.Bytes()
+}
@@ -6,39 +6,192 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"time"
 )
 
 var stdout io.Writer = os.Stdout
+var stderr io.Writer = os.Stderr
+
+// A Color is the parameters of an ANSI SGR escape sequence, e.g. "31" for red
+// or "1;31" for bold red.
+type Color string
+
+const (
+	ColorNone    Color = ""
+	ColorRed     Color = "31"
+	ColorGreen   Color = "32"
+	ColorYellow  Color = "33"
+	ColorBlue    Color = "34"
+	ColorMagenta Color = "35"
+	ColorCyan    Color = "36"
+	ColorWhite   Color = "37"
+	ColorGray    Color = "90"
+	ColorBoldRed Color = "1;31"
+)
+
+// The colors of the levels, unless set otherwise
+var defaultColors = map[Level]Color{
+	FINEST:   ColorGray,
+	FINE:     ColorGray,
+	DEBUG:    ColorCyan,
+	TRACE:    ColorBlue,
+	INFO:     ColorGreen,
+	WARNING:  ColorYellow,
+	ERROR:    ColorRed,
+	CRITICAL: ColorBoldRed,
+}
 
 // This is the standard writer that prints to standard output.
 type ConsoleLogWriter struct {
-	format string
-	w      chan *LogRecord
+	format    string
+	formatter Formatter // in place of format, if set
+	w         chan *LogRecord
+	blocking  bool // as WithBlocking sets
+
+	color     int // 1 to color the levels, -1 not to, or 0 to tell by the output
+	colors    map[Level]Color
+	colorLine bool // the whole line, not just the level
+
+	split       bool // the records at stderrLevel and above to stderr
+	stderrLevel Level
 }
 
 // This creates a new ConsoleLogWriter
-func NewConsoleLogWriter() *ConsoleLogWriter {
+func NewConsoleLogWriter(opts ...Option) *ConsoleLogWriter {
+	o := newWriterOptions(opts)
 	consoleWriter := &ConsoleLogWriter{
-		format: "[%T %D] [%L] (%S) %M",
-		w:      make(chan *LogRecord, LogBufferLength),
+		format:   "[%T %D] [%L] (%S) %M",
+		w:        make(chan *LogRecord, o.bufferLength),
+		blocking: o.blocking,
 	}
 	go consoleWriter.run(stdout)
 	return consoleWriter
 }
 func (c *ConsoleLogWriter) SetFormat(format string) {
-	c.format = format
+	c.format, c.formatter = format, nil
+}
+
+// Set the formatter of the records, in place of a format.  Must be called
+// before the first log message is written.
+func (c *ConsoleLogWriter) SetFormatter(formatter Formatter) {
+	c.formatter = formatter
 }
 func (c *ConsoleLogWriter) run(out io.Writer) {
+	// colored, if they are to be, for out and stderr
+	var outFormats, errFormats map[Level]string
 	for rec := range c.w {
-		fmt.Fprint(out, FormatLogRecord(c.format, rec))
+		dest, formats := out, &outFormats
+		if c.split && rec.Level >= c.stderrLevel {
+			dest, formats = stderr, &errFormats
+		}
+		if *formats == nil {
+			*formats = c.colorFormats(dest)
+		}
+
+		format, colored := (*formats)[rec.Level]
+		switch {
+		case !colored:
+			fmt.Fprint(dest, formatRecord(c.format, c.formatter, rec))
+		case !c.colorLine:
+			fmt.Fprint(dest, formatRecord(format, c.formatter, rec))
+		default:
+			line := formatRecord(c.format, c.formatter, rec)
+			fmt.Fprint(dest, "\x1b["+format+"m"+line[:len(line)-1]+"\x1b[0m\n")
+		}
+		releaseRecord(rec)
+	}
+}
+
+// Set the records at lvl and above to be printed to standard error rather than
+// standard output (chainable), as container platforms expect of WARNING and
+// above; FINEST prints them all there.  By default they all go to standard
+// output.  Must be called before the first log message is written.
+func (c *ConsoleLogWriter) SetStderrLevel(lvl Level) *ConsoleLogWriter {
+	c.split, c.stderrLevel = true, lvl
+	return c
+}
+
+// Set the colors of the levels (chainable), over the defaults: gray for FINEST
+// and FINE, cyan for DEBUG, blue for TRACE, green for INFO, yellow for
+// WARNING, red for ERROR and bold red for CRITICAL.  ColorNone leaves a level
+// uncolored.  Must be called before the first log message is written.
+func (c *ConsoleLogWriter) SetColors(colors map[Level]Color) *ConsoleLogWriter {
+	if c.colors == nil {
+		c.colors = make(map[Level]Color, len(defaultColors))
+		for lvl, color := range defaultColors {
+			c.colors[lvl] = color
+		}
+	}
+	for lvl, color := range colors {
+		c.colors[lvl] = color
 	}
+	return c
 }
 
-// This is the ConsoleLogWriter's output method.  This will block if the output
-// buffer is full.
+// Set whether the levels are colored whatever the output (chainable).  By
+// default they are only when standard output is a terminal and NO_COLOR is
+// empty.  Must be called before the first log message is written.
+func (c *ConsoleLogWriter) SetColor(color bool) *ConsoleLogWriter {
+	if c.color = -1; color {
+		c.color = 1
+	}
+	return c
+}
+
+// Set whether the whole line is colored as its level is, rather than the level
+// alone (chainable).  Must be called before the first log message is written.
+func (c *ConsoleLogWriter) SetColorLine(colorLine bool) *ConsoleLogWriter {
+	c.colorLine = colorLine
+	return c
+}
+
+// The %L format code, with any width and precision
+var levelCode = regexp.MustCompile(`%-?[0-9]*(\.[0-9]*)?L`)
+
+// The formats of the levels with color, with the level colored in or, coloring
+// the whole line, the color alone; none if out is not to be colored
+func (c *ConsoleLogWriter) colorFormats(out io.Writer) map[Level]string {
+	formats := make(map[Level]string)
+	if c.color < 0 || c.color == 0 && !isTerminal(out) {
+		return formats
+	}
+	colors := c.colors
+	if colors == nil {
+		colors = defaultColors
+	}
+	for lvl, color := range colors {
+		switch {
+		case color == ColorNone:
+		case c.colorLine:
+			formats[lvl] = string(color)
+		default:
+			formats[lvl] = levelCode.ReplaceAllString(c.format, "\x1b["+string(color)+"m${0}\x1b[0m")
+		}
+	}
+	return formats
+}
+
+// Whether out is a terminal to be colored: a character device, with NO_COLOR
+// empty
+func isTerminal(out io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// This is the ConsoleLogWriter's output method.  This blocks while the output
+// buffer is full, or drops the record, given WithBlocking(false).
 func (c *ConsoleLogWriter) LogWrite(rec *LogRecord) {
-	c.w <- rec
+	if !sendRecord(c.w, rec, c.blocking) {
+		releaseRecord(rec)
+	}
 }
 
 // Close stops the logger from sending messages to standard output.  Attempts to
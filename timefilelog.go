@@ -18,6 +18,7 @@ It supports:
 package log4go
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -27,6 +28,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -39,7 +41,8 @@ const (
 type TimeFileLogWriter struct {
 	LogCloser //for Elegant exit
 
-	rec chan *LogRecord
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
 
 	// The opened file
 	filename     string
@@ -47,43 +50,67 @@ type TimeFileLogWriter struct {
 	file         *os.File
 
 	// The logging format
-	format string
+	format    string
+	formatter Formatter // in place of format, if set
 
-	when        string // 'D', 'H', 'M'
+	when        string // 'D', 'H', 'M', 'W0'-'W6', 'MONTH', '15M', '4H', ...
 	backupCount int    // If backupCount is > 0, when rollover is done,
 	// no more than backupCount files are kept
+	maxTotalSize int64 // If maxTotalSize is > 0, when rollover is done,
+	// the oldest files are deleted until the rest fit in maxTotalSize bytes
+	maxAge time.Duration // If maxAge is > 0, when rollover is done,
+	// files last written more than maxAge ago are deleted
 
 	interval   int64
 	suffix     string         // suffix of log file
 	fileFilter *regexp.Regexp // for removing old log files
+	backupGlob string         // for removing old log files, overriding fileFilter
+
+	hooks rotationHooks // notified of each rollover
+	utc   bool          // compute rollover and suffix in UTC, not local time
+	perm  fileOptions   // permissions and owner of the log files
+
+	copyTruncate bool          // copy to the backup and truncate, rather than rename
+	rotateAt     time.Duration // time of day daily rollover happens at
+	sequence     bool          // number backups .1, .2, ... instead of by date
+
+	buf           *bufio.Writer // buffers writes to file, if set
+	flushInterval time.Duration // longest a buffered record waits to be written
+	flushed       chan bool     // signalled when Flush has been done
+	recovery      writeRecovery // keeps going when the file cannot be written
+
+	header, footer func() string // lines written when a file is opened and closed
+	encrypt        *logSealer    // encrypts what is written, if set
+	audit          *auditChain   // chains an HMAC to each record, if set
+
+	lock        *rotationLock // shared with other processes writing the file, if set
+	lockChecked time.Time     // when the file was last checked for being moved away
 
 	rolloverAt     int64 // time.Unix()
 	firstRollover  bool  // the flag of first Rollover
 	externalWriter []io.Writer
 }
 
-// This is the FileLogWriter's output method
+// This is the TimeFileLogWriter's output method.  This blocks while the
+// output buffer is full, or drops the record, given WithBlocking(false).
 func (w *TimeFileLogWriter) LogWrite(rec *LogRecord) {
-	if !LogWithBlocking {
-		if len(w.rec) >= LogBufferLength {
-			fmt.Println("ERR_TIMEFILE_LOG_OVERFLOW", LogBufferLength)
-			//            if WithModuleState {
-			//                log4goState.Inc("ERR_TIMEFILE_LOG_OVERFLOW", 1)
-			//            }
-			return
-		}
+	if !sendRecord(w.rec, rec, w.blocking) {
+		releaseRecord(rec)
 	}
-
-	w.rec <- rec
 }
 
-//wait for dump all log and close chan
+// wait for dump all log and close chan
 func (w *TimeFileLogWriter) Close() {
+	unregisterReopener(w)
 	w.WaitForEnd(w.rec)
 	close(w.rec)
 }
 
 func (w *TimeFileLogWriter) computeRollover(currTime time.Time) int64 {
+	if result, ok := calendarRollover(w.when, w.inZone(currTime), w.rotateAt); ok {
+		w.firstRollover = false
+		return result
+	}
 	if w.firstRollover == true {
 		w.firstRollover = false
 		return (currTime.Unix()/w.interval + 1) * w.interval
@@ -91,7 +118,7 @@ func (w *TimeFileLogWriter) computeRollover(currTime time.Time) int64 {
 	var result int64
 
 	if w.when == "MIDNIGHT" {
-		t := currTime.Local()
+		t := w.inZone(currTime)
 		/* r is the number of seconds left between now and midnight */
 		r := MIDNIGHT - ((t.Hour()*60+t.Minute())*60 + t.Second())
 		result = currTime.Unix() + int64(r)
@@ -101,6 +128,84 @@ func (w *TimeFileLogWriter) computeRollover(currTime time.Time) int64 {
 	return result
 }
 
+/*
+* calendarRollover - computes the next rollover after t for the intervals that
+* are not a fixed number of seconds
+*
+* As in python logging, "W0"-"W6" roll over at the midnight which ends the
+* given weekday (0 is Monday); "MONTH" rolls over at midnight on the first.
+* at moves the rollover from midnight to that time of day, and also makes
+* "D" and "MIDNIGHT" calendar intervals.  "15M", "4H", ... roll over every so
+* many minutes or hours counted from midnight (then from at, which also
+* offsets "H" and "M").  ok is false for any other "when".
+ */
+func calendarRollover(when string, t time.Time, at time.Duration) (result int64, ok bool) {
+	// shift t so the day starts at at, then find the next midnight
+	t = t.Add(-at)
+
+	// every so often, counting from midnight
+	if every, ok := whenInterval(when); ok || at != 0 && (when == "H" || when == "M") {
+		if !ok {
+			every = map[string]int64{"H": 60 * 60, "M": 60}[when]
+		}
+		_, offset := t.Zone()
+		local := t.Unix() + int64(offset)
+		return (local/every+1)*every - int64(offset) + int64(at/time.Second), true
+	}
+
+	var next time.Time
+	switch {
+	case (when == "D" || when == "MIDNIGHT") && at != 0:
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	case when == "MONTH":
+		next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+	case len(when) == 2 && when[0] == 'W' && when[1] >= '0' && when[1] <= '6':
+		day := time.Weekday((when[1] - '0' + 1) % 7)
+		last := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		for last.Weekday() != day {
+			last = last.AddDate(0, 0, 1)
+		}
+		next = last.AddDate(0, 0, 1)
+	default:
+		return 0, false
+	}
+	return next.Add(at).Unix(), true
+}
+
+// whenInterval returns the length in seconds of a when such as "15M", "4H" or
+// "2D", a number of minutes, hours or days.
+func whenInterval(when string) (int64, bool) {
+	i := 0
+	for i < len(when) && when[i] >= '0' && when[i] <= '9' {
+		i++
+	}
+	n, err := strconv.Atoi(when[:i])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	switch when[i:] {
+	case "M":
+		return int64(n) * 60, true
+	case "H":
+		return int64(n) * 60 * 60, true
+	case "D":
+		return int64(n) * 60 * 60 * 24, true
+	}
+	return 0, false
+}
+
+// intervalSuffix returns the backup suffix, and the regexp matching it, precise
+// enough to tell apart the backups of an interval of that many seconds.
+func intervalSuffix(interval int64) (suffix, regRule string) {
+	switch {
+	case interval%(60*60*24) == 0:
+		return "%Y-%m-%d", `^\d{4}-\d{2}-\d{2}$`
+	case interval%(60*60) == 0:
+		return "%Y%m%d%H", `^\d{10}$`
+	}
+	return "%Y-%m-%d_%H-%M", `^\d{4}-\d{2}-\d{2}_\d{2}-\d{2}$`
+}
+
 /* prepare according to "when"  */
 func (w *TimeFileLogWriter) prepare() {
 	var regRule string
@@ -118,25 +223,42 @@ func (w *TimeFileLogWriter) prepare() {
 		w.interval = 60 * 60 * 24
 		w.suffix = "%Y-%m-%d"
 		regRule = `^\d{4}-\d{2}-\d{2}$`
+	case "W0", "W1", "W2", "W3", "W4", "W5", "W6":
+		w.interval = 60 * 60 * 24 * 7
+		w.suffix = "%Y-%m-%d"
+		regRule = `^\d{4}-\d{2}-\d{2}$`
+	case "MONTH":
+		w.interval = 60 * 60 * 24 * 31
+		w.suffix = "%Y-%m"
+		regRule = `^\d{4}-\d{2}$`
 	default:
 		// default is "D"
 		w.interval = 60 * 60 * 24
 		w.suffix = "%Y-%m-%d"
 		regRule = `^\d{4}-\d{2}-\d{2}$`
 	}
+	if interval, ok := whenInterval(w.when); ok {
+		w.interval = interval
+		w.suffix, regRule = intervalSuffix(interval)
+	}
 	w.fileFilter = regexp.MustCompile(regRule)
+	w.startRollover()
+}
 
-	fInfo, err := os.Stat(w.filename)
-
-	var t time.Time
-	if err == nil {
+// Set the first rollover, the next after the log file was last written, or
+// after now if there is none
+func (w *TimeFileLogWriter) startRollover() {
+	t := time.Now()
+	if fInfo, err := os.Stat(w.filename); err == nil {
 		t = fInfo.ModTime()
-	} else {
-		t = time.Now()
 	}
 
 	w.firstRollover = true
-	w.rolloverAt = (t.Unix()/w.interval + 1) * w.interval
+	if at, ok := calendarRollover(w.when, w.inZone(t), w.rotateAt); ok {
+		w.rolloverAt = at
+	} else {
+		w.rolloverAt = (t.Unix()/w.interval + 1) * w.interval
+	}
 }
 
 func (w *TimeFileLogWriter) shouldRollover() bool {
@@ -156,6 +278,9 @@ func (w *TimeFileLogWriter) shouldRollover() bool {
 *       "H", hour
 *       "D", day
 *       "MIDNIGHT", roll over at midnight
+*       "W0"-"W6", roll over at the midnight ending the weekday (0=Monday)
+*       "MONTH", roll over at midnight on the first of the month
+*       "15M", "4H", "2D", ..., every so many minutes, hours or days
 *   - backupCount: If backupCount is > 0, when rollover is done, no more than
 *       backupCount files are kept - the oldest ones are deleted.
 *
@@ -163,15 +288,20 @@ func (w *TimeFileLogWriter) shouldRollover() bool {
 *   pointer to TimeFileLogWriter, if succeed
 *   nil, if fail
  */
-func NewTimeFileLogWriter(fname string, when string, backupCount int) *TimeFileLogWriter {
+func NewTimeFileLogWriter(fname string, when string, backupCount int, opts ...Option) *TimeFileLogWriter {
 	when = strings.ToUpper(when)
 
+	o := newWriterOptions(opts)
 	w := &TimeFileLogWriter{
-		rec:         make(chan *LogRecord, LogBufferLength),
-		filename:    fname,
-		format:      "[%D %T] [%L] (%S) %M",
-		when:        when,
-		backupCount: backupCount,
+		rec:           make(chan *LogRecord, o.bufferLength),
+		blocking:      o.blocking,
+		filename:      fname,
+		format:        "[%D %T] [%L] (%S) %M",
+		when:          when,
+		backupCount:   backupCount,
+		flushInterval: time.Second,
+		flushed:       make(chan bool),
+		recovery:      newWriteRecovery(),
 	}
 
 	//init LogCloser
@@ -185,6 +315,11 @@ func NewTimeFileLogWriter(fname string, when string, backupCount int) *TimeFileL
 		w.baseFilename = path
 	}
 
+	// finish a rotation cut short by a crash
+	if err := adoptOrphan(w.filename); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+
 	// prepare for w.interval, w.suffix and w.fileFilter
 	w.prepare()
 
@@ -195,50 +330,120 @@ func NewTimeFileLogWriter(fname string, when string, backupCount int) *TimeFileL
 	}
 
 	go func() {
+		// ticks while there are buffered records
+		var flushTick <-chan time.Time
+		unflushed := false
+
 		defer func() {
 			if w.file != nil {
+				w.flushBuffer()
+				writeHeadFootLine(w.wrapOutput(w.file), w.footer)
+				w.audit.seal(w.encrypt.wrap(w.file))
 				w.file.Close()
 			}
 		}()
 
 		for {
 			select {
+			case <-flushTick:
+				if unflushed {
+					w.flushBuffer()
+					unflushed = false
+				}
 			case rec, ok := <-w.rec:
 				if !ok {
 					return
 				}
 
+				if rec == flushRecord {
+					w.flushBuffer()
+					unflushed = false
+					w.flushed <- true
+					continue
+				}
+				if rec == reopenRecord {
+					if err := w.reopen(); err != nil {
+						w.recovery.failed(w.filename, err, nil, "", nil)
+					}
+					continue
+				}
+
 				if w.EndNotify(rec) {
 					return
 				}
 
-				if w.shouldRollover() {
+				if w.recovery.waiting(time.Now()) {
+					w.recovery.setAside(rec, w.format, w.formatter)
+					continue
+				}
+
+				// a failed file, or one another process rolled over, is
+				// reopened, rolling it over if due
+				if w.recovery.failing || w.shouldRollover() || w.movedAway() {
 					if err := w.intRotate(); err != nil {
-						fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-						return
+						w.recovery.failed(w.filename, err, rec, w.format, w.formatter)
+						continue
 					}
 				}
 
 				// Perform the write
 				var err error
 				if rec.Binary != nil {
-					_, err = w.file.Write(rec.Binary)
+					_, err = w.output().Write(rec.Binary)
 				} else {
-					_, err = fmt.Fprint(w.file, FormatLogRecord(w.format, rec))
+					_, err = fmt.Fprint(w.output(), formatRecord(w.format, w.formatter, rec))
 				}
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
-					return
+					w.recovery.failed(w.filename, err, rec, w.format, w.formatter)
+					continue
+				}
+				w.recovery.succeeded(w.filename)
+
+				if w.buf != nil && w.flushInterval > 0 {
+					unflushed = true
+					if flushTick == nil {
+						ticker := time.NewTicker(w.flushInterval)
+						defer ticker.Stop()
+						flushTick = ticker.C
+					}
 				}
 			}
 		}
 	}()
 
+	o.setup(w)
+	registerReopener(w)
 	return w
 }
 
+// NewTimeFileWriter creates a new TimeFileLogWriter writing to fname, set up
+// by the options, such as WithRotateWhen, WithMaxBackup and WithFormat, as
+// NewTimeFileLogWriter and its setters do; rolled over at midnight and keeping
+// all the old files by default.  It returns nil if the file cannot be opened.
+func NewTimeFileWriter(fname string, opts ...Option) *TimeFileLogWriter {
+	return NewTimeFileLogWriter(fname, optionsWhen(opts), 0, opts...)
+}
+
+// When the options roll a file over, "D" if they do not say
+func optionsWhen(opts []Option) string {
+	if when := newWriterOptions(opts).when; when != "" {
+		return when
+	}
+	return "D"
+}
+
 /* Determine the files to delete when rolling over  */
 func (w *TimeFileLogWriter) getFilesToDelete() []string {
+	if w.backupGlob != "" {
+		result := []string{}
+		backups := w.backups()
+		for len(backups) > w.backupCount {
+			result = append(result, backups[0].path)
+			backups = backups[1:]
+		}
+		return result
+	}
+
 	dirName := filepath.Dir(w.baseFilename)
 	baseName := filepath.Base(w.baseFilename)
 
@@ -281,50 +486,80 @@ func (w *TimeFileLogWriter) moveToBackup() error {
 	_, err := os.Lstat(w.filename)
 	if err == nil { // file exists
 		// get the time that this sequence started at and make it a TimeTuple
-		t := time.Unix(w.rolloverAt-w.interval, 0).Local()
+		t := w.inZone(time.Unix(w.rolloverAt-w.interval, 0))
+		if w.when == "MONTH" {
+			// months vary in length, so use the last second of the sequence
+			t = w.inZone(time.Unix(w.rolloverAt-1, 0).Add(-w.rotateAt))
+		}
 		fname := w.baseFilename + "." + Format(w.suffix, t)
+		if w.sequence {
+			fname = w.baseFilename + ".1"
+			if err := shiftBackups(w.baseFilename, w.backupCount); err != nil {
+				return err
+			}
+		}
+		w.hooks.before(w.baseFilename)
 		// do nothing if exist
 		if _, err := os.Stat(fname); err == nil {
 			b, err := ioutil.ReadFile(w.baseFilename)
 			if err == nil && len(b) > 0 {
 				ioutil.WriteFile(fname, b, 0644)
-				os.Remove(w.baseFilename)
+				if w.copyTruncate {
+					os.Truncate(w.baseFilename, 0)
+				} else {
+					os.Remove(w.baseFilename)
+				}
 			}
 
-			go compressFile(fname+".gz", fname)
+			go w.compressBackup(fname)
 			return nil
 		}
 
 		// Rename the file to its newfound home
-		err = os.Rename(w.baseFilename, fname)
+		if w.copyTruncate {
+			err = copyTruncate(w.baseFilename, fname)
+		} else {
+			err = os.Rename(w.baseFilename, fname)
+		}
 		if err != nil {
 			return err
 		}
-		go compressFile(fname+".gz", fname)
+		go w.compressBackup(fname)
 	}
 	return nil
 }
 
-func compressFile(out string, in string) error {
-	os.Remove(out)
-	nf, err := os.Create(out)
-	if err != nil {
-		return err
+/* gzip a backup, then tell the hooks where it ended up */
+func (w *TimeFileLogWriter) compressBackup(fname string) {
+	compressFile(fname+".gz", fname)
+	if _, err := os.Stat(fname); err != nil {
+		fname = fname + ".gz"
+		w.perm.apply(fname)
 	}
-	defer nf.Close()
+	w.hooks.after(fname, w.filename)
+}
 
+func compressFile(out string, in string) error {
+	os.Remove(out)
 	file, err := os.Open(in)
 	if err != nil {
 		return err
 	}
 
-	zw := gzip.NewWriter(nf)
-
 	filestat, err := file.Stat()
 	if err != nil {
 		return nil
 	}
 
+	// the compressed file gets the same permissions as the log
+	nf, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filestat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer nf.Close()
+
+	zw := gzip.NewWriter(nf)
+
 	zw.Name = filestat.Name()
 	zw.ModTime = filestat.ModTime()
 	_, err = io.Copy(zw, file)
@@ -359,34 +594,97 @@ func (w *TimeFileLogWriter) adjustRolloverAt() {
 
 // If this is called in a threaded context, it MUST be synchronized
 func (w *TimeFileLogWriter) intRotate() error {
-	// Close any log file that may be open
-	if w.file != nil {
-		w.file.Close()
-	}
-
 	if w.shouldRollover() {
-		// rename file to backup name
-		if err := w.moveToBackup(); err != nil {
+		// roll over, unless another process just did
+		moved := true
+		var err error
+		if w.lock != nil {
+			moved, err = w.lock.rotate(w.rollFile)
+		} else {
+			err = w.rollFile()
+		}
+		if err != nil {
 			return err
 		}
+		if !moved {
+			if err := w.reopen(); err != nil {
+				return err
+			}
+		}
+	} else if err := w.reopen(); err != nil {
+		return err
 	}
 
-	// remove files, according to backupCount
-	if w.backupCount > 0 {
+	// remove files, according to backupCount (shifting handles sequences)
+	if w.backupCount > 0 && !w.sequence {
 		for _, fileName := range w.getFilesToDelete() {
 			os.Remove(fileName)
 			os.Remove(fileName + ".gz")
 		}
 	}
 
+	// remove the old files, according to maxAge
+	if w.maxAge > 0 {
+		removeBackupsOlderThan(w.backups(), w.maxAge)
+	}
+
+	// remove the oldest files, according to maxTotalSize
+	if w.maxTotalSize > 0 {
+		removeBackupsOverSize(w.backups(), w.maxTotalSize)
+	}
+
 	//w.filename = w.baseFilename + "." + strftime.Format(w.suffix, time.Now())
 
-	// Open the log file
-	fd, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	// adjust rolloverAt
+	w.adjustRolloverAt()
+
+	return nil
+}
+
+// Move the log file to its backup and open the next one, the next one first
+// so that a failure part way leaves a file to log to.  If this is called in a
+// threaded context, it MUST be synchronized
+func (w *TimeFileLogWriter) rollFile() error {
+	if w.copyTruncate {
+		w.closeFile()
+		if err := w.moveToBackup(); err != nil {
+			return err
+		}
+		return w.openFile()
+	}
+
+	fd, err := rollOver(w.filename, w.openLog, func() error {
+		w.closeFile()
+		return w.moveToBackup()
+	})
+	if err != nil {
+		return err
+	}
+	w.setFile(fd)
+	return nil
+}
+
+// Open the log file, w.file being closed
+func (w *TimeFileLogWriter) openFile() error {
+	fd, err := w.openLog(w.filename)
 	if err != nil {
 		return err
 	}
+	w.setFile(fd)
+	return nil
+}
+
+func (w *TimeFileLogWriter) openLog(name string) (*os.File, error) {
+	return w.perm.open(name, 0644)
+}
+
+// Log to fd, newly opened
+func (w *TimeFileLogWriter) setFile(fd *os.File) {
 	w.file = fd
+	if w.buf != nil {
+		w.buf.Reset(fd)
+	}
+	writeHeadFootLine(w.wrapOutput(w.file), w.header)
 	if strings.Contains(w.filename, ".log.wf") {
 		if os.Getenv("LOGGER_MODE") != "debug" {
 			os.Stdout = fd
@@ -394,16 +692,327 @@ func (w *TimeFileLogWriter) intRotate() error {
 			log.SetOutput(fd)
 		}
 	}
+}
 
-	// adjust rolloverAt
-	w.adjustRolloverAt()
+// Set the function called, on the writer's goroutine, each time the file
+// cannot be opened or written (chainable).  It must not log to this writer.
+// Must be called before the first log message is written.
+func (w *TimeFileLogWriter) SetErrorHandler(handler func(error)) *TimeFileLogWriter {
+	w.recovery.onError = handler
+	return w
+}
 
-	return nil
+// Set whether records are written to stderr while the file cannot be written
+// (chainable); otherwise they are dropped.  Must be called before the first
+// log message is written.
+func (w *TimeFileLogWriter) SetStderrFallback(fallback bool) *TimeFileLogWriter {
+	w.recovery.fallback = fallback
+	return w
+}
+
+// Set how long to wait before trying the file again after it fails
+// (chainable).  The wait doubles with each failure, up to max.  The default is
+// from one second up to a minute.  The records logged meanwhile are dropped, or
+// written to stderr after SetStderrFallback, not written once the file can be.
+// Must be called before the first log message is written.
+func (w *TimeFileLogWriter) SetRetryBackoff(initial, max time.Duration) *TimeFileLogWriter {
+	w.recovery.minWait, w.recovery.maxWait = initial, max
+	return w
+}
+
+// Set a function giving a line, such as the build version or column names, to
+// write at the top of each file when it is opened (chainable).  Must be called
+// before the first log message is written.
+func (w *TimeFileLogWriter) SetHeader(header func() string) *TimeFileLogWriter {
+	w.header = header
+	writeHeadFootLine(w.wrapOutput(w.file), w.header)
+	return w
+}
+
+// Set a function giving a line to write at the end of each file when it is
+// rolled over or closed (chainable).  Must be called before the first log
+// message is written.
+func (w *TimeFileLogWriter) SetFooter(footer func() string) *TimeFileLogWriter {
+	w.footer = footer
+	return w
+}
+
+// Reopen closes the log file and opens it again under the same name, once the
+// records logged so far are written, without rolling it over.  Use it after
+// an outside tool such as logrotate has moved the file away.
+func (w *TimeFileLogWriter) Reopen() {
+	w.rec <- reopenRecord
+}
+
+// Close the file and open it again, without rolling over.  If this is called
+// in a threaded context, it MUST be synchronized
+func (w *TimeFileLogWriter) reopen() error {
+	w.closeFile()
+	return w.openFile()
+}
+
+// Close the file, if it is open.  If this is called in a threaded context, it
+// MUST be synchronized
+func (w *TimeFileLogWriter) closeFile() {
+	if w.file != nil {
+		w.flushBuffer()
+		writeHeadFootLine(w.wrapOutput(w.file), w.footer)
+		w.audit.seal(w.encrypt.wrap(w.file))
+		w.file.Close()
+		w.file = nil
+	}
+}
+
+// Flush writes out the records buffered so far, returning once they have been
+// written.
+func (w *TimeFileLogWriter) Flush() {
+	w.rec <- flushRecord
+	<-w.flushed
+}
+
+// Where records are written: the buffer, if any, else the file
+func (w *TimeFileLogWriter) output() io.Writer {
+	if w.buf != nil {
+		return w.wrapOutput(w.buf)
+	}
+	return w.wrapOutput(w.file)
+}
+
+// Encrypt and audit what is written to out, as set
+func (w *TimeFileLogWriter) wrapOutput(out io.Writer) io.Writer {
+	return w.audit.wrap(w.encrypt.wrap(out))
+}
+
+func (w *TimeFileLogWriter) flushBuffer() {
+	if w.buf != nil && !w.recovery.failing {
+		if err := w.buf.Flush(); err != nil {
+			w.recovery.failed(w.filename, err, nil, "", nil)
+		}
+	}
 }
 
 // Set the logging format (chainable).  Must be called before the first log
 // message is written.
 func (w *TimeFileLogWriter) SetFormat(format string) *TimeFileLogWriter {
-	w.format = format
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *TimeFileLogWriter) SetFormatter(formatter Formatter) *TimeFileLogWriter {
+	w.formatter = formatter
+	return w
+}
+
+// Set the max combined size in bytes of the backup files (chainable).  When
+// rollover is done, the oldest backups are deleted until the rest fit under
+// the cap.  Zero means no cap.
+func (w *TimeFileLogWriter) SetMaxTotalSize(maxTotalSize int64) *TimeFileLogWriter {
+	w.maxTotalSize = maxTotalSize
+	return w
+}
+
+// Encrypt the log files with AES-GCM, using the key keys gives (chainable).
+// Each record is written as a block of its own, which DecryptLog turns back
+// into text.  Should keys give no usable key, nothing is written rather than
+// written in the clear.  Must be called before the first log message is
+// written, and before SetHeader, on a file not yet holding plain text.  What
+// the process prints to a .log.wf file it takes over stdout for is not
+// encrypted.
+func (w *TimeFileLogWriter) SetEncryption(keys KeyProvider) *TimeFileLogWriter {
+	w.encrypt = newLogSealer(keys)
+	if w.encrypt.err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, w.encrypt.err)
+	}
+	return w
+}
+
+// Make the log an audit log, ending each record, header and footer in an
+// HMAC-SHA256 keyed with key and chained to the one before (chainable), so
+// that VerifyLogFile can tell if the file was modified or truncated.  The
+// chain is sealed when the file rolls over or is closed.  Must be called
+// before the first log message is written, and before SetHeader, on a file
+// not yet holding records.
+func (w *TimeFileLogWriter) SetAudit(key []byte) *TimeFileLogWriter {
+	w.audit = &auditChain{key: key}
+	return w
+}
+
+// Set the max age of the backup files (chainable).  When rollover is done,
+// backups last written more than maxAge ago are deleted.  Zero means keep
+// them regardless of age.
+func (w *TimeFileLogWriter) SetMaxAge(maxAge time.Duration) *TimeFileLogWriter {
+	w.maxAge = maxAge
+	return w
+}
+
+// Add a hook to be notified of each rollover (chainable).  Must be called
+// before the first log message is written.  Backups are gzipped in the
+// background, so OnAfterRotate is called from that goroutine with the name of
+// the .gz file once it is complete.
+func (w *TimeFileLogWriter) AddRotationHook(hook RotationHook) *TimeFileLogWriter {
+	w.hooks = append(w.hooks, hook)
 	return w
 }
+
+// Compute rollover times and backup suffixes in UTC instead of local time
+// (chainable).  Must be called before the first log message is written.
+func (w *TimeFileLogWriter) SetUTC(utc bool) *TimeFileLogWriter {
+	w.utc = utc
+	if _, ok := calendarRollover(w.when, time.Now(), w.rotateAt); ok || w.when == "MIDNIGHT" {
+		w.startRollover()
+	}
+	return w
+}
+
+/* convert t to the zone rollover is computed in    */
+func (w *TimeFileLogWriter) inZone(t time.Time) time.Time {
+	if w.utc {
+		return t.UTC()
+	}
+	return t.Local()
+}
+
+// Set the permissions of the log files (chainable).  The mode is applied with
+// chmod, so the umask does not change it.  Must be called before the first
+// log message is written.
+func (w *TimeFileLogWriter) SetFileMode(mode os.FileMode) *TimeFileLogWriter {
+	w.perm.mode = mode
+	if err := w.perm.apply(w.filename); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+	return w
+}
+
+// Set the owner of the log files (chainable).  A uid or gid of -1 is left
+// unchanged.  Must be called before the first log message is written.
+func (w *TimeFileLogWriter) SetFileOwner(uid, gid int) *TimeFileLogWriter {
+	w.perm.chown, w.perm.uid, w.perm.gid = true, uid, gid
+	if err := w.perm.apply(w.filename); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): %s\n", w.filename, err)
+	}
+	return w
+}
+
+// SetCopyTruncate makes rollover copy the log to its backup and truncate it in
+// place, rather than rename it and open a new file (chainable).  Use it when
+// other processes hold the log file open.  Must be called before the first log
+// message is written.
+func (w *TimeFileLogWriter) SetCopyTruncate(copyTruncate bool) *TimeFileLogWriter {
+	w.copyTruncate = copyTruncate
+	return w
+}
+
+// Roll over at hour:minute instead of midnight (chainable).  It applies to the
+// "D", "MIDNIGHT", "W0"-"W6" and "MONTH" intervals, and offsets "H", "M" and
+// the "4H"-style intervals: with "H", SetRotateAt(0, 30) rolls over at half
+// past every hour.  Must be called before the first log message is written.
+func (w *TimeFileLogWriter) SetRotateAt(hour, minute int) *TimeFileLogWriter {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): invalid rotate time %02d:%02d\n", w.filename, hour, minute)
+		return w
+	}
+	w.rotateAt = time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+	w.startRollover()
+	return w
+}
+
+// Set how backups are named (chainable): "date" (the default) suffixes them
+// with the time of their sequence, "sequence" numbers them .1 (the newest),
+// .2, ... shifting them all on every rollover.  Must be called before the
+// first log message is written.
+func (w *TimeFileLogWriter) SetRotationScheme(scheme string) *TimeFileLogWriter {
+	switch scheme {
+	case "date":
+		w.sequence = false
+	case "sequence":
+		w.sequence = true
+	default:
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): unknown rotation scheme %q\n", w.filename, scheme)
+	}
+	return w
+}
+
+// Buffer up to size bytes of records rather than writing each one to the file
+// as it comes (chainable).  The buffer is written out when full, every flush
+// interval, on Flush, rollover and Close.  Zero turns buffering off.  Must be
+// called before the first log message is written.
+func (w *TimeFileLogWriter) SetBufferSize(size int) *TimeFileLogWriter {
+	w.flushBuffer()
+	if size > 0 {
+		w.buf = bufio.NewWriterSize(w.file, size)
+	} else {
+		w.buf = nil
+	}
+	return w
+}
+
+// Set how long a buffered record may wait before it is written (chainable).
+// The default is one second; zero waits for the buffer to fill.  Must be
+// called before the first log message is written.
+func (w *TimeFileLogWriter) SetFlushInterval(flushInterval time.Duration) *TimeFileLogWriter {
+	w.flushInterval = flushInterval
+	return w
+}
+
+// Set whether the log file is shared with other processes (chainable).  They
+// then coordinate through an advisory lock on the file name + ".lock", so
+// that only the first of them to reach a rollover moves the file aside, and
+// the rest reopen the new file within a second.  Every process should use the
+// same settings, and no buffering, which could split records.  Must be called
+// before the first log message is written.
+func (w *TimeFileLogWriter) SetMultiProcess(shared bool) *TimeFileLogWriter {
+	if shared {
+		w.lock = &rotationLock{path: w.baseFilename + ".lock"}
+	} else {
+		w.lock = nil
+	}
+	return w
+}
+
+// In multi-process mode, report whether the log file was moved away since it
+// was opened, checking at most once a second.
+func (w *TimeFileLogWriter) movedAway() bool {
+	if w.lock == nil || time.Since(w.lockChecked) < time.Second {
+		return false
+	}
+	w.lockChecked = time.Now()
+
+	cur, err := w.file.Stat()
+	if err != nil {
+		return false
+	}
+	fi, err := os.Stat(w.filename)
+	return err != nil || !os.SameFile(fi, cur)
+}
+
+// Set a shell pattern (as in filepath.Match) picking out the backup files
+// that rollover may delete, among the files in the log's directory
+// (chainable), e.g. "app.log.*.zst" for backups compressed by a hook.  The
+// default takes the names the suffix gives backups, optionally gzipped.  Must
+// be called before the first log message is written.
+func (w *TimeFileLogWriter) SetBackupGlob(pattern string) *TimeFileLogWriter {
+	if err := checkBackupGlob(pattern); err != nil {
+		fmt.Fprintf(os.Stderr, "FileLogWriter(%q): backup glob %q: %s\n", w.filename, pattern, err)
+		return w
+	}
+	w.backupGlob = pattern
+	return w
+}
+
+// The backups rollover may delete, oldest first
+func (w *TimeFileLogWriter) backups() []backupFile {
+	if w.backupGlob != "" {
+		return globBackups(w.baseFilename, w.backupGlob)
+	}
+	return listBackups(w.baseFilename, w.backupFilter().MatchString)
+}
+
+/* the filter matching the suffixes of this writer's backups    */
+func (w *TimeFileLogWriter) backupFilter() *regexp.Regexp {
+	if w.sequence {
+		return sequenceFilter
+	}
+	return w.fileFilter
+}
@@ -0,0 +1,108 @@
+package log4go
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// A Field is a field of a record, to be logged after the arguments of its
+// message as Fields are, and typed for its constructor, so that the common
+// types are written without reflection or fmt:
+//
+//	log.Info("served %s", path, String("user", id), Duration("latency", d))
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns the field of key with a string value.
+func String(key, value string) Field { return Field{Key: key, Value: value} }
+
+// Int returns the field of key with an int value.
+func Int(key string, value int) Field { return Field{Key: key, Value: value} }
+
+// Int64 returns the field of key with an int64 value.
+func Int64(key string, value int64) Field { return Field{Key: key, Value: value} }
+
+// Uint64 returns the field of key with a uint64 value.
+func Uint64(key string, value uint64) Field { return Field{Key: key, Value: value} }
+
+// Float64 returns the field of key with a float64 value.
+func Float64(key string, value float64) Field { return Field{Key: key, Value: value} }
+
+// Bool returns the field of key with a bool value.
+func Bool(key string, value bool) Field { return Field{Key: key, Value: value} }
+
+// Duration returns the field of key with a time.Duration value, written as
+// its text, or as nanoseconds in JSON.
+func Duration(key string, value time.Duration) Field { return Field{Key: key, Value: value} }
+
+// Time returns the field of key with a time.Time value.
+func Time(key string, value time.Time) Field { return Field{Key: key, Value: value} }
+
+// Err returns the field "error" with err, as ErrorWithErr logs it.
+func Err(err error) Field { return Field{Key: errorField, Value: err} }
+
+// Any returns the field of key with a value of any type, written with fmt or
+// encoding/json if it is none of the types above.
+func Any(key string, value interface{}) Field { return Field{Key: key, Value: value} }
+
+// Append the text of a value of one of the common types to b, as fmt.Sprint
+// writes it, and whether it is one
+func appendTypedText(b []byte, value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case int:
+		return strconv.AppendInt(b, int64(v), 10), true
+	case int64:
+		return strconv.AppendInt(b, v, 10), true
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10), true
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10), true
+	case uint64:
+		return strconv.AppendUint(b, v, 10), true
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10), true
+	case float64:
+		return strconv.AppendFloat(b, v, 'g', -1, 64), true
+	case bool:
+		return strconv.AppendBool(b, v), true
+	case time.Duration:
+		return append(b, v.String()...), true
+	case time.Time:
+		return append(b, v.String()...), true
+	}
+	return b, false
+}
+
+// Append a value of one of the common types to b as JSON, as encoding/json
+// writes it, or a float it cannot as its text, and whether it is one
+func appendTypedJSON(b []byte, value interface{}) ([]byte, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return strconv.AppendInt(b, int64(v), 10), true
+	case time.Time:
+		if y := v.Year(); y < 0 || y > 9999 {
+			return b, false
+		}
+		b = append(b, '"')
+		return append(v.AppendFormat(b, time.RFC3339Nano), '"'), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return appendJSONString(b, strconv.FormatFloat(v, 'g', -1, 64)), true
+		}
+		format := byte('f')
+		if abs := math.Abs(v); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+			format = 'e'
+		}
+		b = strconv.AppendFloat(b, v, format, -1, 64)
+		if n := len(b); format == 'e' && n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			// e-07 as e-7, as encoding/json has it
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+		return b, true
+	}
+	return appendTypedText(b, value)
+}
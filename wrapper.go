@@ -22,6 +22,21 @@ func LoadConfiguration(filename string) {
 	Global.LoadConfiguration(filename)
 }
 
+// Wrapper for (*Logger).LoadConfigurationYAML
+func LoadConfigurationYAML(filename string) {
+	Global.LoadConfigurationYAML(filename)
+}
+
+// Wrapper for (*Logger).LoadConfigurationJSON
+func LoadConfigurationJSON(filename string) {
+	Global.LoadConfigurationJSON(filename)
+}
+
+// Wrapper for (*Logger).WatchConfiguration
+func WatchConfiguration(filename string) *ConfigWatcher {
+	return Global.WatchConfiguration(filename)
+}
+
 // Wrapper for (*Logger).AddFilter
 func AddFilter(name string, lvl Level, writer LogWriter) {
 	Global.AddFilter(name, lvl, writer)
@@ -32,9 +47,24 @@ func Close() {
 	Global.Close()
 }
 
+// Wrapper for (*Logger).With
+func With(fields Fields) Logger {
+	return Global.With(fields)
+}
+
+// Wrapper for (*Logger).DumpConfig
+func DumpConfig() *Configuration {
+	return Global.DumpConfig()
+}
+
+// Wrapper for (*Logger).GetLogger
+func GetLogger(name string) Logger {
+	return Global.GetLogger(name)
+}
+
 func Crash(args ...interface{}) {
-	if len(args) > 0 {
-		Global.intLogf(CRITICAL, strings.Repeat(" %v", len(args))[1:], args...)
+	if argCount(args) > 0 {
+		Global.intLogf(CRITICAL, strings.Repeat(" %v", argCount(args))[1:], args...)
 	}
 	panic(args)
 }
@@ -46,10 +76,21 @@ func Crashf(format string, args ...interface{}) {
 	panic(fmt.Sprintf(format, args...))
 }
 
+// Logs a panic in the calling goroutine to the global logger, then panics
+// again; see Logger.CapturePanic.  Use as: defer CapturePanic()
+func CapturePanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	Global.logPanic(r)
+	panic(r)
+}
+
 // Compatibility with `log`
 func Exit(args ...interface{}) {
-	if len(args) > 0 {
-		Global.intLogf(ERROR, strings.Repeat(" %v", len(args))[1:], args...)
+	if argCount(args) > 0 {
+		Global.intLogf(ERROR, strings.Repeat(" %v", argCount(args))[1:], args...)
 	}
 	Global.Close() // so that hopefully the messages get logged
 	os.Exit(0)
@@ -64,8 +105,8 @@ func Exitf(format string, args ...interface{}) {
 
 // Compatibility with `log`
 func Stderr(args ...interface{}) {
-	if len(args) > 0 {
-		Global.intLogf(ERROR, strings.Repeat(" %v", len(args))[1:], args...)
+	if argCount(args) > 0 {
+		Global.intLogf(ERROR, strings.Repeat(" %v", argCount(args))[1:], args...)
 	}
 }
 
@@ -76,8 +117,8 @@ func Stderrf(format string, args ...interface{}) {
 
 // Compatibility with `log`
 func Stdout(args ...interface{}) {
-	if len(args) > 0 {
-		Global.intLogf(INFO, strings.Repeat(" %v", len(args))[1:], args...)
+	if argCount(args) > 0 {
+		Global.intLogf(INFO, strings.Repeat(" %v", argCount(args))[1:], args...)
 	}
 }
 
@@ -115,11 +156,11 @@ func Finest(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		Global.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		Global.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
@@ -134,11 +175,11 @@ func Fine(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		Global.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		Global.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
@@ -156,11 +197,11 @@ func Debug(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		Global.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		Global.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
@@ -175,11 +216,11 @@ func Trace(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		Global.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		Global.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
@@ -194,11 +235,11 @@ func Info(arg0 interface{}, args ...interface{}) {
 		// Use the string as a format string
 		Global.intLogf(lvl, first, args...)
 	case func() string:
-		// Log the closure (no other arguments used)
-		Global.intLogc(lvl, first)
+		// Log the closure (of the other arguments, only Fields used)
+		Global.intLogc(lvl, first, args...)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", len(args)), args...)
+		Global.intLogf(lvl, fmt.Sprint(arg0)+strings.Repeat(" %v", argCount(args)), args...)
 	}
 }
 
@@ -209,22 +250,23 @@ func Warn(arg0 interface{}, args ...interface{}) error {
 	const (
 		lvl = WARNING
 	)
+	args = computeArgs(args)
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
 		Global.intLogf(lvl, first, args...)
-		return errors.New(fmt.Sprintf(first, args...))
+		return errors.New(fmt.Sprintf(first, plainArgs(args)...))
 	case func() string:
-		// Log the closure (no other arguments used)
+		// Log the closure (of the other arguments, only Fields used)
 		str := first()
-		Global.intLogf(lvl, "%s", str)
+		_, fields := splitFields(args)
+		Global.intLogf(lvl, "%s", str, fields)
 		return errors.New(str)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
-		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
+		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", argCount(args)), args...)
+		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", argCount(args)), plainArgs(args)...))
 	}
-	return nil
 }
 
 // Utility for error log messages (returns an error for easy function returns) (see Debug() for parameter explanation)
@@ -234,22 +276,23 @@ func Error(arg0 interface{}, args ...interface{}) error {
 	const (
 		lvl = ERROR
 	)
+	args = computeArgs(args)
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
 		Global.intLogf(lvl, first, args...)
-		return errors.New(fmt.Sprintf(first, args...))
+		return errors.New(fmt.Sprintf(first, plainArgs(args)...))
 	case func() string:
-		// Log the closure (no other arguments used)
+		// Log the closure (of the other arguments, only Fields used)
 		str := first()
-		Global.intLogf(lvl, "%s", str)
+		_, fields := splitFields(args)
+		Global.intLogf(lvl, "%s", str, fields)
 		return errors.New(str)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
-		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
+		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", argCount(args)), args...)
+		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", argCount(args)), plainArgs(args)...))
 	}
-	return nil
 }
 
 // Utility for critical log messages (returns an error for easy function returns) (see Debug() for parameter explanation)
@@ -259,20 +302,21 @@ func Critical(arg0 interface{}, args ...interface{}) error {
 	const (
 		lvl = CRITICAL
 	)
+	args = computeArgs(args)
 	switch first := arg0.(type) {
 	case string:
 		// Use the string as a format string
 		Global.intLogf(lvl, first, args...)
-		return errors.New(fmt.Sprintf(first, args...))
+		return errors.New(fmt.Sprintf(first, plainArgs(args)...))
 	case func() string:
-		// Log the closure (no other arguments used)
+		// Log the closure (of the other arguments, only Fields used)
 		str := first()
-		Global.intLogf(lvl, "%s", str)
+		_, fields := splitFields(args)
+		Global.intLogf(lvl, "%s", str, fields)
 		return errors.New(str)
 	default:
 		// Build a format string so that it will be similar to Sprint
-		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", len(args)), args...)
-		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", len(args)), args...))
+		Global.intLogf(lvl, fmt.Sprint(first)+strings.Repeat(" %v", argCount(args)), args...)
+		return errors.New(fmt.Sprint(first) + fmt.Sprintf(strings.Repeat(" %v", argCount(args)), plainArgs(args)...))
 	}
-	return nil
 }
@@ -0,0 +1,42 @@
+package log4go
+
+import "sync"
+
+// A WriterFactory makes the writer of a filter of a configuration file, of the
+// type it is registered as, from the filter's properties, by name.  The
+// error it returns, for a property missing or wrong, is the filter's.
+type WriterFactory func(props map[string]string) (LogWriter, error)
+
+// The writer factories registered, by the type of filter
+var (
+	writerFactoriesLock sync.RWMutex
+	writerFactories     = make(map[string]WriterFactory)
+)
+
+// RegisterWriterFactory makes name a type of filter the configuration files
+// can give, of a writer of a package of its own, such as Kafka's, or of the
+// program's, made by factory:
+//
+//	log4go.RegisterWriterFactory("kafka", func(props map[string]string) (log4go.LogWriter, error) {
+//		if props["brokers"] == "" {
+//			return nil, errors.New(`required property "brokers" missing`)
+//		}
+//		return NewKafkaLogWriter(strings.Split(props["brokers"], ","), props["topic"]), nil
+//	})
+//
+// The types console, file, xml and socket are built in, and cannot be
+// registered.  The factory is called as the filter is loaded, not for one
+// disabled or as ValidateConfiguration checks the file.  It must be registered
+// before the configuration is loaded.
+func RegisterWriterFactory(name string, factory WriterFactory) {
+	writerFactoriesLock.Lock()
+	defer writerFactoriesLock.Unlock()
+	writerFactories[name] = factory
+}
+
+// The writer factory registered for the type of filter, if any
+func writerFactory(name string) WriterFactory {
+	writerFactoriesLock.RLock()
+	defer writerFactoriesLock.RUnlock()
+	return writerFactories[name]
+}
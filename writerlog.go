@@ -0,0 +1,99 @@
+package log4go
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// This log writer writes formatted records to any io.Writer: a pipe, a gzip
+// writer, a buffer in a test.  Unlike a FormatLogWriter, its Close waits for
+// the records to be written.
+type WriterLogWriter struct {
+	LogCloser
+	rec      chan *LogRecord
+	blocking bool // as WithBlocking sets
+
+	out       io.Writer
+	format    string
+	formatter Formatter // in place of format, if set
+}
+
+// This is the WriterLogWriter's output method.  This blocks while the output
+// buffer is full, or drops the record, given WithBlocking(false).
+func (w *WriterLogWriter) LogWrite(rec *LogRecord) {
+	if !sendRecord(w.rec, rec, w.blocking) {
+		releaseRecord(rec)
+	}
+}
+
+// Close waits for the records to be written and flushes the writer if it can
+// be flushed.  It does not close the writer; that is left to its owner, once
+// this has returned.
+func (w *WriterLogWriter) Close() {
+	w.WaitForEnd(w.rec)
+	close(w.rec)
+}
+
+// NewWriterLogWriter creates a new LogWriter which writes records to out,
+// formatted with FORMAT_DEFAULT until set otherwise.
+func NewWriterLogWriter(out io.Writer, opts ...Option) *WriterLogWriter {
+	o := newWriterOptions(opts)
+	w := &WriterLogWriter{
+		rec:      make(chan *LogRecord, o.bufferLength),
+		blocking: o.blocking,
+		out:      out,
+		format:   FORMAT_DEFAULT,
+	}
+
+	//init LogCloser
+	w.LogCloserInit()
+
+	go func() {
+		for rec := range w.rec {
+			if rec == nil {
+				w.flush()
+			}
+			if w.EndNotify(rec) {
+				return
+			}
+			var err error
+			if rec.Binary != nil {
+				_, err = w.out.Write(rec.Binary)
+			} else {
+				_, err = io.WriteString(w.out, formatRecord(w.format, w.formatter, rec))
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "WriterLogWriter: %s\n", err)
+			}
+			releaseRecord(rec)
+		}
+	}()
+
+	return w
+}
+
+// Flush the writer, if it can be flushed
+func (w *WriterLogWriter) flush() {
+	if f, ok := w.out.(interface {
+		Flush() error
+	}); ok {
+		if err := f.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "WriterLogWriter: %s\n", err)
+		}
+	}
+}
+
+// Set the logging format (chainable).  Must be called before the first log
+// message is written.
+func (w *WriterLogWriter) SetFormat(format string) *WriterLogWriter {
+	w.format, w.formatter = format, nil
+	return w
+}
+
+// Set the formatter of the records (chainable), in place of a format.  Must be
+// called before the first log message is written.
+func (w *WriterLogWriter) SetFormatter(formatter Formatter) *WriterLogWriter {
+	w.formatter = formatter
+	return w
+}